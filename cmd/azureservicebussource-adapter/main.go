@@ -17,11 +17,67 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
 	"knative.dev/eventing/pkg/adapter/v2"
 
 	"github.com/triggermesh/triggermesh/pkg/sources/adapter/azureservicebussource"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "peek":
+			peek(os.Args[2:])
+			return
+		case "replay":
+			replay(os.Args[2:])
+			return
+		}
+	}
+
 	adapter.Main("azureservicebussource", azureservicebussource.NewEnvConfig, azureservicebussource.NewAdapter)
 }
+
+// peek runs the "peek" diagnostic command, which prints the next messages of
+// the Service Bus entity without consuming them, then exits.
+//
+// Usage: azureservicebussource-adapter peek [-count N]
+func peek(args []string) {
+	fs := flag.NewFlagSet("peek", flag.ExitOnError)
+	count := fs.Int("count", 10, "number of messages to peek at")
+	_ = fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := azureservicebussource.Peek(ctx, *count, os.Stdout); err != nil {
+		stop()
+		fmt.Fprintln(os.Stderr, "Error peeking at messages:", err)
+		os.Exit(1)
+	}
+}
+
+// replay runs the "replay" command, which re-emits as CloudEvents the messages
+// with the given sequence numbers, then exits.
+//
+// Usage: azureservicebussource-adapter replay [-file PATH] [SEQUENCE_NUMBER...]
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := fs.String("file", "", "path of a file listing sequence numbers, separated by commas or whitespaces")
+	_ = fs.Parse(args)
+
+	ctor, err := azureservicebussource.ReplayAdapterConstructor(strings.Join(fs.Args(), ","), *file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading sequence numbers:", err)
+		os.Exit(1)
+	}
+
+	adapter.Main("azureservicebussource", azureservicebussource.NewEnvConfig, ctor)
+}
@@ -0,0 +1,567 @@
+/*
+Copyright 2022 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package azureservicebus contains helpers for adapters which interact with
+// Azure Service Bus entities.
+package azureservicebus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+const resourceProviderServiceBus = "Microsoft.ServiceBus"
+
+// Type of Service Bus namespaces, as found in resource IDs.
+const resourceTypeNamespaces = "namespaces"
+
+// Types of Service Bus resources.
+const (
+	ResourceTypeQueues        = "queues"
+	ResourceTypeTopics        = "topics"
+	ResourceTypeSubscriptions = "subscriptions"
+)
+
+// Names of environment variables used for SAS authentication.
+const (
+	EnvKeyName  = "SERVICEBUS_KEY_NAME"
+	EnvKeyValue = "SERVICEBUS_KEY_VALUE"
+	EnvConnStr  = "SERVICEBUS_CONNECTION_STRING"
+)
+
+// Names of environment variables which contain the path of files to read SAS
+// credentials from, as an alternative to passing them inline via the
+// environment variables above.
+const (
+	EnvKeyNameFile  = EnvKeyName + "_FILE"
+	EnvKeyValueFile = EnvKeyValue + "_FILE"
+	EnvConnStrFile  = EnvConnStr + "_FILE"
+)
+
+// Names of environment variables used for Azure AD authentication with a
+// client certificate. The certificate file is in PEM or PKCS#12 format, and
+// contains both the certificate and its private key. The tenant and client
+// IDs of the service principal are read from the same variables as for other
+// Azure AD authentication methods.
+const (
+	EnvCertificatePath     = "AZURE_CERTIFICATE_PATH"
+	EnvCertificatePassword = "AZURE_CERTIFICATE_PASSWORD"
+
+	envTenantID = "AZURE_TENANT_ID"
+	envClientID = "AZURE_CLIENT_ID"
+)
+
+// EnvAzureEnvironment is the name of the environment variable which selects
+// the Azure cloud hosting the Service Bus namespace (e.g. "AzurePublicCloud",
+// "AzureUSGovernmentCloud", "AzureChinaCloud").
+const EnvAzureEnvironment = "AZURE_ENVIRONMENT"
+
+// EnvEndpointOverride is the name of the environment variable which overrides
+// the endpoint of the Service Bus namespace, which is otherwise composed from
+// the namespace name and the endpoint suffix of the Azure cloud environment.
+// This allows targeting a Service Bus emulator or a custom endpoint. The value
+// is a host name, with an optional port, e.g. "sb://localhost:5672".
+const EnvEndpointOverride = "SERVICEBUS_ENDPOINT_OVERRIDE"
+
+// Methods of authentication to Service Bus.
+const (
+	AuthMethodSASKey           = "sas-key"
+	AuthMethodConnectionString = "connection-string"
+	AuthMethodAzureAD          = "azure-ad"
+)
+
+// ParseResourceID parses the given resource ID string to a structured
+// resource ID, and validates that this resource ID refers to a Service Bus
+// entity which messages can be received from.
+func ParseResourceID(resIDStr string) (*v1alpha1.AzureResourceID, error) {
+	resID, err := parseServiceBusResourceID(resIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Must match one of the following patterns:
+	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/queues/{queueName}
+	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/topics/{topicName}/subscriptions/{subsName}
+	if resID.ResourceType == ResourceTypeQueues && resID.SubResourceType != "" ||
+		resID.ResourceType == ResourceTypeTopics && resID.SubResourceType != ResourceTypeSubscriptions {
+
+		return nil, errors.New("resource ID does not refer to a Service Bus queue or topic subscription")
+	}
+
+	return resID, nil
+}
+
+// ParseTargetResourceID parses the given resource ID string to a structured
+// resource ID, and validates that this resource ID refers to a Service Bus
+// entity which messages can be sent to.
+func ParseTargetResourceID(resIDStr string) (*v1alpha1.AzureResourceID, error) {
+	resID, err := parseServiceBusResourceID(resIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Must match one of the following patterns:
+	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/queues/{queueName}
+	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/topics/{topicName}
+	//
+	// Topic subscription IDs are tolerated for backwards compatibility,
+	// messages are sent to the parent topic.
+	if resID.ResourceType == ResourceTypeQueues && resID.SubResourceType != "" ||
+		resID.ResourceType == ResourceTypeTopics && resID.SubResourceType != "" &&
+			resID.SubResourceType != ResourceTypeSubscriptions {
+
+		return nil, errors.New("resource ID does not refer to a Service Bus queue or topic")
+	}
+
+	return resID, nil
+}
+
+// ParseNamespaceResourceID parses the given resource ID string to a structured
+// resource ID, and validates that this resource ID refers to a Service Bus
+// namespace.
+//
+// For consistency with the resource IDs of entities, the name of the namespace
+// is set as the Namespace attribute of the returned resource ID, and its
+// resource type and name are left empty.
+func ParseNamespaceResourceID(resIDStr string) (*v1alpha1.AzureResourceID, error) {
+	resID := &v1alpha1.AzureResourceID{}
+
+	err := json.Unmarshal([]byte(strconv.Quote(resIDStr)), resID)
+	if err != nil {
+		return nil, fmt.Errorf("deserializing resource ID string: %w", err)
+	}
+
+	// Must match the following pattern:
+	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}
+	if resID.ResourceProvider != resourceProviderServiceBus ||
+		resID.ResourceType != resourceTypeNamespaces ||
+		resID.Namespace != "" || resID.SubResourceType != "" {
+
+		return nil, errors.New("resource ID does not refer to a Service Bus namespace")
+	}
+
+	resID.Namespace = resID.ResourceName
+	resID.ResourceType = ""
+	resID.ResourceName = ""
+
+	return resID, nil
+}
+
+// parseServiceBusResourceID parses the given resource ID string to a
+// structured resource ID, and validates that this resource ID refers to a
+// Service Bus queue or topic, or to one of their sub-resources.
+func parseServiceBusResourceID(resIDStr string) (*v1alpha1.AzureResourceID, error) {
+	resID := &v1alpha1.AzureResourceID{}
+
+	err := json.Unmarshal([]byte(strconv.Quote(resIDStr)), resID)
+	if err != nil {
+		return nil, fmt.Errorf("deserializing resource ID string: %w", err)
+	}
+
+	if resID.ResourceProvider != resourceProviderServiceBus ||
+		resID.Namespace == "" ||
+		resID.ResourceType != ResourceTypeQueues && resID.ResourceType != ResourceTypeTopics {
+
+		return nil, errors.New("resource ID does not refer to a Service Bus entity")
+	}
+
+	return resID, nil
+}
+
+// EntityPath returns the entity path of the given Service Bus entity.
+func EntityPath(entityID *v1alpha1.AzureResourceID) string {
+	switch entityID.ResourceType {
+	case ResourceTypeQueues:
+		queueName := entityID.ResourceName
+		return queueName
+	case ResourceTypeTopics:
+		topicName := entityID.ResourceName
+		subsName := entityID.SubResourceName
+		if subsName == "" {
+			return topicName
+		}
+		return topicName + "/Subscriptions/" + subsName
+	default:
+		return ""
+	}
+}
+
+// ParseConnectionStringEntity returns the ID of the Service Bus entity
+// referenced by the EntityPath of the given connection string, together with
+// the URL of this entity (e.g. "sb://ns.servicebus.windows.net/myqueue").
+//
+// Connection strings don't convey the Azure subscription and resource group of
+// the namespace, so only the namespace and entity attributes of the returned
+// resource ID are set.
+func ParseConnectionStringEntity(connStr string) (*v1alpha1.AzureResourceID, string, error) {
+	var endpoint, entityPath string
+	for _, kv := range strings.Split(connStr, ";") {
+		k, v, _ := strings.Cut(kv, "=")
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "endpoint":
+			endpoint = strings.TrimSpace(v)
+		case "entitypath":
+			entityPath = strings.TrimSpace(v)
+		}
+	}
+
+	// Connection strings are secrets, errors must not include them.
+	if endpoint == "" {
+		return nil, "", errors.New("connection string does not contain an Endpoint")
+	}
+	if entityPath == "" {
+		return nil, "", errors.New("connection string does not contain an EntityPath")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return nil, "", errors.New("connection string does not contain a valid Endpoint")
+	}
+	namespace, _, _ := strings.Cut(u.Hostname(), ".")
+
+	entityID := &v1alpha1.AzureResourceID{
+		ResourceProvider: resourceProviderServiceBus,
+		Namespace:        namespace,
+	}
+
+	// Must match one of the following patterns:
+	//  - {queueName}
+	//  - {topicName}/Subscriptions/{subsName}
+	switch segments := strings.Split(entityPath, "/"); {
+	case len(segments) == 1:
+		entityID.ResourceType = ResourceTypeQueues
+		entityID.ResourceName = segments[0]
+	case len(segments) == 3 && strings.EqualFold(segments[1], ResourceTypeSubscriptions) &&
+		segments[0] != "" && segments[2] != "":
+
+		entityID.ResourceType = ResourceTypeTopics
+		entityID.ResourceName = segments[0]
+		entityID.SubResourceType = ResourceTypeSubscriptions
+		entityID.SubResourceName = segments[2]
+	default:
+		return nil, "", fmt.Errorf("EntityPath %q does not refer to a Service Bus queue or topic subscription", entityPath)
+	}
+
+	entityURL := (&url.URL{
+		Scheme: "sb",
+		Host:   u.Host,
+		Path:   "/" + entityPath,
+	}).String()
+
+	return entityID, entityURL, nil
+}
+
+// DeadLetterQueuePath returns the path of the dead-letter sub-queue of the
+// Service Bus entity at the given path.
+func DeadLetterQueuePath(entityPath string) string {
+	return entityPath + "/$DeadLetterQueue"
+}
+
+// TransferDeadLetterQueuePath returns the path of the transfer dead-letter
+// sub-queue of the Service Bus entity at the given path.
+func TransferDeadLetterQueuePath(entityPath string) string {
+	return entityPath + "/$Transfer/$DeadLetterQueue"
+}
+
+// ClientFromEnvironment mimics the behaviour of eventhub.NewHubFromEnvironment.
+// It returns a azservicebus.Client that is suitable for the
+// authentication method selected via environment variables.
+func ClientFromEnvironment(entityID *v1alpha1.AzureResourceID, clientOptions *azservicebus.ClientOptions) (*azservicebus.Client, error) {
+	azureEnv, err := AzureEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	// SAS authentication (token, connection string)
+	connStr, err := ConnectionStringFromEnvironment(azureEnv, entityID.Namespace, EntityPath(entityID))
+	if err != nil {
+		return nil, err
+	}
+	if connStr != "" {
+		client, err := azservicebus.NewClientFromConnectionString(connStr, clientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("creating client from connection string: %w", err)
+		}
+		return client, nil
+	}
+
+	// AAD authentication (service principal)
+	cred, err := credentialFromEnvironment(azureEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	fqNamespace, err := NamespaceEndpoint(azureEnv, entityID.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	client, err := azservicebus.NewClient(fqNamespace, cred, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("creating client from service principal: %w", err)
+	}
+	return client, nil
+}
+
+// AdminClientFromEnvironment returns a admin.Client for managing the Service
+// Bus namespace of the given entity, using the authentication method selected
+// via environment variables.
+//
+// Unlike the receiving and sending of messages, management operations require
+// the "Manage" access right when SAS authentication is used.
+func AdminClientFromEnvironment(entityID *v1alpha1.AzureResourceID, clientOptions *admin.ClientOptions) (*admin.Client, error) {
+	azureEnv, err := AzureEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	// SAS authentication (token, connection string)
+	connStr, err := ConnectionStringFromEnvironment(azureEnv, entityID.Namespace, EntityPath(entityID))
+	if err != nil {
+		return nil, err
+	}
+	if connStr != "" {
+		client, err := admin.NewClientFromConnectionString(connStr, clientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("creating admin client from connection string: %w", err)
+		}
+		return client, nil
+	}
+
+	// AAD authentication (service principal)
+	cred, err := credentialFromEnvironment(azureEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	fqNamespace, err := NamespaceEndpoint(azureEnv, entityID.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	client, err := admin.NewClient(fqNamespace, cred, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("creating admin client from service principal: %w", err)
+	}
+	return client, nil
+}
+
+// credentialFromEnvironment returns Azure AD credentials for the given Azure
+// cloud environment, read from environment variables.
+//
+// When a client certificate is configured, it is attempted first, before the
+// default chain of credentials (service principal secret, workload identity,
+// managed identity, ...). If all credentials fail to authenticate, the
+// returned error describes each failure.
+func credentialFromEnvironment(azureEnv *azure.Environment) (azcore.TokenCredential, error) {
+	clientOpts := azcore.ClientOptions{
+		Cloud: cloud.Configuration{
+			ActiveDirectoryAuthorityHost: azureEnv.ActiveDirectoryEndpoint,
+		},
+	}
+
+	defaultCred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+		ClientOptions: clientOpts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Azure credentials: %w", err)
+	}
+
+	certCred, err := certificateCredentialFromEnvironment(clientOpts)
+	if err != nil {
+		return nil, err
+	}
+	if certCred == nil {
+		return defaultCred, nil
+	}
+
+	cred, err := azidentity.NewChainedTokenCredential([]azcore.TokenCredential{certCred, defaultCred}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Azure credentials: %w", err)
+	}
+	return cred, nil
+}
+
+// certificateCredentialFromEnvironment returns Azure AD credentials based on
+// the client certificate referenced by environment variables. It returns nil
+// if no certificate is configured.
+func certificateCredentialFromEnvironment(clientOpts azcore.ClientOptions) (azcore.TokenCredential, error) {
+	certPath := os.Getenv(EnvCertificatePath)
+	if certPath == "" {
+		return nil, nil
+	}
+
+	tenantID, clientID := os.Getenv(envTenantID), os.Getenv(envClientID)
+	if tenantID == "" || clientID == "" {
+		return nil, fmt.Errorf("authenticating with a client certificate requires both %s and %s to be set",
+			envTenantID, envClientID)
+	}
+
+	certData, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading client certificate: %w", err)
+	}
+
+	var password []byte
+	if p := os.Getenv(EnvCertificatePassword); p != "" {
+		password = []byte(p)
+	}
+
+	certs, key, err := azidentity.ParseCertificates(certData, password)
+	if err != nil {
+		return nil, fmt.Errorf("parsing client certificate: %w", err)
+	}
+
+	cred, err := azidentity.NewClientCertificateCredential(tenantID, clientID, certs, key,
+		&azidentity.ClientCertificateCredentialOptions{ClientOptions: clientOpts})
+	if err != nil {
+		return nil, fmt.Errorf("creating client certificate credentials: %w", err)
+	}
+	return cred, nil
+}
+
+// AuthMethodFromEnvironment returns the method of authentication selected via
+// environment variables, following the same precedence as
+// ClientFromEnvironment. Only the presence of variables is checked, their
+// values are never read.
+func AuthMethodFromEnvironment() string {
+	isSet := func(envKey, fileEnvKey string) bool {
+		return os.Getenv(envKey) != "" || os.Getenv(fileEnvKey) != ""
+	}
+
+	switch {
+	case isSet(EnvKeyName, EnvKeyNameFile) && isSet(EnvKeyValue, EnvKeyValueFile):
+		return AuthMethodSASKey
+	case isSet(EnvConnStr, EnvConnStrFile):
+		return AuthMethodConnectionString
+	default:
+		return AuthMethodAzureAD
+	}
+}
+
+// ConnectionStringFromEnvironment returns a Service Bus connection string
+// based on values read from the environment.
+//
+// Each value is read from its inline environment variable (e.g.
+// SERVICEBUS_CONNECTION_STRING) or, when this variable is empty, from the file
+// referenced by the variable of the same name suffixed with "_FILE" (e.g.
+// SERVICEBUS_CONNECTION_STRING_FILE).
+//
+// A connection string provided as is takes its endpoint from its own
+// "Endpoint" key, whereas a connection string composed from a SAS key uses the
+// endpoint returned by NamespaceEndpoint.
+func ConnectionStringFromEnvironment(azureEnv *azure.Environment, namespace, entityPath string) (string, error) {
+	connStr, err := valueFromEnvironment(EnvConnStr, EnvConnStrFile)
+	if err != nil {
+		return "", err
+	}
+	keyName, err := valueFromEnvironment(EnvKeyName, EnvKeyNameFile)
+	if err != nil {
+		return "", err
+	}
+	keyValue, err := valueFromEnvironment(EnvKeyValue, EnvKeyValueFile)
+	if err != nil {
+		return "", err
+	}
+
+	// if a key is set explicitly, it takes precedence and is used to
+	// compose a new connection string
+	if keyName != "" && keyValue != "" {
+		endpoint, err := NamespaceEndpoint(azureEnv, namespace)
+		if err != nil {
+			return "", err
+		}
+		connStr = fmt.Sprintf("Endpoint=sb://%s;SharedAccessKeyName=%s;SharedAccessKey=%s;EntityPath=%s",
+			endpoint, keyName, keyValue, entityPath)
+	}
+
+	return connStr, nil
+}
+
+// NamespaceEndpoint returns the fully qualified host name of the given Service
+// Bus namespace in the given Azure cloud environment, unless an endpoint was
+// set explicitly via the environment, in which case this endpoint is returned
+// instead.
+func NamespaceEndpoint(azureEnv *azure.Environment, namespace string) (string, error) {
+	override := os.Getenv(EnvEndpointOverride)
+	if override == "" {
+		return namespace + "." + azureEnv.ServiceBusEndpointSuffix, nil
+	}
+
+	if !strings.Contains(override, "://") {
+		override = "sb://" + override
+	}
+
+	u, err := url.Parse(override)
+	if err != nil {
+		return "", fmt.Errorf("parsing value of %s: %w", EnvEndpointOverride, err)
+	}
+	if u.Scheme != "sb" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+		return "", fmt.Errorf("value of %s is not a valid Service Bus endpoint: %q",
+			EnvEndpointOverride, os.Getenv(EnvEndpointOverride))
+	}
+
+	return u.Host, nil
+}
+
+// valueFromEnvironment returns the value of the environment variable envKey
+// or, if this variable is empty, the content of the file referenced by the
+// environment variable fileEnvKey. Trailing whitespace, such as the newline
+// often found at the end of mounted secrets, is trimmed from file contents.
+func valueFromEnvironment(envKey, fileEnvKey string) (string, error) {
+	if v := os.Getenv(envKey); v != "" {
+		return v, nil
+	}
+
+	path := os.Getenv(fileEnvKey)
+	if path == "" {
+		return "", nil
+	}
+
+	v, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading value of %s from file: %w", envKey, err)
+	}
+	return strings.TrimRightFunc(string(v), unicode.IsSpace), nil
+}
+
+// AzureEnvironment returns the Azure cloud environment selected via the
+// environment. It defaults to the Azure public cloud.
+func AzureEnvironment() (*azure.Environment, error) {
+	name := os.Getenv(EnvAzureEnvironment)
+	if name == "" {
+		return &azure.PublicCloud, nil
+	}
+
+	env, err := azure.EnvironmentFromName(name)
+	if err != nil {
+		return nil, fmt.Errorf("resolving Azure environment %q: %w", name, err)
+	}
+	return &env, nil
+}
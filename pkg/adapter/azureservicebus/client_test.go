@@ -0,0 +1,608 @@
+/*
+Copyright 2022 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebus
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+func TestParseResourceID(t *testing.T) {
+	const resourceIDPrefix = "/subscriptions/s/resourceGroups/rg/providers"
+
+	testCases := []struct {
+		name         string
+		input        string
+		expectErr    bool
+		expectNs     string
+		expectRes    string
+		expectSubRes string
+	}{
+		{
+			name:         "Valid Queue ID",
+			input:        resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/queues/q",
+			expectErr:    false,
+			expectNs:     "ns",
+			expectRes:    "q",
+			expectSubRes: "",
+		},
+		{
+			name:         "Valid Topic subscription ID",
+			input:        resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t/subscriptions/s",
+			expectErr:    false,
+			expectNs:     "ns",
+			expectRes:    "t",
+			expectSubRes: "s",
+		},
+		{
+			name:      "Malformed resource ID",
+			input:     "not-a-resource-id",
+			expectErr: true,
+		},
+		{
+			name:      "Not the Service Bus provider",
+			input:     resourceIDPrefix + "/Microsoft.EventHubs/namespaces/ns/queues/q",
+			expectErr: true,
+		},
+		{
+			name:      "Not a supported Service Bus entity",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/notsupported/x",
+			expectErr: true,
+		},
+		{
+			name:      "Queue ID with a sub-resource",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/queues/q/subscription/s",
+			expectErr: true,
+		},
+		{
+			name:      "Topic ID without sub-resource",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t",
+			expectErr: true,
+		},
+		{
+			name:      "Topic ID with a sub-resource that is not a subscription",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t/notsupported/x",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := ParseResourceID(tc.input)
+
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Nil(t, out)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.NotNil(t, out)
+
+			assert.Equal(t, tc.expectNs, out.Namespace, "Unexpected resource namespace")
+			assert.Equal(t, tc.expectRes, out.ResourceName, "Unexpected resource name")
+			assert.Equal(t, tc.expectSubRes, out.SubResourceName, "Unexpected sub-resource name")
+		})
+	}
+}
+
+func TestParseNamespaceResourceID(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expect    *v1alpha1.AzureResourceID
+		expectErr bool
+	}{
+		{
+			name:  "Namespace",
+			input: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns",
+			expect: &v1alpha1.AzureResourceID{
+				SubscriptionID:   "s",
+				ResourceGroup:    "rg",
+				ResourceProvider: "Microsoft.ServiceBus",
+				Namespace:        "ns",
+			},
+		},
+		{
+			name:      "Queue",
+			input:     "/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q",
+			expectErr: true,
+		},
+		{
+			name:      "Other provider",
+			input:     "/subscriptions/s/resourceGroups/rg/providers/Microsoft.EventHub/namespaces/ns",
+			expectErr: true,
+		},
+		{
+			name:      "Resource group",
+			input:     "/subscriptions/s/resourceGroups/rg",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resID, err := ParseNamespaceResourceID(tc.input)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, resID)
+		})
+	}
+}
+
+func TestParseTargetResourceID(t *testing.T) {
+	const resourceIDPrefix = "/subscriptions/s/resourceGroups/rg/providers"
+
+	testCases := []struct {
+		name      string
+		input     string
+		expectErr bool
+		expectRes string
+	}{
+		{
+			name:      "Valid Queue ID",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/queues/q",
+			expectRes: "q",
+		},
+		{
+			name:      "Valid Topic ID",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t",
+			expectRes: "t",
+		},
+		{
+			name:      "Valid Topic subscription ID",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t/subscriptions/s",
+			expectRes: "t",
+		},
+		{
+			name:      "Malformed resource ID",
+			input:     "not-a-resource-id",
+			expectErr: true,
+		},
+		{
+			name:      "Not the Service Bus provider",
+			input:     resourceIDPrefix + "/Microsoft.EventHubs/namespaces/ns/topics/t",
+			expectErr: true,
+		},
+		{
+			name:      "Not a supported Service Bus entity",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/notsupported/x",
+			expectErr: true,
+		},
+		{
+			name:      "Queue ID with a sub-resource",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/queues/q/subscriptions/s",
+			expectErr: true,
+		},
+		{
+			name:      "Topic ID with a sub-resource that is not a subscription",
+			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t/notsupported/x",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := ParseTargetResourceID(tc.input)
+
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Nil(t, out)
+				return
+			}
+
+			assert.NoError(t, err)
+			require.NotNil(t, out)
+
+			assert.Equal(t, "ns", out.Namespace, "Unexpected resource namespace")
+			assert.Equal(t, tc.expectRes, out.ResourceName, "Unexpected resource name")
+		})
+	}
+}
+
+func TestEntityPath(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  *v1alpha1.AzureResourceID
+		expect string
+	}{
+		{
+			name: "Queue",
+			input: &v1alpha1.AzureResourceID{
+				ResourceType: ResourceTypeQueues,
+				ResourceName: "q",
+			},
+			expect: "q",
+		},
+		{
+			name: "Topic subscription",
+			input: &v1alpha1.AzureResourceID{
+				ResourceType:    ResourceTypeTopics,
+				ResourceName:    "t",
+				SubResourceType: ResourceTypeSubscriptions,
+				SubResourceName: "s",
+			},
+			expect: "t/Subscriptions/s",
+		},
+		{
+			name: "Topic",
+			input: &v1alpha1.AzureResourceID{
+				ResourceType: ResourceTypeTopics,
+				ResourceName: "t",
+			},
+			expect: "t",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, EntityPath(tc.input))
+		})
+	}
+}
+
+func TestDeadLetterQueuePath(t *testing.T) {
+	assert.Equal(t, "q/$DeadLetterQueue", DeadLetterQueuePath("q"))
+	assert.Equal(t, "t/Subscriptions/s/$DeadLetterQueue", DeadLetterQueuePath("t/Subscriptions/s"))
+}
+
+func TestTransferDeadLetterQueuePath(t *testing.T) {
+	assert.Equal(t, "q/$Transfer/$DeadLetterQueue", TransferDeadLetterQueuePath("q"))
+	assert.Equal(t, "t/Subscriptions/s/$Transfer/$DeadLetterQueue", TransferDeadLetterQueuePath("t/Subscriptions/s"))
+}
+
+func TestParseConnectionStringEntity(t *testing.T) {
+	testCases := []struct {
+		name      string
+		connStr   string
+		expectID  *v1alpha1.AzureResourceID
+		expectURL string
+		expectErr bool
+	}{
+		{
+			name:    "Queue",
+			connStr: "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q",
+			expectID: &v1alpha1.AzureResourceID{
+				ResourceProvider: "Microsoft.ServiceBus",
+				Namespace:        "ns",
+				ResourceType:     "queues",
+				ResourceName:     "q",
+			},
+			expectURL: "sb://ns.servicebus.windows.net/q",
+		},
+		{
+			name:    "Topic subscription",
+			connStr: "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=t/Subscriptions/s",
+			expectID: &v1alpha1.AzureResourceID{
+				ResourceProvider: "Microsoft.ServiceBus",
+				Namespace:        "ns",
+				ResourceType:     "topics",
+				ResourceName:     "t",
+				SubResourceType:  "subscriptions",
+				SubResourceName:  "s",
+			},
+			expectURL: "sb://ns.servicebus.windows.net/t/Subscriptions/s",
+		},
+		{
+			name:      "Topic without subscription",
+			connStr:   "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=t/s",
+			expectErr: true,
+		},
+		{
+			name:      "Missing EntityPath",
+			connStr:   "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=kn;SharedAccessKey=kv",
+			expectErr: true,
+		},
+		{
+			name:      "Missing Endpoint",
+			connStr:   "SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entityID, entityURL, err := ParseConnectionStringEntity(tc.connStr)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.NotContains(t, err.Error(), "kv", "Errors must not leak secrets")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectID, entityID)
+			assert.Equal(t, tc.expectURL, entityURL)
+		})
+	}
+}
+
+func TestConnectionStringFromEnvironment(t *testing.T) {
+	testCases := []struct {
+		name      string
+		azureEnv  string
+		expectErr bool
+		expect    string
+	}{
+		{
+			name:   "Default environment",
+			expect: "Endpoint=sb://ns.servicebus.windows.net;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q",
+		},
+		{
+			name:     "Azure US Government",
+			azureEnv: "AzureUSGovernmentCloud",
+			expect:   "Endpoint=sb://ns.servicebus.usgovcloudapi.net;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q",
+		},
+		{
+			name:     "Azure China",
+			azureEnv: "AzureChinaCloud",
+			expect:   "Endpoint=sb://ns.servicebus.chinacloudapi.cn;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q",
+		},
+		{
+			name:      "Unknown environment",
+			azureEnv:  "NotACloud",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvKeyName, "kn")
+			t.Setenv(EnvKeyValue, "kv")
+			t.Setenv(EnvAzureEnvironment, tc.azureEnv)
+
+			azureEnv, err := AzureEnvironment()
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			connStr, err := ConnectionStringFromEnvironment(azureEnv, "ns", "q")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, connStr)
+		})
+	}
+}
+
+func TestNamespaceEndpoint(t *testing.T) {
+	testCases := []struct {
+		name      string
+		override  string
+		expectErr bool
+		expect    string
+	}{
+		{
+			name:   "No override",
+			expect: "ns.servicebus.windows.net",
+		},
+		{
+			name:     "Host and port",
+			override: "localhost:5672",
+			expect:   "localhost:5672",
+		},
+		{
+			name:     "URL with scheme",
+			override: "sb://emulator.local/",
+			expect:   "emulator.local",
+		},
+		{
+			name:      "Unsupported scheme",
+			override:  "https://emulator.local",
+			expectErr: true,
+		},
+		{
+			name:      "URL with path",
+			override:  "sb://emulator.local/q",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvEndpointOverride, tc.override)
+
+			endpoint, err := NamespaceEndpoint(&azure.PublicCloud, "ns")
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, endpoint)
+		})
+	}
+
+	t.Run("Connection string composed from SAS key", func(t *testing.T) {
+		t.Setenv(EnvEndpointOverride, "localhost:5672")
+		t.Setenv(EnvKeyName, "kn")
+		t.Setenv(EnvKeyValue, "kv")
+
+		connStr, err := ConnectionStringFromEnvironment(&azure.PublicCloud, "ns", "q")
+		require.NoError(t, err)
+		assert.Equal(t, "Endpoint=sb://localhost:5672;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q", connStr)
+	})
+}
+
+func TestConnectionStringFromFiles(t *testing.T) {
+	azureEnv := &azure.PublicCloud
+
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "secret")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("connection string read from file", func(t *testing.T) {
+		t.Setenv(EnvConnStrFile, writeFile(t, "Endpoint=sb://ns.servicebus.windows.net;EntityPath=q\n"))
+
+		connStr, err := ConnectionStringFromEnvironment(azureEnv, "ns", "q")
+		require.NoError(t, err)
+		assert.Equal(t, "Endpoint=sb://ns.servicebus.windows.net;EntityPath=q", connStr)
+	})
+
+	t.Run("inline value takes precedence over file", func(t *testing.T) {
+		t.Setenv(EnvKeyName, "kn")
+		t.Setenv(EnvKeyNameFile, writeFile(t, "file-kn"))
+		t.Setenv(EnvKeyValueFile, writeFile(t, "kv \n"))
+
+		connStr, err := ConnectionStringFromEnvironment(azureEnv, "ns", "q")
+		require.NoError(t, err)
+		assert.Equal(t, "Endpoint=sb://ns.servicebus.windows.net;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q", connStr)
+	})
+
+	t.Run("file does not exist", func(t *testing.T) {
+		t.Setenv(EnvConnStrFile, filepath.Join(t.TempDir(), "missing"))
+
+		_, err := ConnectionStringFromEnvironment(azureEnv, "ns", "q")
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthMethodFromEnvironment(t *testing.T) {
+	testCases := []struct {
+		name   string
+		env    map[string]string
+		expect string
+	}{
+		{
+			name:   "No SAS credentials",
+			expect: AuthMethodAzureAD,
+		},
+		{
+			name: "Connection string",
+			env: map[string]string{
+				EnvConnStr: "Endpoint=sb://ns.servicebus.windows.net",
+			},
+			expect: AuthMethodConnectionString,
+		},
+		{
+			name: "Key takes precedence over connection string",
+			env: map[string]string{
+				EnvKeyName:      "kn",
+				EnvKeyValueFile: "/path/to/kv",
+				EnvConnStr:      "Endpoint=sb://ns.servicebus.windows.net",
+			},
+			expect: AuthMethodSASKey,
+		},
+		{
+			name: "Incomplete key",
+			env: map[string]string{
+				EnvKeyName: "kn",
+			},
+			expect: AuthMethodAzureAD,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			assert.Equal(t, tc.expect, AuthMethodFromEnvironment())
+		})
+	}
+}
+
+func TestCredentialFromEnvironment(t *testing.T) {
+	azureEnv := &azure.PublicCloud
+
+	t.Run("no client certificate", func(t *testing.T) {
+		t.Setenv(EnvCertificatePath, "")
+
+		cred, err := credentialFromEnvironment(azureEnv)
+		require.NoError(t, err)
+		assert.IsType(t, (*azidentity.DefaultAzureCredential)(nil), cred)
+	})
+
+	t.Run("client certificate precedes the default credentials", func(t *testing.T) {
+		t.Setenv(EnvCertificatePath, writeTestCertificate(t))
+		t.Setenv(envTenantID, "00000000-0000-0000-0000-000000000000")
+		t.Setenv(envClientID, "00000000-0000-0000-0000-000000000000")
+
+		cred, err := credentialFromEnvironment(azureEnv)
+		require.NoError(t, err)
+		assert.IsType(t, (*azidentity.ChainedTokenCredential)(nil), cred)
+	})
+
+	t.Run("client certificate without client ID", func(t *testing.T) {
+		t.Setenv(EnvCertificatePath, writeTestCertificate(t))
+		t.Setenv(envTenantID, "00000000-0000-0000-0000-000000000000")
+		t.Setenv(envClientID, "")
+
+		_, err := credentialFromEnvironment(azureEnv)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid client certificate", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cert.pem")
+		require.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0o600))
+
+		t.Setenv(EnvCertificatePath, path)
+		t.Setenv(envTenantID, "00000000-0000-0000-0000-000000000000")
+		t.Setenv(envClientID, "00000000-0000-0000-0000-000000000000")
+
+		_, err := credentialFromEnvironment(azureEnv)
+		assert.Error(t, err)
+	})
+}
+
+// writeTestCertificate writes a self-signed certificate and its private key
+// to a PEM file, and returns the path of that file.
+func writeTestCertificate(t *testing.T) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
+	require.NoError(t, pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	return path
+}
@@ -70,6 +70,9 @@ func (s *AzureServiceBusSource) AsEventSource() string {
 func (*AzureServiceBusSource) GetEventTypes() []string {
 	return []string{
 		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusGenericEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusDrainedEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusHeartbeatEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusBatchSummaryEventType),
 	}
 }
 
@@ -31,12 +31,30 @@ import (
 // Supported event types
 const (
 	AzureServiceBusGenericEventType = "message"
+	// Emitted, when enabled in the adapter, once the backlog of a Service
+	// Bus entity has been drained.
+	AzureServiceBusDrainedEventType = "drained"
+	// Emitted, when enabled in the adapter, each time no message was
+	// received from a Service Bus entity for a given interval.
+	AzureServiceBusHeartbeatEventType = "heartbeat"
+	// Emitted, when enabled in the adapter, once for each batch of
+	// messages received from a Service Bus entity.
+	AzureServiceBusBatchSummaryEventType = "batchsummary"
+	// Sent to the dead-letter sink of the adapter, when configured, for
+	// each message which couldn't be handled.
+	AzureServiceBusErrorEventType = "error"
+	// Sent to the error sink of the adapter, when configured, for each
+	// message which couldn't be converted to CloudEvents.
+	AzureServiceBusConversionErrorEventType = "conversionerror"
 )
 
 // GetEventTypes returns the event types generated by the source.
 func (s *AzureServiceBusQueueSource) GetEventTypes() []string {
 	return []string{
 		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusGenericEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusDrainedEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusHeartbeatEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusBatchSummaryEventType),
 	}
 }
 
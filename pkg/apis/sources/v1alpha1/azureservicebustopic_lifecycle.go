@@ -65,6 +65,9 @@ func (s *AzureServiceBusTopicSource) AsEventSource() string {
 func (*AzureServiceBusTopicSource) GetEventTypes() []string {
 	return []string{
 		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusGenericEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusDrainedEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusHeartbeatEventType),
+		AzureEventType(sources.AzureServiceServiceBus, AzureServiceBusBatchSummaryEventType),
 	}
 }
 
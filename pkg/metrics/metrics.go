@@ -37,11 +37,20 @@ const (
 	metricNameEventProcessingSuccessCount = "event_processing_success_count"
 	metricNameEventProcessingErrorCount   = "event_processing_error_count"
 	metricNameEventProcessingLatencies    = "event_processing_latencies"
+	metricNameEventDeliveryLag            = "event_delivery_lag"
+	metricNameNilMessageCount             = "nil_message_count"
+	metricNameProcessorPanicCount         = "processor_panic_count"
+	metricNameLockRenewalCount            = "lock_renewal_count"
+	metricNameMessageTimeoutCount         = "message_timeout_count"
+	metricNameEventLossCount              = "event_loss_count"
 
 	// Conveys whether the delivery of the error returned as the result of
 	// a failed event processing is user-managed, as opposed to managed by
 	// Knative (retries, dead-letter queue).
 	labelUserManagedErr = "user_managed"
+
+	// Conveys whether the lock on a message was successfully renewed.
+	labelRenewalResult = "result"
 )
 
 var (
@@ -51,6 +60,7 @@ var (
 	tagKeyEventType      = tag.MustNewKey(eventingmetrics.LabelEventType)
 	tagKeyEventSource    = tag.MustNewKey(eventingmetrics.LabelEventSource)
 	tagKeyUserManagedErr = tag.MustNewKey(labelUserManagedErr)
+	tagKeyRenewalResult  = tag.MustNewKey(labelRenewalResult)
 )
 
 // eventProcessingSuccessCountM is a measure of the number of events that were
@@ -77,6 +87,60 @@ var eventProcessingLatenciesM = stats.Int64(
 	stats.UnitMilliseconds,
 )
 
+// eventDeliveryLagM is a measure of the time elapsed between the enqueuing of
+// a message in an external system and its delivery to a component.
+var eventDeliveryLagM = stats.Int64(
+	metricNameEventDeliveryLag,
+	"Time elapsed between the enqueuing of messages and their delivery",
+	stats.UnitMilliseconds,
+)
+
+// nilMessageCountM is a measure of the number of empty (nil) messages handed
+// to a component by the client library of an external system.
+var nilMessageCountM = stats.Int64(
+	metricNameNilMessageCount,
+	"Number of nil messages received from the client library of the external system",
+	stats.UnitDimensionless,
+)
+
+// processorPanicCountM is a measure of the number of panics recovered from
+// while a component was processing a message.
+var processorPanicCountM = stats.Int64(
+	metricNameProcessorPanicCount,
+	"Number of panics recovered from while processing messages",
+	stats.UnitDimensionless,
+)
+
+// lockRenewalCountM is a measure of the number of attempts to renew the lock
+// held by a component on a message consumed from an external system.
+var lockRenewalCountM = stats.Int64(
+	metricNameLockRenewalCount,
+	"Number of attempts to renew the lock on messages, by result",
+	stats.UnitDimensionless,
+)
+
+// messageTimeoutCountM is a measure of the number of messages which a
+// component gave up handling because the handling exceeded its time limit.
+var messageTimeoutCountM = stats.Int64(
+	metricNameMessageTimeoutCount,
+	"Number of messages the handling of which exceeded the maximum duration",
+	stats.UnitDimensionless,
+)
+
+// eventLossCountM is a measure of the number of events which a component
+// failed to deliver after acknowledging their source, and therefore lost.
+var eventLossCountM = stats.Int64(
+	metricNameEventLossCount,
+	"Number of events lost because they could not be delivered after their source was acknowledged",
+	stats.UnitDimensionless,
+)
+
+// Values of the "result" tag of lockRenewalCountM.
+const (
+	renewalResultSuccess = "success"
+	renewalResultFailure = "failure"
+)
+
 // MustRegisterEventProcessingStatsView registers an OpenCensus stats view for
 // metrics related to events processing, and panics in case of error.
 func MustRegisterEventProcessingStatsView() {
@@ -115,6 +179,133 @@ func MustRegisterEventProcessingStatsView() {
 	}
 }
 
+// MustRegisterEventDeliveryLagStatsView registers an OpenCensus stats view for
+// the delivery lag of messages consumed from an external system, and panics in
+// case of error.
+func MustRegisterEventDeliveryLagStatsView() {
+	err := view.Register(
+		&view.View{
+			Measure:     eventDeliveryLagM,
+			Description: eventDeliveryLagM.Description(),
+			Aggregation: view.Distribution(metrics.Buckets125(10, 10000000)...), // 10,20,50,100,...,5000000,10000000
+			TagKeys: []tag.Key{
+				tagKeyResourceGroup,
+				tagKeyNamespace,
+				tagKeyName,
+			},
+		},
+	)
+	if err != nil {
+		panic(fmt.Errorf("error registering OpenCensus stats view: %w", err))
+	}
+}
+
+// MustRegisterNilMessageStatsView registers an OpenCensus stats view for the
+// number of nil messages received from an external system, and panics in case
+// of error.
+func MustRegisterNilMessageStatsView() {
+	err := view.Register(
+		&view.View{
+			Measure:     nilMessageCountM,
+			Description: nilMessageCountM.Description(),
+			Aggregation: view.Count(),
+			TagKeys: []tag.Key{
+				tagKeyResourceGroup,
+				tagKeyNamespace,
+				tagKeyName,
+			},
+		},
+	)
+	if err != nil {
+		panic(fmt.Errorf("error registering OpenCensus stats view: %w", err))
+	}
+}
+
+// MustRegisterProcessorPanicStatsView registers an OpenCensus stats view for
+// the number of panics recovered from while processing messages, and panics
+// in case of error.
+func MustRegisterProcessorPanicStatsView() {
+	err := view.Register(
+		&view.View{
+			Measure:     processorPanicCountM,
+			Description: processorPanicCountM.Description(),
+			Aggregation: view.Count(),
+			TagKeys: []tag.Key{
+				tagKeyResourceGroup,
+				tagKeyNamespace,
+				tagKeyName,
+			},
+		},
+	)
+	if err != nil {
+		panic(fmt.Errorf("error registering OpenCensus stats view: %w", err))
+	}
+}
+
+// MustRegisterLockRenewalStatsView registers an OpenCensus stats view for the
+// renewals of locks on messages consumed from an external system, and panics
+// in case of error.
+func MustRegisterLockRenewalStatsView() {
+	err := view.Register(
+		&view.View{
+			Measure:     lockRenewalCountM,
+			Description: lockRenewalCountM.Description(),
+			Aggregation: view.Count(),
+			TagKeys: []tag.Key{
+				tagKeyResourceGroup,
+				tagKeyNamespace,
+				tagKeyName,
+				tagKeyRenewalResult,
+			},
+		},
+	)
+	if err != nil {
+		panic(fmt.Errorf("error registering OpenCensus stats view: %w", err))
+	}
+}
+
+// MustRegisterMessageTimeoutStatsView registers an OpenCensus stats view for
+// the number of messages the handling of which exceeded the maximum
+// duration, and panics in case of error.
+func MustRegisterMessageTimeoutStatsView() {
+	err := view.Register(
+		&view.View{
+			Measure:     messageTimeoutCountM,
+			Description: messageTimeoutCountM.Description(),
+			Aggregation: view.Count(),
+			TagKeys: []tag.Key{
+				tagKeyResourceGroup,
+				tagKeyNamespace,
+				tagKeyName,
+			},
+		},
+	)
+	if err != nil {
+		panic(fmt.Errorf("error registering OpenCensus stats view: %w", err))
+	}
+}
+
+// MustRegisterEventLossStatsView registers an OpenCensus stats view for the
+// number of events lost because they could not be delivered after their
+// source was acknowledged, and panics in case of error.
+func MustRegisterEventLossStatsView() {
+	err := view.Register(
+		&view.View{
+			Measure:     eventLossCountM,
+			Description: eventLossCountM.Description(),
+			Aggregation: view.Sum(),
+			TagKeys: []tag.Key{
+				tagKeyResourceGroup,
+				tagKeyNamespace,
+				tagKeyName,
+			},
+		},
+	)
+	if err != nil {
+		panic(fmt.Errorf("error registering OpenCensus stats view: %w", err))
+	}
+}
+
 // EventProcessingStatsReporter collects and reports stats about the processing of CloudEvents.
 type EventProcessingStatsReporter struct {
 	// context that holds pre-populated OpenCensus tags
@@ -161,6 +352,51 @@ func (r *EventProcessingStatsReporter) ReportProcessingLatency(d time.Duration,
 	metrics.Record(tagsCtx, eventProcessingLatenciesM.M(d.Milliseconds()))
 }
 
+// ReportDeliveryLag records in eventDeliveryLagM the time elapsed between the
+// enqueuing of a message and its delivery.
+func (r *EventProcessingStatsReporter) ReportDeliveryLag(d time.Duration, tms ...tag.Mutator) {
+	tagsCtx, _ := tag.New(r.tagsCtx, tms...)
+	metrics.Record(tagsCtx, eventDeliveryLagM.M(d.Milliseconds()))
+}
+
+// ReportNilMessage increments nilMessageCountM.
+func (r *EventProcessingStatsReporter) ReportNilMessage(tms ...tag.Mutator) {
+	tagsCtx, _ := tag.New(r.tagsCtx, tms...)
+	metrics.Record(tagsCtx, nilMessageCountM.M(1))
+}
+
+// ReportProcessorPanic increments processorPanicCountM.
+func (r *EventProcessingStatsReporter) ReportProcessorPanic(tms ...tag.Mutator) {
+	tagsCtx, _ := tag.New(r.tagsCtx, tms...)
+	metrics.Record(tagsCtx, processorPanicCountM.M(1))
+}
+
+// ReportLockRenewal increments lockRenewalCountM.
+func (r *EventProcessingStatsReporter) ReportLockRenewal(success bool, tms ...tag.Mutator) {
+	result := renewalResultFailure
+	if success {
+		result = renewalResultSuccess
+	}
+	tms = append(tms,
+		tag.Insert(tagKeyRenewalResult, result),
+	)
+
+	tagsCtx, _ := tag.New(r.tagsCtx, tms...)
+	metrics.Record(tagsCtx, lockRenewalCountM.M(1))
+}
+
+// ReportMessageTimeout increments messageTimeoutCountM.
+func (r *EventProcessingStatsReporter) ReportMessageTimeout(tms ...tag.Mutator) {
+	tagsCtx, _ := tag.New(r.tagsCtx, tms...)
+	metrics.Record(tagsCtx, messageTimeoutCountM.M(1))
+}
+
+// ReportEventLoss increments eventLossCountM by the given number of events.
+func (r *EventProcessingStatsReporter) ReportEventLoss(numEvents int, tms ...tag.Mutator) {
+	tagsCtx, _ := tag.New(r.tagsCtx, tms...)
+	metrics.Record(tagsCtx, eventLossCountM.M(int64(numEvents)))
+}
+
 // TagEventType returns a tag mutator that injects the value of the
 // "event_type" tag.
 func TagEventType(val string) tag.Mutator {
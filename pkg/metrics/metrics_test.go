@@ -55,6 +55,12 @@ func TestEventProcessingStatsReporter(t *testing.T) {
 		st.ReportProcessingSuccess()
 		st.ReportProcessingError(true)
 		st.ReportProcessingLatency(12 * time.Millisecond)
+		st.ReportDeliveryLag(3 * time.Second)
+		st.ReportNilMessage()
+		st.ReportProcessorPanic()
+		st.ReportLockRenewal(false)
+		st.ReportMessageTimeout()
+		st.ReportEventLoss(2)
 
 		metricstest.CheckCountData(t,
 			"event_processing_success_count",
@@ -75,6 +81,44 @@ func TestEventProcessingStatsReporter(t *testing.T) {
 			wantCommonTags,
 			1,
 		)
+
+		metricstest.CheckDistributionCount(t,
+			"event_delivery_lag",
+			wantCommonTags,
+			1,
+		)
+
+		metricstest.CheckCountData(t,
+			"nil_message_count",
+			wantCommonTags,
+			1,
+		)
+
+		metricstest.CheckCountData(t,
+			"processor_panic_count",
+			wantCommonTags,
+			1,
+		)
+
+		metricstest.CheckCountData(t,
+			"lock_renewal_count",
+			appendTags(wantCommonTags, map[string]string{
+				"result": "failure",
+			}),
+			1,
+		)
+
+		metricstest.CheckCountData(t,
+			"message_timeout_count",
+			wantCommonTags,
+			1,
+		)
+
+		metricstest.CheckSumData(t,
+			"event_loss_count",
+			wantCommonTags,
+			2,
+		)
 	})
 
 	t.Run("record with tags", func(t *testing.T) {
@@ -127,6 +171,36 @@ func TestEventProcessingStatsReporter(t *testing.T) {
 			2250.0,
 		)
 	})
+
+	t.Run("delivery lag distribution", func(t *testing.T) {
+		metricstesting.ResetMetrics(t)
+
+		st.ReportDeliveryLag(150 * time.Millisecond)
+		st.ReportDeliveryLag(42 * time.Minute)
+
+		metricstest.CheckDistributionData(t,
+			"event_delivery_lag",
+			wantCommonTags,
+			2,
+			150.0,
+			2520000.0,
+		)
+	})
+
+	t.Run("lock renewal success", func(t *testing.T) {
+		metricstesting.ResetMetrics(t)
+
+		st.ReportLockRenewal(true)
+		st.ReportLockRenewal(true)
+
+		metricstest.CheckCountData(t,
+			"lock_renewal_count",
+			appendTags(wantCommonTags, map[string]string{
+				"result": "success",
+			}),
+			2,
+		)
+	})
 }
 
 // appendTags returns a copy of the given metrics tags with extra key/values inserted.
@@ -35,22 +35,46 @@ func ResetMetrics(t *testing.T) {
 	UnregisterMetrics()
 
 	metrics.MustRegisterEventProcessingStatsView()
+	metrics.MustRegisterEventDeliveryLagStatsView()
+	metrics.MustRegisterNilMessageStatsView()
+	metrics.MustRegisterProcessorPanicStatsView()
+	metrics.MustRegisterLockRenewalStatsView()
+	metrics.MustRegisterMessageTimeoutStatsView()
+	metrics.MustRegisterEventLossStatsView()
 
 	metricstest.AssertNoMetric(t,
 		"event_processing_success_count",
 		"event_processing_error_count",
 		"event_processing_latencies",
+		"event_delivery_lag",
+		"nil_message_count",
+		"processor_panic_count",
+		"lock_renewal_count",
+		"message_timeout_count",
+		"event_loss_count",
 	)
 }
 
 // UnregisterMetrics unregisters the metrics that were registered in the global
 // state of OpenCensus.
 // Can be used instead of ResetMetrics to avoid panics in tests that already
-// call metrics.MustRegisterEventProcessingStatsView.
+// call metrics.MustRegisterEventProcessingStatsView,
+// metrics.MustRegisterEventDeliveryLagStatsView,
+// metrics.MustRegisterNilMessageStatsView,
+// metrics.MustRegisterProcessorPanicStatsView,
+// metrics.MustRegisterLockRenewalStatsView,
+// metrics.MustRegisterMessageTimeoutStatsView or
+// metrics.MustRegisterEventLossStatsView.
 func UnregisterMetrics() {
 	metricstest.Unregister(
 		"event_processing_success_count",
 		"event_processing_error_count",
 		"event_processing_latencies",
+		"event_delivery_lag",
+		"nil_message_count",
+		"processor_panic_count",
+		"lock_renewal_count",
+		"message_timeout_count",
+		"event_loss_count",
 	)
 }
@@ -18,47 +18,48 @@ package azureservicebussource
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net"
-	"os"
+	"net/http"
+	"net/url"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/devigned/tab"
+	"go.opencensus.io/tag"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	"nhooyr.io/websocket"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
 
 	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
 	"knative.dev/pkg/logging"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
-	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
 
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
 	"github.com/triggermesh/triggermesh/pkg/apis/sources"
 	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+	"github.com/triggermesh/triggermesh/pkg/metrics"
 	"github.com/triggermesh/triggermesh/pkg/sources/adapter/azureservicebussource/trace"
+	"github.com/triggermesh/triggermesh/pkg/sources/adapter/common"
 )
 
 const (
-	resourceProviderServiceBus = "Microsoft.ServiceBus"
-
-	resourceTypeQueues        = "queues"
-	resourceTypeTopics        = "topics"
-	resourceTypeSubscriptions = "subscriptions"
-)
-
-const (
-	envKeyName  = "SERVICEBUS_KEY_NAME"
-	envKeyValue = "SERVICEBUS_KEY_VALUE"
-	envConnStr  = "SERVICEBUS_CONNECTION_STRING"
+	logfieldMsgID     = "msgID"
+	logfieldSessionID = "sessionID"
+	logfieldEntity    = "entity"
 )
 
 // envConfig is a set parameters sourced from the environment for the source's
@@ -67,21 +68,796 @@ type envConfig struct {
 	pkgadapter.EnvConfig
 
 	// Resource ID of the Service Bus entity (Queue or Topic subscription).
-	EntityResourceID string `envconfig:"SERVICEBUS_ENTITY_RESOURCE_ID" required:"true"`
+	// Multiple entities can be consumed from by the same adapter by
+	// passing a comma-separated list of resource IDs. In that case, the
+	// "source" attribute of CloudEvents is the resource ID of the entity
+	// each message was received from.
+	//
+	// For compatibility with legacy deployments, the entity can instead be
+	// derived from the EntityPath of the connection string passed via
+	// SERVICEBUS_CONNECTION_STRING, when no resource ID is set. The
+	// "source" attribute of CloudEvents is then the URL of the entity,
+	// e.g. "sb://ns.servicebus.windows.net/myqueue".
+	EntityResourceID string `envconfig:"SERVICEBUS_ENTITY_RESOURCE_ID"`
+
+	// Advanced: consume messages from all the queues of the Service Bus
+	// namespace identified by SERVICEBUS_NAMESPACE_RESOURCE_ID, instead of
+	// from the entities identified by SERVICEBUS_ENTITY_RESOURCE_ID.
+	// Queues are listed every SERVICEBUS_DISCOVERY_INTERVAL using the
+	// management API, which requires the "Manage" access right with SAS
+	// authentication. Messages start being consumed from queues which
+	// appear, and stop being consumed from queues which are deleted. The
+	// "source" attribute of CloudEvents is the resource ID of the queue
+	// each message was received from.
+	//
+	// All other settings apply to every discovered queue. Topic
+	// subscriptions are not discovered.
+	DiscoverQueues      bool          `envconfig:"SERVICEBUS_DISCOVER_QUEUES" default:"false"`
+	NamespaceResourceID string        `envconfig:"SERVICEBUS_NAMESPACE_RESOURCE_ID"`
+	DiscoveryInterval   time.Duration `envconfig:"SERVICEBUS_DISCOVERY_INTERVAL" default:"1m"`
 
 	// Name of a message processor which takes care of converting Service
 	// Bus messages to CloudEvents.
 	//
-	// Supported values: [ default ]
+	// Supported values: [ default raw ]
+	//
+	// Additional processors can be made available with
+	// RegisterMessageProcessor. Options which shape the CloudEvents
+	// produced by the "default" processor, such as SERVICEBUS_CE_ID_SOURCE
+	// or SERVICEBUS_BODY_TRANSFORM, can not be set along with other
+	// processors.
 	MessageProcessor string `envconfig:"SERVICEBUS_MESSAGE_PROCESSOR" default:"default"`
 
-	// WebSocketsEnable.
+	// Whether the connection to Service Bus uses AMQP over WebSockets on
+	// port 443 instead of AMQP on port 5671, for networks which only allow
+	// outbound HTTPS traffic.
+	// SERVICEBUS_USE_WEBSOCKETS is accepted as an alias.
 	WebSocketsEnable bool `envconfig:"SERVICEBUS_WEBSOCKETS_ENABLE" default:"false"`
+	UseWebSockets    bool `envconfig:"SERVICEBUS_USE_WEBSOCKETS" default:"false"`
+
+	// URL of a HTTP(S) proxy through which the connection to Service Bus is
+	// established. It takes precedence over the HTTPS_PROXY environment
+	// variable, which is otherwise honored together with NO_PROXY.
+	// Proxies can only be used with AMQP over WebSockets, which must be
+	// enabled when this option is set.
+	ProxyURL string `envconfig:"SERVICEBUS_PROXY_URL"`
+
+	// Maximum duration of the establishment of the connection to Service
+	// Bus at startup. When the Service Bus entity can't be reached within
+	// that duration, the adapter fails instead of starting without a
+	// working connection, so that it gets restarted. With AMQP over
+	// WebSockets, the duration also bounds the establishment of every
+	// subsequent connection. A value of 0 preserves the default behavior,
+	// in which failures to reach the entity at startup are only logged.
+	ConnectTimeout time.Duration `envconfig:"SERVICEBUS_CONNECT_TIMEOUT" default:"0"`
+
+	// Interval between TCP keep-alive probes on the connection to Service
+	// Bus, which detect connections that were silently dropped by the
+	// network. Only supported with AMQP over WebSockets, since the Service
+	// Bus client library doesn't expose the network settings of plain AMQP
+	// connections. A value of 0 keeps the default interval of 30s, and a
+	// negative value disables keep-alive probes.
+	TCPKeepAlive time.Duration `envconfig:"SERVICEBUS_TCP_KEEPALIVE" default:"0"`
 
 	// MaxConcurrent is the maximum number of goroutines that
 	// will be used to process messages.
 	MaxConcurrent int `envconfig:"SERVICEBUS_MAX_CONCURRENT" default:"10"`
 
+	// Verification of the order of messages, when they are handled by a
+	// single goroutine (SERVICEBUS_MAX_CONCURRENT=1). A message which
+	// sequence number is lower than the one of a message handled before
+	// it usually denotes a misconfiguration, such as sessions being
+	// disabled on a session-enabled entity.
+	//
+	// Supported values: [ warn fail ]
+	//
+	// "warn" logs a warning about out-of-order messages. "fail" abandons
+	// the out-of-order message and stops the adapter.
+	// An empty value disables the verification.
+	OrderingCheck string `envconfig:"SERVICEBUS_ORDERING_CHECK"`
+
+	// Complete (or otherwise settle) messages strictly in the order they
+	// were received in, i.e. in the order of their sequence numbers, while
+	// still sending events to the sink concurrently. The settlement of a
+	// message whose handling finished early is buffered in memory until
+	// all the messages received before it are settled, so a slow message
+	// increases the memory usage of the adapter, and can cause the locks
+	// on buffered messages to expire. Only useful when
+	// SERVICEBUS_MAX_CONCURRENT is greater than 1. Does not apply to
+	// messages received from sessions, which are always settled in order.
+	// Not supported with SERVICEBUS_RECEIVER_LINKS greater than 1, nor
+	// with SERVICEBUS_COMPLETE_BATCH_SIZE greater than 1.
+	OrderedCompletion bool `envconfig:"SERVICEBUS_ORDERED_COMPLETION" default:"false"`
+
+	// Maximum number of messages which completion is deferred and
+	// performed together, outside of the processing path of messages.
+	// A value of 1 disables batching. Each message is still completed with
+	// its own disposition, so batching doesn't reduce the number of
+	// disposition frames sent to Service Bus, it only takes their
+	// round-trips off the processing path. Messages remain locked until
+	// their completion is flushed, without their lock being renewed, and
+	// get redelivered if the adapter crashes in the meantime. This
+	// preserves at-least-once delivery, but increases the likelihood of
+	// duplicate events. Not supported with sessions, nor with
+	// SERVICEBUS_ORDERED_COMPLETION, since messages of a batch are
+	// completed concurrently and after messages which were abandoned or
+	// dead-lettered in the meantime.
+	CompleteBatchSize int `envconfig:"SERVICEBUS_COMPLETE_BATCH_SIZE" default:"1"`
+
+	// Maximum duration completions are accumulated for before a batch
+	// which isn't full gets flushed. Must remain well below the lock
+	// duration of the Service Bus entity.
+	CompleteFlushInterval time.Duration `envconfig:"SERVICEBUS_COMPLETE_FLUSH_INTERVAL" default:"1s"`
+
+	// PrefetchCount is the maximum number of messages requested from the
+	// Service Bus entity in a single receive operation. The receiver
+	// issues as many AMQP link credits, so this effectively controls how
+	// many messages are prefetched ahead of processing. For high volumes,
+	// combine with SERVICEBUS_SINK_BATCH_SIZE to also deliver the resulting
+	// events in batches; messages are still settled individually.
+	//
+	// The Service Bus SDK doesn't expose the link credit of receivers
+	// otherwise: credits are only issued by receive operations, which
+	// return either once all credits were used, or shortly (20ms) after the
+	// first message arrived. Together with
+	// SERVICEBUS_PREFETCH_REFILL_THRESHOLD, which controls how often
+	// credits are replenished, this setting trades latency for throughput:
+	//
+	//   - Latency-sensitive workloads with a low rate of messages benefit
+	//     from a prefetch count of 1, or close to it, so that receive
+	//     operations return as soon as a message arrives instead of
+	//     waiting for more messages to use the remaining credits.
+	//   - High-throughput workloads benefit from a large prefetch count
+	//     (e.g. 100 to 1000), which amortizes the cost of receive
+	//     operations over more messages, combined with a refill threshold
+	//     (e.g. 0.5) when receive operations are slow.
+	PrefetchCount int `envconfig:"SERVICEBUS_PREFETCH_COUNT" default:"100"`
+
+	// Fraction of SERVICEBUS_PREFETCH_COUNT, between 0 and 1, below which
+	// the buffer of received messages awaiting one of the
+	// SERVICEBUS_MAX_CONCURRENT handlers gets refilled. The next receive
+	// operation then overlaps with the handling of the buffered messages,
+	// instead of starting once all received messages were taken by
+	// handlers, which smooths throughput when receive operations are slow.
+	// Each refill issues as many link credits as there are free slots in
+	// the buffer, so higher values replenish credits more frequently, in
+	// smaller increments.
+	// Up to SERVICEBUS_PREFETCH_COUNT + SERVICEBUS_MAX_CONCURRENT messages
+	// are locked by the adapter at once. A value of 0 disables the buffer.
+	// Not supported with sessions.
+	PrefetchRefillThreshold float64 `envconfig:"SERVICEBUS_PREFETCH_REFILL_THRESHOLD" default:"0"`
+
+	// Number of AMQP receiver links opened on the Service Bus entity. Each
+	// link receives up to SERVICEBUS_PREFETCH_COUNT messages at a time, in
+	// parallel with the other links, so that the throughput of a single
+	// link doesn't bottleneck high-throughput entities. Messages received
+	// on all links are handled by the same SERVICEBUS_MAX_CONCURRENT
+	// goroutines, and settled on the link they were received from.
+	//
+	// Up to (links * prefetch count) messages can therefore be locked by
+	// the adapter at once; both values should be sized so that these
+	// messages are handled before their lock expires.
+	// Not supported with sessions, SERVICEBUS_ORDERING_CHECK or
+	// SERVICEBUS_ORDERED_COMPLETION.
+	ReceiverLinks int `envconfig:"SERVICEBUS_RECEIVER_LINKS" default:"1"`
+
+	// MaxDeliveryAttempts is the number of delivery attempts after which a
+	// message which can not be converted to CloudEvents, or the handling of
+	// which times out (see SERVICEBUS_MESSAGE_TIMEOUT), gets moved to the
+	// dead-letter sub-queue of the entity, instead of being abandoned.
+	// A value of 0 disables dead-lettering.
+	MaxDeliveryAttempts uint32 `envconfig:"SERVICEBUS_MAX_DELIVERY_ATTEMPTS" default:"0"`
+
+	// Policy which determines how a message gets settled when only some of
+	// the CloudEvents produced from it could be delivered to the sink.
+	//
+	// Supported values: [ all any best-effort ]
+	//
+	// "all" completes a message only if all its events were delivered,
+	// and abandons it otherwise. Events which were already delivered are
+	// sent again when the message gets redelivered.
+	// "any" completes a message if at least one of its events was
+	// delivered, and abandons it otherwise. Events which could not be
+	// delivered while others were are lost.
+	// "best-effort" behaves like "any", but dead-letters messages none of
+	// whose events could be delivered instead of abandoning them, so that
+	// messages are never redelivered.
+	CompletionPolicy string `envconfig:"SERVICEBUS_COMPLETION_POLICY" default:"all"`
+
+	// Comma-separated list of rules which map the HTTP status returned by
+	// the sink when it fails to accept an event to the disposition of the
+	// message this event was produced from, e.g.
+	//   422=deadletter,503=abandon,4xx=complete
+	// Statuses are either HTTP status codes or classes of status codes
+	// (4xx, 5xx), the former taking precedence over the latter.
+	// Dispositions are either "complete", "abandon" or "deadletter". When
+	// multiple events of a message fail to be delivered, "abandon" takes
+	// precedence over "deadletter", which takes precedence over
+	// "complete". Rules take precedence over SERVICEBUS_COMPLETION_POLICY,
+	// and messages are settled as usual when the failed delivery of any of
+	// their events isn't mapped by a rule. When events are delivered in
+	// batches (see SERVICEBUS_SINK_BATCH_SIZE), the status returned for a
+	// batch applies to each of its events.
+	ResultDispositions string `envconfig:"SERVICEBUS_RESULT_DISPOSITIONS"`
+
+	// Guarantee provided for the delivery of CloudEvents to the sink.
+	//
+	// Supported values: [ at-least-once at-most-once ]
+	//
+	// "at-least-once" completes a message after its events were sent to
+	// the sink, so that a message whose events could not be delivered gets
+	// redelivered, at the cost of possibly duplicate events.
+	// "at-most-once" completes a message before its events are sent to the
+	// sink, which is attempted only once the completion succeeded. Events
+	// which can then not be delivered are LOST: they are neither retried
+	// after their retries with SERVICEBUS_SINK_MAX_RETRIES were exhausted,
+	// nor dead-lettered. Such losses are recorded by the event_loss_count
+	// metric. Suitable for streams such as telemetry, in which duplicates
+	// are more harmful than occasional gaps. Can not be combined with
+	// SERVICEBUS_ORDERED_COMPLETION or SERVICEBUS_COMPLETE_BATCH_SIZE.
+	DeliverySemantics string `envconfig:"SERVICEBUS_DELIVERY_SEMANTICS" default:"at-least-once"`
+
+	// Maximum number of consecutive attempts at recovering from transient
+	// errors while receiving messages, such as the loss of the connection
+	// to Service Bus, before the adapter fails. Attempts are spaced by an
+	// exponential backoff. Errors which are permanent, such as missing
+	// access rights, are never retried.
+	ReceiveMaxRetries int `envconfig:"SERVICEBUS_RECEIVE_MAX_RETRIES" default:"5"`
+
+	// Renew the lock on messages automatically while they are being
+	// handled, for sinks which are slower than the lock duration of the
+	// entity. Locks are renewed when half of their duration has elapsed.
+	// Does not apply to messages received from sessions.
+	AutoRenewLock bool `envconfig:"SERVICEBUS_AUTO_RENEW_LOCK" default:"false"`
+
+	// Skip messages whose scheduled enqueue time is still in the future.
+	// Such messages are deferred without being sent, and their sequence
+	// number is logged, so that they can be replayed once due by adding
+	// it to SERVICEBUS_REPLAY_WATCH_FILE. Deferred messages are not
+	// delivered again by Service Bus otherwise.
+	SkipNotDueMessages bool `envconfig:"SERVICEBUS_SKIP_NOT_DUE_MESSAGES" default:"false"`
+
+	// Complete, without sending them to the sink, messages whose time to
+	// live has elapsed since they were enqueued. This is useful when
+	// draining a backlog of messages which Service Bus hasn't expired yet.
+	// Messages without a time to live are always processed.
+	SkipExpired bool `envconfig:"SERVICEBUS_SKIP_EXPIRED" default:"false"`
+
+	// Tolerated skew between the clocks of Service Bus and of the local
+	// host. Applies to all comparisons between the times carried by
+	// messages and the local time: messages are considered expired or not
+	// due only when they are so by more than this duration, locks are
+	// renewed this much earlier, and enqueued times which are in the
+	// future by no more than this duration are replaced with the local
+	// time in the "time" attribute of CloudEvents.
+	ClockSkew time.Duration `envconfig:"SERVICEBUS_CLOCK_SKEW" default:"0"`
+
+	// Duration after which, if no message was received, the connection to
+	// Service Bus is probed. When the probe fails, e.g. because the AMQP
+	// connection half-died without erroring, the receiver is torn down and
+	// rebuilt over a new connection instead of waiting silently forever.
+	// Must exceed the time it takes to handle a message, since messages
+	// which are still being handled when their receiver is torn down can't
+	// be settled anymore. Does not apply to messages received from
+	// sessions. Disabled when 0.
+	IdleTimeout time.Duration `envconfig:"SERVICEBUS_IDLE_TIMEOUT" default:"0"`
+
+	// Consume messages from a session-enabled entity. Messages from a
+	// given session are consumed sequentially, in order.
+	SessionEnabled bool `envconfig:"SERVICEBUS_SESSION_ENABLED" default:"false"`
+
+	// Maximum number of sessions which are consumed in parallel. Ordering
+	// is preserved within each session. Can not exceed 1 when a session ID
+	// is set.
+	MaxConcurrentSessions int `envconfig:"SERVICEBUS_MAX_CONCURRENT_SESSIONS" default:"1"`
+
+	// Maximum number of messages received at once from a session. Because
+	// messages from a session are handled sequentially, a lower value than
+	// the regular prefetch count prevents a slow session from holding
+	// messages for a long time while other sessions could be consumed.
+	// Defaults to SERVICEBUS_PREFETCH_COUNT when set to 0. Has no effect
+	// when sessions are disabled.
+	SessionPrefetch int `envconfig:"SERVICEBUS_SESSION_PREFETCH" default:"0"`
+
+	// ID of the session to consume messages from. When empty, the adapter
+	// consumes from the next available session, in turns.
+	SessionID string `envconfig:"SERVICEBUS_SESSION_ID"`
+
+	// Only validate that messages can be read from the Service Bus entity
+	// with the configured credentials, then exit without consuming any
+	// message.
+	ValidateOnly bool `envconfig:"SERVICEBUS_VALIDATE_ONLY" default:"false"`
+
+	// Path of a file which lists sequence numbers of messages to replay
+	// while the adapter consumes the entity, separated by commas or
+	// whitespaces (e.g. one per line), e.g. a file mounted from a
+	// ConfigMap. Whenever the file changes, the messages whose sequence
+	// numbers were added to it are replayed. Sequence numbers listed when
+	// the adapter starts are not replayed, and each sequence number is
+	// replayed at most once while the adapter runs.
+	ReplayWatchFile string `envconfig:"SERVICEBUS_REPLAY_WATCH_FILE"`
+
+	// Maximum duration the adapter waits for in-flight messages to be
+	// handled when it stops. Messages which are still being handled
+	// after that duration are abandoned. It should be tuned to the
+	// worst-case latency of the sink, while remaining shorter than the
+	// termination grace period of the adapter's Pod (30s by default) so
+	// that messages which could not be handled in time get abandoned
+	// before the adapter is killed.
+	DrainTimeout time.Duration `envconfig:"SERVICEBUS_DRAIN_TIMEOUT" default:"20s"`
+
+	// Alias of SERVICEBUS_DRAIN_TIMEOUT, which it overrides when set.
+	ShutdownGracePeriod time.Duration `envconfig:"SERVICEBUS_SHUTDOWN_GRACE_PERIOD"`
+
+	// Level and format of the logs of the adapter, overriding the logging
+	// configuration shared by all components, e.g. to debug a single
+	// source.
+	//
+	// Supported levels: [ debug info warn error ]
+	// Supported formats: [ json console ]
+	//
+	// When empty, the shared logging configuration applies.
+	LogLevel  string `envconfig:"SERVICEBUS_LOG_LEVEL"`
+	LogFormat string `envconfig:"SERVICEBUS_LOG_FORMAT"`
+
+	// Whether the application properties of Service Bus messages are
+	// propagated as CloudEvent extension attributes. Can be disabled in
+	// case events hit the maximum number of attributes tolerated by the
+	// sink. Properties which value is a list or a map are encoded to JSON,
+	// and accompanied by an attribute "<name>encoding" set to "json".
+	UserPropertiesAsExtensions bool `envconfig:"SERVICEBUS_USER_PROPERTIES_AS_EXTENSIONS" default:"true"`
+
+	// Comma-separated list of "property=attribute" pairs which rename
+	// specific application properties when they are propagated as
+	// CloudEvent extension attributes, e.g.
+	//   X-Tenant-Id=tenant,orderRef=orderid
+	// Other properties are propagated under their normalized name:
+	// lowercased, stripped of characters other than ASCII letters and
+	// digits, and truncated to 20 characters with a hash suffix if longer.
+	// A hash suffix is also appended to normalized names which collide
+	// with another attribute. Attribute names must consist of lowercase
+	// ASCII letters and digits, and are used as is regardless of their
+	// length.
+	PropertyMapping string `envconfig:"SERVICEBUS_PROPERTY_MAPPING"`
+
+	// Comma-separated list of names of AMQP message annotations which are
+	// propagated as CloudEvent extension attributes, e.g.
+	//   x-opt-enqueued-time,x-opt-deadletter-source
+	// Annotations set by the broker carry diagnostic information which
+	// isn't otherwise exposed. None is propagated by default.
+	AnnotationsAsExtensions []string `envconfig:"SERVICEBUS_ANNOTATIONS_AS_EXTENSIONS"`
+
+	// Maximum number of times the delivery of an event to the sink is
+	// retried when it fails with a transient error (network error, HTTP
+	// 408, 429 or 5xx), before the message is abandoned. Messages whose
+	// events are rejected with a fatal error (invalid event, other HTTP
+	// 4xx) are dead-lettered without retrying.
+	// A value of 0 disables retries.
+	SinkMaxRetries int `envconfig:"SERVICEBUS_SINK_MAX_RETRIES" default:"0"`
+
+	// Bounds of the exponential backoff applied between retries.
+	SinkRetryBaseBackoff time.Duration `envconfig:"SERVICEBUS_SINK_RETRY_BASE_BACKOFF" default:"500ms"`
+	SinkRetryMaxBackoff  time.Duration `envconfig:"SERVICEBUS_SINK_RETRY_MAX_BACKOFF" default:"10s"`
+
+	// Maximum duration of each attempt to deliver an event to the sink.
+	// Attempts which time out are retried like other transient errors, so
+	// that a sink which hangs causes messages to be abandoned instead of
+	// stalling the adapter. A value of 0 disables the timeout.
+	SinkTimeout time.Duration `envconfig:"SERVICEBUS_SINK_TIMEOUT" default:"0"`
+
+	// Maximum rate, in events per second, at which events are delivered to
+	// the sink, and maximum number of events which can be delivered in a
+	// burst above that rate. Deliveries which exceed the rate wait for
+	// their turn, including retries, while the corresponding messages
+	// remain locked (see SERVICEBUS_AUTO_RENEW_LOCK for long waits).
+	// The rate is shared by all entities the adapter receives from.
+	// A value of 0 disables rate limiting.
+	SendRateLimit float64 `envconfig:"SERVICEBUS_SEND_RATE_LIMIT" default:"0"`
+	SendRateBurst int     `envconfig:"SERVICEBUS_SEND_RATE_BURST" default:"1"`
+
+	// Maximum number of events delivered to the sink in a single request,
+	// using the batched content mode of the CloudEvents HTTP binding.
+	// A value of 1 disables batching. If the sink doesn't support batches,
+	// events are delivered individually. The delivery of each batch is
+	// bounded by SERVICEBUS_SINK_TIMEOUT, or K_SINK_TIMEOUT if unset.
+	SinkBatchSize int `envconfig:"SERVICEBUS_SINK_BATCH_SIZE" default:"1"`
+
+	// Maximum duration events are accumulated for before a batch which
+	// isn't full gets delivered to the sink.
+	SinkBatchFlushInterval time.Duration `envconfig:"SERVICEBUS_SINK_BATCH_FLUSH_INTERVAL" default:"500ms"`
+
+	// Follow redirects (3xx) returned by the sink, e.g. to a regional
+	// endpoint, instead of treating them as delivery failures. Each event
+	// follows at most one redirect, and the redirect target is used for
+	// subsequent events once it accepted an event.
+	SinkFollowRedirects bool `envconfig:"SERVICEBUS_SINK_FOLLOW_REDIRECTS" default:"false"`
+
+	// Mode of delivery of CloudEvents to the sink.
+	//
+	// Supported values: [ send discard ]
+	//
+	// "discard" drops events instead of sending them, while still
+	// reporting metrics and completing messages as if the events had been
+	// delivered. Intended for measuring the throughput of the adapter
+	// independently of the sink, e.g. in load tests.
+	SinkMode string `envconfig:"SERVICEBUS_SINK_MODE" default:"send"`
+
+	// Content mode of CloudEvents sent to the sink.
+	//
+	// Supported values: [ binary structured ]
+	//
+	// "binary" carries the attributes of events in headers and their data
+	// in the body of requests. "structured" encodes events as a whole in
+	// the body of requests, for sinks which don't read attributes from
+	// headers. Does not apply to batches of events, which are always
+	// encoded in the batched content mode.
+	CEEncoding string `envconfig:"SERVICEBUS_CE_ENCODING" default:"binary"`
+
+	// URL of a secondary sink which receives a CloudEvent describing each
+	// message that couldn't be converted or delivered. The data of these
+	// events is the raw body of the message, and the cause of the failure
+	// is conveyed by the "sberrorreason" and "sberrordescription"
+	// extension attributes. Messages are only forwarded once their
+	// handling failed for good, i.e. when they get dead-lettered, or
+	// completed although some of their events were lost, but not when they
+	// are abandoned for redelivery. Messages are settled as usual
+	// regardless.
+	DeadLetterSink string `envconfig:"K_DEADLETTER_SINK"`
+
+	// URL of a sink which receives a CloudEvent of type
+	// "com.microsoft.azure.servicebus.conversionerror" describing
+	// each message that couldn't be converted to CloudEvents, e.g. for
+	// triaging malformed messages. The data of these events is a JSON
+	// object which contains the cause of the failure, the raw body of the
+	// message and all its system and application properties (see
+	// conversionFailure). Messages are completed once they were forwarded
+	// to the error sink, and forwarded to K_DEADLETTER_SINK as well, if
+	// set, like any other message whose handling failed for good. Messages
+	// which couldn't be forwarded are settled as usual.
+	ErrorSink string `envconfig:"SERVICEBUS_ERROR_SINK"`
+
+	// Comma-separated lists of URLs of sinks which receive each event in
+	// addition to the sink of the source, e.g. an archive. Messages are
+	// only completed once their events were delivered to the sink of the
+	// source and to all required sinks. Failures to deliver to best-effort
+	// sinks are logged, but don't affect the settlement of messages.
+	// Not supported when events are batched.
+	ExtraSinks           []string `envconfig:"SERVICEBUS_EXTRA_SINKS"`
+	ExtraSinksBestEffort []string `envconfig:"SERVICEBUS_EXTRA_SINKS_BEST_EFFORT"`
+
+	// Overrides the "source" attribute of CloudEvents, which defaults to
+	// the resource ID of the Service Bus entity. When set, the resource ID
+	// is propagated in the "sbresourceid" extension attribute instead.
+	CEOverrideSource string `envconfig:"SERVICEBUS_CE_SOURCE_OVERRIDE"`
+
+	// Prefix of the "type" attribute of CloudEvents created from messages
+	// which have a subject (label). The type of such CloudEvents is
+	// "<prefix>.<subject>". Other CloudEvents have the default type.
+	CETypePrefix string `envconfig:"SERVICEBUS_CE_TYPE_PREFIX"`
+
+	// jq expression evaluated against the JSON body of messages. Messages
+	// for which the expression returns false or null are completed without
+	// being sent to the sink. Messages whose body isn't JSON are always
+	// sent.
+	FilterExpression string `envconfig:"SERVICEBUS_FILTER_EXPRESSION"`
+
+	// Regular expression matched against the correlation ID of messages,
+	// e.g. "^tenant-a/". Messages whose correlation ID doesn't match, or
+	// which have none, are completed without being sent to the sink. A
+	// lightweight alternative to subscription rules, which doesn't require
+	// management permissions.
+	CorrelationFilter string `envconfig:"SERVICEBUS_CORRELATION_FILTER"`
+
+	// Interval at which the number of active messages in the Service Bus
+	// entity is polled, through the management API, in order to detect
+	// that its backlog has been drained. Each time this number transitions
+	// from non-zero to zero, a CloudEvent of type
+	// "com.microsoft.azure.servicebus.drained" is sent to the sink, e.g. to
+	// trigger end-of-batch processing downstream. Disabled when 0.
+	DrainedEventInterval time.Duration `envconfig:"SERVICEBUS_DRAINED_EVENT_INTERVAL" default:"0"`
+
+	// Duration without any message received from the Service Bus entity
+	// after which a CloudEvent of type
+	// "com.microsoft.azure.servicebus.heartbeat" is sent to the sink, and
+	// again after each further such duration, e.g. to let monitoring tell
+	// a quiet entity apart from a broken adapter. Disabled when 0.
+	HeartbeatInterval time.Duration `envconfig:"SERVICEBUS_HEARTBEAT_INTERVAL" default:"0"`
+
+	// Emission of a CloudEvent of type
+	// "com.microsoft.azure.servicebus.batchsummary" for each batch of
+	// messages received from the Service Bus entity, carrying the number
+	// of messages in the batch, the bounds of their sequence numbers and
+	// the time span between their enqueued times. Accepted values:
+	//  - "none": no summary is sent
+	//  - "additional": the summary is sent before the events of each
+	//    message of the batch
+	//  - "only": the summary is sent instead of the events of each message
+	//    of the batch, which are all completed once the summary was
+	//    delivered, or abandoned otherwise. Options which apply to the
+	//    handling of individual messages have no effect in this mode.
+	// Not supported with sessions.
+	BatchSummary string `envconfig:"SERVICEBUS_BATCH_SUMMARY" default:"none"`
+
+	// Maximum number of times a message may traverse the consumed queue or
+	// topic, according to the entities recorded in its "Via" application
+	// property. This protects against accidental auto-forwarding loops in
+	// complex topologies. The number of entities a message was forwarded
+	// through is propagated in the "sbhops" extension attribute regardless.
+	// Disabled when 0.
+	HopLimit int `envconfig:"SERVICEBUS_HOP_LIMIT" default:"0"`
+
+	// Action taken on messages which exceed the hop limit. Accepted values:
+	//  - "flag": send the message with the "sbhoplimitexceeded" extension
+	//    attribute set to true
+	//  - "drop": complete the message without sending it to the sink
+	HopLimitAction string `envconfig:"SERVICEBUS_HOP_LIMIT_ACTION" default:"flag"`
+
+	// jq expression which reshapes the JSON body of messages before it
+	// becomes the data of CloudEvents, e.g. '{id: .orderId, total}' or
+	// 'del(.customer.email)'. Only the first value produced by the
+	// expression is used. Messages whose body isn't JSON are sent as is.
+	// When combined with SERVICEBUS_EXPLODE_JSON_ARRAY, the expression is
+	// evaluated against each element of JSON array bodies. Only supported
+	// by the default message processor.
+	BodyTransform string `envconfig:"SERVICEBUS_BODY_TRANSFORM"`
+
+	// Source of the "partitionkey" extension attribute of CloudEvents,
+	// which sinks such as Kafka use to select the partition of events.
+	//
+	// Supported values: [ session-id partition-key body ]
+	//
+	// "session-id" and "partition-key" use the corresponding system
+	// properties of messages. "body" uses the first value returned by the
+	// jq expression SERVICEBUS_PARTITIONKEY_EXPRESSION, evaluated against
+	// the JSON body of messages (after SERVICEBUS_BODY_TRANSFORM), e.g.
+	// '.customer.id'. The attribute is not set for messages which have no
+	// such value, nor when empty. Only supported by the default message
+	// processor.
+	PartitionKeyFrom       string `envconfig:"SERVICEBUS_PARTITIONKEY_FROM"`
+	PartitionKeyExpression string `envconfig:"SERVICEBUS_PARTITIONKEY_EXPRESSION"`
+
+	// Whether messages are received from the dead-letter sub-queue of the
+	// Service Bus entity instead of the entity itself. The reason,
+	// description and source of the dead-lettering of messages are set as
+	// CloudEvent extension attributes. Not supported together with sessions.
+	ConsumeDeadLetterQueue bool `envconfig:"SERVICEBUS_CONSUME_DLQ" default:"false"`
+
+	// Whether messages are received from the transfer dead-letter sub-queue
+	// of the Service Bus entity instead of the entity itself, e.g. to
+	// monitor failures to auto-forward messages in complex topologies.
+	// Like with SERVICEBUS_CONSUME_DLQ, the reason, description and source
+	// of the dead-lettering of messages are set as CloudEvent extension
+	// attributes. Not supported together with sessions nor
+	// SERVICEBUS_CONSUME_DLQ.
+	ConsumeTransferDeadLetterQueue bool `envconfig:"SERVICEBUS_CONSUME_TRANSFER_DLQ" default:"false"`
+
+	// SQL filter expression which messages must match to be delivered to
+	// the topic subscription. When set, the adapter ensures that a rule
+	// with this filter exists on the subscription before receiving
+	// messages. Only applies to topic subscriptions, and requires the
+	// "Manage" access right when SAS authentication is used.
+	SubscriptionFilterSQL string `envconfig:"SERVICEBUS_SUBSCRIPTION_FILTER_SQL"`
+
+	// Create the topic subscription before receiving messages if it
+	// doesn't exist, with the given default message time to live and lock
+	// duration (Service Bus defaults apply when unset). The properties of
+	// existing subscriptions are left untouched. Only applies to topic
+	// subscriptions, and requires the "Manage" access right when SAS
+	// authentication is used.
+	CreateSubscription       bool          `envconfig:"SERVICEBUS_CREATE_SUBSCRIPTION" default:"false"`
+	SubscriptionDefaultTTL   time.Duration `envconfig:"SERVICEBUS_SUBSCRIPTION_DEFAULT_TTL" default:"0"`
+	SubscriptionLockDuration time.Duration `envconfig:"SERVICEBUS_SUBSCRIPTION_LOCK_DURATION" default:"0"`
+
+	// Delete the topic subscription when the adapter shuts down, for
+	// ephemeral consumers. The subscription is deleted even if it existed
+	// already, so that a subscription left behind by an adapter which
+	// didn't shut down gracefully (e.g. after a crash) doesn't leak. As a
+	// safeguard, subscriptions created by the adapter are also deleted by
+	// Service Bus once they have been idle for an hour. Requires
+	// SERVICEBUS_CREATE_SUBSCRIPTION.
+	DeleteSubscriptionOnShutdown bool `envconfig:"SERVICEBUS_DELETE_SUBSCRIPTION_ON_SHUTDOWN" default:"false"`
+
+	// Maximum size, in bytes, of the body of messages. Messages which
+	// exceed this size are dead-lettered instead of being sent to the sink.
+	// The default value leaves some headroom for CloudEvent attributes
+	// below the 1 MiB limit commonly enforced by HTTP sinks.
+	// A value of 0 disables the check.
+	MaxEventSize int `envconfig:"SERVICEBUS_MAX_EVENT_SIZE" default:"1000000"`
+
+	// Maximum duration of the handling of a single message, including its
+	// processing and the delivery of its events to the sink with retries.
+	// The processing of a message is not interrupted, but deliveries stop
+	// once the duration elapses. Messages which exceed this duration are
+	// abandoned, or dead-lettered after SERVICEBUS_MAX_DELIVERY_ATTEMPTS
+	// attempts, if set. A value of 0 disables the timeout.
+	MessageTimeout time.Duration `envconfig:"SERVICEBUS_MESSAGE_TIMEOUT" default:"0"`
+
+	// Duration during which the IDs of messages delivered to the sink are
+	// remembered. Messages which are redelivered by Service Bus within that
+	// duration, e.g. after the expiration of their lock, are completed
+	// without being sent to the sink again. Deduplication is best-effort,
+	// and scoped to a single replica of the adapter.
+	// A value of 0 disables deduplication.
+	DedupWindow time.Duration `envconfig:"SERVICEBUS_DEDUP_WINDOW" default:"0"`
+	// Maximum number of message IDs remembered for deduplication. The
+	// oldest IDs are forgotten first when this limit is reached.
+	DedupCacheSize int `envconfig:"SERVICEBUS_DEDUP_CACHE_SIZE" default:"10000"`
+
+	// Port on which the readiness endpoint of the adapter is served, at the
+	// "/health" URL path. The endpoint responds with 200 OK once the Service
+	// Bus entity was reached, and with 503 Service Unavailable before that
+	// or after an error occurred while receiving messages.
+	// A value of 0 disables the endpoint.
+	HealthPort uint16 `envconfig:"SERVICEBUS_HEALTH_PORT" default:"0"`
+
+	// Serve a JSON report of the current status of the adapter at the
+	// "/debug/status" URL path of the health port: number of in-flight
+	// messages, total number of processed messages, time and delivery lag
+	// of the last processed message, and last error. Intended for ad-hoc
+	// inspection during incident response. Requires
+	// SERVICEBUS_HEALTH_PORT.
+	DebugStatus bool `envconfig:"SERVICEBUS_DEBUG_STATUS" default:"false"`
+
+	// Serve the "/pause" and "/resume" URL paths on the health port, which
+	// respectively suspend and resume the reception of messages upon POST
+	// requests, e.g. during maintenance windows of the sink. Messages which
+	// were already received are still handled, and connections to Service
+	// Bus are kept open. The state is reported by the debug status
+	// endpoint. Requires SERVICEBUS_HEALTH_PORT.
+	PauseEndpoints bool `envconfig:"SERVICEBUS_PAUSE_ENDPOINTS" default:"false"`
+
+	// Source of the "id" attribute of CloudEvents.
+	//
+	// Supported values: [ message-id uuid sequence-number ]
+	//
+	// "message-id" uses the ID of messages, and falls back to a generated
+	// UUID for messages which don't have an ID. "uuid" always uses a
+	// generated UUID. "sequence-number" uses the path of the entity and
+	// the sequence number of messages, e.g. "myqueue/42", which remains the
+	// same across redeliveries of a message and restarts of the adapter.
+	CEIDSource string `envconfig:"SERVICEBUS_CE_ID_SOURCE" default:"message-id"`
+
+	// Source of the "time" attribute of CloudEvents.
+	//
+	// Supported values: [ enqueued-time now ]
+	//
+	// "enqueued-time" uses the time at which messages were enqueued in
+	// Service Bus, and falls back to the current time for messages which
+	// don't have an enqueued time. "now" uses the time at which messages
+	// are processed by the adapter.
+	CETimeSource string `envconfig:"SERVICEBUS_CE_TIME_SOURCE" default:"enqueued-time"`
+
+	// Source of the "subject" attribute of CloudEvents.
+	//
+	// Supported values: [ none message-subject entity-path ]
+	//
+	// "message-subject" uses the subject (label) of messages, and falls
+	// back to the path of the Service Bus entity for messages which don't
+	// have a subject. "entity-path" always uses the path of the entity,
+	// e.g. "mytopic/Subscriptions/mysub". "none" leaves the attribute
+	// unset.
+	CESubjectSource string `envconfig:"SERVICEBUS_CE_SUBJECT_SOURCE" default:"none"`
+
+	// JSONPath expression which selects the "subject" attribute of
+	// CloudEvents in the JSON body of messages (after
+	// SERVICEBUS_BODY_TRANSFORM), e.g. "$.order.id". Only member and array
+	// index accessors are supported. For messages whose body isn't JSON or
+	// doesn't contain the selected value, the subject is determined by
+	// SERVICEBUS_CE_SUBJECT_SOURCE, which leaves it unset by default. Only
+	// supported by the default message processor.
+	CESubjectFrom string `envconfig:"SERVICEBUS_CE_SUBJECT_FROM"`
+
+	// Absolute URI of the schema of the data of CloudEvents, set as the
+	// "dataschema" attribute, e.g. the URI of the schema in a registry.
+	// When empty, the attribute is left unset. Only supported by the
+	// default message processor.
+	CEDataSchema string `envconfig:"SERVICEBUS_CE_DATASCHEMA"`
+
+	// Media type set as the "datacontenttype" attribute of CloudEvents,
+	// e.g. "application/vnd.acme+json", in place of the content type
+	// derived from messages. The data of CloudEvents is left untouched.
+	// When empty, the content type of messages applies, and defaults to
+	// "application/json". Only supported by the default message processor.
+	CEDataContentType string `envconfig:"SERVICEBUS_CE_DATACONTENTTYPE"`
+
+	// Version of the CloudEvents specification which CloudEvents conform
+	// to, among the versions supported by the CloudEvents SDK ("1.0" and
+	// "0.3"), e.g. for consumers which only understand CloudEvents 0.3.
+	// Only supported by the default message processor.
+	CESpecVersion string `envconfig:"SERVICEBUS_CE_SPECVERSION" default:"1.0"`
+
+	// JSON object of CloudEvent extension attribute names to values, which
+	// are set on all CloudEvents sent by the adapter, e.g.
+	//   {"region": "westeurope", "environment": "production"}
+	CEOverrides string `envconfig:"SERVICEBUS_CE_OVERRIDES"`
+
+	// Maximum number of extension attributes of CloudEvents, beyond which
+	// SERVICEBUS_EXTENSION_OVERFLOW_POLICY applies, e.g. to stay below the
+	// number of headers tolerated by the sink in the binary content mode.
+	// Trace context attributes which are added upon sending are not
+	// counted. A value of 0 disables the limit.
+	MaxExtensions int `envconfig:"SERVICEBUS_MAX_EXTENSIONS" default:"0"`
+
+	// Policy which determines how CloudEvents which exceed
+	// SERVICEBUS_MAX_EXTENSIONS are handled.
+	//
+	// Supported values: [ structured drop fail ]
+	//
+	// "structured" sends these events in the structured content mode,
+	// which carries attributes in the body of requests instead of headers.
+	// "drop" removes extension attributes which carry application
+	// properties of messages, in reverse alphabetical order, until events
+	// no longer exceed the limit. Attributes set by the adapter, mapped
+	// with SERVICEBUS_PROPERTY_MAPPING or SERVICEBUS_ANNOTATIONS_AS_EXTENSIONS,
+	// or set with SERVICEBUS_CE_OVERRIDES are never dropped, and events
+	// which still exceed the limit are handled as with "fail".
+	// "fail" doesn't send these events, and dead-letters their message.
+	ExtensionOverflowPolicy string `envconfig:"SERVICEBUS_EXTENSION_OVERFLOW_POLICY" default:"structured"`
+
+	// Sets the "tmsource" extension attribute of CloudEvents to the
+	// Kubernetes identity of the source, in the format "namespace/name",
+	// so that consumers of a sink shared by multiple sources can tell
+	// which source produced each event. The identity is read from the
+	// NAMESPACE and K_NAME environment variables.
+	SourceIdentityExtension bool `envconfig:"SERVICEBUS_SOURCE_IDENTITY_EXTENSION" default:"true"`
+
+	// Sets the "sbazuresubscription" and "sbresourcegroup" extension
+	// attributes of CloudEvents to the Azure subscription ID and resource
+	// group of the Service Bus entity, so that consumers of events from
+	// multiple tenants can attribute them without parsing the "source"
+	// attribute.
+	AzureScopeExtensions bool `envconfig:"SERVICEBUS_AZURE_SCOPE_EXTENSIONS" default:"false"`
+
+	// Ordered list of names of sanitizers which are applied to CloudEvents
+	// that fail validation, e.g. because of quirks of the upstream
+	// producer. Set to an empty value to disable all sanitizers.
+	EventSanitizers []string `envconfig:"SERVICEBUS_EVENT_SANITIZERS" default:"invalid-dataschema,invalid-time,invalid-subject,missing-source"`
+
+	// Attach the body of messages, exactly as received from Service Bus,
+	// to CloudEvents in the base64-encoded "sbrawmessage" extension
+	// attribute. The copy is independent of any transformation applied to
+	// the data of CloudEvents, which makes it suitable for auditing.
+	// Doubles the size of events, roughly.
+	IncludeRawMessage bool `envconfig:"SERVICEBUS_INCLUDE_RAW_MESSAGE" default:"false"`
+
+	// Also attach the system and application properties of messages, in
+	// the base64-encoded JSON "sbrawproperties" extension attribute.
+	// Requires SERVICEBUS_INCLUDE_RAW_MESSAGE.
+	IncludeRawProperties bool `envconfig:"SERVICEBUS_INCLUDE_RAW_PROPERTIES" default:"false"`
+
+	// Reject CloudEvents that fail validation instead of repairing them
+	// with the event sanitizers, which are then ignored. Such events are
+	// not sent to the sink, and their message is settled the same way as
+	// when the sink rejects an event, i.e. dead-lettered with the detail
+	// of the validation error.
+	StrictValidation bool `envconfig:"SERVICEBUS_STRICT_VALIDATION" default:"false"`
+
+	// Encoding of the data of CloudEvents for messages which have a binary
+	// body, i.e. a body which isn't JSON and a ContentType which isn't set.
+	//
+	// Supported values: [ passthrough base64 ]
+	//
+	// "passthrough" sets the body as is, with the "application/octet-stream"
+	// content type. "base64" additionally causes the data to be encoded as
+	// "data_base64" when the CloudEvent is sent in structured mode. When
+	// unset, the body is embedded in the JSON representation of the message.
+	BinaryEncoding string `envconfig:"SERVICEBUS_BINARY_ENCODING"`
+
+	// Emit one CloudEvent per element of message bodies which are JSON
+	// arrays, instead of a single CloudEvent. Messages are only completed
+	// once all of their CloudEvents have been delivered, as per the
+	// completion policy. Only applies to the default message processor.
+	ExplodeJSONArray bool `envconfig:"SERVICEBUS_EXPLODE_JSON_ARRAY" default:"false"`
+
+	// Name of the tracer used to instrument the handling of messages.
+	//
+	// Supported values: [ log opentelemetry ]
+	//
+	// "log" only writes log entries. "opentelemetry" creates spans using
+	// the global OpenTelemetry TracerProvider, and propagates the trace
+	// context of Service Bus messages to the CloudEvents sent to the sink.
+	Tracer string `envconfig:"SERVICEBUS_TRACER" default:"log"`
+
 	// The environment variables below aren't read from the envConfig struct
 	// by the Service Bus SDK, but rather directly using os.Getenv().
 	// They are nevertheless listed here for documentation purposes.
@@ -91,6 +867,10 @@ type envConfig struct {
 	_ string `envconfig:"SERVICEBUS_KEY_NAME"`
 	_ string `envconfig:"SERVICEBUS_KEY_VALUE"`
 	_ string `envconfig:"SERVICEBUS_CONNECTION_STRING"`
+	_ string `envconfig:"SERVICEBUS_KEY_NAME_FILE"`
+	_ string `envconfig:"SERVICEBUS_KEY_VALUE_FILE"`
+	_ string `envconfig:"SERVICEBUS_CONNECTION_STRING_FILE"`
+	_ string `envconfig:"AZURE_ENVIRONMENT"`
 }
 
 // adapter implements the source's adapter.
@@ -98,13 +878,148 @@ type adapter struct {
 	logger *zap.SugaredLogger
 	mt     *pkgadapter.MetricTag
 
-	msgRcvr  *azservicebus.Receiver
+	msgRcvr  messageReceiver
 	ceClient cloudevents.Client
 
-	msgPrcsr      MessageProcessor
-	maxConcurrent int
+	// Additional receiver links, which receive messages from the same
+	// entity in parallel with msgRcvr.
+	extraRcvrs []messageReceiver
+
+	// Retry policy for the delivery of events to the sink.
+	sinkMaxRetries       int
+	sinkRetryBaseBackoff time.Duration
+	sinkRetryMaxBackoff  time.Duration
+	sinkTimeout          time.Duration
+
+	// Detects that the backlog of the Service Bus entity has been drained.
+	// Only set when drained events are enabled.
+	drainWatcher *drainWatcher
+
+	// Signals periods without any message received from the Service Bus
+	// entity. Only set when heartbeat events are enabled.
+	heartbeat *heartbeat
+
+	// Summarizes each batch of received messages in a single event.
+	// Only set when batch summary events are enabled.
+	batchSummary *batchSummary
+
+	// Paces the delivery of events to the sink.
+	// Only set when rate limiting is enabled.
+	sendLimiter *rate.Limiter
+
+	// Delivers events to the sink in batches.
+	// Only set when batching is enabled, in which case it is also used as
+	// ceClient.
+	batcher *batchingClient
+
+	// Accepts sessions on the Service Bus entity.
+	// Only set when the adapter consumes from a session-enabled entity.
+	acceptSession   sessionAcceptor
+	sessionID       string
+	maxSessions     int
+	sessionPrefetch int
+
+	receiveMaxRetries       int
+	receiveRetryBaseBackoff time.Duration
+	receiveRetryMaxBackoff  time.Duration
+
+	// Detects and replaces stalled receivers.
+	// Only set when an idle timeout is configured.
+	idleTimeout time.Duration
+	newReceiver func() (messageReceiver, clientCloser, error)
+
+	msgPrcsr         MessageProcessor
+	filter           *messageFilter
+	corrFilter       *correlationFilter
+	hopLimit         *hopLimit
+	ceOverrides      map[string]string
+	extLimit         *extensionLimit
+	srcIdentity      string
+	scopeExts        map[string]string
+	sanitizers       []EventSanitizer
+	strictValidation bool
+	includeRawMsg    bool
+	includeRawProps  bool
+	dedup            *dedupCache
+	ceSource         string
+	maxConcurrent    int
+	prefetchCount    int
+	ordering         *orderingChecker
+	barrier          *settlementBarrier
+
+	// secondary sink for messages which couldn't be handled, and the
+	// client used to reach it
+	deadLetterSink   string
+	deadLetterClient cloudevents.Client
+	// sink for messages which couldn't be converted to CloudEvents,
+	// reached using deadLetterClient
+	errorSink string
+
+	// deletes the topic subscription upon shutdown; only set when the
+	// subscription is ephemeral
+	deleteSubs func(context.Context) error
+
+	// settles messages; messages are settled through the receiver they
+	// were received from when unset
+	dispositioner dispositioner
+	// defers and batches the completion of messages; only set when
+	// batching is enabled, in which case it is also used as dispositioner
+	completions *completionBatcher
+	// counts the messages settled by the adapter, in order to summarize
+	// the outcome of the drain of in-flight messages upon shutdown
+	settlements *settlementCounter
+
+	maxDeliveryAttempts uint32
+	completionPolicy    string
+	deliverySemantics   string
+	autoRenewLock       bool
+	skipNotDue          bool
+	skipExpired         bool
+	maxEventSize        int
+	clock               *messageClock
+	messageTimeout      time.Duration
+
+	// Maps the results of failed deliveries of events to the disposition
+	// of messages. Only set when rules are configured.
+	resultDispositions *resultDispositions
+
+	// Paces the receipt of messages to keep a buffer of received messages
+	// filled. Only set when a prefetch refill threshold is set.
+	refill *refill
+
+	connectTimeout time.Duration
+	drainTimeout   time.Duration
+	healthPort     uint16
+	status         *statusTracker
+	pause          *pauseControl
+	trackReadiness bool
+	ready          atomic.Bool
+	validateOnly   bool
+	replaySeqNums  []int64
+
+	// Replays messages added to a list of sequence numbers.
+	// Only set when the list is watched.
+	replayWatcher *replayListWatcher
+
+	sr *metrics.EventProcessingStatsReporter
+}
+
+// messageReceiver receives and settles Service Bus messages.
+// It is implemented by both azservicebus.Receiver and
+// azservicebus.SessionReceiver.
+type messageReceiver interface {
+	ReceiveMessages(context.Context, int, *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error)
+	CompleteMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.CompleteMessageOptions) error
+	AbandonMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.AbandonMessageOptions) error
+	DeadLetterMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.DeadLetterOptions) error
+	DeferMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.DeferMessageOptions) error
 }
 
+var (
+	_ messageReceiver = (*azservicebus.Receiver)(nil)
+	_ messageReceiver = (*azservicebus.SessionReceiver)(nil)
+)
+
 // NewEnvConfig satisfies pkgadapter.EnvConfigConstructor.
 func NewEnvConfig() pkgadapter.EnvConfigAccessor {
 	return &envConfig{}
@@ -114,324 +1029,2183 @@ func NewEnvConfig() pkgadapter.EnvConfigAccessor {
 func NewAdapter(ctx context.Context, envAcc pkgadapter.EnvConfigAccessor, ceClient cloudevents.Client) pkgadapter.Adapter {
 	logger := logging.FromContext(ctx)
 
+	metrics.MustRegisterEventProcessingStatsView()
+	metrics.MustRegisterEventDeliveryLagStatsView()
+	metrics.MustRegisterNilMessageStatsView()
+	metrics.MustRegisterProcessorPanicStatsView()
+	metrics.MustRegisterLockRenewalStatsView()
+	metrics.MustRegisterMessageTimeoutStatsView()
+	metrics.MustRegisterEventLossStatsView()
+
+	env := envAcc.(*envConfig)
+
+	if env.LogLevel != "" || env.LogFormat != "" {
+		l, err := newLoggerWithOverrides(env, env.LogLevel, env.LogFormat)
+		if err != nil {
+			logger.Panicw("Invalid logging configuration", zap.Error(err))
+		}
+		logger = l
+		ctx = logging.WithLogger(ctx, logger)
+		logger.Infow("Overriding the logging configuration",
+			zap.String("level", env.LogLevel), zap.String("format", env.LogFormat))
+	}
+
+	if env.MaxConcurrent < 1 {
+		logger.Panic("The maximum number of concurrent message handlers must be at least 1, got ", env.MaxConcurrent)
+	}
+	if env.PrefetchCount < 1 {
+		logger.Panic("The prefetch count must be at least 1, got ", env.PrefetchCount)
+	}
+	if env.PrefetchRefillThreshold < 0 || env.PrefetchRefillThreshold >= 1 {
+		logger.Panic("The prefetch refill threshold must be between 0 and 1, got ", env.PrefetchRefillThreshold)
+	}
+	if env.PrefetchRefillThreshold > 0 && env.SessionEnabled {
+		logger.Panic("A prefetch refill threshold is not supported with sessions")
+	}
+	switch env.CEIDSource {
+	case ceIDSourceMessageID, ceIDSourceUUID, ceIDSourceSequenceNumber:
+	default:
+		logger.Panic("unsupported CloudEvent ID source " + strconv.Quote(env.CEIDSource))
+	}
+	if env.CETimeSource != ceTimeSourceEnqueuedTime && env.CETimeSource != ceTimeSourceNow {
+		logger.Panic("unsupported CloudEvent time source " + strconv.Quote(env.CETimeSource))
+	}
+	switch env.CESubjectSource {
+	case ceSubjectSourceNone, ceSubjectSourceMessageSubject, ceSubjectSourceEntityPath:
+	default:
+		logger.Panic("unsupported CloudEvent subject source " + strconv.Quote(env.CESubjectSource))
+	}
+	if env.CESubjectFrom != "" {
+		if _, err := parseJSONPath(env.CESubjectFrom); err != nil {
+			logger.Panicw("Invalid CloudEvent subject path", zap.Error(err))
+		}
+	}
+	if env.CEDataSchema != "" {
+		if u, err := url.Parse(env.CEDataSchema); err != nil || !u.IsAbs() {
+			logger.Panic("The CloudEvent data schema must be an absolute URI, got " + strconv.Quote(env.CEDataSchema))
+		}
+	}
+	if !isSupportedSpecVersion(env.CESpecVersion) {
+		logger.Panic("Unsupported CloudEvents spec version " + strconv.Quote(env.CESpecVersion) +
+			", expected one of " + strings.Join(supportedSpecVersions(), ", "))
+	}
+	if env.CEDataContentType != "" {
+		if _, _, err := mime.ParseMediaType(env.CEDataContentType); err != nil {
+			logger.Panic("The CloudEvent data content type must be a valid media type, got " +
+				strconv.Quote(env.CEDataContentType))
+		}
+	}
+	if !isSupportedBinaryEncoding(env.BinaryEncoding) {
+		logger.Panic("unsupported binary encoding " + strconv.Quote(env.BinaryEncoding))
+	}
+
+	if _, err := parsePropertyMapping(env.PropertyMapping); err != nil {
+		logger.Panicw("Invalid property mapping", zap.Error(err))
+	}
+	if _, err := parseAnnotationAllowlist(env.AnnotationsAsExtensions); err != nil {
+		logger.Panicw("Invalid list of annotations", zap.Error(err))
+	}
+
+	var ceOverrides map[string]string
+	if env.CEOverrides != "" {
+		var err error
+		if ceOverrides, err = parseCEOverrides(env.CEOverrides); err != nil {
+			logger.Panicw("Invalid CloudEvent overrides", zap.Error(err))
+		}
+	}
+	if !isSupportedCompletionPolicy(env.CompletionPolicy) {
+		logger.Panic("unsupported completion policy " + strconv.Quote(env.CompletionPolicy))
+	}
+	if !isSupportedDeliverySemantics(env.DeliverySemantics) {
+		logger.Panic("unsupported delivery semantics " + strconv.Quote(env.DeliverySemantics))
+	}
+	if env.DeliverySemantics == deliverySemanticsAtMostOnce && env.OrderedCompletion {
+		logger.Panic("Completions can not be ordered when events are delivered at most once")
+	}
+	if env.DeliverySemantics == deliverySemanticsAtMostOnce && env.CompleteBatchSize > 1 {
+		logger.Panic("Completions can not be batched when events are delivered at most once")
+	}
+	if env.SinkMaxRetries < 0 {
+		logger.Panic("The maximum number of sink retries can not be negative, got ", env.SinkMaxRetries)
+	}
+	if env.SinkRetryBaseBackoff <= 0 || env.SinkRetryMaxBackoff < env.SinkRetryBaseBackoff {
+		logger.Panicf("Invalid sink retry backoff bounds: base %s, max %s", env.SinkRetryBaseBackoff, env.SinkRetryMaxBackoff)
+	}
+	if env.SinkTimeout < 0 {
+		logger.Panic("The sink timeout can not be negative, got ", env.SinkTimeout)
+	}
+	if env.SendRateLimit < 0 {
+		logger.Panic("The send rate limit can not be negative, got ", env.SendRateLimit)
+	}
+	if env.SendRateLimit > 0 && env.SendRateBurst < 1 {
+		logger.Panic("The send rate burst must be at least 1, got ", env.SendRateBurst)
+	}
+	if env.ReceiveMaxRetries < 0 {
+		logger.Panic("The maximum number of receive retries can not be negative, got ", env.ReceiveMaxRetries)
+	}
+	if env.MaxEventSize < 0 {
+		logger.Panic("The maximum event size can not be negative, got ", env.MaxEventSize)
+	}
+	if env.MessageTimeout < 0 {
+		logger.Panic("The message timeout can not be negative, got ", env.MessageTimeout)
+	}
+	if env.DedupWindow < 0 {
+		logger.Panic("The deduplication window can not be negative, got ", env.DedupWindow)
+	}
+	if env.DedupWindow > 0 && env.DedupCacheSize < 1 {
+		logger.Panic("The deduplication cache size must be at least 1, got ", env.DedupCacheSize)
+	}
+	if env.IncludeRawProperties && !env.IncludeRawMessage {
+		logger.Panic("Including the raw properties of messages requires the raw message to be included")
+	}
+	if env.IdleTimeout < 0 {
+		logger.Panic("The idle timeout can not be negative, got ", env.IdleTimeout)
+	}
+	if env.DrainTimeout < 0 {
+		logger.Panic("The drain timeout can not be negative, got ", env.DrainTimeout)
+	}
+	if env.ShutdownGracePeriod < 0 {
+		logger.Panic("The shutdown grace period can not be negative, got ", env.ShutdownGracePeriod)
+	}
+	if env.DrainedEventInterval < 0 {
+		logger.Panic("The drained event interval can not be negative, got ", env.DrainedEventInterval)
+	}
+	if env.HeartbeatInterval < 0 {
+		logger.Panic("The heartbeat interval can not be negative, got ", env.HeartbeatInterval)
+	}
+	if env.ClockSkew < 0 {
+		logger.Panic("The clock skew can not be negative, got ", env.ClockSkew)
+	}
+	if !isSupportedBatchSummaryMode(env.BatchSummary) {
+		logger.Panic("unsupported batch summary mode " + strconv.Quote(env.BatchSummary))
+	}
+	if env.BatchSummary != batchSummaryNone && env.SessionEnabled {
+		logger.Panic("Batch summary events are not supported with sessions")
+	}
+	if env.DebugStatus && env.HealthPort == 0 {
+		logger.Panic("The debug status endpoint requires the health port to be set")
+	}
+	if env.PauseEndpoints && env.HealthPort == 0 {
+		logger.Panic("The pause endpoints require the health port to be set")
+	}
+	if env.SinkBatchSize < 1 {
+		logger.Panic("The sink batch size must be at least 1, got ", env.SinkBatchSize)
+	}
+	if env.CompleteBatchSize < 1 {
+		logger.Panic("The completion batch size must be at least 1, got ", env.CompleteBatchSize)
+	}
+	if env.CompleteBatchSize > 1 && env.CompleteFlushInterval <= 0 {
+		logger.Panic("The completion flush interval must be positive, got ", env.CompleteFlushInterval)
+	}
+	if env.CompleteBatchSize > 1 && env.SessionEnabled {
+		logger.Panic("Completions can not be batched when sessions are enabled")
+	}
+	if env.CompleteBatchSize > 1 && env.OrderedCompletion {
+		logger.Panic("Completions can not be batched when they are ordered")
+	}
+	if env.ProxyURL != "" {
+		if _, err := url.Parse(env.ProxyURL); err != nil {
+			logger.Panicw("Invalid proxy URL "+strconv.Quote(env.ProxyURL), zap.Error(err))
+		}
+		if !env.WebSocketsEnable && !env.UseWebSockets {
+			logger.Panic("A proxy can only be used when AMQP over WebSockets is enabled")
+		}
+	}
+	if env.ConnectTimeout < 0 {
+		logger.Panic("The connect timeout can not be negative, got ", env.ConnectTimeout)
+	}
+	if env.TCPKeepAlive != 0 && !env.WebSocketsEnable && !env.UseWebSockets {
+		logger.Panic("The TCP keep-alive interval can only be set when AMQP over WebSockets is enabled")
+	}
+
+	// All entity IDs are parsed upfront, so that the adapter fails fast
+	// if any of them is malformed.
+	entityIDStrs := splitEntityResourceIDs(env.EntityResourceID)
+
+	entityIDs := make([]*v1alpha1.AzureResourceID, len(entityIDStrs))
+	for i, idStr := range entityIDStrs {
+		entityID, err := azureservicebus.ParseResourceID(idStr)
+		if err != nil {
+			logger.Panicw("Unable to parse entity ID "+strconv.Quote(idStr), zap.Error(err))
+		}
+		entityIDs[i] = entityID
+	}
+
+	var namespaceID *v1alpha1.AzureResourceID
+	if env.DiscoverQueues {
+		if len(entityIDs) != 0 {
+			logger.Panic("Entity IDs can not be set when queues are discovered")
+		}
+		var err error
+		if namespaceID, err = azureservicebus.ParseNamespaceResourceID(env.NamespaceResourceID); err != nil {
+			logger.Panicw("Unable to parse namespace ID "+strconv.Quote(env.NamespaceResourceID), zap.Error(err))
+		}
+		if env.DiscoveryInterval <= 0 {
+			logger.Panic("The discovery interval must be positive, got ", env.DiscoveryInterval)
+		}
+		if env.SubscriptionFilterSQL != "" {
+			logger.Panic("A subscription filter can not be set when queues are discovered")
+		}
+		if env.CreateSubscription {
+			logger.Panic("Subscriptions can not be created when queues are discovered")
+		}
+		if env.ValidateOnly {
+			logger.Panic("Queues can not be discovered in validate-only mode")
+		}
+	}
+
+	if len(entityIDs) == 0 && !env.DiscoverQueues {
+		entityID, entityURL, err := entityFromConnectionString()
+		if err != nil {
+			logger.Panicw("Either "+envEntityResourceID+" or a connection string which contains an EntityPath "+
+				"must be set", zap.Error(err))
+		}
+		logger.Info("Deriving the Service Bus entity from the EntityPath of the connection string, since " +
+			envEntityResourceID + " isn't set")
+
+		entityIDStrs = []string{entityURL}
+		entityIDs = []*v1alpha1.AzureResourceID{entityID}
+	}
+
+	for i, entityID := range entityIDs {
+		if env.SubscriptionFilterSQL != "" && entityID.SubResourceName == "" {
+			logger.Panic("A subscription filter can only be set on topic subscriptions, got entity ID " +
+				strconv.Quote(entityIDStrs[i]))
+		}
+		if env.CreateSubscription && entityID.SubResourceName == "" {
+			logger.Panic("Only topic subscriptions can be created, got entity ID " + strconv.Quote(entityIDStrs[i]))
+		}
+	}
+	if env.DeleteSubscriptionOnShutdown && !env.CreateSubscription {
+		logger.Panic("Deleting the subscription on shutdown requires the subscription to be created by the adapter")
+	}
+	if env.SubscriptionDefaultTTL < 0 || env.SubscriptionLockDuration < 0 {
+		logger.Panicf("The properties of the subscription can not be negative, got default TTL %s and lock duration %s",
+			env.SubscriptionDefaultTTL, env.SubscriptionLockDuration)
+	}
+
+	if !isSupportedOrderingCheck(env.OrderingCheck) {
+		logger.Panic("unsupported ordering check " + strconv.Quote(env.OrderingCheck))
+	}
+	if env.OrderingCheck != "" {
+		if env.MaxConcurrent != 1 {
+			logger.Panic("The order of messages can only be verified when they are handled by a single goroutine, got ",
+				env.MaxConcurrent)
+		}
+		if env.SessionEnabled {
+			logger.Panic("The order of messages can not be verified when sessions are enabled")
+		}
+	}
+
+	if env.ReceiverLinks < 1 {
+		logger.Panic("The number of receiver links must be at least 1, got ", env.ReceiverLinks)
+	}
+	if env.ReceiverLinks > 1 {
+		if env.SessionEnabled {
+			logger.Panic("Multiple receiver links are not supported with sessions")
+		}
+		if env.OrderingCheck != "" {
+			logger.Panic("The order of messages can not be verified when they are received on multiple links")
+		}
+		if env.OrderedCompletion {
+			logger.Panic("Messages can not be completed in order when they are received on multiple links")
+		}
+	}
+
+	if env.SessionID != "" && !env.SessionEnabled {
+		logger.Panic("A session ID can only be set when sessions are enabled")
+	}
+	if env.MaxConcurrentSessions < 1 {
+		logger.Panic("The maximum number of concurrent sessions must be at least 1, got ", env.MaxConcurrentSessions)
+	}
+	if env.SessionID != "" && env.MaxConcurrentSessions > 1 {
+		logger.Panic("Only one session can be consumed at a time when a session ID is set")
+	}
+	if env.SessionPrefetch < 0 {
+		logger.Panic("The session prefetch count can not be negative, got ", env.SessionPrefetch)
+	}
+	if (env.ConsumeDeadLetterQueue || env.ConsumeTransferDeadLetterQueue) && env.SessionEnabled {
+		logger.Panic("Sessions are not supported on dead-letter queues")
+	}
+	if env.ConsumeDeadLetterQueue && env.ConsumeTransferDeadLetterQueue {
+		logger.Panic("Messages can be consumed from either the dead-letter queue or the transfer dead-letter queue, not both")
+	}
+
+	var replayWatcher *replayListWatcher
+	if env.ReplayWatchFile != "" {
+		if env.SessionEnabled {
+			logger.Panic("Messages can not be replayed from session-enabled entities")
+		}
+		if len(entityIDs) > 1 || env.DiscoverQueues {
+			logger.Panic("Messages can only be replayed from a single entity")
+		}
+		var err error
+		if replayWatcher, err = newReplayListWatcher(env.ReplayWatchFile); err != nil {
+			logger.Panicw("Unable to watch the replay list", zap.Error(err))
+		}
+	}
+
+	if ceOverrideSource := env.CEOverrideSource; ceOverrideSource != "" {
+		if _, err := url.Parse(ceOverrideSource); err != nil {
+			logger.Panicw("The CloudEvents source override "+strconv.Quote(ceOverrideSource)+
+				" is not a valid URI-reference", zap.Error(err))
+		}
+	}
+
+	if _, ok := msgPrcsrs.lookup(env.MessageProcessor); !ok {
+		logger.Panic("unsupported message processor " + strconv.Quote(env.MessageProcessor) +
+			", expected one of " + strings.Join(msgPrcsrs.names(), ", "))
+	}
+	if env.MessageProcessor != msgPrcsrDefault {
+		if opts := defaultProcessorOptions(env); len(opts) != 0 {
+			logger.Panic("The options " + strings.Join(opts, ", ") + " are only supported by the " +
+				strconv.Quote(msgPrcsrDefault) + " message processor, got " + strconv.Quote(env.MessageProcessor))
+		}
+	}
+
+	enabledSanitizers := make([]EventSanitizer, 0, len(env.EventSanitizers))
+	for _, name := range env.EventSanitizers {
+		s, ok := sanitizers.lookup(strings.TrimSpace(name))
+		if !ok {
+			logger.Panic("unsupported event sanitizer " + strconv.Quote(name) +
+				", expected one of " + strings.Join(sanitizers.names(), ", "))
+		}
+		enabledSanitizers = append(enabledSanitizers, s)
+	}
+
+	// The default "NoOpTracer" tab.Tracer implementation does not produce
+	// any log message. We register a custom implementation so that event
+	// handling errors are, at a minimum, logged via Knative's logging
+	// facilities.
+	tracer, ok := newTracer(env.Tracer, logger)
+	if !ok {
+		logger.Panic("unsupported tracer " + strconv.Quote(env.Tracer))
+	}
+	tab.Register(tracer)
+
+	var filter *messageFilter
+	if env.FilterExpression != "" {
+		var err error
+		if filter, err = newMessageFilter(env.FilterExpression); err != nil {
+			logger.Panicw("Invalid message filter "+strconv.Quote(env.FilterExpression), zap.Error(err))
+		}
+	}
+	var corrFilter *correlationFilter
+	if env.CorrelationFilter != "" {
+		var err error
+		if corrFilter, err = newCorrelationFilter(env.CorrelationFilter); err != nil {
+			logger.Panicw("Invalid correlation filter "+strconv.Quote(env.CorrelationFilter), zap.Error(err))
+		}
+	}
+	resultDispositions, err := parseResultDispositions(env.ResultDispositions)
+	if err != nil {
+		logger.Panicw("Invalid result disposition rules "+strconv.Quote(env.ResultDispositions), zap.Error(err))
+	}
+	var extLimit *extensionLimit
+	if env.MaxExtensions > 0 {
+		propMapping, _ := parsePropertyMapping(env.PropertyMapping)                // validated in NewAdapter
+		annotationExts, _ := parseAnnotationAllowlist(env.AnnotationsAsExtensions) // validated in NewAdapter
+
+		var configured []string
+		for _, names := range []map[string]string{propMapping, annotationExts} {
+			for _, n := range names {
+				configured = append(configured, n)
+			}
+		}
+		for n := range ceOverrides {
+			configured = append(configured, n)
+		}
+
+		extLimit = newExtensionLimit(env.MaxExtensions, env.ExtensionOverflowPolicy, configured...)
+	}
+	if env.BodyTransform != "" {
+		if _, err := newBodyTransform(env.BodyTransform); err != nil {
+			logger.Panicw("Invalid body transformation "+strconv.Quote(env.BodyTransform), zap.Error(err))
+		}
+	}
+	if env.PartitionKeyFrom != "" {
+		if _, err := newPartitionKeyExtractor(env.PartitionKeyFrom, env.PartitionKeyExpression); err != nil {
+			logger.Panicw("Invalid partition key configuration", zap.Error(err))
+		}
+	}
+
+	if env.HopLimit != 0 {
+		if _, err := newHopLimit("", env.HopLimit, env.HopLimitAction); err != nil {
+			logger.Panicw("Invalid hop limit configuration", zap.Error(err))
+		}
+	}
+
+	if env.SinkMode != sinkModeSend && env.SinkMode != sinkModeDiscard {
+		logger.Panic("unsupported sink mode " + strconv.Quote(env.SinkMode))
+	}
+	if env.CEEncoding != ceEncodingBinary && env.CEEncoding != ceEncodingStructured {
+		logger.Panic("unsupported CloudEvent encoding " + strconv.Quote(env.CEEncoding))
+	}
+	if env.MaxExtensions < 0 {
+		logger.Panic("The maximum number of extension attributes can not be negative, got ", env.MaxExtensions)
+	}
+	if !isSupportedExtensionOverflowPolicy(env.ExtensionOverflowPolicy) {
+		logger.Panic("unsupported extension overflow policy " + strconv.Quote(env.ExtensionOverflowPolicy))
+	}
+
+	if env.DeadLetterSink != "" {
+		if u, err := url.Parse(env.DeadLetterSink); err != nil || !u.IsAbs() {
+			logger.Panic("The dead-letter sink must be an absolute URL, got " + strconv.Quote(env.DeadLetterSink))
+		}
+	}
+
+	if env.ErrorSink != "" {
+		if u, err := url.Parse(env.ErrorSink); err != nil || !u.IsAbs() {
+			logger.Panic("The error sink must be an absolute URL, got " + strconv.Quote(env.ErrorSink))
+		}
+	}
+
+	if env.SinkFollowRedirects {
+		if env.Sink == "" {
+			logger.Panic("Following redirects requires the URL of the sink to be set")
+		}
+		if env.SinkBatchSize > 1 {
+			logger.Panic("Redirects can not be followed when events are batched")
+		}
+		sinkURL, err := url.Parse(env.Sink)
+		if err != nil {
+			logger.Panicw("Invalid sink URL", zap.Error(err))
+		}
+		sinkOverrides, err := envAcc.GetCloudEventOverrides()
+		if err != nil {
+			logger.Panicw("Invalid CloudEvent overrides", zap.Error(err))
+		}
+		sinkTimeout := time.Duration(envAcc.GetSinktimeout()) * time.Second
+		if ceClient, err = newRedirectingClient(logger, sinkURL, sinkOverrides, sinkTimeout); err != nil {
+			logger.Panicw("Unable to create CloudEvents client which follows redirects", zap.Error(err))
+		}
+	}
+
+	if env.CEEncoding == ceEncodingStructured {
+		ceClient = &structuredClient{Client: ceClient}
+	}
+
+	// Events are forwarded to the dead-letter and error sinks individually,
+	// so the client is captured before it gets wrapped for batching.
+	deadLetterClient := ceClient
+
+	if len(env.ExtraSinks) != 0 || len(env.ExtraSinksBestEffort) != 0 {
+		if env.SinkBatchSize > 1 {
+			logger.Panic("Events can not be sent to extra sinks when they are batched")
+		}
+
+		sinks := make([]extraSink, 0, len(env.ExtraSinks)+len(env.ExtraSinksBestEffort))
+		for _, s := range env.ExtraSinks {
+			sinks = append(sinks, extraSink{url: s})
+		}
+		for _, s := range env.ExtraSinksBestEffort {
+			sinks = append(sinks, extraSink{url: s, bestEffort: true})
+		}
+		for _, s := range sinks {
+			if u, err := url.Parse(s.url); err != nil || !u.IsAbs() {
+				logger.Panic("Extra sinks must be absolute URLs, got " + strconv.Quote(s.url))
+			}
+		}
+
+		ceClient = &fanOutClient{Client: ceClient, logger: logger, sinks: sinks}
+	}
+
+	if env.SinkMode == sinkModeDiscard {
+		if env.SinkBatchSize > 1 {
+			logger.Panic("Events can not be batched when they are discarded")
+		}
+		logger.Warn("Events are discarded instead of being sent to the sink")
+		ceClient = &discardingClient{Client: ceClient}
+	}
+
+	var batcher *batchingClient
+	if env.SinkBatchSize > 1 {
+		if env.Sink == "" {
+			logger.Panic("Batching events requires the URL of the sink to be set")
+		}
+		batchTimeout := env.SinkTimeout
+		if batchTimeout == 0 {
+			batchTimeout = time.Duration(envAcc.GetSinktimeout()) * time.Second
+		}
+		batcher = newBatchingClient(ceClient, logger, env.Sink, env.SinkBatchSize, env.SinkBatchFlushInterval,
+			batchTimeout)
+		ceClient = batcher
+	}
+
+	var sendLimiter *rate.Limiter
+	if env.SendRateLimit > 0 {
+		sendLimiter = rate.NewLimiter(rate.Limit(env.SendRateLimit), env.SendRateBurst)
+	}
+
+	var srcIdentity string
+	if env.SourceIdentityExtension {
+		srcIdentity = sourceIdentity(env.GetNamespace(), env.GetName())
+	}
+
+	// Shared by all adapters, so that the status aggregates all entities.
+	var status *statusTracker
+	if env.DebugStatus {
+		status = &statusTracker{}
+	}
+	var pause *pauseControl
+	if env.PauseEndpoints {
+		pause = newPauseControl(logger)
+		if status != nil {
+			status.pause = pause
+		}
+	}
+
+	newAdapter := func(ctx context.Context, entityIDStr string, entityID *v1alpha1.AzureResourceID) *adapter {
+		a := newEntityAdapter(ctx, env, entityIDStr, entityID, ceClient)
+		a.filter = filter
+		a.corrFilter = corrFilter
+		a.ceOverrides = ceOverrides
+		a.extLimit = extLimit
+		a.resultDispositions = resultDispositions
+		a.srcIdentity = srcIdentity
+		a.sendLimiter = sendLimiter
+		a.sanitizers = enabledSanitizers
+		a.deadLetterSink = env.DeadLetterSink
+		a.deadLetterClient = deadLetterClient
+		a.errorSink = env.ErrorSink
+		a.status = status
+		a.pause = pause
+		return a
+	}
+
+	if env.DiscoverQueues {
+		adminClient, err := azureservicebus.AdminClientFromEnvironment(namespaceID, nil)
+		if err != nil {
+			logger.Panicw("Unable to obtain administration client for Service Bus Namespace", zap.Error(err))
+		}
+
+		logger.Warnw("Discovering the queues of the Service Bus namespace",
+			zap.String("namespace", namespaceID.Namespace),
+			zap.Duration("discoveryInterval", env.DiscoveryInterval))
+
+		return &discoveryAdapter{
+			logger:     logger,
+			listQueues: adminQueueLister(adminClient),
+			newAdapter: func(ctx context.Context, queue string) *adapter {
+				queueID := queueResourceID(namespaceID, queue)
+				// The context of Start carries the logger of the
+				// Knative adapter, which ignores the log overrides.
+				return newAdapter(logging.WithLogger(ctx, logger), queueID.String(), queueID)
+			},
+			interval:   env.DiscoveryInterval,
+			running:    make(map[string]*runningAdapter),
+			batcher:    batcher,
+			healthPort: env.HealthPort,
+			status:     status,
+			pause:      pause,
+		}
+	}
+
+	adapters := make([]*adapter, len(entityIDs))
+	for i, entityID := range entityIDs {
+		adapters[i] = newAdapter(ctx, entityIDStrs[i], entityID)
+	}
+
+	if len(adapters) == 1 {
+		a := adapters[0]
+		a.batcher = batcher
+		a.healthPort = env.HealthPort
+		a.replayWatcher = replayWatcher
+		return a
+	}
+
+	return &multiAdapter{
+		logger:     logger,
+		adapters:   adapters,
+		batcher:    batcher,
+		healthPort: env.HealthPort,
+		status:     status,
+		pause:      pause,
+	}
+}
+
+// newEntityAdapter returns an adapter which receives messages from the given
+// Service Bus entity.
+func newEntityAdapter(ctx context.Context, env *envConfig, entityIDStr string, entityID *v1alpha1.AzureResourceID,
+	ceClient cloudevents.Client) *adapter {
+
+	logger := logging.FromContext(ctx)
+
 	mt := &pkgadapter.MetricTag{
-		Namespace: envAcc.GetNamespace(),
-		Name:      envAcc.GetName(),
+		Namespace: env.GetNamespace(),
+		Name:      env.GetName(),
+	}
+
+	var proxyURL *url.URL
+	if env.ProxyURL != "" {
+		// validated in NewAdapter
+		proxyURL, _ = url.Parse(env.ProxyURL)
+	}
+
+	clientOpts := newAzureServiceBusClientOptions(
+		webSocketsClientOption(env.WebSocketsEnable || env.UseWebSockets, proxyURL, env.TCPKeepAlive),
+		connectTimeoutClientOption(env.ConnectTimeout),
+	)
+	client, err := azureservicebus.ClientFromEnvironment(entityID, clientOpts)
+	if err != nil {
+		logger.Panicw("Unable to obtain interface for Service Bus Namespace", zap.Error(err))
+	}
+
+	switch entityID.ResourceType {
+	case azureservicebus.ResourceTypeQueues:
+		mt.ResourceGroup = sources.AzureServiceBusQueueSourceResource.String()
+	case azureservicebus.ResourceTypeSubscriptions, azureservicebus.ResourceTypeTopics:
+		mt.ResourceGroup = sources.AzureServiceBusTopicSourceResource.String()
+	}
+
+	// Subscriptions aren't created in validate-only mode, which must not
+	// have side effects. Their absence is reported by the validation.
+	var deleteSubscription func(context.Context) error
+	if env.CreateSubscription && !env.ValidateOnly {
+		adminClient, err := azureservicebus.AdminClientFromEnvironment(entityID, nil)
+		if err != nil {
+			logger.Panicw("Unable to obtain admin interface for Service Bus Namespace", zap.Error(err))
+		}
+		props := &admin.SubscriptionProperties{
+			DefaultMessageTimeToLive: iso8601Duration(env.SubscriptionDefaultTTL),
+			LockDuration:             iso8601Duration(env.SubscriptionLockDuration),
+		}
+		if env.DeleteSubscriptionOnShutdown {
+			props.AutoDeleteOnIdle = iso8601Duration(ephemeralSubscriptionIdleTimeout)
+		}
+		if _, err := ensureSubscription(ctx, logger, adminClient, entityID, props); err != nil {
+			logger.Panicw("Unable to ensure the existence of Service Bus subscription "+
+				strconv.Quote(azureservicebus.EntityPath(entityID)), zap.Error(err))
+		}
+		if env.DeleteSubscriptionOnShutdown {
+			deleteSubscription = subscriptionDeleter(adminClient, entityID)
+		}
+	}
+
+	if env.SubscriptionFilterSQL != "" {
+		adminClient, err := azureservicebus.AdminClientFromEnvironment(entityID, nil)
+		if err != nil {
+			logger.Panicw("Unable to obtain admin interface for Service Bus Namespace", zap.Error(err))
+		}
+		if err := ensureSubscriptionFilter(ctx, logger, adminClient, entityID, env.SubscriptionFilterSQL); err != nil {
+			logger.Panicw("Unable to ensure the filter of Service Bus subscription "+
+				strconv.Quote(azureservicebus.EntityPath(entityID)), zap.Error(err))
+		}
+	}
+
+	entityPath := azureservicebus.EntityPath(entityID)
+
+	var rcvrOpts *azservicebus.ReceiverOptions
+	switch subQueue := receiverSubQueue(env); subQueue {
+	case azservicebus.SubQueueDeadLetter:
+		entityPath = azureservicebus.DeadLetterQueuePath(entityPath)
+		rcvrOpts = &azservicebus.ReceiverOptions{SubQueue: subQueue}
+	case azservicebus.SubQueueTransfer:
+		entityPath = azureservicebus.TransferDeadLetterQueuePath(entityPath)
+		rcvrOpts = &azservicebus.ReceiverOptions{SubQueue: subQueue}
+	}
+
+	var rcvr messageReceiver
+	var extraRcvrs []messageReceiver
+	var acceptSession sessionAcceptor
+
+	if env.SessionEnabled {
+		acceptSession = newSessionAcceptor(client, entityID, env.SessionID)
+		if err := wrapPermissionError(probeSessionEntity(ctx, acceptSession)); err != nil {
+			if hint := missingPermissionHint(err, entityID.ResourceType, azureservicebus.AuthMethodFromEnvironment()); hint != "" {
+				logger.Panicw("Insufficient permissions on Service Bus entity "+strconv.Quote(entityPath)+". "+hint, zap.Error(err))
+			}
+			logger.Panicw("Unable to accept a session on Service Bus entity "+strconv.Quote(entityPath)+
+				". Ensure that sessions are enabled on this entity", zap.Error(err))
+		}
+	} else {
+		// Each receiver opens its own AMQP link to the entity.
+		for i := 0; i < env.ReceiverLinks; i++ {
+			r, err := newEntityReceiver(client, entityID, rcvrOpts)
+			if err != nil {
+				logger.Panicw("Unable to obtain message receiver for Service Bus entity "+strconv.Quote(entityPath), zap.Error(err))
+			}
+
+			if i == 0 {
+				rcvr = r
+			} else {
+				extraRcvrs = append(extraRcvrs, r)
+			}
+		}
+	}
+
+	ceSource := entityIDStr
+	var resourceIDExt string
+	if env.CEOverrideSource != "" {
+		ceSource = env.CEOverrideSource
+		resourceIDExt = entityIDStr
+	}
+
+	sessionPrefetch := env.SessionPrefetch
+	if sessionPrefetch == 0 {
+		sessionPrefetch = env.PrefetchCount
+	}
+
+	logger = logger.With(zap.String(logfieldEntity, entityPath))
+
+	// Secrets such as keys and connection strings must never be logged.
+	logger.Infow("Loaded adapter configuration",
+		zap.String("namespace", entityID.Namespace),
+		zap.String("resourceType", entityID.ResourceType),
+		zap.String("authMethod", azureservicebus.AuthMethodFromEnvironment()),
+		zap.String("messageProcessor", env.MessageProcessor),
+		zap.String("receiveMode", receiveMode(env)),
+		zap.String("ceSource", ceSource),
+		zap.String("ceTimeSource", env.CETimeSource),
+		zap.String("ceSubjectSource", env.CESubjectSource),
+		zap.String("ceSubjectFrom", env.CESubjectFrom),
+		zap.String("ceDataSchema", env.CEDataSchema),
+		zap.String("ceDataContentType", env.CEDataContentType),
+		zap.String("ceSpecVersion", env.CESpecVersion),
+		zap.Int("maxConcurrent", env.MaxConcurrent),
+		zap.Bool("orderedCompletion", env.OrderedCompletion),
+		zap.Int("completeBatchSize", env.CompleteBatchSize),
+		zap.String("deliverySemantics", env.DeliverySemantics),
+		zap.String("resultDispositions", env.ResultDispositions),
+		zap.Int("prefetchCount", env.PrefetchCount),
+		zap.Float64("prefetchRefillThreshold", env.PrefetchRefillThreshold),
+		zap.Int("receiverLinks", env.ReceiverLinks),
+		zap.Duration("idleTimeout", env.IdleTimeout),
+		zap.Bool("webSockets", env.WebSocketsEnable || env.UseWebSockets),
+		zap.Bool("proxy", env.ProxyURL != ""),
+		zap.Duration("connectTimeout", env.ConnectTimeout),
+		zap.Duration("tcpKeepAlive", env.TCPKeepAlive),
+		zap.String("sinkMode", env.SinkMode),
+		zap.String("ceEncoding", env.CEEncoding),
+		zap.Int("maxExtensions", env.MaxExtensions),
+		zap.String("extensionOverflowPolicy", env.ExtensionOverflowPolicy),
+		zap.Bool("sinkFollowRedirects", env.SinkFollowRedirects),
+		zap.Bool("deadLetterSink", env.DeadLetterSink != ""),
+		zap.Bool("errorSink", env.ErrorSink != ""),
+		zap.Int("extraSinks", len(env.ExtraSinks)+len(env.ExtraSinksBestEffort)),
+		zap.Strings("eventSanitizers", env.EventSanitizers),
+		zap.Bool("strictValidation", env.StrictValidation),
+		zap.Bool("createSubscription", env.CreateSubscription),
+		zap.Bool("ephemeralSubscription", deleteSubscription != nil),
+		zap.Bool("includeRawMessage", env.IncludeRawMessage),
+		zap.Duration("dedupWindow", env.DedupWindow),
+		zap.Bool("skipExpired", env.SkipExpired),
+		zap.Duration("clockSkew", env.ClockSkew),
+		zap.Bool("explodeJSONArray", env.ExplodeJSONArray),
+		zap.Bool("bodyTransform", env.BodyTransform != ""),
+		zap.String("partitionKeyFrom", env.PartitionKeyFrom),
+		zap.Int("hopLimit", env.HopLimit),
+		zap.Duration("drainTimeout", drainTimeout(env)),
+		zap.Duration("drainedEventInterval", env.DrainedEventInterval),
+		zap.Duration("heartbeatInterval", env.HeartbeatInterval),
+		zap.String("batchSummary", env.BatchSummary),
+		zap.Bool("sourceIdentityExtension", env.SourceIdentityExtension),
+		zap.Bool("azureScopeExtensions", env.AzureScopeExtensions),
+		zap.Duration("sinkTimeout", env.SinkTimeout),
+		zap.Float64("sendRateLimit", env.SendRateLimit),
+	)
+
+	newMsgPrcsr, _ := msgPrcsrs.lookup(env.MessageProcessor) // validated in NewAdapter
+	msgPrcsr := newMsgPrcsr(ceSource)
+
+	clock := newMessageClock(env.ClockSkew)
+
+	// The default processor supports additional options.
+	if p, ok := msgPrcsr.(*defaultMessageProcessor); ok {
+		p.resourceIDExt = resourceIDExt
+		p.subQueueExt = subQueueName(receiverSubQueue(env))
+		p.ceTypePrefix = env.CETypePrefix
+		p.propsAsExtensions = env.UserPropertiesAsExtensions
+		p.propMapping, _ = parsePropertyMapping(env.PropertyMapping)                // validated in NewAdapter
+		p.annotationExts, _ = parseAnnotationAllowlist(env.AnnotationsAsExtensions) // validated in NewAdapter
+		p.ceIDSource = env.CEIDSource
+		p.binaryEncoding = env.BinaryEncoding
+		p.ceTimeSource = env.CETimeSource
+		p.clock = clock
+		p.ceSubjectSource = env.CESubjectSource
+		if env.CESubjectFrom != "" {
+			p.ceSubjectPath, _ = parseJSONPath(env.CESubjectFrom) // validated in NewAdapter
+		}
+		p.ceDataSchema = env.CEDataSchema
+		p.ceDataContentType = env.CEDataContentType
+		p.ceSpecVersion = env.CESpecVersion
+		if env.BodyTransform != "" {
+			p.bodyTransform, _ = newBodyTransform(env.BodyTransform) // validated in NewAdapter
+		}
+		if env.PartitionKeyFrom != "" {
+			// validated in NewAdapter
+			p.partitionKey, _ = newPartitionKeyExtractor(env.PartitionKeyFrom, env.PartitionKeyExpression)
+		}
+		p.entityPath = entityPath
+		p.explodeJSONArray = env.ExplodeJSONArray
+		p.logger = logger
+	}
+
+	a := &adapter{
+		logger: logger,
+		mt:     mt,
+
+		ceClient: ceClient,
+
+		sinkMaxRetries:       env.SinkMaxRetries,
+		sinkRetryBaseBackoff: env.SinkRetryBaseBackoff,
+		sinkRetryMaxBackoff:  env.SinkRetryMaxBackoff,
+		sinkTimeout:          env.SinkTimeout,
+
+		msgRcvr:          rcvr,
+		extraRcvrs:       extraRcvrs,
+		acceptSession:    acceptSession,
+		sessionID:        env.SessionID,
+		maxSessions:      env.MaxConcurrentSessions,
+		sessionPrefetch:  sessionPrefetch,
+		msgPrcsr:         msgPrcsr,
+		strictValidation: env.StrictValidation,
+		deleteSubs:       deleteSubscription,
+		includeRawMsg:    env.IncludeRawMessage,
+		includeRawProps:  env.IncludeRawProperties,
+		ceSource:         ceSource,
+		maxConcurrent:    env.MaxConcurrent,
+		prefetchCount:    env.PrefetchCount,
+		ordering:         newOrderingChecker(env.OrderingCheck),
+
+		receiveMaxRetries:       env.ReceiveMaxRetries,
+		receiveRetryBaseBackoff: receiveRetryBaseBackoff,
+		receiveRetryMaxBackoff:  receiveRetryMaxBackoff,
+
+		dispositioner: receiverDispositioner{},
+
+		maxDeliveryAttempts: env.MaxDeliveryAttempts,
+		completionPolicy:    env.CompletionPolicy,
+		deliverySemantics:   env.DeliverySemantics,
+		autoRenewLock:       env.AutoRenewLock,
+		skipNotDue:          env.SkipNotDueMessages,
+		skipExpired:         env.SkipExpired,
+		maxEventSize:        env.MaxEventSize,
+		clock:               clock,
+		messageTimeout:      env.MessageTimeout,
+
+		connectTimeout: env.ConnectTimeout,
+		drainTimeout:   drainTimeout(env),
+		trackReadiness: env.HealthPort != 0,
+		validateOnly:   env.ValidateOnly,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(mt),
+	}
+
+	if env.DrainedEventInterval > 0 {
+		adminClient, err := azureservicebus.AdminClientFromEnvironment(entityID, nil)
+		if err != nil {
+			logger.Panicw("Unable to obtain admin interface for Service Bus Namespace", zap.Error(err))
+		}
+		a.drainWatcher = &drainWatcher{
+			countMessages: adminMessageCounter(adminClient, entityID, receiverSubQueue(env)),
+			interval:      env.DrainedEventInterval,
+			entityPath:    entityPath,
+		}
+	}
+
+	if env.HeartbeatInterval > 0 {
+		a.heartbeat = newHeartbeat(env.HeartbeatInterval, entityPath)
+	}
+
+	if env.BatchSummary != batchSummaryNone {
+		a.batchSummary = &batchSummary{
+			mode:       env.BatchSummary,
+			entityPath: entityPath,
+		}
+	}
+
+	if env.PrefetchRefillThreshold > 0 {
+		a.refill = newRefill(env.PrefetchCount, env.PrefetchRefillThreshold)
+	}
+
+	if env.AzureScopeExtensions {
+		a.scopeExts = azureScopeExtensions(entityID)
+	}
+
+	// Forwarding trails record queues and topics, never subscriptions.
+	if env.HopLimit != 0 {
+		a.hopLimit, _ = newHopLimit(entityID.ResourceName, env.HopLimit, env.HopLimitAction) // validated in NewAdapter
+	}
+
+	// Stalled receivers are replaced by receivers which use a new client,
+	// and thereby a new connection.
+	if env.IdleTimeout > 0 && rcvr != nil {
+		a.idleTimeout = env.IdleTimeout
+		a.newReceiver = func() (messageReceiver, clientCloser, error) {
+			client, err := azureservicebus.ClientFromEnvironment(entityID, clientOpts)
+			if err != nil {
+				return nil, nil, fmt.Errorf("creating client: %w", err)
+			}
+			rcvr, err := newEntityReceiver(client, entityID, rcvrOpts)
+			if err != nil {
+				_ = client.Close(context.Background())
+				return nil, nil, err
+			}
+			return rcvr, client, nil
+		}
+	}
+
+	if env.OrderedCompletion {
+		a.barrier = newSettlementBarrier()
+	}
+
+	// Settlements are counted before completions get batched, so that
+	// deferred completions are only counted once they were flushed.
+	a.settlements = newSettlementCounter(a.dispositioner)
+	a.dispositioner = a.settlements
+
+	if env.CompleteBatchSize > 1 {
+		a.completions = newCompletionBatcher(a.dispositioner, logger, env.CompleteBatchSize, env.CompleteFlushInterval)
+		a.dispositioner = a.completions
+	}
+
+	// Message IDs are only unique within a given entity.
+	if env.DedupWindow > 0 {
+		a.dedup = newDedupCache(env.DedupWindow, env.DedupCacheSize)
+	}
+
+	// Sessions were already probed above. In validate-only mode, errors
+	// are reported by Start instead.
+	if rcvr != nil && !env.ValidateOnly {
+		a.checkAccess(ctx, entityID.ResourceType, azureservicebus.AuthMethodFromEnvironment())
+	}
+
+	return a
+}
+
+// Modes of reception of Service Bus messages, as reported in logs.
+const (
+	receiveModePeekLock                = "peek-lock"
+	receiveModeSessions                = "sessions"
+	receiveModeDeadLetterQueue         = "dead-letter-queue"
+	receiveModeTransferDeadLetterQueue = "transfer-dead-letter-queue"
+)
+
+// receiveMode returns the mode of reception of messages selected by the given
+// configuration.
+func receiveMode(env *envConfig) string {
+	switch {
+	case env.SessionEnabled:
+		return receiveModeSessions
+	case env.ConsumeDeadLetterQueue:
+		return receiveModeDeadLetterQueue
+	case env.ConsumeTransferDeadLetterQueue:
+		return receiveModeTransferDeadLetterQueue
+	default:
+		return receiveModePeekLock
+	}
+}
+
+// receiverSubQueue returns the sub-queue of the Service Bus entity which
+// messages are received from according to the given configuration, or zero
+// if messages are received from the entity itself.
+func receiverSubQueue(env *envConfig) azservicebus.SubQueue {
+	switch {
+	case env.ConsumeDeadLetterQueue:
+		return azservicebus.SubQueueDeadLetter
+	case env.ConsumeTransferDeadLetterQueue:
+		return azservicebus.SubQueueTransfer
+	default:
+		return 0
+	}
+}
+
+// Names of the sub-queues of Service Bus entities, as conveyed by the
+// "sbsubqueue" extension attribute.
+const (
+	subQueueNameDeadLetter         = "deadletter"
+	subQueueNameTransferDeadLetter = "transferdeadletter"
+)
+
+// subQueueName returns the name of the given sub-queue, or an empty string if
+// no sub-queue is selected.
+func subQueueName(subQueue azservicebus.SubQueue) string {
+	switch subQueue {
+	case azservicebus.SubQueueDeadLetter:
+		return subQueueNameDeadLetter
+	case azservicebus.SubQueueTransfer:
+		return subQueueNameTransferDeadLetter
+	default:
+		return ""
+	}
+}
+
+// newEntityReceiver returns a receiver for the given Service Bus entity.
+func newEntityReceiver(client *azservicebus.Client, entityID *v1alpha1.AzureResourceID,
+	opts *azservicebus.ReceiverOptions) (*azservicebus.Receiver, error) {
+
+	switch entityID.ResourceType {
+	case azureservicebus.ResourceTypeQueues:
+		return client.NewReceiverForQueue(entityID.ResourceName, opts)
+	case azureservicebus.ResourceTypeSubscriptions, azureservicebus.ResourceTypeTopics:
+		return client.NewReceiverForSubscription(entityID.ResourceName, entityID.SubResourceName, opts)
+	default:
+		return nil, fmt.Errorf("unsupported resource type %q", entityID.ResourceType)
+	}
+}
+
+// splitEntityResourceIDs splits the given comma-separated list of entity
+// resource IDs.
+func splitEntityResourceIDs(ids string) []string {
+	var out []string
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// envEntityResourceID is the name of the environment variable which contains
+// the resource IDs of Service Bus entities.
+const envEntityResourceID = "SERVICEBUS_ENTITY_RESOURCE_ID"
+
+// entityFromConnectionString returns the ID and URL of the Service Bus entity
+// referenced by the EntityPath of the connection string read from the
+// environment, for legacy deployments which don't set the resource ID of the
+// entity.
+func entityFromConnectionString() (*v1alpha1.AzureResourceID, string, error) {
+	if azureservicebus.AuthMethodFromEnvironment() != azureservicebus.AuthMethodConnectionString {
+		return nil, "", errors.New("no connection string is set")
+	}
+
+	azureEnv, err := azureservicebus.AzureEnvironment()
+	if err != nil {
+		return nil, "", err
+	}
+
+	connStr, err := azureservicebus.ConnectionStringFromEnvironment(azureEnv, "", "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return azureservicebus.ParseConnectionStringEntity(connStr)
+}
+
+// Start implements adapter.Adapter.
+//
+// Required permissions:
+//
+//	Service Bus Queues:
+//	  - Microsoft.ServiceBus/namespaces/queues/read
+//	Service Bus Topics:
+//	  - Microsoft.ServiceBus/namespaces/topics/read
+//	  - Microsoft.ServiceBus/namespaces/topics/subscriptions/read
+//	Both (DataAction):
+//	- Microsoft.ServiceBus/namespaces/messages/receive/action
+func (a *adapter) Start(ctx context.Context) error {
+	if a.validateOnly {
+		if err := a.validate(ctx); err != nil {
+			return fmt.Errorf("validating access to the Service Bus entity: %w", err)
+		}
+		a.logger.Info("Successfully validated access to the Service Bus entity")
+		return nil
+	}
+
+	a.logger.Info("Listening for messages")
+	ctx = pkgadapter.ContextWithMetricTag(ctx, a.mt)
+
+	// Reception of messages stops as soon as the adapter is stopped, or
+	// if an error occurs in any of the routines.
+	rcvCtx, stopReceiving := context.WithCancel(ctx)
+	defer stopReceiving()
+
+	// Messages which were already received are handled in a context which
+	// is detached from the adapter's context, so that they can be drained
+	// after the adapter was stopped.
+	handleCtx, stopHandling := context.WithCancel(detach(ctx))
+	defer stopHandling()
+
+	if a.healthPort != 0 {
+		stopHealthServer, err := startHealthServer(a.logger, a.healthPort, a.isReady, a.status, a.pause)
+		if err != nil {
+			return fmt.Errorf("starting health server: %w", err)
+		}
+		defer stopHealthServer()
+	}
+	if a.trackReadiness && a.acceptSession == nil {
+		go a.probeReadiness(rcvCtx)
+	}
+
+	// Batches of events are delivered until all messages were handled.
+	if a.batcher != nil {
+		batchCtx, stopBatching := context.WithCancel(detach(ctx))
+		batcherDone := make(chan struct{})
+		go func() {
+			a.batcher.run(batchCtx)
+			close(batcherDone)
+		}()
+		defer func() {
+			stopBatching()
+			<-batcherDone
+		}()
+	}
+
+	// Deferred completions are flushed once all messages were settled.
+	flushCompletions := func() {}
+	if a.completions != nil {
+		complCtx, stopCompleting := context.WithCancel(detach(ctx))
+		completionsDone := make(chan struct{})
+		go func() {
+			a.completions.run(complCtx)
+			close(completionsDone)
+		}()
+
+		var once sync.Once
+		flushCompletions = func() {
+			once.Do(func() {
+				stopCompleting()
+				<-completionsDone
+			})
+		}
+		defer flushCompletions()
+	}
+
+	if a.replaySeqNums != nil {
+		return a.replay(ctx)
+	}
+
+	// Waitgroup makes sure all routines have finished before
+	// returning from start.
+	wg := &sync.WaitGroup{}
+
+	if a.drainWatcher != nil {
+		wg.Add(1)
+		go func() {
+			a.watchDrained(rcvCtx)
+			wg.Done()
+		}()
+	}
+
+	if a.heartbeat != nil {
+		wg.Add(1)
+		go func() {
+			a.emitHeartbeats(rcvCtx)
+			wg.Done()
+		}()
+	}
+
+	if a.replayWatcher != nil {
+		wg.Add(1)
+		go func() {
+			a.watchReplayList(rcvCtx)
+			wg.Done()
+		}()
+	}
+
+	// We are communicating with routines via channels.
+	// Create errChan with capacity to deal with the worst case,
+	// which would be one error returned from every routine (consumers
+	// plus the producers, or session routines).
+	errChan := make(chan error, a.maxConcurrent+a.maxSessions+1+len(a.extraRcvrs))
+	var msgChan chan *fullMessage
+	if a.refill != nil {
+		msgChan = make(chan *fullMessage, a.prefetchCount)
+	} else {
+		msgChan = make(chan *fullMessage)
+	}
+
+	if a.acceptSession != nil {
+		// Each session is consumed in order by a single routine, and
+		// multiple sessions can be consumed in parallel.
+		for i := 0; i < a.maxSessions; i++ {
+			wg.Add(1)
+			go func() {
+				a.runSessions(rcvCtx, handleCtx, errChan)
+				wg.Done()
+			}()
+		}
+	} else {
+		a.runConsumers(handleCtx, wg, msgChan, errChan)
+
+		// Launch one producer per receiver link. Consumers return once
+		// the producers have closed msgChan and all received messages
+		// were handled.
+		producersWg := &sync.WaitGroup{}
+		for _, rcvr := range append([]messageReceiver{a.msgRcvr}, a.extraRcvrs...) {
+			rcvr := rcvr
+			producersWg.Add(1)
+			go func() {
+				a.produce(rcvCtx, rcvr, msgChan, errChan)
+				producersWg.Done()
+			}()
+		}
+
+		wg.Add(1)
+		go func() {
+			producersWg.Wait()
+			close(msgChan)
+			wg.Done()
+		}()
+	}
+
+	// This variable store all errors returned from routines.
+	errs := []string{}
+
+	// Wait for either context done or an error from any routine.
+	select {
+	case <-ctx.Done():
+	case err := <-errChan:
+		errs = append(errs, err.Error())
+	}
+
+	// Stop receiving messages, and let in-flight messages drain.
+	stopReceiving()
+	a.drain(wg, stopHandling, flushCompletions)
+	close(errChan)
+
+	if a.deleteSubs != nil {
+		a.deleteSubscription(ctx)
+	}
+
+	// Gather and sumarize errors from routines
+	for err := range errChan {
+		errs = append(errs, err.Error())
+	}
+
+	// If there are errors, return them as a single error.
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ". "))
+	}
+
+	return nil
+}
+
+// drain waits for all routines to exit. If routines are still running after
+// drainTimeout, the handling of in-flight messages is interrupted by calling
+// stopHandling, which causes those messages to be abandoned.
+//
+// The number of messages which were settled while draining is logged once all
+// routines have exited, and deferred completions were flushed by calling
+// flushCompletions.
+func (a *adapter) drain(wg *sync.WaitGroup, stopHandling context.CancelFunc, flushCompletions func()) {
+	before := a.settlements.counts()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	timedOut := false
+
+	select {
+	case <-drained:
+	case <-time.After(a.drainTimeout):
+		timedOut = true
+
+		a.logger.Warnw("In-flight messages were not handled within the drain timeout, abandoning them",
+			zap.Duration("timeout", a.drainTimeout))
+		stopHandling()
+		<-drained
+	}
+
+	flushCompletions()
+
+	settled := a.settlements.counts().since(before)
+
+	a.logger.Infow("Finished draining in-flight messages",
+		zap.Int64("completed", settled.completed),
+		zap.Int64("abandoned", settled.abandoned),
+		zap.Int64("deadLettered", settled.deadLettered),
+		zap.Bool("timedOut", timedOut))
+}
+
+// defaultProcessorOptions returns the names of the environment variables set
+// in the given configuration which are only supported by the default message
+// processor, and would therefore be ignored by other processors.
+func defaultProcessorOptions(env *envConfig) []string {
+	var opts []string
+
+	for _, o := range []struct {
+		name  string
+		isSet bool
+	}{
+		{"SERVICEBUS_CE_ID_SOURCE", env.CEIDSource != ceIDSourceMessageID},
+		{"SERVICEBUS_CE_TIME_SOURCE", env.CETimeSource != ceTimeSourceEnqueuedTime},
+		{"SERVICEBUS_CE_SUBJECT_SOURCE", env.CESubjectSource != ceSubjectSourceNone},
+		{"SERVICEBUS_CE_SUBJECT_FROM", env.CESubjectFrom != ""},
+		{"SERVICEBUS_CE_DATASCHEMA", env.CEDataSchema != ""},
+		{"SERVICEBUS_CE_DATACONTENTTYPE", env.CEDataContentType != ""},
+		{"SERVICEBUS_CE_SPECVERSION", env.CESpecVersion != cloudevents.VersionV1},
+		{"SERVICEBUS_CE_TYPE_PREFIX", env.CETypePrefix != ""},
+		{"SERVICEBUS_PROPERTY_MAPPING", env.PropertyMapping != ""},
+		{"SERVICEBUS_ANNOTATIONS_AS_EXTENSIONS", len(env.AnnotationsAsExtensions) != 0},
+		{"SERVICEBUS_BINARY_ENCODING", env.BinaryEncoding != ""},
+		{"SERVICEBUS_BODY_TRANSFORM", env.BodyTransform != ""},
+		{"SERVICEBUS_PARTITIONKEY_FROM", env.PartitionKeyFrom != ""},
+		{"SERVICEBUS_EXPLODE_JSON_ARRAY", env.ExplodeJSONArray},
+	} {
+		if o.isSet {
+			opts = append(opts, o.name)
+		}
+	}
+
+	return opts
+}
+
+// drainTimeout returns the duration the adapter waits for in-flight messages to
+// be handled when it stops, which is set by either SERVICEBUS_DRAIN_TIMEOUT or
+// its alias SERVICEBUS_SHUTDOWN_GRACE_PERIOD.
+func drainTimeout(env *envConfig) time.Duration {
+	if env.ShutdownGracePeriod > 0 {
+		return env.ShutdownGracePeriod
+	}
+	return env.DrainTimeout
+}
+
+// convenience structure for message processing.
+type fullMessage struct {
+	// receiver which the message was received from, and which must be
+	// used to settle it
+	rcvr messageReceiver
+
+	received     *azservicebus.ReceivedMessage
+	serializable *Message
+
+	// position of the message in the settlement order; only set when
+	// completions are ordered
+	ticket uint64
+
+	// whether the message was completed before its events were sent;
+	// only set when events are delivered at most once
+	completed bool
+}
+
+// produce receives messages from the Service Bus entity on the given receiver
+// link and passes them to the consumers via msgChan, until ctx is canceled.
+//
+// Transient errors which occur while receiving messages are retried with an
+// exponential backoff, up to receiveMaxRetries consecutive times. The
+// receiver re-establishes its link to Service Bus upon the next attempt.
+// Receivers whose connection stalled silently are replaced (see
+// receiveMessages).
+func (a *adapter) produce(ctx context.Context, rcvr messageReceiver, msgChan chan *fullMessage, errChan chan error) {
+	var backoff *common.Backoff
+	var retries int
+
+	// client of the current receiver, if it replaced a stalled receiver
+	var client clientCloser
+
+	for {
+		count := a.prefetchCount
+		if a.refill != nil {
+			var err error
+			if count, err = a.refill.wait(ctx, msgChan); err != nil {
+				return
+			}
+		}
+
+		messages, err := a.receiveUnlessPaused(ctx, rcvr, count)
+
+		switch {
+		case err == nil:
+			if retries > 0 {
+				a.logger.Info("Recovered from receive errors")
+				a.setReady(true)
+				retries = 0
+				backoff.Reset()
+			}
+
+			if a.batchSummary != nil && a.summarizeBatch(ctx, rcvr, messages) {
+				continue
+			}
+
+			for i, m := range messages {
+				msg, err := toMessage(m)
+				if err != nil {
+					errChan <- fmt.Errorf("error transforming message: %w", err)
+					return
+				}
+
+				fm := &fullMessage{
+					rcvr:         rcvr,
+					received:     m,
+					serializable: msg,
+				}
+				if a.barrier != nil {
+					fm.ticket = a.barrier.ticket()
+				}
+
+				select {
+				case msgChan <- fm:
+				case <-ctx.Done():
+					if a.barrier != nil {
+						_ = a.barrier.settle(fm.ticket, nil)
+					}
+					a.abandonMessages(detach(ctx), rcvr, messages[i:])
+					return
+				}
+			}
+		case errors.Is(err, context.Canceled):
+			return
+		default:
+			if errors.Is(err, errReceiverStalled) && a.newReceiver != nil {
+				a.logger.Warnw("Replacing stalled receiver", zap.Error(err))
+
+				r, c, replaceErr := a.replaceReceiver(ctx, rcvr, client)
+				if replaceErr == nil {
+					rcvr, client = r, c
+					continue
+				}
+				err = replaceErr
+			}
+
+			a.setReady(false)
+
+			err = wrapPermissionError(err)
+			if retries >= a.receiveMaxRetries || isPermanentReceiveError(err) {
+				errChan <- fmt.Errorf("error receiving messages: %w", err)
+				return
+			}
+
+			if backoff == nil {
+				backoff = common.NewBackoff(a.receiveRetryBaseBackoff, a.receiveRetryMaxBackoff)
+			}
+			retries++
+
+			a.logger.Warnw("Error receiving messages, retrying (attempt "+strconv.Itoa(retries)+
+				" of "+strconv.Itoa(a.receiveMaxRetries)+")", zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff.Duration()):
+			}
+		}
+	}
+}
+
+// Bounds of the backoff between attempts at receiving messages after an
+// error.
+const (
+	receiveRetryBaseBackoff = time.Second
+	receiveRetryMaxBackoff  = 30 * time.Second
+)
+
+// isPermanentReceiveError returns whether the given error, which occurred
+// while receiving messages, can not be recovered from by retrying.
+func isPermanentReceiveError(err error) bool {
+	return errors.Is(err, errListenRightRequired) ||
+		strings.Contains(err.Error(), amqpConditionNotFound)
+}
+
+// runConsumers launches maxConcurrent consumers, which bounds the number of
+// messages that are handled concurrently.
+func (a *adapter) runConsumers(ctx context.Context, wg *sync.WaitGroup, msgChan chan *fullMessage, errChan chan error) {
+	for i := 0; i < a.maxConcurrent; i++ {
+		wg.Add(1)
+		go func() {
+			a.consume(ctx, msgChan, errChan)
+			wg.Done()
+		}()
+	}
+}
+
+// consume handles messages from msgChan until it is closed.
+//
+// Messages are settled in a context which is detached from ctx, so that
+// messages which handling was interrupted by the cancellation of ctx can still
+// be abandoned.
+func (a *adapter) consume(ctx context.Context, msgChan chan *fullMessage, errChan chan error) {
+	for fm := range msgChan {
+		if a.refill != nil {
+			a.refill.notifyTaken()
+		}
+
+		if err := a.checkOrdering(fm); err != nil {
+			if a.barrier != nil {
+				_ = a.barrier.settle(fm.ticket, nil)
+			}
+			a.abandonMessages(detach(ctx), fm.rcvr, []*azservicebus.ReceivedMessage{fm.received})
+			errChan <- err
+			return
+		}
+
+		stopLockRenewal := a.startLockRenewal(ctx, fm)
+		handleErr := a.handleMessage(ctx, fm.serializable, a.earlyCompletion(ctx, fm))
+		stopLockRenewal()
+
+		// The settlement may be buffered by the barrier and run after
+		// the next iteration started.
+		fm := fm
+		settle := func() error {
+			return a.settleMessage(detach(ctx), fm, handleErr)
+		}
+
+		var err error
+		if a.barrier != nil {
+			err = a.barrier.settle(fm.ticket, settle)
+		} else {
+			err = settle()
+		}
+		if err != nil {
+			errChan <- err
+			return
+		}
+	}
+}
+
+// checkOrdering verifies that the given message isn't out of order, if this
+// verification is enabled. Out-of-order messages are reported, and an error
+// is returned if the adapter is configured to fail on such messages.
+func (a *adapter) checkOrdering(fm *fullMessage) error {
+	if a.ordering == nil {
+		return nil
+	}
+
+	err := a.ordering.check(fm.received)
+	if err == nil {
+		return nil
+	}
+
+	if a.ordering.failOnViolation {
+		return fmt.Errorf("verifying the order of messages: %w", err)
+	}
+	a.logger.Warnw("Message received out of order. Ensure that sessions are enabled on the Service Bus entity "+
+		"if it requires them", zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(err))
+	return nil
+}
+
+// abandonMessages abandons messages which were received but won't be handled.
+func (a *adapter) abandonMessages(ctx context.Context, rcvr messageReceiver, msgs []*azservicebus.ReceivedMessage) {
+	for _, m := range msgs {
+		if err := a.disposition().Abandon(ctx, rcvr, m); err != nil {
+			a.logger.Errorw("Failed to abandon message", zap.String(logfieldMsgID, m.MessageID), zap.Error(err))
+		}
+	}
+}
+
+// Policies which determine how messages get settled when only some of their
+// events could be delivered.
+const (
+	completionPolicyAll        = "all"
+	completionPolicyAny        = "any"
+	completionPolicyBestEffort = "best-effort"
+)
+
+// isSupportedCompletionPolicy returns whether the given completion policy is
+// supported.
+func isSupportedCompletionPolicy(p string) bool {
+	switch p {
+	case completionPolicyAll, completionPolicyAny, completionPolicyBestEffort:
+		return true
+	}
+	return false
+}
+
+// settleMessage settles the given message based on the result of its
+// handling.
+//
+// Messages which were skipped because they aren't due yet are abandoned, which
+// increments their delivery count. Messages which were skipped because they
+// expired are completed. Messages which were completed before their events
+// were sent, with at-most-once delivery semantics, are not settled again.
+//
+// Messages which were handled successfully are completed. Messages whose body
+// exceeds the maximum event size are dead-lettered. Messages which could not
+// be converted to CloudEvents are dead-lettered once they reach the maximum
+// number of delivery attempts, if configured. Messages whose events could
+// only partly be delivered are settled according to the completion policy.
+// Messages whose undelivered events were all rejected by the sink with a
+// fatal error (e.g. HTTP 400), or failed validation in strict mode, are
+// dead-lettered, since redelivering them would fail the same way. Other
+// messages which could not be handled are abandoned, so that Service Bus
+// makes them available for redelivery right away instead of waiting for
+// their lock to expire.
+//
+// Messages which get dead-lettered, or completed although some of their
+// events were lost, are forwarded to the dead-letter sink beforehand.
+func (a *adapter) settleMessage(ctx context.Context, fm *fullMessage, handleErr error) error {
+	if fm.completed {
+		if handleErr != nil {
+			a.logger.Errorw("Events of a message which was completed before being sent could not be delivered "+
+				"and were lost", zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+			a.forwardToDeadLetterSink(ctx, fm.serializable, handleErr)
+		}
+		return nil
+	}
+
+	// Abandoning the message would make Service Bus deliver it again right
+	// away, until its delivery count reaches the maximum delivery count of
+	// the entity and it gets dead-lettered.
+	if errors.Is(handleErr, errMessageNotDue) {
+		a.logger.Infow("Deferring message whose scheduled enqueue time is in the future",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Int64p("sequenceNumber", fm.received.SequenceNumber),
+			zap.Timep("scheduledTime", fm.received.ScheduledEnqueueTime))
+
+		if err := a.disposition().Defer(ctx, fm.rcvr, fm.received); err != nil {
+			return fmt.Errorf("error deferring message: %w", err)
+		}
+		return nil
+	}
+
+	if errors.Is(handleErr, errMessageExpired) {
+		a.logger.Debugw("Completing expired message without sending it",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Timep("expiryTime", messageExpiry(fm.received)))
+
+		if err := a.disposition().Complete(ctx, fm.rcvr, fm.received); err != nil {
+			return fmt.Errorf("error completing message: %w", err)
+		}
+		return nil
+	}
+
+	if settled, err := a.settleConversionFailure(ctx, fm, handleErr); settled {
+		return err
+	}
+
+	var sizeErr *messageTooLargeError
+	if errors.As(handleErr, &sizeErr) {
+		a.logger.Errorw("Dead-lettering message which exceeds the maximum event size",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+		return a.deadLetter(ctx, fm, handleErr, deadLetterReasonSize, sizeErr.Error())
+	}
+
+	var timeoutErr *messageTimeoutError
+	if errors.As(handleErr, &timeoutErr) {
+		if a.maxDeliveryAttempts > 0 && fm.received.DeliveryCount >= a.maxDeliveryAttempts {
+			a.logger.Errorw("Dead-lettering message the handling of which timed out after "+
+				strconv.FormatUint(uint64(fm.received.DeliveryCount), 10)+" delivery attempts",
+				zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+			return a.deadLetter(ctx, fm, handleErr, deadLetterReasonTimeout, timeoutErr.Error())
+		}
+
+		a.logger.Errorw("Abandoning message the handling of which timed out",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+		if err := a.disposition().Abandon(ctx, fm.rcvr, fm.received); err != nil {
+			return fmt.Errorf("error abandoning message: %w", err)
+		}
+		return nil
+	}
+
+	var procErr *processingError
+	if errors.As(handleErr, &procErr) && a.maxDeliveryAttempts > 0 && fm.received.DeliveryCount >= a.maxDeliveryAttempts {
+		a.logger.Errorw("Dead-lettering message which could not be processed after "+
+			strconv.FormatUint(uint64(fm.received.DeliveryCount), 10)+" delivery attempts",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+		return a.deadLetter(ctx, fm, handleErr, failureReason(procErr), procErr.Error())
+	}
+
+	if settled, err := a.settleByResult(ctx, fm, handleErr); settled {
+		return err
+	}
+
+	var delivErr *deliveryError
+	if errors.As(handleErr, &delivErr) && a.completionPolicy != "" && a.completionPolicy != completionPolicyAll {
+		switch {
+		case delivErr.numDelivered() > 0:
+			a.logger.Warnw("Completing message some events of which could not be delivered",
+				zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+			a.forwardToDeadLetterSink(ctx, fm.serializable, handleErr)
+			handleErr = nil
+
+		case a.completionPolicy == completionPolicyBestEffort:
+			a.logger.Errorw("Dead-lettering message none of the events of which could be delivered",
+				zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+			return a.deadLetter(ctx, fm, handleErr, deadLetterReasonDelivery, delivErr.Error())
+		}
 	}
 
-	env := envAcc.(*envConfig)
+	if errors.As(handleErr, &delivErr) && delivErr.isFatal() {
+		a.logger.Errorw("Dead-lettering message the events of which were rejected by the sink",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
 
-	entityID, err := parseServiceBusResourceID(env.EntityResourceID)
-	if err != nil {
-		logger.Panicw("Unable to parse entity ID "+strconv.Quote(env.EntityResourceID), zap.Error(err))
+		return a.deadLetter(ctx, fm, handleErr, deadLetterReasonRejected, delivErr.Error())
 	}
 
-	client, err := clientFromEnvironment(entityID, newAzureServiceBusClientOptions(
-		webSocketsClientOption(env.WebSocketsEnable)))
-	if err != nil {
-		logger.Panicw("Unable to obtain interface for Service Bus Namespace", zap.Error(err))
+	if handleErr != nil {
+		a.logger.Errorw("Abandoning message which could not be handled",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+		if err := a.disposition().Abandon(ctx, fm.rcvr, fm.received); err != nil {
+			return fmt.Errorf("error abandoning message: %w", err)
+		}
+		return nil
 	}
 
-	var rcvr *azservicebus.Receiver
-	switch entityID.ResourceType {
-	case resourceTypeQueues:
-		rcvr, err = client.NewReceiverForQueue(entityID.ResourceName, nil)
-		mt.ResourceGroup = sources.AzureServiceBusQueueSourceResource.String()
-	case resourceTypeSubscriptions, resourceTypeTopics:
-		rcvr, err = client.NewReceiverForSubscription(entityID.ResourceName, entityID.SubResourceName, nil)
-		mt.ResourceGroup = sources.AzureServiceBusTopicSourceResource.String()
+	if err := a.disposition().Complete(ctx, fm.rcvr, fm.received); err != nil {
+		return fmt.Errorf("error completing message: %w", err)
 	}
-	if err != nil {
-		logger.Panicw("Unable to obtain message receiver for Service Bus entity "+strconv.Quote(strconv.Quote(entityPath(entityID))), zap.Error(err))
+	return nil
+}
+
+// handleMessage handles a single Service Bus message.
+//
+// When completeEarly is non-nil, it is called to complete the message once it
+// was processed, before its events are sent (see earlyCompletion).
+func (a *adapter) handleMessage(ctx context.Context, msg *Message, completeEarly func() error) (err error) {
+	// The client library isn't expected to deliver nil messages. Bursts of
+	// those usually denote an issue with the connection to Service Bus.
+	if msg == nil {
+		a.logger.Debug("Ignoring nil message received from Service Bus")
+		a.sr.ReportNilMessage()
+		return nil
 	}
 
-	ceSource := env.EntityResourceID
+	if a.status != nil {
+		done := a.status.begin(msg)
+		defer func() { done(err) }()
+	}
 
-	var msgPrcsr MessageProcessor
-	switch env.MessageProcessor {
-	case "default":
-		msgPrcsr = &defaultMessageProcessor{ceSource: ceSource}
-	default:
-		logger.Panic("unsupported message processor " + strconv.Quote(env.MessageProcessor))
+	if a.heartbeat != nil {
+		a.heartbeat.touch()
 	}
 
-	// The Service Bus client uses the default "NoOpTracer" tab.Tracer
-	// implementation, which does not produce any log message. We register
-	// a custom implementation so that event handling errors are logged via
-	// Knative's logging facilities.
-	tab.Register(trace.NewNoOpTracerWithLogger(logger))
+	if a.skipNotDue && msg.ScheduledEnqueueTime != nil && a.clock.isFuture(*msg.ScheduledEnqueueTime) {
+		return errMessageNotDue
+	}
 
-	return &adapter{
-		logger: logger,
-		mt:     mt,
+	if a.skipExpired {
+		if exp := messageExpiry(msg.ReceivedMessage); exp != nil && a.clock.isPast(*exp) {
+			return errMessageExpired
+		}
+	}
 
-		ceClient: ceClient,
+	a.reportDeliveryLag(msg)
 
-		msgRcvr:       rcvr,
-		msgPrcsr:      msgPrcsr,
-		maxConcurrent: env.MaxConcurrent,
+	if a.maxEventSize > 0 && len(msg.Body) > a.maxEventSize {
+		a.sr.ReportProcessingError(false)
+		return &messageTooLargeError{
+			size:    len(msg.Body),
+			maxSize: a.maxEventSize,
+		}
 	}
-}
 
-// parseServiceBusResourceID parses the given resource ID string to a
-// structured resource ID, and validates that this resource ID refers to a
-// Service Bus entity.
-func parseServiceBusResourceID(resIDStr string) (*v1alpha1.AzureResourceID, error) {
-	resID := &v1alpha1.AzureResourceID{}
+	if a.corrFilter != nil && !a.corrFilter.matches(msg) {
+		a.logger.Debugw("Discarding message which doesn't match the correlation filter",
+			zap.String(logfieldMsgID, msg.ReceivedMessage.MessageID))
+		return nil
+	}
 
-	err := json.Unmarshal([]byte(strconv.Quote(resIDStr)), resID)
-	if err != nil {
-		return nil, fmt.Errorf("deserializing resource ID string: %w", err)
+	if a.filter != nil && !a.filter.matches(msg.Body) {
+		a.logger.Debugw("Discarding message which doesn't match the filter expression",
+			zap.String(logfieldMsgID, msg.ReceivedMessage.MessageID))
+		return nil
 	}
 
-	// Must match one of the following patterns:
-	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/queues/{queueName}
-	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/topics/{topicName}/subscriptions/{subsName}
-	if resID.ResourceProvider != resourceProviderServiceBus ||
-		resID.Namespace == "" ||
-		resID.ResourceType != resourceTypeQueues && resID.ResourceType != resourceTypeTopics ||
-		resID.ResourceType == resourceTypeQueues && resID.SubResourceType != "" ||
-		resID.ResourceType == resourceTypeTopics && resID.SubResourceType != resourceTypeSubscriptions {
+	if a.dedup != nil && msg.MessageID != "" && a.dedup.seen(msg.MessageID) {
+		a.logger.Debugw("Discarding message which was already delivered",
+			zap.String(logfieldMsgID, msg.ReceivedMessage.MessageID))
+		return nil
+	}
 
-		return nil, errors.New("resource ID does not refer to a Service Bus entity")
+	via := messageVia(msg)
+	hopLimitExceeded := a.hopLimit != nil && a.hopLimit.exceeded(via)
+	if hopLimitExceeded && a.hopLimit.action == hopLimitActionDrop {
+		a.logger.Warnw("Discarding message which exceeded the hop limit, the Service Bus topology may contain "+
+			"an auto-forwarding loop", zap.String(logfieldMsgID, msg.ReceivedMessage.MessageID), zap.Strings("via", via))
+		return nil
 	}
 
-	return resID, nil
-}
+	start := time.Now()
 
-// entityPath returns the entity path of the given Service Bus entity.
-func entityPath(entityID *v1alpha1.AzureResourceID) string {
-	switch entityID.ResourceType {
-	case resourceTypeQueues:
-		queueName := entityID.ResourceName
-		return queueName
-	case resourceTypeTopics:
-		topicName := entityID.ResourceName
-		subsName := entityID.SubResourceName
-		return topicName + "/Subscriptions/" + subsName
-	default:
-		return ""
+	if a.messageTimeout > 0 {
+		msgCtx, cancel := context.WithTimeout(ctx, a.messageTimeout)
+		defer cancel()
+		defer func(parentCtx context.Context) {
+			if err != nil && parentCtx.Err() == nil && errors.Is(msgCtx.Err(), context.DeadlineExceeded) {
+				err = &messageTimeoutError{timeout: a.messageTimeout, err: err}
+				a.sr.ReportMessageTimeout()
+			}
+		}(ctx)
+		ctx = msgCtx
 	}
-}
 
-// clientFromEnvironment mimics the behaviour of eventhub.NewHubFromEnvironment.
-// It returns a azservicebus.Client that is suitable for the
-// authentication method selected via environment variables.
-func clientFromEnvironment(entityID *v1alpha1.AzureResourceID, clientOptions *azservicebus.ClientOptions) (*azservicebus.Client, error) {
-	// SAS authentication (token, connection string)
-	connStr := connectionStringFromEnvironment(entityID.Namespace, entityPath(entityID))
-	if connStr != "" {
-		client, err := azservicebus.NewClientFromConnectionString(connStr, clientOptions)
-		if err != nil {
-			return nil, fmt.Errorf("creating client from connection string: %w", err)
+	ctx, span := tab.StartSpanWithRemoteParent(ctx, spanNameReceive, newMessageCarrier(msg))
+	defer span.End()
+	span.AddAttributes(tab.StringAttribute(logfieldMsgID, msg.MessageID))
+
+	// Captured before processing, which may transform the message.
+	var rawExts map[string]string
+	if a.includeRawMsg {
+		var err error
+		if rawExts, err = rawMessageExtensions(msg, a.includeRawProps); err != nil {
+			err = &processingError{
+				err: fmt.Errorf("capturing raw Service Bus message with ID %s: %w", msg.ReceivedMessage.MessageID, err),
+			}
+			trace.SetSpanError(span, err)
+			a.sr.ReportProcessingError(false)
+			return err
 		}
-		return client, nil
 	}
 
-	// AAD authentication (service principal)
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	events, err := a.processMessage(msg)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create Azure credentials: %w", err)
+		err = &processingError{
+			err: fmt.Errorf("processing Service Bus message with ID %s: %w", msg.ReceivedMessage.MessageID, err),
+		}
+		trace.SetSpanError(span, err)
+		a.sr.ReportProcessingError(false)
+		return err
 	}
 
-	fqNamespace := entityID.Namespace + ".servicebus.windows.net"
-	client, err := azservicebus.NewClient(fqNamespace, cred, clientOptions)
-	if err != nil {
-		return nil, fmt.Errorf("creating client from service principal: %w", err)
+	// With at-most-once delivery semantics, the message is completed once
+	// it was successfully processed, and its events are lost if they can
+	// not be delivered.
+	completed := completeEarly != nil
+	if completed {
+		if err := completeEarly(); err != nil {
+			err = fmt.Errorf("completing Service Bus message with ID %s before sending its events: %w",
+				msg.ReceivedMessage.MessageID, err)
+			trace.SetSpanError(span, err)
+			return err
+		}
 	}
-	return client, nil
-}
 
-// connectionStringFromEnvironment returns a Service Bus connection string
-// based on values read from the environment.
-func connectionStringFromEnvironment(namespace, entityPath string) string {
-	connStr := os.Getenv(envConnStr)
+	var sendErrs errList
 
-	// if a key is set explicitly, it takes precedence and is used to
-	// compose a new connection string
-	if keyName, keyValue := os.Getenv(envKeyName), os.Getenv(envKeyValue); keyName != "" && keyValue != "" {
-		azureEnv := &azure.PublicCloud
-		connStr = fmt.Sprintf("Endpoint=sb://%s.%s;SharedAccessKeyName=%s;SharedAccessKey=%s;EntityPath=%s",
-			namespace, azureEnv.ServiceBusEndpointSuffix, keyName, keyValue, entityPath)
-	}
+	for _, ev := range events {
+		if err := ev.Validate(); err != nil {
+			if a.strictValidation {
+				// Validation errors are classified as fatal send
+				// failures, which get the message dead-lettered.
+				sendErrs.errs = append(sendErrs.errs, &sendError{
+					eventID: ev.ID(),
+					err:     err,
+				})
+				a.sr.ReportProcessingError(false,
+					metrics.TagEventType(ev.Type()),
+					metrics.TagEventSource(ev.Source()),
+				)
+				continue
+			}
+			ev = sanitizeEvent(a.sanitizers, err.(event.ValidationError), ev, a.ceSource)
+		}
 
-	return connStr
-}
+		if len(via) != 0 {
+			ev.SetExtension(extHops, len(via))
+		}
+		if hopLimitExceeded {
+			ev.SetExtension(extHopLimitExceeded, true)
+		}
+		if a.srcIdentity != "" {
+			ev.SetExtension(extSourceIdentity, a.srcIdentity)
+		}
+		for name, val := range a.scopeExts {
+			ev.SetExtension(name, val)
+		}
+		for name, val := range rawExts {
+			ev.SetExtension(name, val)
+		}
+		for name, val := range a.ceOverrides {
+			ev.SetExtension(name, val)
+		}
 
-// Start implements adapter.Adapter.
-//
-// Required permissions:
-//
-//	Service Bus Queues:
-//	  - Microsoft.ServiceBus/namespaces/queues/read
-//	Service Bus Topics:
-//	  - Microsoft.ServiceBus/namespaces/topics/read
-//	  - Microsoft.ServiceBus/namespaces/topics/subscriptions/read
-//	Both (DataAction):
-//	- Microsoft.ServiceBus/namespaces/messages/receive/action
-func (a *adapter) Start(ctx context.Context) error {
-	logging.FromContext(ctx).Info("Listening for messages")
-	ctx = pkgadapter.ContextWithMetricTag(ctx, a.mt)
+		evtTags := []tag.Mutator{
+			metrics.TagEventType(ev.Type()),
+			metrics.TagEventSource(ev.Source()),
+		}
 
-	// We might need to cancel the context to make routines
-	// exit if an error occurs at any of them.
-	cctx, cancel := context.WithCancel(ctx)
+		sendCtx, err := a.limitExtensions(ctx, ev)
+		if err != nil {
+			sendErrs.errs = append(sendErrs.errs, &sendError{
+				eventID: ev.ID(),
+				err:     err,
+			})
+			a.sr.ReportProcessingError(false, evtTags...)
+			continue
+		}
 
-	// Waitgroup makes sure all routines have finished before
-	// returning from start.
-	wg := &sync.WaitGroup{}
+		if err := a.sendCloudEventWithRetry(sendCtx, ev); err != nil {
+			sendErrs.errs = append(sendErrs.errs, &sendError{
+				eventID: ev.ID(),
+				err:     err,
+			})
+			a.sr.ReportProcessingError(false, evtTags...)
+			continue
+		}
 
-	// We are communicating with routines via channels.
-	// Create errChan with capacity to deal with the worst case,
-	// which would be one error returned from every routine.
-	errChan := make(chan error, a.maxConcurrent)
-	msgChan := make(chan *fullMessage)
+		a.sr.ReportProcessingSuccess(evtTags...)
+		a.sr.ReportProcessingLatency(time.Since(start), evtTags...)
+	}
 
-	// Launch maxConcurrent consumers
-	for i := 0; i < a.maxConcurrent; i++ {
-		wg.Add(1)
-		go func() {
-			a.consume(cctx, msgChan, errChan)
-			wg.Done()
-		}()
+	if a.dedup != nil && msg.MessageID != "" && len(sendErrs.errs) == 0 {
+		a.dedup.add(msg.MessageID)
 	}
 
-	// Launch one producer.
-	wg.Add(1)
-	go func() {
-		a.produce(cctx, msgChan, errChan)
-		wg.Done()
-	}()
+	if completed && len(sendErrs.errs) != 0 {
+		a.sr.ReportEventLoss(len(sendErrs.errs))
+	}
 
-	// This variable store all errors returned from routines.
-	errs := []string{}
+	if len(sendErrs.errs) != 0 {
+		err := &deliveryError{
+			numEvents: len(events),
+			errs:      sendErrs,
+		}
+		trace.SetSpanError(span, err)
+		return err
+	}
 
-	// Wait for either context done or an error from any routine.
-	select {
-	case <-cctx.Done():
-	case err := <-errChan:
-		// If an error occurs, write it at the errors store, we
-		// will
-		// errs = append(errs, err)
-		errs = append(errs, err.Error())
+	return nil
+}
 
+// reportDeliveryLag records the time elapsed between the enqueuing of the
+// given message in Service Bus and its delivery to the adapter. Messages
+// without an enqueued time are not observed.
+func (a *adapter) reportDeliveryLag(msg *Message) {
+	if msg.EnqueuedTime == nil {
+		return
 	}
 
-	// cancel the context to bring all routines to an end.
-	cancel()
-
-	// Wait for all routines to exit. If routines fail while exiting
-	// they will write to the errChan, which has capacity to store
-	// an error per routine without blocking.
-	wg.Wait()
+	a.sr.ReportDeliveryLag(a.clock.since(*msg.EnqueuedTime))
+}
 
-	// Gather and sumarize errors from routines
-	for err := range errChan {
-		// errs = append(errs, err)
-		errs = append(errs, err.Error())
+// sendCloudEvent sends a single CloudEvent to the event sink.
+// The trace context of the current span is propagated to the event.
+func sendCloudEvent(ctx context.Context, cli cloudevents.Client, event *cloudevents.Event) protocol.Result {
+	ctx, span := tab.StartSpan(ctx, spanNameSend)
+	defer span.End()
 
+	if err := span.Inject(&eventCarrier{event: event}); err != nil {
+		span.Logger().Debug("Unable to propagate trace context: " + err.Error())
 	}
 
-	// If there are errors, return them as a single error.
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, ". "))
+	if result := cli.Send(ctx, *event); !cloudevents.IsACK(result) {
+		trace.SetSpanError(span, result)
+		return result
 	}
-
 	return nil
 }
 
-// convenience structure for message processing.
-type fullMessage struct {
-	received     *azservicebus.ReceivedMessage
-	serializable *Message
-}
-
-func (a *adapter) produce(ctx context.Context, msgChan chan *fullMessage, errChan chan error) {
-	const maxMessages = 100
+// sendCloudEventWithRetry sends a single CloudEvent to the event sink, and
+// retries transient failures with an exponential backoff, up to
+// sinkMaxRetries times. Each attempt is bounded by sinkTimeout, if set, and
+// paced by sendLimiter, if set. Retries stop as soon as ctx is canceled.
+func (a *adapter) sendCloudEventWithRetry(ctx context.Context, event *cloudevents.Event) protocol.Result {
+	var backoff *common.Backoff
+
+	for attempt := 0; ; attempt++ {
+		if a.sendLimiter != nil {
+			if err := a.sendLimiter.Wait(ctx); err != nil {
+				return fmt.Errorf("waiting for the send rate limiter: %w", err)
+			}
+		}
 
-	for {
-		messages, err := a.msgRcvr.ReceiveMessages(ctx, maxMessages, nil)
+		sendCtx, cancel := a.withSinkTimeout(ctx)
+		result := sendCloudEvent(sendCtx, a.ceClient, event)
+		cancel()
 
-		switch {
-		case err == nil:
-			for _, m := range messages {
-				msg, err := toMessage(m)
-				if err != nil {
-					errChan <- fmt.Errorf("error transforming message: %w", err)
-					return
-				}
+		if result == nil || attempt >= a.sinkMaxRetries || classifySendResult(result) != sendFailureRetryable {
+			return result
+		}
 
-				msgChan <- &fullMessage{
-					received:     m,
-					serializable: msg,
-				}
-			}
-		case errors.Is(err, context.Canceled):
-			return
-		default:
-			errChan <- fmt.Errorf("error receiving messages: %w", err)
-			return
+		if backoff == nil {
+			backoff = common.NewBackoff(a.sinkRetryBaseBackoff, a.sinkRetryMaxBackoff)
 		}
-	}
-}
 
-func (a *adapter) consume(ctx context.Context, msgChan chan *fullMessage, errChan chan error) {
-	for {
+		a.logger.Debugw("Retrying the delivery of event with ID "+event.ID(), zap.Error(result))
+
 		select {
 		case <-ctx.Done():
-			return
-		case fm := <-msgChan:
-			if err := a.handleMessage(ctx, fm.serializable); err != nil {
-				errChan <- fmt.Errorf("error handling message: %w", err)
-				return
-			}
-			if err := a.msgRcvr.CompleteMessage(ctx, fm.received, nil); err != nil {
-				errChan <- fmt.Errorf("error completing message: %w", err)
-				return
-			}
+			return result
+		case <-time.After(backoff.Duration()):
 		}
 	}
 }
 
-// handleMessage handles a single Service Bus message.
-func (a *adapter) handleMessage(ctx context.Context, msg *Message) error {
-	if msg == nil {
-		return nil
+// withSinkTimeout returns a copy of ctx which is canceled once the sink
+// timeout elapses, if set. Cancellations of ctx are propagated to the
+// returned context.
+func (a *adapter) withSinkTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.sinkTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, a.sinkTimeout)
+}
 
-	events, err := a.msgPrcsr.Process(msg)
-	if err != nil {
-		return fmt.Errorf("processing Service Bus message with ID %s: %w", msg.ReceivedMessage.MessageID, err)
+// sendFailureClass is the class of a failure to deliver an event to the sink.
+type sendFailureClass uint8
+
+// Classes of failures to deliver events to the sink.
+const (
+	// The event was delivered.
+	sendFailureNone sendFailureClass = iota
+	// The failure may not occur on a subsequent attempt, e.g. a timeout, a
+	// connection error, or an HTTP 408, 429 or 5xx response.
+	sendFailureRetryable
+	// The event was rejected and would be rejected again on any subsequent
+	// attempt, e.g. because it is invalid or the sink responded with an
+	// HTTP 4xx status.
+	sendFailureFatal
+)
+
+// classifySendResult returns the class of failure indicated by the given
+// result of a CloudEvent delivery.
+func classifySendResult(result protocol.Result) sendFailureClass {
+	if cloudevents.IsACK(result) {
+		return sendFailureNone
 	}
 
-	var sendErrs errList
+	var validErr event.ValidationError
+	if errors.As(result, &validErr) {
+		return sendFailureFatal
+	}
 
-	for _, ev := range events {
-		if err := ev.Validate(); err != nil {
-			ev = sanitizeEvent(err.(event.ValidationError), ev)
+	var httpResult *cehttp.Result
+	if cloudevents.ResultAs(result, &httpResult) {
+		switch sc := httpResult.StatusCode; {
+		case sc == http.StatusRequestTimeout, sc == http.StatusTooManyRequests, sc >= 500:
+			return sendFailureRetryable
+		default:
+			return sendFailureFatal
 		}
+	}
 
-		if err := sendCloudEvent(ctx, a.ceClient, ev); err != nil {
-			sendErrs.errs = append(sendErrs.errs,
-				fmt.Errorf("failed to send event with ID %s: %w", ev.ID(), err),
-			)
-			continue
+	// Failures of an undetermined nature, such as connection errors, are
+	// given the benefit of the doubt.
+	return sendFailureRetryable
+}
+
+// processMessage converts the given message to CloudEvents using the message
+// processor. A panic in the message processor, e.g. caused by a malformed
+// message, is converted to an error so that it doesn't take down the adapter.
+func (a *adapter) processMessage(msg *Message) (events []*cloudevents.Event, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.logger.Errorw("Recovered from panic in message processor",
+				zap.String(logfieldMsgID, msg.ReceivedMessage.MessageID),
+				zap.Any("panic", r), zap.ByteString("stack", debug.Stack()))
+			a.sr.ReportProcessorPanic()
+			events, err = nil, fmt.Errorf("%w: %v", errProcessorPanic, r)
 		}
-	}
+	}()
 
-	if len(sendErrs.errs) != 0 {
-		return fmt.Errorf("sending events to the sink: %w", sendErrs)
+	return a.msgPrcsr.Process(msg)
+}
+
+// errProcessorPanic is returned when the message processor panics while
+// processing a message.
+var errProcessorPanic = errors.New("the message processor panicked")
+
+// errMessageNotDue is returned when a message is skipped because its
+// scheduled enqueue time is in the future.
+var errMessageNotDue = errors.New("the scheduled enqueue time of the message is in the future")
+
+// errMessageExpired is returned when a message is skipped because its time
+// to live has elapsed.
+var errMessageExpired = errors.New("the time to live of the message has elapsed")
+
+// messageExpiry returns the time at which the given message expires, based
+// on its enqueued time and time to live, or nil if the message doesn't
+// expire.
+func messageExpiry(msg *azservicebus.ReceivedMessage) *time.Time {
+	if msg.EnqueuedTime == nil || msg.TimeToLive == nil {
+		return nil
 	}
+	exp := msg.EnqueuedTime.Add(*msg.TimeToLive)
+	return &exp
+}
 
-	return nil
+// messageTooLargeError is returned when the body of a Service Bus message
+// exceeds the maximum event size.
+type messageTooLargeError struct {
+	size    int
+	maxSize int
 }
 
-// sendCloudEvent sends a single CloudEvent to the event sink.
-func sendCloudEvent(ctx context.Context, cli cloudevents.Client, event *cloudevents.Event) protocol.Result {
-	if result := cli.Send(ctx, *event); !cloudevents.IsACK(result) {
-		return result
+var _ error = (*messageTooLargeError)(nil)
+
+// Error implements the error interface.
+func (e *messageTooLargeError) Error() string {
+	return "message body of " + strconv.Itoa(e.size) + " bytes exceeds the maximum event size of " +
+		strconv.Itoa(e.maxSize) + " bytes"
+}
+
+// messageTimeoutError is returned when the handling of a Service Bus message
+// exceeds the message timeout.
+type messageTimeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+var _ error = (*messageTimeoutError)(nil)
+
+// Error implements the error interface.
+func (e *messageTimeoutError) Error() string {
+	return "handling of the message exceeded the timeout of " + e.timeout.String() + ": " + e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *messageTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// processingError is returned when a Service Bus message can not be
+// converted to CloudEvents.
+type processingError struct {
+	err error
+}
+
+var _ error = (*processingError)(nil)
+
+// Error implements the error interface.
+func (e *processingError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *processingError) Unwrap() error {
+	return e.err
+}
+
+// sendError is returned when a CloudEvent can not be sent to the sink.
+type sendError struct {
+	eventID string
+	err     error
+}
+
+var _ error = (*sendError)(nil)
+
+// Error implements the error interface.
+func (e *sendError) Error() string {
+	return "failed to send event with ID " + e.eventID + ": " + e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *sendError) Unwrap() error {
+	return e.err
+}
+
+// deliveryError is returned when some of the events produced from a message
+// could not be delivered to the sink.
+type deliveryError struct {
+	numEvents int
+	errs      errList
+}
+
+var _ error = (*deliveryError)(nil)
+
+// Error implements the error interface.
+func (e *deliveryError) Error() string {
+	return "sending events to the sink: " + e.errs.Error()
+}
+
+// Unwrap returns the aggregated send errors.
+func (e *deliveryError) Unwrap() error {
+	return e.errs
+}
+
+// numDelivered returns the number of events which were delivered.
+func (e *deliveryError) numDelivered() int {
+	return e.numEvents - len(e.errs.errs)
+}
+
+// isFatal returns whether all the events which could not be delivered were
+// rejected by the sink, in which case delivering them again is pointless.
+func (e *deliveryError) isFatal() bool {
+	for _, err := range e.errs.errs {
+		var sendErr *sendError
+		if !errors.As(err, &sendErr) || classifySendResult(sendErr.err) != sendFailureFatal {
+			return false
+		}
 	}
-	return nil
+	return len(e.errs.errs) > 0
 }
 
 // errList is an aggregate of errors.
@@ -442,31 +3216,28 @@ type errList struct {
 var _ error = (*errList)(nil)
 
 // Error implements the error interface.
+//
+// Errors are joined on a single line, separated by semicolons.
 func (e errList) Error() string {
 	if len(e.errs) == 0 {
 		return ""
 	}
-	return fmt.Sprintf("%q", e.errs)
-}
 
-// sanitizeEvent tries to fix the validation issues listed in the given
-// cloudevents.ValidationError, and returns a sanitized version of the event.
-//
-// For now, this helper exists solely to fix CloudEvents sent by Azure Event
-// Grid, which often contain
-//
-//	"dataschema": "#"
-func sanitizeEvent(validErrs event.ValidationError, origEvent *cloudevents.Event) *cloudevents.Event {
-	for attr := range validErrs {
-		// we don't bother cloning, events are garbage collected after
-		// being sent to the sink
-		switch attr {
-		case "dataschema":
-			origEvent.SetDataSchema("")
-		}
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
 	}
 
-	return origEvent
+	if len(msgs) == 1 {
+		return msgs[0]
+	}
+	return strconv.Itoa(len(msgs)) + " errors occurred: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the aggregated errors, so that errList can be inspected
+// using errors.Is and errors.As.
+func (e errList) Unwrap() []error {
+	return e.errs
 }
 
 type clientOption func(*azservicebus.ClientOptions)
@@ -479,12 +3250,34 @@ func newAzureServiceBusClientOptions(opts ...clientOption) *azservicebus.ClientO
 	return co
 }
 
-func webSocketsClientOption(webSocketsEnable bool) clientOption {
+// defaultDialTimeout is the dial timeout of http.DefaultTransport, which is
+// preserved when the TCP keep-alive interval is overridden.
+const defaultDialTimeout = 30 * time.Second
+
+// webSocketsClientOption returns a clientOption which makes the client
+// connect to Service Bus using AMQP over WebSockets when webSocketsEnable is
+// true, optionally through the given HTTP(S) proxy. A non-zero keepAlive
+// overrides the interval between TCP keep-alive probes, or disables them if
+// negative. The default AMQP transport is left untouched otherwise.
+func webSocketsClientOption(webSocketsEnable bool, proxyURL *url.URL, keepAlive time.Duration) clientOption {
 	return func(opts *azservicebus.ClientOptions) {
 
 		if webSocketsEnable {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.Proxy = proxyFunc(proxyURL)
+			if keepAlive != 0 {
+				transport.DialContext = (&net.Dialer{
+					Timeout:   defaultDialTimeout,
+					KeepAlive: keepAlive,
+				}).DialContext
+			}
+			httpClient := &http.Client{Transport: transport}
+
 			opts.NewWebSocketConn = func(ctx context.Context, args azservicebus.NewWebSocketConnArgs) (net.Conn, error) {
-				opts := &websocket.DialOptions{Subprotocols: []string{"amqp"}}
+				opts := &websocket.DialOptions{
+					HTTPClient:   httpClient,
+					Subprotocols: []string{"amqp"},
+				}
 				wssConn, _, err := websocket.Dial(ctx, args.Host, opts)
 
 				if err != nil {
@@ -496,3 +3289,48 @@ func webSocketsClientOption(webSocketsEnable bool) clientOption {
 		}
 	}
 }
+
+// connectTimeoutClientOption returns a clientOption which bounds the
+// establishment of connections to Service Bus over WebSockets to the given
+// duration, if positive. The establishment of plain AMQP connections can't be
+// bounded that way, since the client library doesn't expose their network
+// settings.
+func connectTimeoutClientOption(timeout time.Duration) clientOption {
+	return func(opts *azservicebus.ClientOptions) {
+		if timeout <= 0 || opts.NewWebSocketConn == nil {
+			return
+		}
+
+		newConn := opts.NewWebSocketConn
+		opts.NewWebSocketConn = func(ctx context.Context, args azservicebus.NewWebSocketConnArgs) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return newConn(ctx, args)
+		}
+	}
+}
+
+// detachedContext is a context.Context which carries the values of its parent,
+// but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+var _ context.Context = (*detachedContext)(nil)
+
+// detach returns a copy of the given context which is never canceled.
+func detach(ctx context.Context) context.Context {
+	return &detachedContext{parent: ctx}
+}
+
+// Deadline implements context.Context.
+func (*detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done implements context.Context.
+func (*detachedContext) Done() <-chan struct{} { return nil }
+
+// Err implements context.Context.
+func (*detachedContext) Err() error { return nil }
+
+// Value implements context.Context.
+func (c *detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
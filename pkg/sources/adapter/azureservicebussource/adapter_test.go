@@ -19,14 +19,40 @@ package azureservicebussource
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/cloudevents/sdk-go/v2/types"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
 
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
 	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/metrics/metricstest"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+	metricstesting "github.com/triggermesh/triggermesh/pkg/metrics/testing"
 )
 
 func TestHandleMessage(t *testing.T) {
@@ -60,9 +86,11 @@ func TestHandleMessage(t *testing.T) {
 			a := &adapter{
 				ceClient: ceClient,
 				msgPrcsr: &defaultMessageProcessor{},
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
 			}
 
-			err := a.handleMessage(context.Background(), msg)
+			err := a.handleMessage(context.Background(), msg, nil)
 			assert.NoError(t, err)
 
 			events := ceClient.Sent()
@@ -75,91 +103,2494 @@ func TestHandleMessage(t *testing.T) {
 	}
 }
 
-func extractDataFromEvent(t *testing.T, b []byte) string {
-	unstructuredEvent := make(map[string]interface{})
-	err := json.Unmarshal(b, &unstructuredEvent)
-	require.NoError(t, err)
+func TestHandleMessageCEOverrides(t *testing.T) {
+	ceClient := adaptertest.NewTestClient()
 
-	dataBytes, err := json.Marshal(unstructuredEvent["Body"])
-	require.NoError(t, err)
+	a := &adapter{
+		ceClient:    ceClient,
+		msgPrcsr:    &fanOutMessageProcessor{numEvents: 2},
+		ceOverrides: map[string]string{"region": "westeurope"},
 
-	var data json.RawMessage
-	err = json.Unmarshal(dataBytes, &data)
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body: []byte(`{"test": null}`),
+		},
+	}
+
+	err := a.handleMessage(context.Background(), msg, nil)
 	require.NoError(t, err)
 
-	return string(data)
+	events := ceClient.Sent()
+	require.Len(t, events, 2)
+	for _, ev := range events {
+		assert.Equal(t, "westeurope", ev.Extensions()["region"])
+	}
 }
 
-func TestParseServiceBusResourceID(t *testing.T) {
-	const resourceIDPrefix = "/subscriptions/s/resourceGroups/rg/providers"
+func TestHandleMessageSourceIdentity(t *testing.T) {
+	testCases := []struct {
+		name           string
+		srcIdentity    string
+		ceOverrides    map[string]string
+		expectIdentity any
+	}{
+		{
+			name:           "Identity is set",
+			srcIdentity:    "my-namespace/my-source",
+			expectIdentity: "my-namespace/my-source",
+		},
+		{
+			name:           "Identity is unset",
+			expectIdentity: nil,
+		},
+		{
+			name:           "Identity is overridden",
+			srcIdentity:    "my-namespace/my-source",
+			ceOverrides:    map[string]string{extSourceIdentity: "custom"},
+			expectIdentity: "custom",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				ceClient:    ceClient,
+				msgPrcsr:    &fanOutMessageProcessor{numEvents: 2},
+				srcIdentity: tc.srcIdentity,
+				ceOverrides: tc.ceOverrides,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body: []byte(`{"test": null}`),
+				},
+			}
 
+			err := a.handleMessage(context.Background(), msg, nil)
+			require.NoError(t, err)
+
+			events := ceClient.Sent()
+			require.Len(t, events, 2)
+			for _, ev := range events {
+				assert.Equal(t, tc.expectIdentity, ev.Extensions()[extSourceIdentity])
+			}
+		})
+	}
+}
+
+func TestHandleMessageAzureScope(t *testing.T) {
 	testCases := []struct {
 		name         string
-		input        string
-		expectErr    bool
-		expectNs     string
-		expectRes    string
-		expectSubRes string
+		entityID     *v1alpha1.AzureResourceID
+		expectSubID  any
+		expectRGName any
+	}{
+		{
+			name: "Entity identified by resource ID",
+			entityID: &v1alpha1.AzureResourceID{
+				SubscriptionID: "00000000-0000-0000-0000-000000000000",
+				ResourceGroup:  "my-rg",
+				ResourceName:   "my-queue",
+			},
+			expectSubID:  "00000000-0000-0000-0000-000000000000",
+			expectRGName: "my-rg",
+		},
+		{
+			name: "Entity identified by connection string",
+			entityID: &v1alpha1.AzureResourceID{
+				Namespace:    "my-namespace",
+				ResourceName: "my-queue",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				ceClient:  ceClient,
+				msgPrcsr:  &defaultMessageProcessor{},
+				scopeExts: azureScopeExtensions(tc.entityID),
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body: []byte(`{"test": null}`),
+				},
+			}
+
+			err := a.handleMessage(context.Background(), msg, nil)
+			require.NoError(t, err)
+
+			events := ceClient.Sent()
+			require.Len(t, events, 1)
+			assert.Equal(t, tc.expectSubID, events[0].Extensions()[extAzureSubscription])
+			assert.Equal(t, tc.expectRGName, events[0].Extensions()[extResourceGroup])
+		})
+	}
+}
+
+func TestHandleMessageStrictValidation(t *testing.T) {
+	const ceSource = "/some/source"
+
+	testCases := []struct {
+		name             string
+		strictValidation bool
+		expectSent       bool
 	}{
 		{
-			name:         "Valid Queue ID",
-			input:        resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/queues/q",
-			expectErr:    false,
-			expectNs:     "ns",
-			expectRes:    "q",
-			expectSubRes: "",
+			name:       "Invalid event is sanitized",
+			expectSent: true,
 		},
 		{
-			name:         "Valid Topic subscription ID",
-			input:        resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t/subscriptions/s",
-			expectErr:    false,
-			expectNs:     "ns",
-			expectRes:    "t",
-			expectSubRes: "s",
+			name:             "Invalid event is rejected",
+			strictValidation: true,
+			expectSent:       false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				ceClient:         ceClient,
+				ceSource:         ceSource,
+				msgPrcsr:         &sourcelessMessageProcessor{},
+				sanitizers:       []EventSanitizer{sanitizers.entries[sanitizerMissingSource]},
+				strictValidation: tc.strictValidation,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body: []byte(`{"test": null}`),
+				},
+			}
+
+			err := a.handleMessage(context.Background(), msg, nil)
+
+			if !tc.expectSent {
+				var delivErr *deliveryError
+				require.ErrorAs(t, err, &delivErr)
+				assert.True(t, delivErr.isFatal(), "Expected the validation error to be fatal")
+				assert.Contains(t, err.Error(), "source", "Expected the error to contain the validation detail")
+				assert.Empty(t, ceClient.Sent())
+				return
+			}
+
+			require.NoError(t, err)
+			events := ceClient.Sent()
+			require.Len(t, events, 1)
+			assert.Equal(t, ceSource, events[0].Source())
+		})
+	}
+}
+
+func TestHandleMessageRawMessage(t *testing.T) {
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		ceClient:      ceClient,
+		msgPrcsr:      &fanOutMessageProcessor{numEvents: 2},
+		includeRawMsg: true,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body: []byte(`{"test": null}`),
 		},
+	}
+
+	err := a.handleMessage(context.Background(), msg, nil)
+	require.NoError(t, err)
+
+	events := ceClient.Sent()
+	require.Len(t, events, 2)
+	for _, ev := range events {
+		assert.Equal(t, "eyJ0ZXN0IjogbnVsbH0=", ev.Extensions()[extRawMessage])
+		assert.NotContains(t, ev.Extensions(), extRawProperties)
+	}
+}
+
+func TestHandleMessageHopLimit(t *testing.T) {
+	testCases := []struct {
+		name           string
+		hopLimit       *hopLimit
+		via            any
+		expectEvents   int
+		expectHops     any
+		expectExceeded any
+	}{
 		{
-			name:      "Not the Service Bus provider",
-			input:     resourceIDPrefix + "/Microsoft.EventHubs/namespaces/ns/queues/q",
-			expectErr: true,
+			name:         "Message was not forwarded",
+			hopLimit:     &hopLimit{entity: "q1", max: 1, action: hopLimitActionDrop},
+			expectEvents: 2,
 		},
 		{
-			name:      "Not a supported Service Bus entity",
-			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/notsupported/x",
-			expectErr: true,
+			name:         "Hops are reported without a limit",
+			via:          "q1,q2,q1",
+			expectEvents: 2,
+			expectHops:   int32(3),
 		},
 		{
-			name:      "Queue ID with a sub-resource",
-			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/queues/q/subscription/s",
-			expectErr: true,
+			name:         "Limit is not exceeded",
+			hopLimit:     &hopLimit{entity: "q1", max: 2, action: hopLimitActionDrop},
+			via:          []any{"q1", "q2", "q1"},
+			expectEvents: 2,
+			expectHops:   int32(3),
 		},
 		{
-			name:      "Topic ID without sub-resource",
-			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t",
-			expectErr: true,
+			name:           "Message exceeding the limit is flagged",
+			hopLimit:       &hopLimit{entity: "q1", max: 1, action: hopLimitActionFlag},
+			via:            []any{"q1", "q2", "Q1"},
+			expectEvents:   2,
+			expectHops:     int32(3),
+			expectExceeded: true,
 		},
 		{
-			name:      "Topic ID with a sub-resource that is not a subscription",
-			input:     resourceIDPrefix + "/Microsoft.ServiceBus/namespaces/ns/topics/t/notsupported/x",
-			expectErr: true,
+			name:         "Message exceeding the limit is dropped",
+			hopLimit:     &hopLimit{entity: "q1", max: 1, action: hopLimitActionDrop},
+			via:          []any{"q1", "q2", "q1"},
+			expectEvents: 0,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			out, err := parseServiceBusResourceID(tc.input)
+			ceClient := adaptertest.NewTestClient()
 
-			if tc.expectErr {
-				assert.Error(t, err)
-				assert.Nil(t, out)
-				return
+			a := &adapter{
+				logger:   logtesting.TestLogger(t),
+				ceClient: ceClient,
+				msgPrcsr: &fanOutMessageProcessor{numEvents: 2},
+				hopLimit: tc.hopLimit,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
 			}
 
-			assert.NoError(t, err)
-			require.NotNil(t, out)
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body: []byte(`{"test": null}`),
+				},
+			}
+			if tc.via != nil {
+				msg.ApplicationProperties = map[string]any{propertyVia: tc.via}
+			}
 
-			assert.Equal(t, tc.expectNs, out.Namespace, "Unexpected resource namespace")
-			assert.Equal(t, tc.expectRes, out.ResourceName, "Unexpected resource name")
-			assert.Equal(t, tc.expectSubRes, out.SubResourceName, "Unexpected sub-resource name")
+			err := a.handleMessage(context.Background(), msg, nil)
+			require.NoError(t, err)
+
+			events := ceClient.Sent()
+			require.Len(t, events, tc.expectEvents)
+			for _, ev := range events {
+				assert.Equal(t, tc.expectHops, ev.Extensions()[extHops])
+				assert.Equal(t, tc.expectExceeded, ev.Extensions()[extHopLimitExceeded])
+			}
+		})
+	}
+}
+
+func TestHandleMessageMetrics(t *testing.T) {
+	const ceSource = "/some/source"
+
+	testCases := []struct {
+		name          string
+		msgPrcsr      MessageProcessor
+		sendResult    protocol.Result
+		expectMetric  string
+		expectTags    map[string]string
+		expectLatency bool
+	}{
+		{
+			name:         "Events are delivered",
+			msgPrcsr:     &defaultMessageProcessor{ceSource: ceSource},
+			expectMetric: "event_processing_success_count",
+			expectTags: map[string]string{
+				"event_type":   "com.microsoft.azure.servicebus.message",
+				"event_source": ceSource,
+			},
+			expectLatency: true,
+		},
+		{
+			name:         "Events delivery fails",
+			msgPrcsr:     &defaultMessageProcessor{ceSource: ceSource},
+			sendResult:   errors.New("sink unavailable"),
+			expectMetric: "event_processing_error_count",
+			expectTags: map[string]string{
+				"event_type":   "com.microsoft.azure.servicebus.message",
+				"event_source": ceSource,
+				"user_managed": "false",
+			},
+		},
+		{
+			name:         "Processing fails",
+			msgPrcsr:     &failingMessageProcessor{},
+			expectMetric: "event_processing_error_count",
+			expectTags: map[string]string{
+				"user_managed": "false",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metricstesting.ResetMetrics(t)
+
+			a := &adapter{
+				logger: logtesting.TestLogger(t),
+				ceClient: &staticResultClient{
+					TestCloudEventsClient: adaptertest.NewTestClient(),
+					result:                tc.sendResult,
+				},
+				msgPrcsr: tc.msgPrcsr,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body: []byte(`{"test": null}`),
+				},
+			}
+
+			_ = a.handleMessage(context.Background(), msg, nil)
+
+			metricstest.CheckCountData(t, tc.expectMetric, tc.expectTags, 1)
+
+			if tc.expectLatency {
+				metricstest.CheckDistributionCount(t, "event_processing_latencies", tc.expectTags, 1)
+			} else {
+				metricstest.CheckStatsNotReported(t, "event_processing_latencies")
+			}
+		})
+	}
+}
+
+func TestHandleMessageNil(t *testing.T) {
+	metricstesting.ResetMetrics(t)
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:   logtesting.TestLogger(t),
+		ceClient: ceClient,
+		msgPrcsr: &defaultMessageProcessor{},
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, a.handleMessage(context.Background(), nil, nil))
+	}
+
+	assert.Empty(t, ceClient.Sent())
+	metricstest.CheckCountData(t, "nil_message_count", map[string]string{}, 3)
+	metricstest.CheckStatsNotReported(t, "event_processing_success_count", "event_processing_error_count")
+}
+
+func TestHandleMessageDeliveryLag(t *testing.T) {
+	enqueuedTime := time.Now().Add(-3 * time.Second)
+
+	testCases := []struct {
+		name         string
+		enqueuedTime *time.Time
+		expectLag    bool
+	}{
+		{
+			name:         "Message has an enqueued time",
+			enqueuedTime: &enqueuedTime,
+			expectLag:    true,
+		},
+		{
+			name:         "Message has no enqueued time",
+			enqueuedTime: nil,
+			expectLag:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metricstesting.ResetMetrics(t)
+
+			a := &adapter{
+				logger:   logtesting.TestLogger(t),
+				ceClient: adaptertest.NewTestClient(),
+				msgPrcsr: &defaultMessageProcessor{},
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body:         []byte(`{"test": null}`),
+					EnqueuedTime: tc.enqueuedTime,
+				},
+			}
+
+			err := a.handleMessage(context.Background(), msg, nil)
+			require.NoError(t, err)
+
+			if tc.expectLag {
+				metricstest.CheckDistributionCount(t, "event_delivery_lag", map[string]string{}, 1)
+			} else {
+				metricstest.CheckStatsNotReported(t, "event_delivery_lag")
+			}
+		})
+	}
+}
+
+func TestErrList(t *testing.T) {
+	errSinkUnavailable := errors.New("sink unavailable")
+
+	errs := errList{
+		errs: []error{
+			&sendError{eventID: "event-1", err: errSinkUnavailable},
+			&sendError{eventID: "event-2", err: errors.New("bad request")},
+		},
+	}
+
+	const expectMsg = "2 errors occurred: " +
+		"failed to send event with ID event-1: sink unavailable; " +
+		"failed to send event with ID event-2: bad request"
+
+	err := fmt.Errorf("sending events to the sink: %w", errs)
+
+	assert.Equal(t, "sending events to the sink: "+expectMsg, err.Error())
+	assert.ErrorIs(t, err, errSinkUnavailable)
+
+	var sendErr *sendError
+	require.ErrorAs(t, err, &sendErr)
+	assert.Equal(t, "event-1", sendErr.eventID)
+
+	single := errList{errs: errs.errs[:1]}
+	assert.Equal(t, "failed to send event with ID event-1: sink unavailable", single.Error())
+}
+
+func TestSendCloudEventWithRetry(t *testing.T) {
+	unavailable := cehttp.NewResult(http.StatusServiceUnavailable, "unavailable")
+	badRequest := cehttp.NewResult(http.StatusBadRequest, "bad request")
+
+	testCases := []struct {
+		name           string
+		results        []protocol.Result
+		maxRetries     int
+		expectAttempts int
+		expectErr      bool
+	}{
+		{
+			name:           "Transient errors are retried",
+			results:        []protocol.Result{unavailable, unavailable, nil},
+			maxRetries:     3,
+			expectAttempts: 3,
+		},
+		{
+			name:           "Retries are exhausted",
+			results:        []protocol.Result{unavailable, unavailable, unavailable, nil},
+			maxRetries:     2,
+			expectAttempts: 3,
+			expectErr:      true,
+		},
+		{
+			name:           "Permanent errors are not retried",
+			results:        []protocol.Result{badRequest, nil},
+			maxRetries:     3,
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+		{
+			name:           "Retries are disabled",
+			results:        []protocol.Result{unavailable, nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ceClient := &sequenceResultClient{
+				TestCloudEventsClient: adaptertest.NewTestClient(),
+				results:               tc.results,
+			}
+
+			a := &adapter{
+				logger:               logtesting.TestLogger(t),
+				ceClient:             ceClient,
+				sinkMaxRetries:       tc.maxRetries,
+				sinkRetryBaseBackoff: time.Millisecond,
+				sinkRetryMaxBackoff:  time.Millisecond,
+			}
+
+			ev := newTestEvent("1")
+			result := a.sendCloudEventWithRetry(context.Background(), &ev)
+
+			if tc.expectErr {
+				assert.False(t, cloudevents.IsACK(result), "Expected the delivery to fail")
+			} else {
+				assert.True(t, cloudevents.IsACK(result), "Unexpected delivery failure: %v", result)
+			}
+			assert.Equal(t, tc.expectAttempts, ceClient.attempts)
 		})
 	}
+
+	t.Run("Context cancellation aborts retries", func(t *testing.T) {
+		ceClient := &sequenceResultClient{
+			TestCloudEventsClient: adaptertest.NewTestClient(),
+			results:               []protocol.Result{unavailable, unavailable},
+		}
+
+		a := &adapter{
+			logger:               logtesting.TestLogger(t),
+			ceClient:             ceClient,
+			sinkMaxRetries:       1,
+			sinkRetryBaseBackoff: time.Hour,
+			sinkRetryMaxBackoff:  time.Hour,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		ev := newTestEvent("1")
+
+		start := time.Now()
+		result := a.sendCloudEventWithRetry(ctx, &ev)
+
+		assert.False(t, cloudevents.IsACK(result))
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.Equal(t, 1, ceClient.attempts)
+	})
+
+	t.Run("Hanging sink times out", func(t *testing.T) {
+		ceClient := &hangingClient{
+			TestCloudEventsClient: adaptertest.NewTestClient(),
+			numHangs:              1,
+		}
+
+		a := &adapter{
+			logger:               logtesting.TestLogger(t),
+			ceClient:             ceClient,
+			sinkMaxRetries:       1,
+			sinkRetryBaseBackoff: time.Millisecond,
+			sinkRetryMaxBackoff:  time.Millisecond,
+			sinkTimeout:          20 * time.Millisecond,
+		}
+
+		ev := newTestEvent("1")
+		result := a.sendCloudEventWithRetry(context.Background(), &ev)
+
+		assert.True(t, cloudevents.IsACK(result), "Unexpected delivery failure: %v", result)
+		assert.Equal(t, 2, ceClient.attempts, "Expected the attempt which timed out to be retried")
+		assert.Len(t, ceClient.Sent(), 1)
+	})
+
+	t.Run("Hanging sink without retries", func(t *testing.T) {
+		ceClient := &hangingClient{
+			TestCloudEventsClient: adaptertest.NewTestClient(),
+			numHangs:              1,
+		}
+
+		a := &adapter{
+			logger:      logtesting.TestLogger(t),
+			ceClient:    ceClient,
+			sinkTimeout: 20 * time.Millisecond,
+		}
+
+		ev := newTestEvent("1")
+		result := a.sendCloudEventWithRetry(context.Background(), &ev)
+
+		assert.False(t, cloudevents.IsACK(result), "Expected the delivery to fail")
+		assert.ErrorIs(t, result, context.DeadlineExceeded)
+	})
+
+	t.Run("Rate limiter paces deliveries", func(t *testing.T) {
+		ceClient := adaptertest.NewTestClient()
+
+		a := &adapter{
+			logger:      logtesting.TestLogger(t),
+			ceClient:    ceClient,
+			sendLimiter: rate.NewLimiter(rate.Every(50*time.Millisecond), 1),
+		}
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			ev := newTestEvent(strconv.Itoa(i))
+			result := a.sendCloudEventWithRetry(context.Background(), &ev)
+			require.True(t, cloudevents.IsACK(result), "Unexpected delivery failure: %v", result)
+		}
+
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond,
+			"Expected deliveries beyond the burst to wait for the rate limiter")
+		assert.Len(t, ceClient.Sent(), 3)
+	})
+
+	t.Run("Context cancellation aborts waiting for the rate limiter", func(t *testing.T) {
+		ceClient := adaptertest.NewTestClient()
+
+		limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+		require.True(t, limiter.Allow(), "Expected the burst to be consumed")
+
+		a := &adapter{
+			logger:      logtesting.TestLogger(t),
+			ceClient:    ceClient,
+			sendLimiter: limiter,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		ev := newTestEvent("1")
+
+		start := time.Now()
+		result := a.sendCloudEventWithRetry(ctx, &ev)
+
+		assert.False(t, cloudevents.IsACK(result), "Expected the delivery to fail")
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.Empty(t, ceClient.Sent())
+	})
+}
+
+func TestClassifySendResult(t *testing.T) {
+	testCases := []struct {
+		name   string
+		result protocol.Result
+		expect sendFailureClass
+	}{
+		{
+			name:   "Delivered",
+			result: nil,
+			expect: sendFailureNone,
+		},
+		{
+			name:   "Acknowledged",
+			result: protocol.ResultACK,
+			expect: sendFailureNone,
+		},
+		{
+			name:   "Server error",
+			result: cehttp.NewResult(http.StatusBadGateway, "bad gateway"),
+			expect: sendFailureRetryable,
+		},
+		{
+			name:   "Throttled",
+			result: cehttp.NewResult(http.StatusTooManyRequests, "too many requests"),
+			expect: sendFailureRetryable,
+		},
+		{
+			name:   "Request timeout",
+			result: cehttp.NewResult(http.StatusRequestTimeout, "request timeout"),
+			expect: sendFailureRetryable,
+		},
+		{
+			name:   "Connection error",
+			result: errors.New("connection refused"),
+			expect: sendFailureRetryable,
+		},
+		{
+			name:   "Send timeout",
+			result: context.DeadlineExceeded,
+			expect: sendFailureRetryable,
+		},
+		{
+			name:   "Bad request",
+			result: cehttp.NewResult(http.StatusBadRequest, "bad request"),
+			expect: sendFailureFatal,
+		},
+		{
+			name:   "Invalid event",
+			result: event.ValidationError{"source": errors.New("REQUIRED but MISSING")},
+			expect: sendFailureFatal,
+		},
+		{
+			name:   "Not acknowledged without status",
+			result: protocol.ResultNACK,
+			expect: sendFailureRetryable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, classifySendResult(tc.result))
+		})
+	}
+}
+
+func TestSettleMessage(t *testing.T) {
+	testCases := []struct {
+		name                string
+		msgPrcsr            MessageProcessor
+		sendResult          protocol.Result
+		deliveryCount       uint32
+		maxDeliveryAttempts uint32
+		scheduledTime       *time.Time
+		skipNotDue          bool
+		enqueuedTime        *time.Time
+		timeToLive          *time.Duration
+		skipExpired         bool
+		clockSkew           time.Duration
+		expectSettlement    string
+		expectReason        string
+		expectNotSent       bool
+	}{
+		{
+			name:             "Events are delivered",
+			msgPrcsr:         &defaultMessageProcessor{},
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Events delivery fails",
+			msgPrcsr:         &defaultMessageProcessor{},
+			sendResult:       errors.New("sink unavailable"),
+			deliveryCount:    10,
+			expectSettlement: settledAbandon,
+		},
+		{
+			name:             "Processing fails and dead-lettering is disabled",
+			msgPrcsr:         &failingMessageProcessor{},
+			deliveryCount:    10,
+			expectSettlement: settledAbandon,
+		},
+		{
+			name:                "Processing fails below the max delivery attempts",
+			msgPrcsr:            &failingMessageProcessor{},
+			deliveryCount:       2,
+			maxDeliveryAttempts: 3,
+			expectSettlement:    settledAbandon,
+		},
+		{
+			name:                "Processing fails at the max delivery attempts",
+			msgPrcsr:            &failingMessageProcessor{},
+			deliveryCount:       3,
+			maxDeliveryAttempts: 3,
+			expectSettlement:    settledDeadLetter,
+			expectReason:        deadLetterReasonProcessing,
+		},
+		{
+			name:             "Events are rejected by the sink",
+			msgPrcsr:         &defaultMessageProcessor{},
+			sendResult:       cehttp.NewResult(http.StatusBadRequest, "bad request"),
+			expectSettlement: settledDeadLetter,
+			expectReason:     deadLetterReasonRejected,
+		},
+		{
+			name:             "Events are throttled by the sink",
+			msgPrcsr:         &defaultMessageProcessor{},
+			sendResult:       cehttp.NewResult(http.StatusTooManyRequests, "too many requests"),
+			expectSettlement: settledAbandon,
+		},
+		{
+			name:             "Message is not due and skipping is enabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			scheduledTime:    to.Ptr(time.Now().Add(time.Hour)),
+			skipNotDue:       true,
+			expectSettlement: settledDefer,
+			expectNotSent:    true,
+		},
+		{
+			name:             "Message is not due and skipping is disabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			scheduledTime:    to.Ptr(time.Now().Add(time.Hour)),
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Message is due and skipping is enabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			scheduledTime:    to.Ptr(time.Now().Add(-time.Hour)),
+			skipNotDue:       true,
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Message is expired and skipping is enabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			enqueuedTime:     to.Ptr(time.Now().Add(-time.Hour)),
+			timeToLive:       to.Ptr(time.Minute),
+			skipExpired:      true,
+			expectSettlement: settledComplete,
+			expectNotSent:    true,
+		},
+		{
+			name:             "Message is expired and skipping is disabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			enqueuedTime:     to.Ptr(time.Now().Add(-time.Hour)),
+			timeToLive:       to.Ptr(time.Minute),
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Message is not expired and skipping is enabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			enqueuedTime:     to.Ptr(time.Now().Add(-time.Hour)),
+			timeToLive:       to.Ptr(2 * time.Hour),
+			skipExpired:      true,
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Message is expired within the clock skew and skipping is enabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			enqueuedTime:     to.Ptr(time.Now().Add(-time.Hour)),
+			timeToLive:       to.Ptr(time.Hour - 5*time.Second),
+			skipExpired:      true,
+			clockSkew:        time.Minute,
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Message is not due within the clock skew and skipping is enabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			scheduledTime:    to.Ptr(time.Now().Add(5 * time.Second)),
+			skipNotDue:       true,
+			clockSkew:        time.Minute,
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Message without time to live and skipping is enabled",
+			msgPrcsr:         &defaultMessageProcessor{},
+			enqueuedTime:     to.Ptr(time.Now().Add(-time.Hour)),
+			skipExpired:      true,
+			expectSettlement: settledComplete,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disp := &fakeDispositioner{}
+
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				logger: logtesting.TestLogger(t),
+				ceClient: &staticResultClient{
+					TestCloudEventsClient: ceClient,
+					result:                tc.sendResult,
+				},
+				msgPrcsr:            tc.msgPrcsr,
+				dispositioner:       disp,
+				maxDeliveryAttempts: tc.maxDeliveryAttempts,
+				skipNotDue:          tc.skipNotDue,
+				skipExpired:         tc.skipExpired,
+				clock:               newMessageClock(tc.clockSkew),
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				Body:                 []byte(`{"test": null}`),
+				DeliveryCount:        tc.deliveryCount,
+				ScheduledEnqueueTime: tc.scheduledTime,
+				EnqueuedTime:         tc.enqueuedTime,
+				TimeToLive:           tc.timeToLive,
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			err = a.settleMessage(ctx, fm, a.handleMessage(ctx, fm.serializable, nil))
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectSettlement, disp.lastSettlement(), "Unexpected message settlement")
+			if tc.expectSettlement == settledDeadLetter {
+				assert.Equal(t, []string{tc.expectReason}, disp.deadLetterReasons)
+			}
+			if tc.expectNotSent {
+				assert.Empty(t, ceClient.Sent(), "Expected the message not to be sent")
+			}
+		})
+	}
+}
+
+func TestSkipNotDueMessageNotDeadLettered(t *testing.T) {
+	rcvr := &redeliveringReceiver{
+		maxDeliveryCount: 10,
+	}
+	rcvr.batch = []*azservicebus.ReceivedMessage{{
+		MessageID:            "1",
+		SequenceNumber:       to.Ptr[int64](1),
+		Body:                 []byte(`{"test": null}`),
+		DeliveryCount:        1,
+		ScheduledEnqueueTime: to.Ptr(time.Now().Add(time.Hour)),
+	}}
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		msgRcvr:       rcvr,
+		ceClient:      ceClient,
+		msgPrcsr:      &defaultMessageProcessor{},
+		maxConcurrent: 1,
+		prefetchCount: 1,
+		skipNotDue:    true,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- a.Start(ctx)
+	}()
+
+	settled := func() int {
+		rcvr.mu.Lock()
+		defer rcvr.mu.Unlock()
+		return len(rcvr.deferred) + len(rcvr.deadLettered)
+	}
+
+	require.Eventually(t, func() bool { return settled() > 0 },
+		5*time.Second, 10*time.Millisecond, "The message should be settled")
+
+	// Leave time for redeliveries, if any.
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the adapter to stop")
+	}
+
+	assert.Equal(t, []string{"1"}, rcvr.deferred, "The message should be deferred")
+	assert.Empty(t, rcvr.abandoned, "The message should not be redelivered")
+	assert.Empty(t, rcvr.deadLettered, "The message should not be dead-lettered")
+	assert.Empty(t, ceClient.Sent(), "The message should not be sent")
+}
+
+func TestSettleMessageOversized(t *testing.T) {
+	testCases := []struct {
+		name             string
+		bodySize         int
+		expectDeadLetter bool
+		expectSent       int
+	}{
+		{
+			name:       "Message is within the maximum size",
+			bodySize:   512,
+			expectSent: 1,
+		},
+		{
+			name:             "Message exceeds the maximum size",
+			bodySize:         2048,
+			expectDeadLetter: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disp := &fakeDispositioner{}
+
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				logger:        logtesting.TestLogger(t),
+				ceClient:      ceClient,
+				msgPrcsr:      &defaultMessageProcessor{},
+				dispositioner: disp,
+				maxEventSize:  1024,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			body := []byte(`{"data": "` + strings.Repeat("x", tc.bodySize-len(`{"data": ""}`)) + `"}`)
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID: "1",
+				Body:      body,
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			err = a.settleMessage(ctx, fm, a.handleMessage(ctx, fm.serializable, nil))
+			assert.NoError(t, err)
+
+			if tc.expectDeadLetter {
+				assert.Equal(t, []string{deadLetterReasonSize}, disp.deadLetterReasons)
+				assert.Equal(t, settledDeadLetter, disp.lastSettlement(), "Oversized message should not be completed")
+			} else {
+				assert.Empty(t, disp.deadLetterReasons)
+				assert.Equal(t, settledComplete, disp.lastSettlement(), "Message should be completed")
+			}
+
+			assert.Len(t, ceClient.Sent(), tc.expectSent)
+		})
+	}
+}
+
+func TestSettleMessageTimeout(t *testing.T) {
+	testCases := []struct {
+		name                string
+		numHangs            int
+		deliveryCount       uint32
+		maxDeliveryAttempts uint32
+		expectSettlement    string
+		expectTimeouts      int64
+	}{
+		{
+			name:             "Message is handled within the timeout",
+			expectSettlement: settledComplete,
+		},
+		{
+			name:                "Handling times out below the max delivery attempts",
+			numHangs:            1,
+			deliveryCount:       2,
+			maxDeliveryAttempts: 3,
+			expectSettlement:    settledAbandon,
+			expectTimeouts:      1,
+		},
+		{
+			name:                "Handling times out at the max delivery attempts",
+			numHangs:            1,
+			deliveryCount:       3,
+			maxDeliveryAttempts: 3,
+			expectSettlement:    settledDeadLetter,
+			expectTimeouts:      1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := recordMetrics(t)
+
+			disp := &fakeDispositioner{}
+
+			a := &adapter{
+				logger: logtesting.TestLogger(t),
+				ceClient: &hangingClient{
+					TestCloudEventsClient: adaptertest.NewTestClient(),
+					numHangs:              tc.numHangs,
+				},
+				msgPrcsr:            &defaultMessageProcessor{},
+				dispositioner:       disp,
+				maxDeliveryAttempts: tc.maxDeliveryAttempts,
+				messageTimeout:      50 * time.Millisecond,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID:     "1",
+				Body:          []byte(`{"test": null}`),
+				DeliveryCount: tc.deliveryCount,
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			handleErr := a.handleMessage(ctx, fm.serializable, nil)
+			var timeoutErr *messageTimeoutError
+			assert.Equal(t, tc.expectTimeouts != 0, errors.As(handleErr, &timeoutErr), "Unexpected error: %v", handleErr)
+
+			err = a.settleMessage(ctx, fm, handleErr)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectSettlement, disp.lastSettlement(), "Unexpected message settlement")
+			if tc.expectSettlement == settledDeadLetter {
+				assert.Equal(t, []string{deadLetterReasonTimeout}, disp.deadLetterReasons)
+			}
+
+			if tc.expectTimeouts != 0 {
+				m.assertTotal("message_timeout_count", nil, float64(tc.expectTimeouts))
+			} else {
+				m.assertNotRecorded("message_timeout_count")
+			}
+		})
+	}
+}
+
+func TestSettleMessageCompletionPolicy(t *testing.T) {
+	errSend := errors.New("sink unavailable")
+
+	testCases := []struct {
+		name             string
+		policy           string
+		sendResults      []protocol.Result
+		expectSettlement string
+	}{
+		{
+			name:             "All policy with partial delivery",
+			policy:           completionPolicyAll,
+			sendResults:      []protocol.Result{nil, errSend},
+			expectSettlement: settledAbandon,
+		},
+		{
+			name:             "Any policy with partial delivery",
+			policy:           completionPolicyAny,
+			sendResults:      []protocol.Result{errSend, nil},
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Any policy without delivery",
+			policy:           completionPolicyAny,
+			sendResults:      []protocol.Result{errSend, errSend},
+			expectSettlement: settledAbandon,
+		},
+		{
+			name:             "Best-effort policy with partial delivery",
+			policy:           completionPolicyBestEffort,
+			sendResults:      []protocol.Result{nil, errSend},
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Best-effort policy without delivery",
+			policy:           completionPolicyBestEffort,
+			sendResults:      []protocol.Result{errSend, errSend},
+			expectSettlement: settledDeadLetter,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disp := &fakeDispositioner{}
+
+			a := &adapter{
+				logger: logtesting.TestLogger(t),
+				ceClient: &sequenceResultClient{
+					TestCloudEventsClient: adaptertest.NewTestClient(),
+					results:               tc.sendResults,
+				},
+				msgPrcsr:         &fanOutMessageProcessor{numEvents: len(tc.sendResults)},
+				dispositioner:    disp,
+				completionPolicy: tc.policy,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				Body: []byte(`{"test": null}`),
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			err = a.settleMessage(ctx, fm, a.handleMessage(ctx, fm.serializable, nil))
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectSettlement, disp.lastSettlement(), "Unexpected message settlement")
+			if tc.expectSettlement == settledDeadLetter {
+				assert.Equal(t, []string{deadLetterReasonDelivery}, disp.deadLetterReasons)
+			}
+		})
+	}
+}
+
+func TestHandleMessageProcessorPanic(t *testing.T) {
+	testCases := []struct {
+		name             string
+		deliveryCount    uint32
+		expectSettlement string
+	}{
+		{
+			name:             "Message is abandoned",
+			deliveryCount:    1,
+			expectSettlement: settledAbandon,
+		},
+		{
+			name:             "Message is dead-lettered after the maximum delivery attempts",
+			deliveryCount:    3,
+			expectSettlement: settledDeadLetter,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metricstesting.ResetMetrics(t)
+
+			ceClient := adaptertest.NewTestClient()
+			disp := &fakeDispositioner{}
+
+			a := &adapter{
+				logger:              logtesting.TestLogger(t),
+				ceClient:            ceClient,
+				msgPrcsr:            &panickingMessageProcessor{},
+				dispositioner:       disp,
+				maxDeliveryAttempts: 3,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID:     "someMessageID",
+				Body:          []byte(`{"test": null}`),
+				DeliveryCount: tc.deliveryCount,
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			handleErr := a.handleMessage(ctx, fm.serializable, nil)
+			var procErr *processingError
+			assert.ErrorAs(t, handleErr, &procErr)
+			assert.ErrorIs(t, handleErr, errProcessorPanic)
+
+			require.NoError(t, a.settleMessage(ctx, fm, handleErr))
+
+			assert.Empty(t, ceClient.Sent())
+			assert.Equal(t, tc.expectSettlement, disp.lastSettlement(), "Unexpected message settlement")
+			if tc.expectSettlement == settledDeadLetter {
+				assert.Equal(t, []string{deadLetterReasonPanic}, disp.deadLetterReasons)
+			}
+
+			metricstest.CheckCountData(t, "processor_panic_count", map[string]string{}, 1)
+		})
+	}
+}
+
+func TestSettleMessageExplodedJSONArray(t *testing.T) {
+	errSend := errors.New("sink unavailable")
+
+	testCases := []struct {
+		name             string
+		sendResults      []protocol.Result
+		expectSettlement string
+	}{
+		{
+			name:             "All events are delivered",
+			sendResults:      []protocol.Result{nil, nil, nil},
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Some events are not delivered",
+			sendResults:      []protocol.Result{nil, errSend, nil},
+			expectSettlement: settledAbandon,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disp := &fakeDispositioner{}
+
+			ceClient := &sequenceResultClient{
+				TestCloudEventsClient: adaptertest.NewTestClient(),
+				results:               tc.sendResults,
+			}
+
+			a := &adapter{
+				logger:   logtesting.TestLogger(t),
+				ceClient: ceClient,
+				msgPrcsr: &defaultMessageProcessor{
+					explodeJSONArray: true,
+				},
+				dispositioner: disp,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID: "batch",
+				Body:      []byte(`[{"a": 1}, {"b": 2}, {"c": 3}]`),
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			err = a.settleMessage(ctx, fm, a.handleMessage(ctx, fm.serializable, nil))
+			assert.NoError(t, err)
+
+			assert.Equal(t, len(tc.sendResults), ceClient.attempts, "Expected one event per array element")
+			assert.Equal(t, tc.expectSettlement, disp.lastSettlement(), "Unexpected message settlement")
+		})
+	}
+}
+
+func TestHandleMessageDisposition(t *testing.T) {
+	errSinkUnavailable := errors.New("sink unavailable")
+
+	testCases := []struct {
+		name            string
+		sendResults     []protocol.Result
+		expectFailedIDs []string
+		expectCompleted bool
+	}{
+		{
+			name:            "All events are acknowledged",
+			sendResults:     []protocol.Result{protocol.ResultACK, protocol.ResultACK},
+			expectCompleted: true,
+		},
+		{
+			name:            "One event is not acknowledged",
+			sendResults:     []protocol.Result{protocol.ResultACK, protocol.ResultNACK},
+			expectFailedIDs: []string{"1"},
+		},
+		{
+			name: "No event is delivered",
+			sendResults: []protocol.Result{
+				cehttp.NewResult(http.StatusBadRequest, "bad request"),
+				errSinkUnavailable,
+			},
+			expectFailedIDs: []string{"0", "1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &fakeReceiver{}
+
+			a := &adapter{
+				logger: logtesting.TestLogger(t),
+				ceClient: &sequenceResultClient{
+					TestCloudEventsClient: adaptertest.NewTestClient(),
+					results:               tc.sendResults,
+				},
+				msgPrcsr: &fanOutMessageProcessor{numEvents: len(tc.sendResults)},
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID: "msg",
+				Body:      []byte(`{"test": null}`),
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				rcvr:         rcvr,
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			handleErr := a.handleMessage(ctx, fm.serializable, nil)
+
+			if tc.expectFailedIDs == nil {
+				assert.NoError(t, handleErr)
+			} else {
+				var delivErr *deliveryError
+				require.ErrorAs(t, handleErr, &delivErr)
+				assert.Equal(t, len(tc.sendResults)-len(tc.expectFailedIDs), delivErr.numDelivered())
+
+				var failedIDs []string
+				for _, err := range delivErr.errs.errs {
+					var sendErr *sendError
+					require.ErrorAs(t, err, &sendErr, "Send errors should be aggregated")
+					failedIDs = append(failedIDs, sendErr.eventID)
+				}
+				assert.Equal(t, tc.expectFailedIDs, failedIDs)
+			}
+
+			err = a.settleMessage(ctx, fm, handleErr)
+			assert.NoError(t, err)
+
+			if tc.expectCompleted {
+				assert.Equal(t, []string{"msg"}, rcvr.completed)
+				assert.Empty(t, rcvr.abandoned)
+			} else {
+				assert.Empty(t, rcvr.completed)
+				assert.Equal(t, []string{"msg"}, rcvr.abandoned)
+			}
+		})
+	}
+}
+
+func TestConsumeConcurrency(t *testing.T) {
+	const maxConcurrent = 3
+	const numMessages = 30
+
+	disp := &fakeDispositioner{}
+
+	ceClient := &concurrencyTrackingClient{
+		TestCloudEventsClient: adaptertest.NewTestClient(),
+	}
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		ceClient:      ceClient,
+		msgPrcsr:      &defaultMessageProcessor{},
+		dispositioner: disp,
+		maxConcurrent: maxConcurrent,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgChan := make(chan *fullMessage)
+	errChan := make(chan error, maxConcurrent)
+
+	wg := &sync.WaitGroup{}
+	a.runConsumers(ctx, wg, msgChan, errChan)
+
+	for i := 0; i < numMessages; i++ {
+		msgChan <- &fullMessage{
+			received: &azservicebus.ReceivedMessage{},
+			serializable: &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body: []byte(`{"test": null}`),
+				},
+			},
+		}
+	}
+
+	close(msgChan)
+
+	require.Eventually(t, func() bool {
+		return disp.count(settledComplete) == numMessages
+	}, 5*time.Second, 10*time.Millisecond, "All messages should be completed")
+
+	wg.Wait()
+
+	assert.Empty(t, errChan)
+	assert.Len(t, ceClient.Sent(), numMessages)
+	assert.LessOrEqual(t, atomic.LoadInt32(&ceClient.maxInFlight), int32(maxConcurrent),
+		"The number of concurrent handlers should never exceed the configured bound")
+}
+
+func TestStartDrain(t *testing.T) {
+	testCases := []struct {
+		name            string
+		sendDelay       time.Duration
+		drainTimeout    time.Duration
+		expectCompleted []string
+		expectAbandoned []string
+	}{
+		{
+			name:            "In-flight message handled within the drain timeout",
+			sendDelay:       100 * time.Millisecond,
+			drainTimeout:    5 * time.Second,
+			expectCompleted: []string{"1"},
+			expectAbandoned: []string{"2"},
+		},
+		{
+			name:            "Drain timeout elapses",
+			sendDelay:       time.Hour,
+			drainTimeout:    50 * time.Millisecond,
+			expectAbandoned: []string{"1", "2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &fakeReceiver{
+				batch: []*azservicebus.ReceivedMessage{
+					{MessageID: "1", Body: []byte(`{"test": null}`)},
+					{MessageID: "2", Body: []byte(`{"test": null}`)},
+				},
+			}
+
+			ceClient := &slowClient{
+				TestCloudEventsClient: adaptertest.NewTestClient(),
+				delay:                 tc.sendDelay,
+				sending:               make(chan struct{}),
+			}
+
+			settlements := newSettlementCounter(receiverDispositioner{})
+
+			a := &adapter{
+				logger:        logtesting.TestLogger(t),
+				msgRcvr:       rcvr,
+				ceClient:      ceClient,
+				msgPrcsr:      &defaultMessageProcessor{},
+				maxConcurrent: 1,
+				prefetchCount: 2,
+				drainTimeout:  tc.drainTimeout,
+				dispositioner: settlements,
+				settlements:   settlements,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errCh := make(chan error)
+			go func() {
+				errCh <- a.Start(ctx)
+			}()
+
+			select {
+			case <-ceClient.sending:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the first message to be handled")
+			}
+
+			cancel()
+
+			select {
+			case err := <-errCh:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the adapter to stop")
+			}
+
+			assert.ElementsMatch(t, tc.expectCompleted, rcvr.completed, "Unexpected completed messages")
+			assert.ElementsMatch(t, tc.expectAbandoned, rcvr.abandoned, "Unexpected abandoned messages")
+
+			counts := settlements.counts()
+			assert.EqualValues(t, len(tc.expectCompleted), counts.completed, "Unexpected count of completed messages")
+			assert.EqualValues(t, len(tc.expectAbandoned), counts.abandoned, "Unexpected count of abandoned messages")
+		})
+	}
+}
+
+func TestStartDrainDeferredCompletions(t *testing.T) {
+	testCases := []struct {
+		name            string
+		completeErr     error
+		expectCompleted int64
+	}{
+		{
+			name:            "Deferred completions are flushed",
+			expectCompleted: 2,
+		},
+		{
+			name:        "Deferred completions fail",
+			completeErr: errors.New("lock lost"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := logtesting.TestLogger(t)
+
+			rcvr := &fakeReceiver{
+				batch: []*azservicebus.ReceivedMessage{
+					{MessageID: "1", Body: []byte(`{"test": null}`)},
+					{MessageID: "2", Body: []byte(`{"test": null}`)},
+				},
+			}
+
+			ceClient := adaptertest.NewTestClient()
+
+			disp := &completionFailingDispositioner{
+				fakeDispositioner: &fakeDispositioner{},
+				err:               tc.completeErr,
+			}
+			settlements := newSettlementCounter(disp)
+			completions := newCompletionBatcher(settlements, logger, 10, time.Hour)
+
+			a := &adapter{
+				logger:        logger,
+				msgRcvr:       rcvr,
+				ceClient:      ceClient,
+				msgPrcsr:      &defaultMessageProcessor{},
+				maxConcurrent: 1,
+				prefetchCount: 2,
+				drainTimeout:  5 * time.Second,
+				dispositioner: completions,
+				completions:   completions,
+				settlements:   settlements,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errCh := make(chan error)
+			go func() {
+				errCh <- a.Start(ctx)
+			}()
+
+			require.Eventually(t, func() bool { return len(ceClient.Sent()) == 2 },
+				5*time.Second, 10*time.Millisecond, "Timed out waiting for the messages to be handled")
+
+			assert.Zero(t, settlements.counts().completed, "Completions should only be counted once flushed")
+
+			cancel()
+
+			select {
+			case err := <-errCh:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the adapter to stop")
+			}
+
+			assert.Equal(t, tc.expectCompleted, settlements.counts().completed, "Unexpected count of completed messages")
+		})
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	testCases := []struct {
+		name          string
+		env           envConfig
+		expectTimeout time.Duration
+	}{
+		{
+			name:          "Alias not set",
+			env:           envConfig{DrainTimeout: 20 * time.Second},
+			expectTimeout: 20 * time.Second,
+		},
+		{
+			name:          "Alias overrides the drain timeout",
+			env:           envConfig{DrainTimeout: 20 * time.Second, ShutdownGracePeriod: 45 * time.Second},
+			expectTimeout: 45 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectTimeout, drainTimeout(&tc.env))
+		})
+	}
+}
+
+func TestDefaultProcessorOptions(t *testing.T) {
+	defaults := func() envConfig {
+		return envConfig{
+			CEIDSource:      ceIDSourceMessageID,
+			CETimeSource:    ceTimeSourceEnqueuedTime,
+			CESubjectSource: ceSubjectSourceNone,
+			CESpecVersion:   "1.0",
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		setOpts    func(*envConfig)
+		expectOpts []string
+	}{
+		{
+			name:    "Defaults",
+			setOpts: func(*envConfig) {},
+		},
+		{
+			name: "CloudEvent attributes",
+			setOpts: func(env *envConfig) {
+				env.CEIDSource = ceIDSourceUUID
+				env.CESubjectFrom = "$.id"
+				env.CESpecVersion = "0.3"
+			},
+			expectOpts: []string{"SERVICEBUS_CE_ID_SOURCE", "SERVICEBUS_CE_SUBJECT_FROM", "SERVICEBUS_CE_SPECVERSION"},
+		},
+		{
+			name: "Transformations of the body",
+			setOpts: func(env *envConfig) {
+				env.BodyTransform = "$.data"
+				env.ExplodeJSONArray = true
+			},
+			expectOpts: []string{"SERVICEBUS_BODY_TRANSFORM", "SERVICEBUS_EXPLODE_JSON_ARRAY"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := defaults()
+			tc.setOpts(&env)
+			assert.Equal(t, tc.expectOpts, defaultProcessorOptions(&env))
+		})
+	}
+}
+
+func TestWebSocketsClientOption(t *testing.T) {
+	opts := newAzureServiceBusClientOptions(webSocketsClientOption(false, nil, 0))
+	assert.Nil(t, opts.NewWebSocketConn, "The default AMQP transport should be used")
+
+	opts = newAzureServiceBusClientOptions(webSocketsClientOption(true, nil, 0))
+	assert.NotNil(t, opts.NewWebSocketConn, "AMQP over WebSockets should be used")
+}
+
+func TestConnectTimeoutClientOption(t *testing.T) {
+	opts := newAzureServiceBusClientOptions(
+		webSocketsClientOption(false, nil, 0),
+		connectTimeoutClientOption(time.Second),
+	)
+	assert.Nil(t, opts.NewWebSocketConn, "The default AMQP transport should be used")
+
+	// The listener accepts connections but never completes the WebSocket
+	// handshake, like a peer behind a flaky network.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				for _, c := range conns {
+					_ = c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	opts = newAzureServiceBusClientOptions(
+		webSocketsClientOption(true, nil, time.Minute),
+		connectTimeoutClientOption(50*time.Millisecond),
+	)
+	require.NotNil(t, opts.NewWebSocketConn)
+
+	start := time.Now()
+	_, err = opts.NewWebSocketConn(context.Background(), azservicebus.NewWebSocketConnArgs{
+		Host: "ws://" + ln.Addr().String() + "/$servicebus/websocket",
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second, "The connection attempt should have been interrupted")
+}
+
+func TestStartDisposition(t *testing.T) {
+	const numMessages = 5
+
+	var batch []*azservicebus.ReceivedMessage
+	for i := 1; i <= numMessages; i++ {
+		batch = append(batch, &azservicebus.ReceivedMessage{
+			MessageID: strconv.Itoa(i),
+			Body:      []byte(`{"test": null}`),
+		})
+	}
+	// exceeds the maximum event size
+	batch = append(batch, &azservicebus.ReceivedMessage{
+		MessageID: "big",
+		Body:      []byte(`{"test": "` + strings.Repeat("x", 64) + `"}`),
+	})
+
+	rcvr := &fakeReceiver{batch: batch}
+
+	ceClient := &rejectingClient{
+		TestCloudEventsClient: adaptertest.NewTestClient(),
+		rejectIDs:             map[string]struct{}{"3": {}},
+	}
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		msgRcvr:       rcvr,
+		ceClient:      ceClient,
+		msgPrcsr:      &defaultMessageProcessor{},
+		maxConcurrent: 2,
+		prefetchCount: 2,
+		maxEventSize:  64,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- a.Start(ctx)
+	}()
+
+	settled := func() int {
+		rcvr.mu.Lock()
+		defer rcvr.mu.Unlock()
+		return len(rcvr.completed) + len(rcvr.abandoned) + len(rcvr.deadLettered)
+	}
+
+	assert.Eventually(t, func() bool { return settled() == len(batch) },
+		5*time.Second, 10*time.Millisecond, "All messages should be settled")
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the adapter to stop")
+	}
+
+	assert.ElementsMatch(t, []string{"1", "2", "4", "5"}, rcvr.completed)
+	assert.Empty(t, rcvr.abandoned)
+	assert.ElementsMatch(t, []string{"3", "big"}, rcvr.deadLettered,
+		"Messages which exceed the maximum size or whose events are rejected should be dead-lettered")
+	assert.Len(t, ceClient.Sent(), numMessages-1)
+}
+
+func TestStartReceiverLinks(t *testing.T) {
+	newBatch := func(prefix string) []*azservicebus.ReceivedMessage {
+		var batch []*azservicebus.ReceivedMessage
+		for i := 1; i <= 3; i++ {
+			batch = append(batch, &azservicebus.ReceivedMessage{
+				MessageID: prefix + strconv.Itoa(i),
+				Body:      []byte(`{"test": null}`),
+			})
+		}
+		return batch
+	}
+
+	rcvr1 := &fakeReceiver{batch: newBatch("a")}
+	rcvr2 := &fakeReceiver{batch: newBatch("b")}
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		msgRcvr:       rcvr1,
+		extraRcvrs:    []messageReceiver{rcvr2},
+		ceClient:      ceClient,
+		msgPrcsr:      &defaultMessageProcessor{},
+		maxConcurrent: 2,
+		prefetchCount: 2,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- a.Start(ctx)
+	}()
+
+	completed := func(r *fakeReceiver) int {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.completed)
+	}
+
+	assert.Eventually(t, func() bool { return completed(rcvr1)+completed(rcvr2) == 6 },
+		5*time.Second, 10*time.Millisecond, "All messages should be completed")
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the adapter to stop")
+	}
+
+	// Messages are settled on the link they were received from.
+	assert.ElementsMatch(t, []string{"a1", "a2", "a3"}, rcvr1.completed)
+	assert.ElementsMatch(t, []string{"b1", "b2", "b3"}, rcvr2.completed)
+	assert.Len(t, ceClient.Sent(), 6)
+}
+
+// BenchmarkStartReceiverLinks measures the throughput of the adapter with a
+// varying number of receiver links, each of which incurs a fixed latency per
+// receive operation.
+func BenchmarkStartReceiverLinks(b *testing.B) {
+	const rcvLatency = 2 * time.Millisecond
+
+	for _, links := range []int{1, 2, 4} {
+		b.Run(strconv.Itoa(links)+" links", func(b *testing.B) {
+			var handled int64
+			remaining := int64(b.N)
+
+			newRcvr := func() messageReceiver {
+				return &latencyReceiver{latency: rcvLatency, remaining: &remaining}
+			}
+
+			a := &adapter{
+				logger:        zap.NewNop().Sugar(),
+				msgRcvr:       newRcvr(),
+				ceClient:      &countingClient{count: &handled},
+				msgPrcsr:      &defaultMessageProcessor{},
+				maxConcurrent: 10,
+				prefetchCount: 10,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+			for i := 1; i < links; i++ {
+				a.extraRcvrs = append(a.extraRcvrs, newRcvr())
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			b.ResetTimer()
+
+			errCh := make(chan error)
+			go func() {
+				errCh <- a.Start(ctx)
+			}()
+
+			for atomic.LoadInt64(&handled) < int64(b.N) {
+				time.Sleep(time.Millisecond)
+			}
+
+			b.StopTimer()
+			cancel()
+			<-errCh
+		})
+	}
+}
+
+func TestProduceRetry(t *testing.T) {
+	errConnLost := &azservicebus.Error{Code: azservicebus.CodeConnectionLost}
+	errUnauthorized := errors.New("*Error{Condition: amqp:unauthorized-access, Description: Unauthorized access.}")
+
+	testCases := []struct {
+		name           string
+		rcvErrs        []error
+		maxRetries     int
+		expectAttempts int
+		expectErr      bool
+	}{
+		{
+			name:           "Recovers from transient errors",
+			rcvErrs:        []error{errConnLost, errConnLost},
+			maxRetries:     3,
+			expectAttempts: 4, // 2 failures + 1 success + 1 blocking until canceled
+		},
+		{
+			name:           "Transient errors exceed the maximum retries",
+			rcvErrs:        []error{errConnLost, errConnLost, errConnLost},
+			maxRetries:     2,
+			expectAttempts: 3,
+			expectErr:      true,
+		},
+		{
+			name:           "Permanent error is not retried",
+			rcvErrs:        []error{errUnauthorized},
+			maxRetries:     3,
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &flakyReceiver{
+				fakeReceiver: fakeReceiver{
+					batch: []*azservicebus.ReceivedMessage{
+						{MessageID: "1", Body: []byte(`{"test": null}`)},
+					},
+				},
+				errs: tc.rcvErrs,
+			}
+
+			a := &adapter{
+				logger:        logtesting.TestLogger(t),
+				msgRcvr:       rcvr,
+				prefetchCount: 1,
+
+				receiveMaxRetries:       tc.maxRetries,
+				receiveRetryBaseBackoff: time.Millisecond,
+				receiveRetryMaxBackoff:  time.Millisecond,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			msgChan := make(chan *fullMessage)
+			errChan := make(chan error, 1)
+
+			done := make(chan struct{})
+			go func() {
+				a.produce(ctx, a.msgRcvr, msgChan, errChan)
+				close(done)
+			}()
+
+			if !tc.expectErr {
+				select {
+				case fm := <-msgChan:
+					assert.Equal(t, "1", fm.received.MessageID)
+				case <-time.After(5 * time.Second):
+					t.Fatal("Timed out waiting for a message")
+				}
+				assert.Eventually(t, func() bool { return rcvr.attempts() == tc.expectAttempts },
+					time.Second, time.Millisecond)
+				cancel()
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the producer to return")
+			}
+			close(errChan)
+
+			err := <-errChan
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectAttempts, rcvr.attempts())
+		})
+	}
+}
+
+func TestReceiveMode(t *testing.T) {
+	assert.Equal(t, receiveModePeekLock, receiveMode(&envConfig{}))
+	assert.Equal(t, receiveModeSessions, receiveMode(&envConfig{SessionEnabled: true}))
+	assert.Equal(t, receiveModeDeadLetterQueue, receiveMode(&envConfig{ConsumeDeadLetterQueue: true}))
+	assert.Equal(t, receiveModeTransferDeadLetterQueue, receiveMode(&envConfig{ConsumeTransferDeadLetterQueue: true}))
+}
+
+func TestReceiverSubQueue(t *testing.T) {
+	testCases := []struct {
+		name        string
+		env         envConfig
+		expectQueue azservicebus.SubQueue
+		expectName  string
+	}{
+		{
+			name: "Entity",
+		},
+		{
+			name:        "Dead-letter queue",
+			env:         envConfig{ConsumeDeadLetterQueue: true},
+			expectQueue: azservicebus.SubQueueDeadLetter,
+			expectName:  "deadletter",
+		},
+		{
+			name:        "Transfer dead-letter queue",
+			env:         envConfig{ConsumeTransferDeadLetterQueue: true},
+			expectQueue: azservicebus.SubQueueTransfer,
+			expectName:  "transferdeadletter",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			subQueue := receiverSubQueue(&tc.env)
+			assert.Equal(t, tc.expectQueue, subQueue)
+			assert.Equal(t, tc.expectName, subQueueName(subQueue))
+		})
+	}
+}
+
+func TestEntityFromConnectionString(t *testing.T) {
+	t.Run("Connection string with EntityPath", func(t *testing.T) {
+		t.Setenv(azureservicebus.EnvConnStr,
+			"Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=kn;SharedAccessKey=kv;EntityPath=q")
+
+		entityID, entityURL, err := entityFromConnectionString()
+		require.NoError(t, err)
+		assert.Equal(t, "q", azureservicebus.EntityPath(entityID))
+		assert.Equal(t, "ns", entityID.Namespace)
+		assert.Equal(t, "sb://ns.servicebus.windows.net/q", entityURL)
+	})
+
+	t.Run("Connection string without EntityPath", func(t *testing.T) {
+		t.Setenv(azureservicebus.EnvConnStr,
+			"Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=kn;SharedAccessKey=kv")
+
+		_, _, err := entityFromConnectionString()
+		assert.Error(t, err)
+	})
+
+	t.Run("No connection string", func(t *testing.T) {
+		t.Setenv(azureservicebus.EnvConnStr, "")
+		t.Setenv(azureservicebus.EnvConnStrFile, "")
+
+		_, _, err := entityFromConnectionString()
+		assert.Error(t, err)
+	})
+}
+
+// fakeReceiver is an in-memory messageReceiver which returns predefined
+// messages, at most maxMessages at a time, then blocks until the receive
+// context is canceled. It records the settlement of messages.
+type fakeReceiver struct {
+	mu    sync.Mutex
+	batch []*azservicebus.ReceivedMessage
+
+	completed    []string
+	abandoned    []string
+	deadLettered []string
+	deferred     []string
+}
+
+var _ messageReceiver = (*fakeReceiver)(nil)
+
+// ReceiveMessages implements messageReceiver.
+func (r *fakeReceiver) ReceiveMessages(ctx context.Context, maxMessages int, _ *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	r.mu.Lock()
+	b := r.batch
+	if maxMessages > 0 && len(b) > maxMessages {
+		b = b[:maxMessages]
+	}
+	r.batch = r.batch[len(b):]
+	r.mu.Unlock()
+
+	if len(b) > 0 {
+		return b, nil
+	}
+
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// CompleteMessage implements messageReceiver.
+func (r *fakeReceiver) CompleteMessage(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.CompleteMessageOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed = append(r.completed, msg.MessageID)
+	return nil
+}
+
+// AbandonMessage implements messageReceiver.
+func (r *fakeReceiver) AbandonMessage(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.AbandonMessageOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.abandoned = append(r.abandoned, msg.MessageID)
+	return nil
+}
+
+// DeadLetterMessage implements messageReceiver.
+func (r *fakeReceiver) DeadLetterMessage(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.DeadLetterOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadLettered = append(r.deadLettered, msg.MessageID)
+	return nil
+}
+
+// DeferMessage implements messageReceiver.
+func (r *fakeReceiver) DeferMessage(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.DeferMessageOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deferred = append(r.deferred, msg.MessageID)
+	return nil
+}
+
+// redeliveringReceiver is a fakeReceiver which, like Service Bus, makes
+// abandoned messages available again for receiving with an incremented
+// delivery count, until that count reaches the given maximum and the message
+// gets dead-lettered.
+type redeliveringReceiver struct {
+	fakeReceiver
+
+	maxDeliveryCount uint32
+}
+
+var _ messageReceiver = (*redeliveringReceiver)(nil)
+
+// ReceiveMessages implements messageReceiver.
+func (r *redeliveringReceiver) ReceiveMessages(ctx context.Context, maxMessages int, _ *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	for {
+		r.mu.Lock()
+		b := r.batch
+		if maxMessages > 0 && len(b) > maxMessages {
+			b = b[:maxMessages]
+		}
+		r.batch = r.batch[len(b):]
+		r.mu.Unlock()
+
+		if len(b) > 0 {
+			return b, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// AbandonMessage implements messageReceiver.
+func (r *redeliveringReceiver) AbandonMessage(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.AbandonMessageOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.abandoned = append(r.abandoned, msg.MessageID)
+
+	if msg.DeliveryCount >= r.maxDeliveryCount {
+		r.deadLettered = append(r.deadLettered, msg.MessageID)
+		return nil
+	}
+
+	redelivered := *msg
+	redelivered.DeliveryCount++
+	r.batch = append(r.batch, &redelivered)
+	return nil
+}
+
+// flakyReceiver is a fakeReceiver which fails to receive messages with the
+// given errors, in sequence, before succeeding.
+type flakyReceiver struct {
+	fakeReceiver
+
+	errs  []error
+	calls int32
+}
+
+// ReceiveMessages implements messageReceiver.
+func (r *flakyReceiver) ReceiveMessages(ctx context.Context, maxMessages int, opts *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	if i := int(atomic.AddInt32(&r.calls, 1)) - 1; i < len(r.errs) {
+		return nil, r.errs[i]
+	}
+	return r.fakeReceiver.ReceiveMessages(ctx, maxMessages, opts)
+}
+
+// attempts returns the number of calls to ReceiveMessages.
+func (r *flakyReceiver) attempts() int {
+	return int(atomic.LoadInt32(&r.calls))
+}
+
+// latencyReceiver is a messageReceiver which returns up to the requested
+// number of messages after a fixed latency, until the shared count of
+// remaining messages is exhausted.
+type latencyReceiver struct {
+	latency   time.Duration
+	remaining *int64
+}
+
+var _ messageReceiver = (*latencyReceiver)(nil)
+
+// ReceiveMessages implements messageReceiver.
+func (r *latencyReceiver) ReceiveMessages(ctx context.Context, maxMessages int, _ *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(r.latency):
+	}
+
+	var msgs []*azservicebus.ReceivedMessage
+	for i := 0; i < maxMessages && atomic.AddInt64(r.remaining, -1) >= 0; i++ {
+		msgs = append(msgs, &azservicebus.ReceivedMessage{
+			MessageID: "msg",
+			Body:      []byte(`{"test": null}`),
+		})
+	}
+	return msgs, nil
+}
+
+// CompleteMessage implements messageReceiver.
+func (*latencyReceiver) CompleteMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.CompleteMessageOptions) error {
+	return nil
+}
+
+// AbandonMessage implements messageReceiver.
+func (*latencyReceiver) AbandonMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.AbandonMessageOptions) error {
+	return nil
+}
+
+// DeadLetterMessage implements messageReceiver.
+func (*latencyReceiver) DeadLetterMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.DeadLetterOptions) error {
+	return nil
+}
+
+// DeferMessage implements messageReceiver.
+func (*latencyReceiver) DeferMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.DeferMessageOptions) error {
+	return nil
+}
+
+// countingClient is a CloudEvents client which counts the events it is
+// requested to send, and discards them.
+type countingClient struct {
+	cloudevents.Client
+	count *int64
+}
+
+// Send implements cloudevents.Client.
+func (c *countingClient) Send(context.Context, cloudevents.Event) protocol.Result {
+	atomic.AddInt64(c.count, 1)
+	return nil
+}
+
+// slowClient is a CloudEvents client which takes the given delay to send
+// events, unless the context is canceled first.
+type slowClient struct {
+	*adaptertest.TestCloudEventsClient
+
+	delay   time.Duration
+	sending chan struct{}
+	once    sync.Once
+}
+
+// Send implements cloudevents.Client.
+func (c *slowClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	c.once.Do(func() { close(c.sending) })
+
+	select {
+	case <-time.After(c.delay):
+		return c.TestCloudEventsClient.Send(ctx, e)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sequenceResultClient is a CloudEvents client which returns the given
+// results in sequence.
+type sequenceResultClient struct {
+	*adaptertest.TestCloudEventsClient
+
+	results  []protocol.Result
+	attempts int
+}
+
+// Send implements cloudevents.Client.
+func (c *sequenceResultClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	res := c.results[c.attempts]
+	c.attempts++
+	if res != nil {
+		return res
+	}
+	return c.TestCloudEventsClient.Send(ctx, e)
+}
+
+// hangingClient is a CloudEvents client which blocks on its first numHangs
+// sends until their context is done, then delivers events.
+type hangingClient struct {
+	*adaptertest.TestCloudEventsClient
+
+	numHangs int
+	attempts int
+}
+
+// Send implements cloudevents.Client.
+func (c *hangingClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	c.attempts++
+	if c.attempts <= c.numHangs {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.TestCloudEventsClient.Send(ctx, e)
+}
+
+// concurrencyTrackingClient is a CloudEvents client which records the
+// maximum number of events being sent concurrently.
+type concurrencyTrackingClient struct {
+	*adaptertest.TestCloudEventsClient
+
+	inFlight    int32
+	maxInFlight int32
+}
+
+// Send implements cloudevents.Client.
+func (c *concurrencyTrackingClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	n := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+
+	for {
+		max := atomic.LoadInt32(&c.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&c.maxInFlight, max, n) {
+			break
+		}
+	}
+
+	// leave a chance to other handlers to run concurrently
+	time.Sleep(5 * time.Millisecond)
+
+	return c.TestCloudEventsClient.Send(ctx, e)
+}
+
+// failingMessageProcessor is a MessageProcessor which always fails.
+type failingMessageProcessor struct{}
+
+// Process implements MessageProcessor.
+func (*failingMessageProcessor) Process(*Message) ([]*cloudevents.Event, error) {
+	return nil, errors.New("malformed message")
+}
+
+// panickingMessageProcessor is a MessageProcessor which panics while
+// processing any message.
+type panickingMessageProcessor struct{}
+
+// Process implements MessageProcessor.
+func (*panickingMessageProcessor) Process(*Message) ([]*cloudevents.Event, error) {
+	panic("index out of range")
+}
+
+// sourcelessMessageProcessor is a MessageProcessor which produces CloudEvents
+// without a source, which fail validation.
+type sourcelessMessageProcessor struct{}
+
+// Process implements MessageProcessor.
+func (*sourcelessMessageProcessor) Process(*Message) ([]*cloudevents.Event, error) {
+	e := newTestEvent("0")
+	e.Context.(*event.EventContextV1).Source = types.URIRef{}
+	return []*cloudevents.Event{&e}, nil
+}
+
+// fanOutMessageProcessor is a MessageProcessor which produces multiple
+// CloudEvents from every message.
+type fanOutMessageProcessor struct {
+	numEvents int
+}
+
+// Process implements MessageProcessor.
+func (p *fanOutMessageProcessor) Process(*Message) ([]*cloudevents.Event, error) {
+	events := make([]*cloudevents.Event, p.numEvents)
+	for i := range events {
+		e := newTestEvent(strconv.Itoa(i))
+		events[i] = &e
+	}
+	return events, nil
+}
+
+// rejectingClient is a CloudEvents client which rejects the events with the
+// given IDs.
+type rejectingClient struct {
+	*adaptertest.TestCloudEventsClient
+
+	rejectIDs map[string]struct{}
+}
+
+// Send implements cloudevents.Client.
+func (c *rejectingClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	if _, reject := c.rejectIDs[e.ID()]; reject {
+		return cehttp.NewResult(http.StatusBadRequest, "rejected event %s", e.ID())
+	}
+	return c.TestCloudEventsClient.Send(ctx, e)
+}
+
+// staticResultClient is a CloudEvents client which returns a static result
+// upon sending.
+type staticResultClient struct {
+	*adaptertest.TestCloudEventsClient
+	result protocol.Result
+}
+
+// Send implements cloudevents.Client.
+func (c *staticResultClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	if c.result != nil {
+		return c.result
+	}
+	return c.TestCloudEventsClient.Send(ctx, e)
+}
+
+func extractDataFromEvent(t *testing.T, b []byte) string {
+	unstructuredEvent := make(map[string]interface{})
+	err := json.Unmarshal(b, &unstructuredEvent)
+	require.NoError(t, err)
+
+	dataBytes, err := json.Marshal(unstructuredEvent["Body"])
+	require.NoError(t, err)
+
+	var data json.RawMessage
+	err = json.Unmarshal(dataBytes, &data)
+	require.NoError(t, err)
+
+	return string(data)
 }
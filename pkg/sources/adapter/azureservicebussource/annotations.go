@@ -0,0 +1,91 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"fmt"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Prefix of the names of annotations which Service Bus sets on messages. It
+// is omitted from the names of extension attributes.
+const annotationPrefixBroker = "x-opt-"
+
+// messageAnnotations returns the annotations of the given AMQP message which
+// have a string key, such as the ones set by the Service Bus broker.
+func messageAnnotations(amqpMsg *azservicebus.AMQPAnnotatedMessage) map[string]interface{} {
+	if amqpMsg == nil || len(amqpMsg.MessageAnnotations) == 0 {
+		return nil
+	}
+
+	annotations := make(map[string]interface{}, len(amqpMsg.MessageAnnotations))
+	for k, v := range amqpMsg.MessageAnnotations {
+		if name, ok := k.(string); ok {
+			annotations[name] = v
+		}
+	}
+	return annotations
+}
+
+// parseAnnotationAllowlist returns the names of the extension attributes which
+// the given message annotations are propagated as, indexed by annotation
+// name. The name of an extension attribute is the normalized name of its
+// annotation, stripped of the "x-opt-" prefix and prefixed with "sb", e.g.
+// "x-opt-enqueued-time" is propagated as "sbenqueuedtime". Names which exceed
+// the maximum length of attribute names are truncated (see extensionName).
+func parseAnnotationAllowlist(annotations []string) (map[string]string, error) {
+	names := make(map[string]string, len(annotations))
+	annots := make(map[string]string, len(annotations))
+
+	for _, a := range annotations {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+
+		name := extensionName("sb" + normalizeExtensionName(strings.TrimPrefix(a, annotationPrefixBroker)))
+		if name == "sb" {
+			return nil, fmt.Errorf("annotation %q can not be converted to a CloudEvent extension attribute name", a)
+		}
+		if otherAnnot, dup := annots[name]; dup && otherAnnot != a {
+			return nil, fmt.Errorf("annotations %q and %q both convert to attribute %q", otherAnnot, a, name)
+		}
+
+		names[a] = name
+		annots[name] = a
+	}
+
+	return names, nil
+}
+
+// setAnnotationsExtensions sets the annotations of the given message which
+// are found in the allowlist as extension attributes of the given CloudEvent.
+// Attributes that are already set, such as the ones carrying system
+// properties, are never overwritten.
+func setAnnotationsExtensions(event *cloudevents.Event, msg *Message, allowlist map[string]string) {
+	selected := make(map[string]interface{}, len(allowlist))
+	for a := range allowlist {
+		if v, ok := msg.Annotations[a]; ok {
+			selected[a] = v
+		}
+	}
+
+	setPropertiesExtensions(event, selected, allowlist)
+}
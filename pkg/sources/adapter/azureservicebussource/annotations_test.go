@@ -0,0 +1,120 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestParseAnnotationAllowlist(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations []string
+		expectErr   bool
+		expect      map[string]string
+	}{
+		{
+			name:   "Empty list",
+			expect: map[string]string{},
+		},
+		{
+			name:        "Broker and custom annotations",
+			annotations: []string{"x-opt-enqueued-time", " x-opt-deadletter-source ", "My-Annotation", ""},
+			expect: map[string]string{
+				"x-opt-enqueued-time":     "sbenqueuedtime",
+				"x-opt-deadletter-source": "sbdeadlettersource",
+				"My-Annotation":           "sbmyannotation",
+			},
+		},
+		{
+			name:        "Name exceeds the maximum length",
+			annotations: []string{"x-opt-scheduled-enqueue-time"},
+			expect: map[string]string{
+				"x-opt-scheduled-enqueue-time": "sbscheduledeae8559fa",
+			},
+		},
+		{
+			name:        "No valid character",
+			annotations: []string{"x-opt-_"},
+			expectErr:   true,
+		},
+		{
+			name:        "Colliding names",
+			annotations: []string{"x-opt-lock-token", "x-opt-locktoken"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := parseAnnotationAllowlist(tc.annotations)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, names)
+		})
+	}
+}
+
+func TestProcessMessageAnnotations(t *testing.T) {
+	enqueuedTime := time.Unix(0, 0)
+
+	rcvMsg := &azservicebus.ReceivedMessage{
+		MessageID: "someMessageID",
+		Body:      sampleEvent,
+		RawAMQPMessage: &azservicebus.AMQPAnnotatedMessage{
+			MessageAnnotations: map[any]any{
+				"x-opt-enqueued-time":     enqueuedTime,
+				"x-opt-deadletter-source": "some-queue",
+				"x-opt-not-allowed":       "some-value",
+				int64(42):                 "ignored",
+			},
+		},
+		DeadLetterSource: to.Ptr("some-other-queue"),
+	}
+
+	msg, err := toMessage(rcvMsg)
+	require.NoError(t, err)
+	assert.Len(t, msg.Annotations, 3, "Expected annotations with a non-string key to be ignored")
+
+	allowlist, err := parseAnnotationAllowlist([]string{"x-opt-enqueued-time", "x-opt-deadletter-source", "x-opt-missing"})
+	require.NoError(t, err)
+
+	msgPrcsr := &defaultMessageProcessor{
+		ceSource:       "/some/source",
+		annotationExts: allowlist,
+	}
+	events, err := msgPrcsr.Process(msg)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	exts := events[0].Extensions()
+	assert.Equal(t, "1970-01-01T00:00:00Z", exts["sbenqueuedtime"])
+	assert.Equal(t, "some-other-queue", exts["sbdeadlettersource"],
+		"System properties should take precedence over annotations")
+	assert.NotContains(t, exts, "sbnotallowed")
+	assert.NotContains(t, exts, "sbmissing")
+}
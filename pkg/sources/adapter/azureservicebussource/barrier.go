@@ -0,0 +1,89 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// settlementBarrier settles messages strictly in the order they were received
+// in, which is the order of their sequence numbers, while letting them be
+// handled concurrently.
+//
+// Each received message is given a ticket. The settlement of a message whose
+// handling finished before the one of its predecessors is buffered until all
+// its predecessors are settled. Buffered settlements retain their message in
+// memory, so the memory usage grows with the number of messages handled while
+// an older message is still in flight, e.g. waiting for a slow sink. The lock
+// on buffered messages isn't renewed, and may therefore expire before they
+// get settled, in which case they are redelivered.
+type settlementBarrier struct {
+	issued atomic.Uint64
+
+	mu      sync.Mutex
+	next    uint64
+	pending map[uint64]func() error
+}
+
+// newSettlementBarrier returns an initialized settlementBarrier.
+func newSettlementBarrier() *settlementBarrier {
+	return &settlementBarrier{
+		pending: make(map[uint64]func() error),
+	}
+}
+
+// ticket returns the ticket of the next received message. It must be called
+// in the order messages are received in.
+func (b *settlementBarrier) ticket() uint64 {
+	return b.issued.Add(1) - 1
+}
+
+// settle settles the message with the given ticket using the given function,
+// once all messages with a lower ticket have been settled, along with all the
+// buffered settlements which were waiting for this message. A nil function
+// releases the ticket without settling any message.
+//
+// It returns the first error returned by the settlements which were run.
+func (b *settlementBarrier) settle(t uint64, settle func() error) error {
+	if settle == nil {
+		settle = func() error { return nil }
+	}
+
+	// Settlements run while holding the lock, so that they happen strictly
+	// in order.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending[t] = settle
+
+	var firstErr error
+	for {
+		fn, ok := b.pending[b.next]
+		if !ok {
+			break
+		}
+		delete(b.pending, b.next)
+		b.next++
+
+		if err := fn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
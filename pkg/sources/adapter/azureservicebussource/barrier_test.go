@@ -0,0 +1,145 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestSettlementBarrier(t *testing.T) {
+	b := newSettlementBarrier()
+
+	t0, t1, t2, t3 := b.ticket(), b.ticket(), b.ticket(), b.ticket()
+
+	var settled []uint64
+	settleFn := func(t uint64) func() error {
+		return func() error {
+			settled = append(settled, t)
+			return nil
+		}
+	}
+
+	errSettle := errors.New("settlement failed")
+
+	assert.NoError(t, b.settle(t2, settleFn(t2)))
+	assert.NoError(t, b.settle(t1, nil), "Releasing a ticket should not settle anything")
+	assert.Empty(t, settled, "Settlements should wait for their predecessors")
+
+	err := b.settle(t0, func() error {
+		settled = append(settled, t0)
+		return errSettle
+	})
+	assert.ErrorIs(t, err, errSettle)
+	assert.Equal(t, []uint64{t0, t2}, settled, "Buffered settlements should run in order")
+
+	assert.NoError(t, b.settle(t3, settleFn(t3)))
+	assert.Equal(t, []uint64{t0, t2, t3}, settled)
+	assert.Empty(t, b.pending)
+}
+
+func TestStartOrderedCompletion(t *testing.T) {
+	const numMessages = 6
+
+	var batch []*azservicebus.ReceivedMessage
+	var expectOrder []string
+	for i := 1; i <= numMessages; i++ {
+		batch = append(batch, &azservicebus.ReceivedMessage{
+			MessageID:      strconv.Itoa(i),
+			SequenceNumber: to.Ptr(int64(i)),
+			Body:           []byte(`{"test": null}`),
+		})
+		expectOrder = append(expectOrder, strconv.Itoa(i))
+	}
+
+	rcvr := &fakeReceiver{batch: batch}
+
+	a := &adapter{
+		logger:  logtesting.TestLogger(t),
+		msgRcvr: rcvr,
+		ceClient: &delayingClient{
+			TestCloudEventsClient: adaptertest.NewTestClient(),
+			delayIDs:              map[string]time.Duration{"1": 200 * time.Millisecond, "3": 100 * time.Millisecond},
+		},
+		msgPrcsr:      &defaultMessageProcessor{},
+		maxConcurrent: 3,
+		prefetchCount: numMessages,
+		barrier:       newSettlementBarrier(),
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- a.Start(ctx)
+	}()
+
+	completed := func() []string {
+		rcvr.mu.Lock()
+		defer rcvr.mu.Unlock()
+		return append([]string(nil), rcvr.completed...)
+	}
+
+	assert.Eventually(t, func() bool { return len(completed()) == numMessages },
+		5*time.Second, 10*time.Millisecond, "All messages should be completed")
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the adapter to stop")
+	}
+
+	assert.Equal(t, expectOrder, completed(), "Messages should be completed in sequence")
+}
+
+// delayingClient is a CloudEvents client which delays the delivery of the
+// events with the given IDs.
+type delayingClient struct {
+	*adaptertest.TestCloudEventsClient
+
+	delayIDs map[string]time.Duration
+}
+
+// Send implements cloudevents.Client.
+func (c *delayingClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	time.Sleep(c.delayIDs[e.ID()])
+	return c.TestCloudEventsClient.Send(ctx, e)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// batchingClient is a cloudevents.Client which accumulates the events passed
+// to Send and delivers them to the sink in batches, using the batched content
+// mode of the CloudEvents HTTP protocol binding.
+//
+// Send returns once the batch containing the event was delivered, so that the
+// settlement of messages remains tied to the delivery of their events.
+//
+// If the sink doesn't support the batched content mode (415 Unsupported Media
+// Type), the client falls back to sending events individually using the
+// wrapped cloudevents.Client, for the remainder of its lifetime. A batch which
+// is otherwise rejected as malformed (400 Bad Request) is retried event by
+// event, since a single invalid event is enough to cause that.
+type batchingClient struct {
+	cloudevents.Client
+
+	logger *zap.SugaredLogger
+
+	sink          string
+	httpClient    *http.Client
+	size          int
+	flushInterval time.Duration
+	// maximum duration of the delivery of a batch, if non-zero
+	timeout time.Duration
+
+	reqs chan *batchRequest
+
+	// Set when the sink rejected a batch.
+	unsupported atomic.Bool
+}
+
+// batchRequest is a request to deliver an event as part of a batch.
+type batchRequest struct {
+	// context of the requester
+	ctx    context.Context
+	event  cloudevents.Event
+	result chan error
+}
+
+var _ cloudevents.Client = (*batchingClient)(nil)
+
+// newBatchingClient returns a batchingClient which delivers events to the
+// given sink in batches of up to size events, or whatever number of events
+// was accumulated after flushInterval. The delivery of each batch is bounded
+// by timeout, unless it is zero.
+func newBatchingClient(cli cloudevents.Client, logger *zap.SugaredLogger, sink string,
+	size int, flushInterval, timeout time.Duration) *batchingClient {
+
+	return &batchingClient{
+		Client:        cli,
+		logger:        logger,
+		sink:          sink,
+		httpClient:    &http.Client{Timeout: timeout},
+		size:          size,
+		flushInterval: flushInterval,
+		timeout:       timeout,
+		reqs:          make(chan *batchRequest),
+	}
+}
+
+// Send implements cloudevents.Client.
+func (c *batchingClient) Send(ctx context.Context, event cloudevents.Event) protocol.Result {
+	if c.unsupported.Load() {
+		return c.Client.Send(ctx, event)
+	}
+
+	req := &batchRequest{
+		ctx:    ctx,
+		event:  event,
+		result: make(chan error, 1),
+	}
+
+	select {
+	case c.reqs <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run accumulates events and delivers them in batches until ctx is canceled.
+// Events which were accumulated at that point are delivered before run
+// returns.
+func (c *batchingClient) run(ctx context.Context) {
+	var batch []*batchRequest
+
+	timer := time.NewTimer(c.flushInterval)
+	timer.Stop()
+
+	for {
+		select {
+		case req := <-c.reqs:
+			batch = append(batch, req)
+			if len(batch) == 1 {
+				timer.Reset(c.flushInterval)
+			}
+			if len(batch) < c.size {
+				continue
+			}
+			// A tick which fired concurrently would otherwise flush
+			// the next batch early.
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+		case <-timer.C:
+
+		case <-ctx.Done():
+			c.flush(detach(ctx), batch)
+			return
+		}
+
+		c.flush(ctx, batch)
+		batch = nil
+	}
+}
+
+// flush delivers the given batch of events, and notifies each requester of
+// the result.
+//
+// Events of requesters which already gave up are left out of the batch, since
+// their message may have been abandoned in the meantime.
+func (c *batchingClient) flush(ctx context.Context, batch []*batchRequest) {
+	pending := batch[:0]
+	for _, req := range batch {
+		if err := req.ctx.Err(); err != nil {
+			req.result <- err
+			continue
+		}
+		pending = append(pending, req)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	sendCtx, cancel := c.withFlushTimeout(ctx, pending)
+	defer cancel()
+
+	result := c.sendBatch(sendCtx, pending)
+
+	var httpResult *cehttp.Result
+	if cloudevents.ResultAs(result, &httpResult) {
+		switch httpResult.StatusCode {
+		case http.StatusUnsupportedMediaType:
+			c.logger.Warnw("The sink does not support batches of events, falling back to sending events individually",
+				zap.Error(result))
+			c.unsupported.Store(true)
+			c.sendIndividually(pending)
+			return
+
+		case http.StatusBadRequest:
+			c.logger.Warnw("The sink rejected a batch of events, retrying events individually", zap.Error(result))
+			c.sendIndividually(pending)
+			return
+		}
+	}
+
+	for _, req := range pending {
+		req.result <- result
+	}
+}
+
+// withFlushTimeout returns a copy of ctx which is canceled once the timeout of
+// the client elapses, or once the earliest deadline among the contexts of the
+// given requesters expires, whichever comes first.
+func (c *batchingClient) withFlushTimeout(ctx context.Context,
+	batch []*batchRequest) (context.Context, context.CancelFunc) {
+
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	for _, req := range batch {
+		if d, ok := req.ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+	}
+
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// sendIndividually sends each event of the given batch using the wrapped
+// cloudevents.Client, within the context of its requester.
+func (c *batchingClient) sendIndividually(batch []*batchRequest) {
+	for _, req := range batch {
+		req.result <- c.Client.Send(req.ctx, req.event)
+	}
+}
+
+// sendBatch sends the given events to the sink in a single request. The
+// result carries the HTTP status of the response, if any, like the results
+// returned by the CloudEvents HTTP protocol binding.
+func (c *batchingClient) sendBatch(ctx context.Context, batch []*batchRequest) protocol.Result {
+	events := make([]cloudevents.Event, len(batch))
+	for i, req := range batch {
+		events[i] = req.event
+	}
+
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("serializing batch of events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.sink, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", cloudevents.ApplicationCloudEventsBatchJSON)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending batch of events: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return cehttp.NewResult(resp.StatusCode, "%w", protocol.ResultACK)
+	}
+	return cehttp.NewResult(resp.StatusCode, "%w: %s", protocol.ResultNACK, resp.Status)
+}
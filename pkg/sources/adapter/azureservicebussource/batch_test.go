@@ -0,0 +1,271 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestBatchingClient(t *testing.T) {
+	testCases := []struct {
+		name          string
+		numEvents     int
+		batchSize     int
+		sinkStatus    int
+		expectBatches []int
+		expectErr     bool
+		expectDirect  int
+		// whether the client should fall back to individual sends
+		expectUnsupported bool
+	}{
+		{
+			name:          "Full batch",
+			numEvents:     3,
+			batchSize:     3,
+			sinkStatus:    http.StatusAccepted,
+			expectBatches: []int{3},
+		},
+		{
+			name:          "Partial batch flushed after interval",
+			numEvents:     2,
+			batchSize:     10,
+			sinkStatus:    http.StatusAccepted,
+			expectBatches: []int{2},
+		},
+		{
+			name:          "Sink rejects batches",
+			numEvents:     2,
+			batchSize:     2,
+			sinkStatus:    http.StatusUnsupportedMediaType,
+			expectBatches: []int{2},
+			expectDirect:  2,
+
+			expectUnsupported: true,
+		},
+		{
+			name:          "Sink rejects malformed batch",
+			numEvents:     2,
+			batchSize:     2,
+			sinkStatus:    http.StatusBadRequest,
+			expectBatches: []int{2},
+			expectDirect:  2,
+		},
+		{
+			name:          "Sink fails",
+			numEvents:     2,
+			batchSize:     2,
+			sinkStatus:    http.StatusInternalServerError,
+			expectBatches: []int{2},
+			expectErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var batches []int
+
+			sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, cloudevents.ApplicationCloudEventsBatchJSON, r.Header.Get("Content-Type"))
+
+				var events []cloudevents.Event
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+
+				mu.Lock()
+				batches = append(batches, len(events))
+				mu.Unlock()
+
+				w.WriteHeader(tc.sinkStatus)
+			}))
+			defer sink.Close()
+
+			ceClient := adaptertest.NewTestClient()
+
+			c := newBatchingClient(ceClient, logtesting.TestLogger(t), sink.URL, tc.batchSize, 50*time.Millisecond, 0)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			runDone := make(chan struct{})
+			go func() {
+				c.run(ctx)
+				close(runDone)
+			}()
+
+			results := make([]error, tc.numEvents)
+
+			var wg sync.WaitGroup
+			for i := 0; i < tc.numEvents; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = c.Send(ctx, newTestEvent(strconv.Itoa(i)))
+				}(i)
+			}
+			wg.Wait()
+
+			cancel()
+			<-runDone
+
+			for _, res := range results {
+				if tc.expectErr {
+					assert.False(t, cloudevents.IsACK(res), "Expected delivery to fail")
+
+					var httpResult *cehttp.Result
+					require.True(t, cloudevents.ResultAs(res, &httpResult), "Expected a HTTP result")
+					assert.Equal(t, tc.sinkStatus, httpResult.StatusCode)
+				} else {
+					assert.True(t, cloudevents.IsACK(res), "Unexpected delivery failure: %v", res)
+				}
+			}
+
+			assert.Equal(t, tc.expectBatches, batches)
+			assert.Len(t, ceClient.Sent(), tc.expectDirect)
+			assert.Equal(t, tc.expectUnsupported, c.unsupported.Load())
+		})
+	}
+}
+
+func TestBatchingClientFallback(t *testing.T) {
+	var requests int
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+	}))
+	defer sink.Close()
+
+	ceClient := adaptertest.NewTestClient()
+
+	c := newBatchingClient(ceClient, logtesting.TestLogger(t), sink.URL, 1, time.Hour, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go c.run(ctx)
+
+	require.True(t, cloudevents.IsACK(c.Send(ctx, newTestEvent("1"))))
+	require.True(t, cloudevents.IsACK(c.Send(ctx, newTestEvent("2"))))
+
+	assert.Equal(t, 1, requests, "Events should be sent individually once the sink rejected a batch")
+	assert.Len(t, ceClient.Sent(), 2)
+}
+
+func TestBatchingClientTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer sink.Close()
+	defer close(unblock)
+
+	c := newBatchingClient(adaptertest.NewTestClient(), logtesting.TestLogger(t), sink.URL, 1, time.Hour,
+		100*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go c.run(ctx)
+
+	res := make(chan error, 1)
+	go func() {
+		res <- c.Send(ctx, newTestEvent("1"))
+	}()
+
+	select {
+	case err := <-res:
+		assert.False(t, cloudevents.IsACK(err), "Expected delivery to fail")
+		assert.Equal(t, sendFailureRetryable, classifySendResult(err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("The delivery of the batch should have timed out")
+	}
+}
+
+func TestBatchingClientSkipsAbandonedRequests(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []cloudevents.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+
+		mu.Lock()
+		for _, e := range events {
+			ids = append(ids, e.ID())
+		}
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer sink.Close()
+
+	c := newBatchingClient(adaptertest.NewTestClient(), logtesting.TestLogger(t), sink.URL, 10,
+		200*time.Millisecond, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go c.run(ctx)
+
+	abandonCtx, abandon := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer abandon()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var abandonedRes, deliveredRes error
+	go func() {
+		defer wg.Done()
+		abandonedRes = c.Send(abandonCtx, newTestEvent("abandoned"))
+	}()
+	go func() {
+		defer wg.Done()
+		deliveredRes = c.Send(ctx, newTestEvent("delivered"))
+	}()
+	wg.Wait()
+
+	assert.False(t, cloudevents.IsACK(abandonedRes), "Expected delivery to fail")
+	assert.True(t, cloudevents.IsACK(deliveredRes), "Unexpected delivery failure: %v", deliveredRes)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"delivered"}, ids, "Events of requesters which gave up should not be delivered")
+}
+
+func newTestEvent(id string) cloudevents.Event {
+	e := cloudevents.NewEvent()
+	e.SetID(id)
+	e.SetType("some.type")
+	e.SetSource("some/source")
+	return e
+}
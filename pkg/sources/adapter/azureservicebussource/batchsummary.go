@@ -0,0 +1,192 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// Modes of emission of batch summary events.
+const (
+	// No batch summary event is emitted.
+	batchSummaryNone = "none"
+	// A batch summary event is emitted in addition to the events of each
+	// message of the batch.
+	batchSummaryAdditional = "additional"
+	// A batch summary event is emitted instead of the events of each
+	// message of the batch.
+	batchSummaryOnly = "only"
+)
+
+// isSupportedBatchSummaryMode returns whether the given batch summary mode is
+// supported.
+func isSupportedBatchSummaryMode(m string) bool {
+	switch m {
+	case batchSummaryNone, batchSummaryAdditional, batchSummaryOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// batchSummary summarizes each batch of messages received from a Service Bus
+// entity in a single CloudEvent.
+type batchSummary struct {
+	mode       string
+	entityPath string
+}
+
+// summarizeBatch sends a CloudEvent which summarizes the given batch of
+// messages to the sink.
+//
+// In the "only" mode, the messages of the batch are settled as a whole
+// depending on the outcome of the delivery of that event: they are completed
+// if it was delivered, abandoned otherwise. The returned value indicates
+// whether the messages were settled, in which case they must not be handled
+// individually.
+//
+// The event is sent from the goroutine which receives messages, so the locks
+// on the messages of the batch are renewed until the delivery is over, lest
+// they expire before the messages are settled or handled individually.
+func (a *adapter) summarizeBatch(ctx context.Context, rcvr messageReceiver,
+	msgs []*azservicebus.ReceivedMessage) (settled bool) {
+
+	if len(msgs) == 0 {
+		return false
+	}
+
+	only := a.batchSummary.mode == batchSummaryOnly
+
+	// Messages are not handled individually in the "only" mode, so the
+	// heartbeat has to be kept informed of their reception here.
+	if only && a.heartbeat != nil {
+		a.heartbeat.touch()
+	}
+
+	stopLockRenewals := make([]func(), len(msgs))
+	for i, m := range msgs {
+		stopLockRenewals[i] = a.startLockRenewal(ctx, &fullMessage{rcvr: rcvr, received: m})
+	}
+	err := a.sendBatchSummary(ctx, msgs)
+	for _, stop := range stopLockRenewals {
+		stop()
+	}
+	if err != nil && ctx.Err() == nil {
+		a.logger.Errorw("Unable to send batch summary event", zap.Error(err))
+	}
+
+	if !only {
+		return false
+	}
+
+	// The summary was either sent or not, so messages are settled
+	// regardless of the cancelation of ctx.
+	if err != nil {
+		a.abandonMessages(detach(ctx), rcvr, msgs)
+		return true
+	}
+	for _, m := range msgs {
+		if err := a.disposition().Complete(detach(ctx), rcvr, m); err != nil {
+			a.logger.Errorw("Failed to complete message", zap.String(logfieldMsgID, m.MessageID), zap.Error(err))
+		}
+	}
+	return true
+}
+
+// sendBatchSummary sends a CloudEvent which summarizes the given batch of
+// messages to the sink.
+func (a *adapter) sendBatchSummary(ctx context.Context, msgs []*azservicebus.ReceivedMessage) error {
+	ev, err := newBatchSummaryEvent(a.ceSource, a.batchSummary.entityPath, msgs)
+	if err != nil {
+		return fmt.Errorf("creating batch summary event: %w", err)
+	}
+	if a.srcIdentity != "" {
+		ev.SetExtension(extSourceIdentity, a.srcIdentity)
+	}
+
+	if err := a.sendCloudEventWithRetry(ctx, ev); err != nil {
+		return err
+	}
+	a.logger.Debug("Sent batch summary event for " + strconv.Itoa(len(msgs)) + " messages")
+	return nil
+}
+
+// batchSummaryEventData is the data of the CloudEvent which summarizes a batch
+// of messages received from a Service Bus entity.
+//
+// Bounds are omitted when none of the messages of the batch carry the
+// corresponding system property.
+type batchSummaryEventData struct {
+	Entity            string     `json:"entity"`
+	Count             int        `json:"count"`
+	MinSequenceNumber *int64     `json:"minSequenceNumber,omitempty"`
+	MaxSequenceNumber *int64     `json:"maxSequenceNumber,omitempty"`
+	FirstEnqueuedTime *time.Time `json:"firstEnqueuedTime,omitempty"`
+	LastEnqueuedTime  *time.Time `json:"lastEnqueuedTime,omitempty"`
+	TimeSpan          string     `json:"timeSpan,omitempty"`
+}
+
+// newBatchSummaryEvent returns a CloudEvent which summarizes the given batch of
+// messages received from the given Service Bus entity.
+func newBatchSummaryEvent(ceSource, entityPath string, msgs []*azservicebus.ReceivedMessage) (*cloudevents.Event, error) {
+	return newControlEvent(ceSource, entityPath, v1alpha1.AzureServiceBusBatchSummaryEventType,
+		summarizeMessages(entityPath, msgs))
+}
+
+// summarizeMessages returns the summary of the given batch of messages.
+func summarizeMessages(entityPath string, msgs []*azservicebus.ReceivedMessage) *batchSummaryEventData {
+	data := &batchSummaryEventData{
+		Entity: entityPath,
+		Count:  len(msgs),
+	}
+
+	for _, m := range msgs {
+		if sn := m.SequenceNumber; sn != nil {
+			if data.MinSequenceNumber == nil || *sn < *data.MinSequenceNumber {
+				data.MinSequenceNumber = sn
+			}
+			if data.MaxSequenceNumber == nil || *sn > *data.MaxSequenceNumber {
+				data.MaxSequenceNumber = sn
+			}
+		}
+		if t := m.EnqueuedTime; t != nil {
+			if data.FirstEnqueuedTime == nil || t.Before(*data.FirstEnqueuedTime) {
+				data.FirstEnqueuedTime = t
+			}
+			if data.LastEnqueuedTime == nil || t.After(*data.LastEnqueuedTime) {
+				data.LastEnqueuedTime = t
+			}
+		}
+	}
+
+	if data.FirstEnqueuedTime != nil {
+		data.TimeSpan = data.LastEnqueuedTime.Sub(*data.FirstEnqueuedTime).String()
+	}
+
+	return data
+}
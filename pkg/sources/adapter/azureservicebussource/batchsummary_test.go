@@ -0,0 +1,212 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+	metricstesting "github.com/triggermesh/triggermesh/pkg/metrics/testing"
+)
+
+func TestSummarizeMessages(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		msgs   []*azservicebus.ReceivedMessage
+		expect string
+	}{{
+		name: "Unordered batch",
+		msgs: []*azservicebus.ReceivedMessage{
+			{SequenceNumber: to.Ptr[int64](12), EnqueuedTime: to.Ptr(t0.Add(time.Second))},
+			{SequenceNumber: to.Ptr[int64](10), EnqueuedTime: to.Ptr(t0)},
+			{SequenceNumber: to.Ptr[int64](14), EnqueuedTime: to.Ptr(t0.Add(1500 * time.Millisecond))},
+		},
+		expect: `{"entity":"myqueue","count":3,"minSequenceNumber":10,"maxSequenceNumber":14,` +
+			`"firstEnqueuedTime":"2023-01-01T12:00:00Z","lastEnqueuedTime":"2023-01-01T12:00:01.5Z","timeSpan":"1.5s"}`,
+	}, {
+		name: "Single message",
+		msgs: []*azservicebus.ReceivedMessage{
+			{SequenceNumber: to.Ptr[int64](10), EnqueuedTime: to.Ptr(t0)},
+		},
+		expect: `{"entity":"myqueue","count":1,"minSequenceNumber":10,"maxSequenceNumber":10,` +
+			`"firstEnqueuedTime":"2023-01-01T12:00:00Z","lastEnqueuedTime":"2023-01-01T12:00:00Z","timeSpan":"0s"}`,
+	}, {
+		name: "Missing system properties",
+		msgs: []*azservicebus.ReceivedMessage{
+			{}, {},
+		},
+		expect: `{"entity":"myqueue","count":2}`,
+	}}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ev, err := newBatchSummaryEvent("/some/source", "myqueue", tc.msgs)
+			require.NoError(t, err)
+
+			assert.Equal(t, "com.microsoft.azure.servicebus.batchsummary", ev.Type())
+			assert.Equal(t, "/some/source", ev.Source())
+			assert.Equal(t, "myqueue", ev.Subject())
+			assert.JSONEq(t, tc.expect, string(ev.Data()))
+		})
+	}
+}
+
+func TestProduceBatchSummary(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mode             string
+		sendErr          error
+		expectSent       int
+		expectDispatched int
+		expectCompleted  []string
+		expectAbandoned  []string
+	}{{
+		name:             "Summary in addition to messages",
+		mode:             batchSummaryAdditional,
+		expectSent:       1,
+		expectDispatched: 2,
+	}, {
+		name:            "Summary only",
+		mode:            batchSummaryOnly,
+		expectSent:      1,
+		expectCompleted: []string{"1", "2"},
+	}, {
+		name:            "Summary only, sink unavailable",
+		mode:            batchSummaryOnly,
+		sendErr:         errors.New("sink unavailable"),
+		expectAbandoned: []string{"1", "2"},
+	}}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &fakeReceiver{
+				batch: []*azservicebus.ReceivedMessage{
+					{MessageID: "1", SequenceNumber: to.Ptr[int64](1), Body: []byte(`{"test": null}`)},
+					{MessageID: "2", SequenceNumber: to.Ptr[int64](2), Body: []byte(`{"test": null}`)},
+				},
+			}
+
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				logger:        logtesting.TestLogger(t),
+				msgRcvr:       rcvr,
+				prefetchCount: 2,
+				ceClient: &staticResultClient{
+					TestCloudEventsClient: ceClient,
+					result:                tc.sendErr,
+				},
+				ceSource: "/some/source",
+				batchSummary: &batchSummary{
+					mode:       tc.mode,
+					entityPath: "myqueue",
+				},
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			msgChan := make(chan *fullMessage, 2)
+			errChan := make(chan error, 1)
+
+			done := make(chan struct{})
+			go func() {
+				a.produce(ctx, a.msgRcvr, msgChan, errChan)
+				close(done)
+			}()
+
+			require.Eventually(t, func() bool {
+				rcvr.mu.Lock()
+				defer rcvr.mu.Unlock()
+				return len(rcvr.batch) == 0 &&
+					len(rcvr.completed)+len(rcvr.abandoned) == len(tc.expectCompleted)+len(tc.expectAbandoned) &&
+					len(msgChan) == tc.expectDispatched
+			}, 5*time.Second, 10*time.Millisecond)
+
+			cancel()
+			<-done
+
+			sent := ceClient.Sent()
+			require.Len(t, sent, tc.expectSent)
+			for _, ev := range sent {
+				assert.Equal(t, "com.microsoft.azure.servicebus.batchsummary", ev.Type())
+				data := &batchSummaryEventData{}
+				require.NoError(t, ev.DataAs(data))
+				assert.Equal(t, 2, data.Count)
+			}
+
+			assert.Equal(t, tc.expectCompleted, rcvr.completed)
+			assert.Equal(t, tc.expectAbandoned, rcvr.abandoned)
+		})
+	}
+}
+
+func TestSummarizeBatchRenewsLocks(t *testing.T) {
+	metricstesting.ResetMetrics(t)
+
+	rcvr := &lockRenewingReceiver{}
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		autoRenewLock: true,
+		ceClient: &slowClient{
+			TestCloudEventsClient: adaptertest.NewTestClient(),
+			delay:                 minLockRenewalInterval + 500*time.Millisecond,
+			sending:               make(chan struct{}),
+		},
+		ceSource: "/some/source",
+		batchSummary: &batchSummary{
+			mode:       batchSummaryOnly,
+			entityPath: "myqueue",
+		},
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	msgs := []*azservicebus.ReceivedMessage{
+		{MessageID: "1", LockedUntil: to.Ptr(time.Now())},
+		{MessageID: "2", LockedUntil: to.Ptr(time.Now())},
+	}
+
+	settled := a.summarizeBatch(context.Background(), rcvr, msgs)
+	require.True(t, settled)
+
+	renewals := atomic.LoadInt32(&rcvr.renewals)
+	assert.GreaterOrEqual(t, renewals, int32(len(msgs)), "The locks of all messages should have been renewed")
+	assert.Equal(t, []string{"1", "2"}, rcvr.completed)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, renewals, atomic.LoadInt32(&rcvr.renewals), "Renewals should stop once the summary is sent")
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import "time"
+
+// messageClock compares the times carried by Service Bus messages, which are
+// set by Service Bus, with the local time, tolerating some skew between the
+// clocks of Service Bus and of the local host.
+//
+// A nil *messageClock uses the system clock and tolerates no skew.
+type messageClock struct {
+	now  func() time.Time
+	skew time.Duration
+}
+
+// newMessageClock returns a messageClock which uses the system clock and
+// tolerates the given skew.
+func newMessageClock(skew time.Duration) *messageClock {
+	return &messageClock{
+		now:  time.Now,
+		skew: skew,
+	}
+}
+
+// Now returns the local time.
+func (c *messageClock) Now() time.Time {
+	if c == nil || c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// tolerance returns the tolerated clock skew.
+func (c *messageClock) tolerance() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.skew
+}
+
+// isPast returns whether the given time is in the past by more than the
+// tolerated skew, e.g. to determine that a message expired.
+func (c *messageClock) isPast(t time.Time) bool {
+	return t.Before(c.Now().Add(-c.tolerance()))
+}
+
+// isFuture returns whether the given time is in the future by more than the
+// tolerated skew, e.g. to determine that a message isn't due yet.
+func (c *messageClock) isFuture(t time.Time) bool {
+	return t.After(c.Now().Add(c.tolerance()))
+}
+
+// until returns the duration until the given time, shortened by the tolerated
+// skew so that deadlines set by Service Bus are not missed.
+func (c *messageClock) until(t time.Time) time.Duration {
+	return t.Sub(c.Now()) - c.tolerance()
+}
+
+// since returns the duration elapsed since the given time. Times in the
+// future, which can only be the result of clock skew, yield 0.
+func (c *messageClock) since(t time.Time) time.Duration {
+	if d := c.Now().Sub(t); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// notAfterNow returns the given time, or the local time if the given time is
+// in the future by no more than the tolerated skew. This prevents times set
+// by Service Bus from appearing to be in the future because of clock skew.
+func (c *messageClock) notAfterNow(t time.Time) time.Time {
+	if now := c.Now(); t.After(now) && !c.isFuture(t) {
+		return now
+	}
+	return t
+}
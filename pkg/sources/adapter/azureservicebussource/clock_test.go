@@ -0,0 +1,99 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageClock(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	testCases := []struct {
+		name              string
+		clock             *messageClock
+		t                 time.Time
+		expectPast        bool
+		expectFuture      bool
+		expectUntil       time.Duration
+		expectSince       time.Duration
+		expectNotAfterNow time.Time
+	}{
+		{
+			name:              "Past beyond the skew",
+			clock:             &messageClock{now: func() time.Time { return now }, skew: 5 * time.Second},
+			t:                 now.Add(-time.Minute),
+			expectPast:        true,
+			expectUntil:       -time.Minute - 5*time.Second,
+			expectSince:       time.Minute,
+			expectNotAfterNow: now.Add(-time.Minute),
+		},
+		{
+			name:              "Past within the skew",
+			clock:             &messageClock{now: func() time.Time { return now }, skew: 5 * time.Second},
+			t:                 now.Add(-time.Second),
+			expectUntil:       -6 * time.Second,
+			expectSince:       time.Second,
+			expectNotAfterNow: now.Add(-time.Second),
+		},
+		{
+			name:              "Future within the skew",
+			clock:             &messageClock{now: func() time.Time { return now }, skew: 5 * time.Second},
+			t:                 now.Add(time.Second),
+			expectUntil:       -4 * time.Second,
+			expectNotAfterNow: now,
+		},
+		{
+			name:              "Future beyond the skew",
+			clock:             &messageClock{now: func() time.Time { return now }, skew: 5 * time.Second},
+			t:                 now.Add(time.Minute),
+			expectFuture:      true,
+			expectUntil:       55 * time.Second,
+			expectNotAfterNow: now.Add(time.Minute),
+		},
+		{
+			name:              "No skew tolerated",
+			clock:             &messageClock{now: func() time.Time { return now }},
+			t:                 now.Add(time.Second),
+			expectFuture:      true,
+			expectUntil:       time.Second,
+			expectNotAfterNow: now.Add(time.Second),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectPast, tc.clock.isPast(tc.t), "isPast")
+			assert.Equal(t, tc.expectFuture, tc.clock.isFuture(tc.t), "isFuture")
+			assert.Equal(t, tc.expectUntil, tc.clock.until(tc.t), "until")
+			assert.Equal(t, tc.expectSince, tc.clock.since(tc.t), "since")
+			assert.Equal(t, tc.expectNotAfterNow, tc.clock.notAfterNow(tc.t), "notAfterNow")
+		})
+	}
+}
+
+func TestMessageClockNil(t *testing.T) {
+	var c *messageClock
+
+	assert.WithinDuration(t, time.Now(), c.Now(), time.Second)
+	assert.True(t, c.isPast(time.Now().Add(-time.Second)))
+	assert.True(t, c.isFuture(time.Now().Add(time.Minute)))
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// completionBatcher is a dispositioner which defers the completion of
+// messages, and completes them in batches of up to size messages, or whatever
+// number of messages was accumulated after flushInterval. Other settlements
+// are passed through to the wrapped dispositioner.
+//
+// The azservicebus client doesn't expose any bulk settlement operation, so
+// each message is still completed with its own disposition, and batching
+// doesn't reduce the number of disposition frames sent to Service Bus. It
+// only moves these round-trips out of the processing path of messages, and
+// performs them concurrently. Messages of a batch are therefore completed in
+// no particular order, and after any message which was abandoned or
+// dead-lettered while their completion was pending.
+//
+// This doesn't weaken the at-least-once delivery guarantee, at the cost of
+// possible duplicates: messages whose completion is pending remain locked,
+// and are redelivered by Service Bus once their lock expires if the adapter
+// crashes before flushing them, or if their completion fails. The lock of a
+// message isn't renewed while its completion is pending, so the flush
+// interval must remain well below the lock duration of the entity.
+type completionBatcher struct {
+	dispositioner
+
+	logger *zap.SugaredLogger
+
+	size          int
+	flushInterval time.Duration
+
+	reqs chan *completionRequest
+}
+
+// completionRequest is a request to complete a message as part of a batch.
+type completionRequest struct {
+	rcvr messageReceiver
+	msg  *azservicebus.ReceivedMessage
+}
+
+var _ dispositioner = (*completionBatcher)(nil)
+
+// newCompletionBatcher returns a completionBatcher which completes messages
+// using the given dispositioner.
+func newCompletionBatcher(d dispositioner, logger *zap.SugaredLogger,
+	size int, flushInterval time.Duration) *completionBatcher {
+
+	return &completionBatcher{
+		dispositioner: d,
+		logger:        logger,
+		size:          size,
+		flushInterval: flushInterval,
+		reqs:          make(chan *completionRequest),
+	}
+}
+
+// Complete implements dispositioner.
+//
+// It returns once the completion of the message was accepted into a batch.
+// Failures to complete the message are logged when the batch is flushed.
+func (b *completionBatcher) Complete(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	select {
+	case b.reqs <- &completionRequest{rcvr: rcvr, msg: msg}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run accumulates completions and flushes them in batches until ctx is
+// canceled. Completions which were accumulated at that point are flushed
+// before run returns.
+func (b *completionBatcher) run(ctx context.Context) {
+	var batch []*completionRequest
+
+	timer := time.NewTimer(b.flushInterval)
+	timer.Stop()
+
+	for {
+		select {
+		case req := <-b.reqs:
+			batch = append(batch, req)
+			if len(batch) == 1 {
+				timer.Reset(b.flushInterval)
+			}
+			if len(batch) < b.size {
+				continue
+			}
+			// A tick which fired concurrently would otherwise flush
+			// the next batch early.
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+		case <-timer.C:
+
+		case <-ctx.Done():
+			b.flush(detach(ctx), batch)
+			return
+		}
+
+		b.flush(ctx, batch)
+		batch = nil
+	}
+}
+
+// flush completes the messages of the given batch concurrently, and waits
+// for all completions to return.
+func (b *completionBatcher) flush(ctx context.Context, batch []*completionRequest) {
+	var wg sync.WaitGroup
+	wg.Add(len(batch))
+
+	for _, req := range batch {
+		req := req
+		go func() {
+			defer wg.Done()
+			if err := b.dispositioner.Complete(ctx, req.rcvr, req.msg); err != nil {
+				b.logger.Errorw("Failed to complete message, it will be redelivered once its lock expires",
+					zap.String(logfieldMsgID, req.msg.MessageID), zap.Error(err))
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	"knative.dev/pkg/logging"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	metricstesting "github.com/triggermesh/triggermesh/pkg/metrics/testing"
+)
+
+func TestCompletionBatcher(t *testing.T) {
+	const flushInterval = 50 * time.Millisecond
+
+	t.Run("flushes full batches", func(t *testing.T) {
+		disp := &fakeDispositioner{}
+		b := newCompletionBatcher(disp, logtesting.TestLogger(t), 2, time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go b.run(ctx)
+
+		require.NoError(t, b.Complete(ctx, &fakeReceiver{}, &azservicebus.ReceivedMessage{MessageID: "1"}))
+		require.NoError(t, b.Complete(ctx, &fakeReceiver{}, &azservicebus.ReceivedMessage{MessageID: "2"}))
+
+		assert.Eventually(t, func() bool { return disp.count(settledComplete) == 2 },
+			time.Second, 5*time.Millisecond, "Expected a full batch to be flushed immediately")
+	})
+
+	t.Run("flushes partial batches after the interval", func(t *testing.T) {
+		disp := &fakeDispositioner{}
+		b := newCompletionBatcher(disp, logtesting.TestLogger(t), 10, flushInterval)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go b.run(ctx)
+
+		require.NoError(t, b.Complete(ctx, &fakeReceiver{}, &azservicebus.ReceivedMessage{MessageID: "1"}))
+		assert.Zero(t, disp.count(settledComplete), "Expected the completion to be deferred")
+
+		assert.Eventually(t, func() bool { return disp.count(settledComplete) == 1 },
+			time.Second, 5*time.Millisecond, "Expected a partial batch to be flushed after the interval")
+	})
+
+	t.Run("flushes pending completions on shutdown", func(t *testing.T) {
+		disp := &fakeDispositioner{}
+		b := newCompletionBatcher(disp, logtesting.TestLogger(t), 10, time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			b.run(ctx)
+			close(done)
+		}()
+
+		require.NoError(t, b.Complete(ctx, &fakeReceiver{}, &azservicebus.ReceivedMessage{MessageID: "1"}))
+		cancel()
+		<-done
+
+		assert.Equal(t, 1, disp.count(settledComplete))
+	})
+
+	t.Run("passes other settlements through", func(t *testing.T) {
+		disp := &fakeDispositioner{}
+		b := newCompletionBatcher(disp, logtesting.TestLogger(t), 10, time.Hour)
+
+		ctx := context.Background()
+		require.NoError(t, b.Abandon(ctx, &fakeReceiver{}, &azservicebus.ReceivedMessage{MessageID: "1"}))
+		require.NoError(t, b.DeadLetter(ctx, &fakeReceiver{}, &azservicebus.ReceivedMessage{MessageID: "2"},
+			deadLetterReasonProcessing, "some error"))
+
+		assert.Equal(t, []string{settledAbandon, settledDeadLetter}, disp.settlements)
+	})
+
+	t.Run("fails when the batcher isn't running", func(t *testing.T) {
+		b := newCompletionBatcher(&fakeDispositioner{}, logtesting.TestLogger(t), 10, time.Hour)
+
+		ctx, cancel := context.WithTimeout(context.Background(), flushInterval)
+		defer cancel()
+
+		assert.ErrorIs(t, b.Complete(ctx, &fakeReceiver{}, &azservicebus.ReceivedMessage{MessageID: "1"}),
+			context.DeadlineExceeded)
+	})
+}
+
+func TestNewAdapterCompletionBatching(t *testing.T) {
+	testCases := []struct {
+		name        string
+		setOpts     func(*envConfig)
+		expectPanic string
+	}{
+		{
+			name: "Ordered completions",
+			setOpts: func(env *envConfig) {
+				env.OrderedCompletion = true
+			},
+			expectPanic: "Completions can not be batched when they are ordered",
+		},
+		{
+			name: "Sessions",
+			setOpts: func(env *envConfig) {
+				env.SessionEnabled = true
+			},
+			expectPanic: "Completions can not be batched when sessions are enabled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// NewAdapter registers metrics views.
+			metricstesting.UnregisterMetrics()
+
+			env := &envConfig{}
+			require.NoError(t, envconfig.Process("", env))
+
+			env.CompleteBatchSize = 2
+			tc.setOpts(env)
+
+			ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+
+			assert.PanicsWithValue(t, tc.expectPanic, func() {
+				NewAdapter(ctx, env, adaptertest.NewTestClient())
+			})
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"fmt"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/Azure/azure-amqp-common-go/v3/uuid"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// newControlEvent returns a CloudEvent of the given type which conveys
+// information about the given Service Bus entity rather than about one of its
+// messages, such as drained, heartbeat and batch summary events.
+func newControlEvent(ceSource, entityPath, typ string, data any) (*cloudevents.Event, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("generating CloudEvent ID: %w", err)
+	}
+
+	event := cloudevents.NewEvent()
+	event.SetID(id.String())
+	event.SetSource(ceSource)
+	event.SetType(v1alpha1.AzureEventType(sources.AzureServiceServiceBus, typ))
+	event.SetSubject(entityPath)
+	event.SetTime(time.Now())
+
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return nil, fmt.Errorf("setting CloudEvent data: %w", err)
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/Azure/azure-amqp-common-go/v3/uuid"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// Names of the CloudEvent extension attributes which describe the failure
+// to handle a message, in events sent to the dead-letter sink.
+const (
+	extErrorReason      = "sberrorreason"
+	extErrorDescription = "sberrordescription"
+)
+
+// failureReason returns the reason of a failure to handle a message, as
+// conveyed by the given error returned by handleMessage.
+func failureReason(handleErr error) string {
+	var sizeErr *messageTooLargeError
+	var timeoutErr *messageTimeoutError
+	var procErr *processingError
+	var delivErr *deliveryError
+
+	switch {
+	case errors.As(handleErr, &sizeErr):
+		return deadLetterReasonSize
+	case errors.As(handleErr, &timeoutErr):
+		return deadLetterReasonTimeout
+	case errors.Is(handleErr, errProcessorPanic):
+		return deadLetterReasonPanic
+	case errors.As(handleErr, &procErr):
+		return deadLetterReasonProcessing
+	case errors.As(handleErr, &delivErr) && delivErr.isFatal():
+		return deadLetterReasonRejected
+	default:
+		return deadLetterReasonDelivery
+	}
+}
+
+// deadLetter forwards the given message to the dead-letter sink, if one is
+// configured, then moves it to the dead-letter sub-queue of the entity.
+func (a *adapter) deadLetter(ctx context.Context, fm *fullMessage, handleErr error, reason, description string) error {
+	a.forwardToDeadLetterSink(ctx, fm.serializable, handleErr)
+
+	if err := a.disposition().DeadLetter(ctx, fm.rcvr, fm.received, reason, description); err != nil {
+		return fmt.Errorf("error dead-lettering message: %w", err)
+	}
+	return nil
+}
+
+// forwardToDeadLetterSink sends a CloudEvent which describes a message that
+// couldn't be handled to the dead-letter sink, if one is configured.
+//
+// Messages are only forwarded once their handling failed for good, i.e. when
+// they get dead-lettered, or completed although their events were lost.
+// Messages which are abandoned for redelivery are not.
+//
+// Failures to reach the dead-letter sink are only logged, since they must not
+// affect the settlement of the message.
+func (a *adapter) forwardToDeadLetterSink(ctx context.Context, msg *Message, handleErr error) {
+	if a.deadLetterSink == "" {
+		return
+	}
+
+	if err := a.forwardFailedMessage(ctx, a.deadLetterSink, failurePayloadRaw, msg, handleErr); err != nil {
+		a.logger.Errorw("Failed to forward message to the dead-letter sink",
+			zap.String(logfieldMsgID, msg.ReceivedMessage.MessageID), zap.Error(err))
+	}
+}
+
+// failurePayload is the format of the CloudEvents which describe a message
+// that couldn't be handled.
+type failurePayload int
+
+const (
+	// The data of the event is the raw body of the message, and the
+	// failure is described by extension attributes (see makeDeadLetterEvent).
+	failurePayloadRaw failurePayload = iota
+	// The data of the event is a conversionFailure, which describes the
+	// failure along with the body and properties of the message (see
+	// makeConversionFailureEvent).
+	failurePayloadConversion
+)
+
+// forwardFailedMessage sends a CloudEvent which describes a message that
+// couldn't be handled because of the given error to the given sink, in the
+// given format.
+func (a *adapter) forwardFailedMessage(ctx context.Context, sink string, payload failurePayload,
+	msg *Message, handleErr error) error {
+
+	var event *cloudevents.Event
+	var err error
+
+	switch payload {
+	case failurePayloadConversion:
+		event, err = makeConversionFailureEvent(msg, a.ceSource, handleErr)
+	default:
+		event, err = makeDeadLetterEvent(msg, a.ceSource, handleErr)
+	}
+	if err != nil {
+		return fmt.Errorf("creating CloudEvent: %w", err)
+	}
+
+	ctx, cancel := a.withSinkTimeout(cloudevents.ContextWithTarget(ctx, sink))
+	defer cancel()
+
+	return sendCloudEvent(ctx, a.deadLetterClient, event)
+}
+
+// makeDeadLetterEvent returns a CloudEvent which describes a message that
+// couldn't be handled because of the given error.
+func makeDeadLetterEvent(msg *Message, srcAttr string, handleErr error) (*cloudevents.Event, error) {
+	event := cloudevents.NewEvent()
+	event.SetID(msg.ReceivedMessage.MessageID)
+	event.SetSource(srcAttr)
+	event.SetType(v1alpha1.AzureEventType(sources.AzureServiceServiceBus, v1alpha1.AzureServiceBusErrorEventType))
+	event.SetTime(time.Now())
+
+	if msg.ReceivedMessage.MessageID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, fmt.Errorf("generating CloudEvent ID: %w", err)
+		}
+		event.SetID(id.String())
+	}
+
+	setSystemPropertiesExtensions(&event, msg)
+
+	event.SetExtension(extErrorReason, failureReason(handleErr))
+	event.SetExtension(extErrorDescription, handleErr.Error())
+
+	ct := contentType(msg)
+	if ct == "" {
+		ct = "application/octet-stream"
+		if json.Valid(msg.Body) {
+			ct = cloudevents.ApplicationJSON
+		}
+	}
+
+	if err := event.SetData(ct, msg.Body); err != nil {
+		return nil, fmt.Errorf("setting CloudEvent data: %w", err)
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestMakeDeadLetterEvent(t *testing.T) {
+	testCases := []struct {
+		name         string
+		handleErr    error
+		expectReason string
+	}{
+		{
+			name:         "Processing failure",
+			handleErr:    &processingError{err: errors.New("invalid message")},
+			expectReason: deadLetterReasonProcessing,
+		},
+		{
+			name:         "Processor panic",
+			handleErr:    &processingError{err: fmt.Errorf("%w: index out of range", errProcessorPanic)},
+			expectReason: deadLetterReasonPanic,
+		},
+		{
+			name:         "Delivery failure",
+			handleErr:    &deliveryError{numEvents: 1, errs: errList{errs: []error{errors.New("sink unavailable")}}},
+			expectReason: deadLetterReasonDelivery,
+		},
+		{
+			name:         "Handling timeout",
+			handleErr:    &messageTimeoutError{timeout: time.Second, err: context.DeadlineExceeded},
+			expectReason: deadLetterReasonTimeout,
+		},
+		{
+			name:         "Oversized message",
+			handleErr:    &messageTooLargeError{size: 2, maxSize: 1},
+			expectReason: deadLetterReasonSize,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID:     "someMessageID",
+					Body:          []byte("not JSON"),
+					DeliveryCount: 2,
+				},
+			}
+
+			event, err := makeDeadLetterEvent(msg, "/some/source", tc.handleErr)
+			require.NoError(t, err)
+			require.NoError(t, event.Validate())
+
+			assert.Equal(t, "com.microsoft.azure.servicebus.error", event.Type())
+			assert.Equal(t, "/some/source", event.Source())
+			assert.Equal(t, "someMessageID", event.ID())
+			assert.Equal(t, "application/octet-stream", event.DataContentType())
+			assert.Equal(t, []byte("not JSON"), event.Data())
+
+			exts := event.Extensions()
+			assert.Equal(t, tc.expectReason, exts[extErrorReason])
+			assert.Equal(t, tc.handleErr.Error(), exts[extErrorDescription])
+			assert.Equal(t, "2", exts["sbdeliverycount"])
+		})
+	}
+}
+
+func TestSettleMessageDeadLetterSink(t *testing.T) {
+	const deadLetterSink = "http://deadletter.example.com"
+
+	testCases := []struct {
+		name                string
+		sendResult          protocol.Result
+		deliveryCount       uint32
+		completionPolicy    string
+		expectAbandoned     []string
+		expectDeadLettered  []string
+		expectCompleted     []string
+		expectForwardReason string
+	}{
+		{
+			name:            "Message is abandoned for redelivery",
+			sendResult:      errors.New("sink unavailable"),
+			expectAbandoned: []string{"someMessageID"},
+		},
+		{
+			name:                "Message is dead-lettered after a rejection",
+			sendResult:          cehttp.NewResult(http.StatusBadRequest, "bad request"),
+			expectDeadLettered:  []string{"someMessageID"},
+			expectForwardReason: deadLetterReasonRejected,
+		},
+		{
+			name:                "Message is dead-lettered by the completion policy",
+			sendResult:          errors.New("sink unavailable"),
+			completionPolicy:    completionPolicyBestEffort,
+			expectDeadLettered:  []string{"someMessageID"},
+			expectForwardReason: deadLetterReasonDelivery,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dlClient := &targetRecordingClient{TestCloudEventsClient: adaptertest.NewTestClient()}
+
+			a := &adapter{
+				logger: logtesting.TestLogger(t),
+				ceClient: &staticResultClient{
+					TestCloudEventsClient: adaptertest.NewTestClient(),
+					result:                tc.sendResult,
+				},
+				msgPrcsr:         &defaultMessageProcessor{},
+				ceSource:         "/some/source",
+				deadLetterSink:   deadLetterSink,
+				deadLetterClient: dlClient,
+				completionPolicy: tc.completionPolicy,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvr := &fakeReceiver{}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID: "someMessageID",
+				Body:      []byte(`{"test": null}`),
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				rcvr:         rcvr,
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			handleErr := a.handleMessage(ctx, msg, nil)
+			require.Error(t, handleErr)
+
+			err = a.settleMessage(ctx, fm, handleErr)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectAbandoned, rcvr.abandoned, "Message is settled as usual")
+			assert.Equal(t, tc.expectDeadLettered, rcvr.deadLettered, "Message is settled as usual")
+			assert.Equal(t, tc.expectCompleted, rcvr.completed, "Message is settled as usual")
+
+			sent := dlClient.Sent()
+			if tc.expectForwardReason == "" {
+				assert.Empty(t, sent, "Messages which may be redelivered are not forwarded")
+				return
+			}
+
+			require.Len(t, sent, 1)
+			assert.Equal(t, "com.microsoft.azure.servicebus.error", sent[0].Type())
+			assert.Equal(t, tc.expectForwardReason, sent[0].Extensions()[extErrorReason])
+			assert.JSONEq(t, `{"test": null}`, string(sent[0].Data()))
+			assert.Equal(t, []string{deadLetterSink}, dlClient.targets)
+		})
+	}
+}
+
+// targetRecordingClient is a cloudevents.Client which records the target URL
+// set in the context of sent events.
+type targetRecordingClient struct {
+	*adaptertest.TestCloudEventsClient
+	targets []string
+}
+
+// Send implements cloudevents.Client.
+func (c *targetRecordingClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	if target := cecontext.TargetFrom(ctx); target != nil {
+		c.targets = append(c.targets, target.String())
+	}
+	return c.TestCloudEventsClient.Send(ctx, e)
+}
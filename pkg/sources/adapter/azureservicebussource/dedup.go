@@ -0,0 +1,111 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// dedupCache remembers the IDs of messages which were delivered to the sink
+// within a sliding time window, so that redeliveries of the same messages
+// (e.g. after the expiration of their lock) can be detected.
+//
+// The cache is bounded: when it is full, the IDs which were recorded the
+// longest time ago are evicted first. Deduplication is therefore best-effort.
+type dedupCache struct {
+	window  time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// IDs ordered by time of recording, oldest first
+	order *list.List
+
+	// returns the current time; overridden in tests
+	now func() time.Time
+}
+
+// dedupEntry is an element of the dedupCache.
+type dedupEntry struct {
+	id     string
+	seenAt time.Time
+}
+
+// newDedupCache returns a dedupCache which remembers up to maxSize message IDs
+// during the given time window.
+func newDedupCache(window time.Duration, maxSize int) *dedupCache {
+	return &dedupCache{
+		window:  window,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// seen returns whether the given message ID was recorded within the time
+// window of the cache.
+func (c *dedupCache) seen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return false
+	}
+	return c.now().Sub(e.Value.(*dedupEntry).seenAt) < c.window
+}
+
+// add records the given message ID.
+func (c *dedupCache) add(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if e, ok := c.entries[id]; ok {
+		e.Value.(*dedupEntry).seenAt = now
+		c.order.MoveToBack(e)
+	} else {
+		c.entries[id] = c.order.PushBack(&dedupEntry{id: id, seenAt: now})
+	}
+
+	c.evict(now)
+}
+
+// evict removes expired entries, as well as the oldest entries in excess of
+// the size of the cache.
+// Must be called with the mutex held.
+func (c *dedupCache) evict(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		entry := e.Value.(*dedupEntry)
+		if c.order.Len() <= c.maxSize && now.Sub(entry.seenAt) < c.window {
+			return
+		}
+		c.order.Remove(e)
+		delete(c.entries, entry.id)
+	}
+}
+
+// len returns the number of message IDs in the cache.
+func (c *dedupCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
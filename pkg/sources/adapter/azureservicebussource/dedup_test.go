@@ -0,0 +1,119 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestDedupCache(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	c := newDedupCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	assert.False(t, c.seen("a"))
+
+	c.add("a")
+	assert.True(t, c.seen("a"))
+
+	now = now.Add(59 * time.Second)
+	assert.True(t, c.seen("a"), "ID is still within the window")
+
+	now = now.Add(time.Second)
+	assert.False(t, c.seen("a"), "ID is outside of the window")
+
+	c.add("b")
+	assert.Equal(t, 1, c.len(), "Expired IDs are evicted")
+
+	c.add("c")
+	c.add("d")
+	assert.Equal(t, 2, c.len())
+	assert.False(t, c.seen("b"), "Oldest ID is evicted when the cache is full")
+	assert.True(t, c.seen("c"))
+	assert.True(t, c.seen("d"))
+
+	c.add("c")
+	c.add("e")
+	assert.True(t, c.seen("c"), "Recorded ID is refreshed")
+	assert.False(t, c.seen("d"))
+}
+
+func TestHandleMessageDedup(t *testing.T) {
+	newMsg := func(id string) *Message {
+		return &Message{
+			ReceivedMessage: &azservicebus.ReceivedMessage{
+				MessageID: id,
+				Body:      []byte(`{"test": null}`),
+			},
+		}
+	}
+
+	t.Run("Redelivered message is sent once", func(t *testing.T) {
+		ceClient := adaptertest.NewTestClient()
+
+		a := &adapter{
+			logger:   logtesting.TestLogger(t),
+			ceClient: ceClient,
+			msgPrcsr: &defaultMessageProcessor{},
+			dedup:    newDedupCache(time.Minute, 10),
+
+			sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+		}
+
+		assert.NoError(t, a.handleMessage(context.Background(), newMsg("1"), nil))
+		assert.NoError(t, a.handleMessage(context.Background(), newMsg("1"), nil))
+		assert.NoError(t, a.handleMessage(context.Background(), newMsg("2"), nil))
+
+		assert.Len(t, ceClient.Sent(), 2)
+	})
+
+	t.Run("Undelivered message is not recorded", func(t *testing.T) {
+		ceClient := &staticResultClient{
+			TestCloudEventsClient: adaptertest.NewTestClient(),
+			result:                errors.New("sink unavailable"),
+		}
+
+		a := &adapter{
+			logger:   logtesting.TestLogger(t),
+			ceClient: ceClient,
+			msgPrcsr: &defaultMessageProcessor{},
+			dedup:    newDedupCache(time.Minute, 10),
+
+			sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+		}
+
+		assert.Error(t, a.handleMessage(context.Background(), newMsg("1"), nil))
+
+		ceClient.result = nil
+		assert.NoError(t, a.handleMessage(context.Background(), newMsg("1"), nil))
+		assert.Len(t, ceClient.Sent(), 1)
+	})
+}
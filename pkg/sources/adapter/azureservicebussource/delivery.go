@@ -0,0 +1,59 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import "context"
+
+// Delivery semantics of the adapter, which determine whether messages are
+// settled after or before their events are sent to the sink.
+const (
+	deliverySemanticsAtLeastOnce = "at-least-once"
+	deliverySemanticsAtMostOnce  = "at-most-once"
+)
+
+// isSupportedDeliverySemantics returns whether the given delivery semantics
+// are supported.
+func isSupportedDeliverySemantics(s string) bool {
+	switch s {
+	case deliverySemanticsAtLeastOnce, deliverySemanticsAtMostOnce:
+		return true
+	}
+	return false
+}
+
+// earlyCompletion returns a function which lets handleMessage complete the
+// given message before sending its events, if the adapter delivers events at
+// most once, or nil otherwise. Messages completed that way are marked as
+// such, so that settleMessage doesn't attempt to settle them a second time.
+//
+// The completion runs in a context which is detached from ctx, like any
+// other settlement.
+func (a *adapter) earlyCompletion(ctx context.Context, fm *fullMessage) func() error {
+	if a.deliverySemantics != deliverySemanticsAtMostOnce {
+		return nil
+	}
+
+	settleCtx := detach(ctx)
+
+	return func() error {
+		if err := a.disposition().Complete(settleCtx, fm.rcvr, fm.received); err != nil {
+			return err
+		}
+		fm.completed = true
+		return nil
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestHandleMessageDeliverySemantics(t *testing.T) {
+	errComplete := errors.New("lock lost")
+
+	testCases := []struct {
+		name                 string
+		semantics            string
+		sendResult           protocol.Result
+		completeErr          error
+		expectSettlements    []string
+		expectSettledAtSend  string
+		expectSent           int
+		expectCompletedEarly bool
+		expectLostEvents     int64
+	}{
+		{
+			name:                "At least once, delivered",
+			semantics:           deliverySemanticsAtLeastOnce,
+			expectSettlements:   []string{settledComplete},
+			expectSettledAtSend: "",
+			expectSent:          1,
+		},
+		{
+			name:                "At least once, not delivered",
+			semantics:           deliverySemanticsAtLeastOnce,
+			sendResult:          cehttp.NewResult(503, "%w", protocol.ResultNACK),
+			expectSettlements:   []string{settledAbandon},
+			expectSettledAtSend: "",
+		},
+		{
+			name:                 "At most once, delivered",
+			semantics:            deliverySemanticsAtMostOnce,
+			expectSettlements:    []string{settledComplete},
+			expectSettledAtSend:  settledComplete,
+			expectSent:           1,
+			expectCompletedEarly: true,
+		},
+		{
+			name:                 "At most once, not delivered",
+			semantics:            deliverySemanticsAtMostOnce,
+			sendResult:           cehttp.NewResult(503, "%w", protocol.ResultNACK),
+			expectSettlements:    []string{settledComplete},
+			expectSettledAtSend:  settledComplete,
+			expectCompletedEarly: true,
+			expectLostEvents:     1,
+		},
+		{
+			name:              "At most once, completion fails",
+			semantics:         deliverySemanticsAtMostOnce,
+			completeErr:       errComplete,
+			expectSettlements: []string{settledAbandon},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := recordMetrics(t)
+
+			disp := &completionFailingDispositioner{
+				fakeDispositioner: &fakeDispositioner{},
+				err:               tc.completeErr,
+			}
+
+			ceClient := &settlementRecordingClient{
+				staticResultClient: &staticResultClient{
+					TestCloudEventsClient: adaptertest.NewTestClient(),
+					result:                tc.sendResult,
+				},
+				disp: disp.fakeDispositioner,
+			}
+
+			a := &adapter{
+				logger:            logtesting.TestLogger(t),
+				ceClient:          ceClient,
+				msgPrcsr:          &defaultMessageProcessor{},
+				dispositioner:     disp,
+				deliverySemantics: tc.semantics,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID: "1",
+				Body:      []byte(`{"test": null}`),
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			ctx := context.Background()
+
+			handleErr := a.handleMessage(ctx, fm.serializable, a.earlyCompletion(ctx, fm))
+			if tc.completeErr != nil {
+				assert.ErrorIs(t, handleErr, tc.completeErr)
+			}
+			assert.Equal(t, tc.expectCompletedEarly, fm.completed)
+
+			err = a.settleMessage(ctx, fm, handleErr)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectSettlements, disp.settlements, "Unexpected message settlements")
+			assert.Len(t, ceClient.Sent(), tc.expectSent)
+			assert.Equal(t, tc.expectSettledAtSend, ceClient.settledAtSend,
+				"Unexpected settlement of the message at the time its event was sent")
+
+			if tc.expectLostEvents != 0 {
+				m.assertTotal("event_loss_count", nil, float64(tc.expectLostEvents))
+			} else {
+				m.assertNotRecorded("event_loss_count")
+			}
+		})
+	}
+}
+
+func TestEarlyCompletion(t *testing.T) {
+	fm := &fullMessage{received: &azservicebus.ReceivedMessage{}}
+
+	a := &adapter{
+		dispositioner:     &fakeDispositioner{},
+		deliverySemantics: deliverySemanticsAtLeastOnce,
+	}
+	assert.Nil(t, a.earlyCompletion(context.Background(), fm),
+		"Messages should not be completed early with at-least-once semantics")
+
+	a.deliverySemantics = deliverySemanticsAtMostOnce
+	complete := a.earlyCompletion(context.Background(), fm)
+	require.NotNil(t, complete, "Messages should be completed early with at-most-once semantics")
+	assert.NoError(t, complete())
+	assert.True(t, fm.completed)
+}
+
+// completionFailingDispositioner is a fakeDispositioner which fails to
+// complete messages with the given error, if set.
+type completionFailingDispositioner struct {
+	*fakeDispositioner
+	err error
+}
+
+// Complete implements dispositioner.
+func (d *completionFailingDispositioner) Complete(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	if d.err != nil {
+		return d.err
+	}
+	return d.fakeDispositioner.Complete(ctx, rcvr, msg)
+}
+
+// settlementRecordingClient is a staticResultClient which records the last
+// settlement of the message at the time an event is sent.
+type settlementRecordingClient struct {
+	*staticResultClient
+	disp          *fakeDispositioner
+	settledAtSend string
+}
+
+// Send implements cloudevents.Client.
+func (c *settlementRecordingClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	c.settledAtSend = c.disp.lastSettlement()
+	return c.staticResultClient.Send(ctx, e)
+}
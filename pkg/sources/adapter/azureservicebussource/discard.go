@@ -0,0 +1,45 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+// Modes of delivery of CloudEvents to the sink.
+const (
+	sinkModeSend    = "send"
+	sinkModeDiscard = "discard"
+)
+
+// discardingClient is a cloudevents.Client which discards the events passed
+// to Send instead of delivering them, as if they had been acknowledged by the
+// sink. It allows measuring the throughput of the adapter independently of
+// the performance of the sink.
+type discardingClient struct {
+	cloudevents.Client
+}
+
+var _ cloudevents.Client = (*discardingClient)(nil)
+
+// Send implements cloudevents.Client.
+func (*discardingClient) Send(context.Context, cloudevents.Event) protocol.Result {
+	return nil
+}
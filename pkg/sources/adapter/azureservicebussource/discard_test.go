@@ -0,0 +1,77 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/metrics/metricstest"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+	metricstesting "github.com/triggermesh/triggermesh/pkg/metrics/testing"
+)
+
+func TestDiscardSinkMode(t *testing.T) {
+	metricstesting.ResetMetrics(t)
+
+	ceClient := adaptertest.NewTestClient()
+	rcvr := &fakeReceiver{}
+
+	a := &adapter{
+		logger:   logtesting.TestLogger(t),
+		ceClient: &discardingClient{Client: ceClient},
+		msgPrcsr: &defaultMessageProcessor{ceSource: "/some/source"},
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	rcvMsg := &azservicebus.ReceivedMessage{
+		MessageID: "someMessageID",
+		Body:      []byte(`{"test": null}`),
+	}
+	msg, err := toMessage(rcvMsg)
+	require.NoError(t, err)
+
+	fm := &fullMessage{
+		rcvr:         rcvr,
+		received:     rcvMsg,
+		serializable: msg,
+	}
+
+	ctx := context.Background()
+
+	handleErr := a.handleMessage(ctx, msg, nil)
+	require.NoError(t, handleErr)
+	require.NoError(t, a.settleMessage(ctx, fm, handleErr))
+
+	assert.Empty(t, ceClient.Sent(), "Events should be discarded")
+	assert.Equal(t, []string{"someMessageID"}, rcvr.completed)
+
+	metricstest.CheckCountData(t, "event_processing_success_count", map[string]string{
+		"event_type":   "com.microsoft.azure.servicebus.message",
+		"event_source": "/some/source",
+	}, 1)
+}
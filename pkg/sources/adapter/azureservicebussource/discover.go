@@ -0,0 +1,295 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// discoveryAdapter receives messages from all the queues of a Service Bus
+// namespace, using one adapter per queue.
+//
+// The queues of the namespace are listed periodically. Adapters are started
+// for queues which appear, and stopped for queues which disappear. Unlike with
+// the multiAdapter, a failure to consume from a given queue doesn't stop the
+// other adapters; the adapter of that queue is started again upon the next
+// discovery.
+type discoveryAdapter struct {
+	logger *zap.SugaredLogger
+
+	// returns the names of the queues of the namespace
+	listQueues func(context.Context) ([]string, error)
+	// returns an adapter which receives messages from the given queue
+	newAdapter func(ctx context.Context, queue string) *adapter
+	// interval between two discoveries
+	interval time.Duration
+
+	mu      sync.Mutex
+	running map[string]*runningAdapter
+	wg      sync.WaitGroup
+
+	// whether queues were discovered at least once
+	discovered atomic.Bool
+
+	// Shared by all adapters.
+	batcher    *batchingClient
+	healthPort uint16
+	status     *statusTracker
+	pause      *pauseControl
+}
+
+// runningAdapter is an adapter started by the discoveryAdapter.
+type runningAdapter struct {
+	adapter *adapter
+	stop    context.CancelFunc
+	done    chan struct{}
+}
+
+var _ pkgadapter.Adapter = (*discoveryAdapter)(nil)
+
+// Start implements adapter.Adapter.
+//
+// All adapters are stopped when ctx is canceled.
+func (d *discoveryAdapter) Start(ctx context.Context) error {
+	// Batches of events are delivered until all adapters have returned.
+	if d.batcher != nil {
+		batchCtx, stopBatching := context.WithCancel(detach(ctx))
+		batcherDone := make(chan struct{})
+		go func() {
+			d.batcher.run(batchCtx)
+			close(batcherDone)
+		}()
+		defer func() {
+			stopBatching()
+			<-batcherDone
+		}()
+	}
+
+	if d.healthPort != 0 {
+		stopHealthServer, err := startHealthServer(d.logger, d.healthPort, d.isReady, d.status, d.pause)
+		if err != nil {
+			return fmt.Errorf("starting health server: %w", err)
+		}
+		defer stopHealthServer()
+	}
+
+	defer d.stopAll()
+
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+
+	for {
+		d.discover(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// discover lists the queues of the namespace, and reconciles the set of
+// running adapters with these queues. Errors are only logged, the discovery
+// is attempted again after the discovery interval.
+func (d *discoveryAdapter) discover(ctx context.Context) {
+	queues, err := d.listQueues(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.Errorw("Unable to list the queues of the Service Bus namespace", zap.Error(err))
+		}
+		return
+	}
+	d.discovered.Store(true)
+
+	listed := make(map[string]struct{}, len(queues))
+	for _, q := range queues {
+		listed[q] = struct{}{}
+	}
+
+	d.mu.Lock()
+	var removed []*runningAdapter
+	for q, ra := range d.running {
+		if _, ok := listed[q]; !ok {
+			d.logger.Infow("Stopping the consumption of messages from deleted queue", zap.String(logfieldEntity, q))
+			removed = append(removed, ra)
+			delete(d.running, q)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, ra := range removed {
+		ra.stop()
+		<-ra.done
+	}
+
+	for _, q := range queues {
+		d.mu.Lock()
+		_, ok := d.running[q]
+		d.mu.Unlock()
+
+		if !ok && ctx.Err() == nil {
+			d.start(ctx, q)
+		}
+	}
+}
+
+// start starts an adapter which receives messages from the given queue.
+func (d *discoveryAdapter) start(ctx context.Context, queue string) {
+	a, err := d.tryNewAdapter(ctx, queue)
+	if err != nil {
+		d.logger.Errorw("Unable to consume messages from discovered queue", zap.String(logfieldEntity, queue), zap.Error(err))
+		return
+	}
+
+	d.logger.Infow("Starting the consumption of messages from discovered queue", zap.String(logfieldEntity, queue))
+
+	ctx, stop := context.WithCancel(ctx)
+	ra := &runningAdapter{
+		adapter: a,
+		stop:    stop,
+		done:    make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	d.running[queue] = ra
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer close(ra.done)
+		defer stop()
+
+		if err := a.Start(ctx); err != nil {
+			d.logger.Errorw("Stopped consuming messages from discovered queue", zap.String(logfieldEntity, queue), zap.Error(err))
+		}
+
+		// Allow the adapter to be started again upon the next
+		// discovery, unless it was stopped on purpose.
+		d.mu.Lock()
+		if d.running[queue] == ra {
+			delete(d.running, queue)
+		}
+		d.mu.Unlock()
+	}()
+}
+
+// tryNewAdapter returns an adapter which receives messages from the given
+// queue. The configuration of the adapter is validated upfront, so any panic
+// while creating the adapter is caused by a transient or queue-specific issue
+// (e.g. missing permissions), which must not take down the other adapters.
+func (d *discoveryAdapter) tryNewAdapter(ctx context.Context, queue string) (a *adapter, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return d.newAdapter(ctx, queue), nil
+}
+
+// stopAll stops all running adapters and waits for them to return.
+func (d *discoveryAdapter) stopAll() {
+	d.mu.Lock()
+	for _, ra := range d.running {
+		ra.stop()
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+// runningQueues returns the sorted names of the queues which adapters are
+// running for.
+func (d *discoveryAdapter) runningQueues() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	queues := make([]string, 0, len(d.running))
+	for q := range d.running {
+		queues = append(queues, q)
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+// isReady returns whether queues were discovered, and all running adapters
+// are ready to receive messages.
+func (d *discoveryAdapter) isReady() bool {
+	if !d.discovered.Load() {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, ra := range d.running {
+		if !ra.adapter.isReady() {
+			return false
+		}
+	}
+	return true
+}
+
+// adminQueueLister returns a function which lists the names of the queues of
+// a Service Bus namespace using the given admin.Client.
+//
+// Required permissions:
+//
+//	Microsoft.ServiceBus/namespaces/queues/read
+func adminQueueLister(cli *admin.Client) func(context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
+		var queues []string
+
+		pager := cli.NewListQueuesPager(nil)
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("listing queues: %w", err)
+			}
+			for _, q := range page.Queues {
+				queues = append(queues, q.QueueName)
+			}
+		}
+
+		return queues, nil
+	}
+}
+
+// queueResourceID returns the resource ID of the queue with the given name in
+// the given Service Bus namespace.
+func queueResourceID(namespaceID *v1alpha1.AzureResourceID, queue string) *v1alpha1.AzureResourceID {
+	queueID := *namespaceID
+	queueID.ResourceType = azureservicebus.ResourceTypeQueues
+	queueID.ResourceName = queue
+	return &queueID
+}
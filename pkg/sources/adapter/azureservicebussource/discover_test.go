@@ -0,0 +1,129 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestDiscoveryAdapterDiscover(t *testing.T) {
+	ceClient := adaptertest.NewTestClient()
+
+	var mu sync.Mutex
+	var queues []string
+	var listErr error
+
+	setQueues := func(qs []string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queues, listErr = qs, err
+	}
+
+	d := &discoveryAdapter{
+		logger: logtesting.TestLogger(t),
+		listQueues: func(context.Context) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return queues, listErr
+		},
+		newAdapter: func(_ context.Context, queue string) *adapter {
+			if queue == "forbidden" {
+				panic("missing permissions")
+			}
+
+			return &adapter{
+				logger: logtesting.TestLogger(t),
+				msgRcvr: &fakeReceiver{
+					batch: []*azservicebus.ReceivedMessage{
+						{MessageID: queue, Body: []byte(`{"test": null}`)},
+					},
+				},
+				ceClient:      ceClient,
+				ceSource:      queue,
+				msgPrcsr:      &defaultMessageProcessor{ceSource: queue},
+				maxConcurrent: 1,
+				prefetchCount: 1,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+		},
+		running: make(map[string]*runningAdapter),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	setQueues(nil, errors.New("namespace unavailable"))
+	d.discover(ctx)
+	assert.False(t, d.isReady(), "Expected the adapter not to be ready before queues are discovered")
+	assert.Empty(t, d.runningQueues())
+
+	setQueues([]string{"queue1", "queue2", "forbidden"}, nil)
+	d.discover(ctx)
+	assert.Equal(t, []string{"queue1", "queue2"}, d.runningQueues(),
+		"Queues which can't be consumed from should be skipped")
+
+	assert.Eventually(t, func() bool { return len(ceClient.Sent()) == 2 },
+		5*time.Second, 10*time.Millisecond, "Expected one event per discovered queue")
+
+	setQueues([]string{"queue2", "queue3"}, nil)
+	d.discover(ctx)
+	assert.Equal(t, []string{"queue2", "queue3"}, d.runningQueues(),
+		"Expected deleted queues to stop being consumed from")
+
+	assert.Eventually(t, func() bool { return len(ceClient.Sent()) == 3 },
+		5*time.Second, 10*time.Millisecond, "Expected one event per discovered queue")
+
+	cancel()
+	d.stopAll()
+	assert.Empty(t, d.runningQueues())
+
+	sources := make(map[string]string, 3)
+	for _, ev := range ceClient.Sent() {
+		sources[ev.ID()] = ev.Source()
+	}
+	assert.Equal(t, map[string]string{"queue1": "queue1", "queue2": "queue2", "queue3": "queue3"}, sources)
+}
+
+func TestQueueResourceID(t *testing.T) {
+	namespaceID, err := azureservicebus.ParseNamespaceResourceID(
+		"/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns")
+	require.NoError(t, err)
+
+	queueID := queueResourceID(namespaceID, "q")
+
+	assert.Equal(t, "/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q",
+		queueID.String())
+	assert.Equal(t, "q", azureservicebus.EntityPath(queueID))
+	assert.Empty(t, namespaceID.ResourceName, "The namespace ID should not be modified")
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Reasons attached to messages which get dead-lettered by the adapter.
+const (
+	deadLetterReasonProcessing = "MessageProcessingFailed"
+	deadLetterReasonDelivery   = "EventDeliveryFailed"
+	deadLetterReasonSize       = "MessageTooLarge"
+	deadLetterReasonRejected   = "EventRejected"
+	deadLetterReasonPanic      = "MessageProcessorPanicked"
+	deadLetterReasonTimeout    = "MessageHandlingTimedOut"
+)
+
+// dispositioner settles Service Bus messages. Messages must be settled using
+// the receiver they were received from.
+type dispositioner interface {
+	// Complete removes the given message from the entity.
+	Complete(ctx context.Context, rcvr messageReceiver, msg *azservicebus.ReceivedMessage) error
+	// Abandon releases the lock on the given message, so that Service Bus
+	// makes it available for redelivery.
+	Abandon(ctx context.Context, rcvr messageReceiver, msg *azservicebus.ReceivedMessage) error
+	// DeadLetter moves the given message to the dead-letter sub-queue of
+	// the entity.
+	DeadLetter(ctx context.Context, rcvr messageReceiver, msg *azservicebus.ReceivedMessage,
+		reason, description string) error
+	// Defer sets the given message aside, so that Service Bus only
+	// delivers it again when it is received by sequence number.
+	Defer(ctx context.Context, rcvr messageReceiver, msg *azservicebus.ReceivedMessage) error
+}
+
+// receiverDispositioner is a dispositioner which settles messages using the
+// settlement methods of the given receiver.
+type receiverDispositioner struct{}
+
+var _ dispositioner = receiverDispositioner{}
+
+// Complete implements dispositioner.
+func (receiverDispositioner) Complete(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	return rcvr.CompleteMessage(ctx, msg, nil)
+}
+
+// Abandon implements dispositioner.
+func (receiverDispositioner) Abandon(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	return rcvr.AbandonMessage(ctx, msg, nil)
+}
+
+// DeadLetter implements dispositioner.
+func (receiverDispositioner) DeadLetter(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage, reason, description string) error {
+
+	return rcvr.DeadLetterMessage(ctx, msg, &azservicebus.DeadLetterOptions{
+		Reason:           &reason,
+		ErrorDescription: &description,
+	})
+}
+
+// Defer implements dispositioner.
+func (receiverDispositioner) Defer(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	return rcvr.DeferMessage(ctx, msg, nil)
+}
+
+// disposition returns the dispositioner of the adapter.
+func (a *adapter) disposition() dispositioner {
+	if a.dispositioner == nil {
+		return receiverDispositioner{}
+	}
+	return a.dispositioner
+}
+
+// settlementCounter is a dispositioner which counts the messages successfully
+// settled through the dispositioner it wraps.
+type settlementCounter struct {
+	dispositioner
+
+	completed    atomic.Int64
+	abandoned    atomic.Int64
+	deadLettered atomic.Int64
+	deferred     atomic.Int64
+}
+
+var _ dispositioner = (*settlementCounter)(nil)
+
+// newSettlementCounter returns a settlementCounter which wraps the given
+// dispositioner.
+func newSettlementCounter(d dispositioner) *settlementCounter {
+	return &settlementCounter{
+		dispositioner: d,
+	}
+}
+
+// Complete implements dispositioner.
+func (c *settlementCounter) Complete(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	if err := c.dispositioner.Complete(ctx, rcvr, msg); err != nil {
+		return err
+	}
+	c.completed.Add(1)
+	return nil
+}
+
+// Abandon implements dispositioner.
+func (c *settlementCounter) Abandon(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	if err := c.dispositioner.Abandon(ctx, rcvr, msg); err != nil {
+		return err
+	}
+	c.abandoned.Add(1)
+	return nil
+}
+
+// DeadLetter implements dispositioner.
+func (c *settlementCounter) DeadLetter(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage, reason, description string) error {
+
+	if err := c.dispositioner.DeadLetter(ctx, rcvr, msg, reason, description); err != nil {
+		return err
+	}
+	c.deadLettered.Add(1)
+	return nil
+}
+
+// Defer implements dispositioner.
+func (c *settlementCounter) Defer(ctx context.Context, rcvr messageReceiver,
+	msg *azservicebus.ReceivedMessage) error {
+
+	if err := c.dispositioner.Defer(ctx, rcvr, msg); err != nil {
+		return err
+	}
+	c.deferred.Add(1)
+	return nil
+}
+
+// settlementCounts is a snapshot of the counts of a settlementCounter.
+type settlementCounts struct {
+	completed    int64
+	abandoned    int64
+	deadLettered int64
+	deferred     int64
+}
+
+// counts returns a snapshot of the counts of the settlementCounter. A nil
+// settlementCounter has all its counts equal to zero.
+func (c *settlementCounter) counts() settlementCounts {
+	if c == nil {
+		return settlementCounts{}
+	}
+
+	return settlementCounts{
+		completed:    c.completed.Load(),
+		abandoned:    c.abandoned.Load(),
+		deadLettered: c.deadLettered.Load(),
+		deferred:     c.deferred.Load(),
+	}
+}
+
+// since returns the difference between the counts and an earlier snapshot.
+func (c settlementCounts) since(earlier settlementCounts) settlementCounts {
+	return settlementCounts{
+		completed:    c.completed - earlier.completed,
+		abandoned:    c.abandoned - earlier.abandoned,
+		deadLettered: c.deadLettered - earlier.deadLettered,
+		deferred:     c.deferred - earlier.deferred,
+	}
+}
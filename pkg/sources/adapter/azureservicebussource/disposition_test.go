@@ -0,0 +1,156 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestReceiverDispositioner(t *testing.T) {
+	rcvr := &fakeReceiver{}
+	disp := receiverDispositioner{}
+
+	ctx := context.Background()
+
+	require.NoError(t, disp.Complete(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "1"}))
+	require.NoError(t, disp.Abandon(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "2"}))
+	require.NoError(t, disp.DeadLetter(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "3"},
+		deadLetterReasonProcessing, "some error"))
+	require.NoError(t, disp.Defer(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "4"}))
+
+	assert.Equal(t, []string{"1"}, rcvr.completed)
+	assert.Equal(t, []string{"2"}, rcvr.abandoned)
+	assert.Equal(t, []string{"3"}, rcvr.deadLettered)
+	assert.Equal(t, []string{"4"}, rcvr.deferred)
+}
+
+func TestAdapterDisposition(t *testing.T) {
+	a := &adapter{}
+	assert.IsType(t, receiverDispositioner{}, a.disposition(),
+		"Messages should be settled through their receiver by default")
+
+	disp := &fakeDispositioner{}
+	a.dispositioner = disp
+	assert.Same(t, disp, a.disposition())
+}
+
+func TestSettlementCounter(t *testing.T) {
+	rcvr := &fakeReceiver{}
+	c := newSettlementCounter(receiverDispositioner{})
+
+	ctx := context.Background()
+
+	require.NoError(t, c.Complete(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "1"}))
+	before := c.counts()
+
+	require.NoError(t, c.Complete(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "2"}))
+	require.NoError(t, c.Abandon(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "3"}))
+	require.NoError(t, c.DeadLetter(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "4"},
+		deadLetterReasonProcessing, "some error"))
+	require.NoError(t, c.Defer(ctx, rcvr, &azservicebus.ReceivedMessage{MessageID: "5"}))
+
+	assert.Equal(t, settlementCounts{completed: 2, abandoned: 1, deadLettered: 1, deferred: 1}, c.counts())
+	assert.Equal(t, settlementCounts{completed: 1, abandoned: 1, deadLettered: 1, deferred: 1}, c.counts().since(before))
+	assert.Equal(t, []string{"1", "2"}, rcvr.completed, "Messages should be settled through the wrapped dispositioner")
+
+	var nilCounter *settlementCounter
+	assert.Zero(t, nilCounter.counts())
+}
+
+// Settlements recorded by a fakeDispositioner.
+const (
+	settledComplete   = "complete"
+	settledAbandon    = "abandon"
+	settledDeadLetter = "deadletter"
+	settledDefer      = "defer"
+)
+
+// fakeDispositioner is a dispositioner which records the settlement of
+// messages instead of settling them.
+type fakeDispositioner struct {
+	mu                sync.Mutex
+	settlements       []string
+	deadLetterReasons []string
+}
+
+var _ dispositioner = (*fakeDispositioner)(nil)
+
+// Complete implements dispositioner.
+func (d *fakeDispositioner) Complete(context.Context, messageReceiver, *azservicebus.ReceivedMessage) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settlements = append(d.settlements, settledComplete)
+	return nil
+}
+
+// Abandon implements dispositioner.
+func (d *fakeDispositioner) Abandon(context.Context, messageReceiver, *azservicebus.ReceivedMessage) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settlements = append(d.settlements, settledAbandon)
+	return nil
+}
+
+// DeadLetter implements dispositioner.
+func (d *fakeDispositioner) DeadLetter(_ context.Context, _ messageReceiver, _ *azservicebus.ReceivedMessage,
+	reason, _ string) error {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settlements = append(d.settlements, settledDeadLetter)
+	d.deadLetterReasons = append(d.deadLetterReasons, reason)
+	return nil
+}
+
+// Defer implements dispositioner.
+func (d *fakeDispositioner) Defer(context.Context, messageReceiver, *azservicebus.ReceivedMessage) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settlements = append(d.settlements, settledDefer)
+	return nil
+}
+
+// lastSettlement returns the last recorded settlement, or an empty string if
+// no message was settled.
+func (d *fakeDispositioner) lastSettlement() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.settlements) == 0 {
+		return ""
+	}
+	return d.settlements[len(d.settlements)-1]
+}
+
+// count returns the number of recorded settlements of the given kind.
+func (d *fakeDispositioner) count(settlement string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var n int
+	for _, s := range d.settlements {
+		if s == settlement {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// messageCounter returns the number of active messages in a Service Bus
+// entity.
+type messageCounter func(context.Context) (int64, error)
+
+// drainWatcher detects when the backlog of a Service Bus entity has been
+// drained, by periodically polling the number of active messages in that
+// entity.
+type drainWatcher struct {
+	countMessages messageCounter
+	interval      time.Duration
+	entityPath    string
+
+	// whether the entity contained messages upon the last poll
+	hadMessages bool
+}
+
+// poll returns whether the entity became empty since the last poll. Errors
+// leave the state of the watcher unchanged.
+func (w *drainWatcher) poll(ctx context.Context) (drained bool, err error) {
+	count, err := w.countMessages(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	drained = w.hadMessages && count == 0
+	w.hadMessages = count > 0
+	return drained, nil
+}
+
+// watchDrained sends a CloudEvent to the sink every time the backlog of the
+// Service Bus entity transitions from non-empty to empty, until ctx is
+// canceled.
+func (a *adapter) watchDrained(ctx context.Context) {
+	t := time.NewTicker(a.drainWatcher.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		drained, err := a.drainWatcher.poll(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				a.logger.Warnw("Unable to count the active messages of the Service Bus entity", zap.Error(err))
+			}
+			continue
+		}
+		if !drained {
+			continue
+		}
+
+		ev, err := newDrainedEvent(a.ceSource, a.drainWatcher.entityPath)
+		if err != nil {
+			a.logger.Errorw("Unable to create drained event", zap.Error(err))
+			continue
+		}
+		if a.srcIdentity != "" {
+			ev.SetExtension(extSourceIdentity, a.srcIdentity)
+		}
+
+		if err := a.sendCloudEventWithRetry(ctx, ev); err != nil {
+			a.logger.Errorw("Unable to send drained event", zap.Error(err))
+			continue
+		}
+		a.logger.Debug("Sent drained event")
+	}
+}
+
+// drainedEventData is the data of the CloudEvent which signals that the
+// backlog of a Service Bus entity has been drained.
+type drainedEventData struct {
+	Entity string `json:"entity"`
+}
+
+// newDrainedEvent returns a CloudEvent which signals that the backlog of the
+// given Service Bus entity has been drained.
+func newDrainedEvent(ceSource, entityPath string) (*cloudevents.Event, error) {
+	return newControlEvent(ceSource, entityPath, v1alpha1.AzureServiceBusDrainedEventType,
+		&drainedEventData{Entity: entityPath})
+}
+
+// adminMessageCounter returns a messageCounter which reads the number of
+// active messages in the given Service Bus entity using the given
+// admin.Client. The number of messages in the given sub-queue of the entity is
+// returned instead when subQueue is non-zero.
+//
+// Required permissions:
+//
+//	Microsoft.ServiceBus/namespaces/queues/read
+//	Microsoft.ServiceBus/namespaces/topics/subscriptions/read
+func adminMessageCounter(cli *admin.Client, entityID *v1alpha1.AzureResourceID,
+	subQueue azservicebus.SubQueue) messageCounter {
+
+	return func(ctx context.Context) (int64, error) {
+		var active, deadLettered, transferDeadLettered int32
+
+		switch entityID.ResourceType {
+		case azureservicebus.ResourceTypeQueues:
+			resp, err := cli.GetQueueRuntimeProperties(ctx, entityID.ResourceName, nil)
+			if err != nil {
+				return 0, fmt.Errorf("getting queue runtime properties: %w", err)
+			}
+			if resp == nil {
+				return 0, fmt.Errorf("queue %q not found", entityID.ResourceName)
+			}
+			active, deadLettered = resp.ActiveMessageCount, resp.DeadLetterMessageCount
+			transferDeadLettered = resp.TransferDeadLetterMessageCount
+
+		default:
+			resp, err := cli.GetSubscriptionRuntimeProperties(ctx, entityID.ResourceName, entityID.SubResourceName, nil)
+			if err != nil {
+				return 0, fmt.Errorf("getting subscription runtime properties: %w", err)
+			}
+			if resp == nil {
+				return 0, fmt.Errorf("subscription %q not found", azureservicebus.EntityPath(entityID))
+			}
+			active, deadLettered = resp.ActiveMessageCount, resp.DeadLetterMessageCount
+			transferDeadLettered = resp.TransferDeadLetterMessageCount
+		}
+
+		switch subQueue {
+		case azservicebus.SubQueueDeadLetter:
+			return int64(deadLettered), nil
+		case azservicebus.SubQueueTransfer:
+			return int64(transferDeadLettered), nil
+		default:
+			return int64(active), nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+// sequenceCounter is a messageCounter which returns the given results in
+// order, then zero.
+type sequenceCounter struct {
+	counts []int64
+	errs   []error
+}
+
+func (c *sequenceCounter) count(context.Context) (int64, error) {
+	if len(c.counts) == 0 {
+		return 0, nil
+	}
+
+	count, err := c.counts[0], c.errs[0]
+	c.counts, c.errs = c.counts[1:], c.errs[1:]
+	return count, err
+}
+
+func TestDrainWatcherPoll(t *testing.T) {
+	errCount := errors.New("count failed")
+
+	c := &sequenceCounter{
+		counts: []int64{0, 3, 1, 0, 0, 2, 0, 0},
+		errs:   []error{nil, nil, nil, nil, nil, nil, errCount, nil},
+	}
+	w := &drainWatcher{countMessages: c.count}
+
+	expect := []struct {
+		drained bool
+		err     error
+	}{
+		{false, nil},      // 0: was never non-zero
+		{false, nil},      // 3
+		{false, nil},      // 1
+		{true, nil},       // 0: transitions to zero
+		{false, nil},      // 0: already empty
+		{false, nil},      // 2
+		{false, errCount}, // error: state is preserved
+		{true, nil},       // 0: transitions to zero
+	}
+
+	for i, e := range expect {
+		drained, err := w.poll(context.Background())
+		assert.Equal(t, e.err, err, "Unexpected error at poll #%d", i)
+		assert.Equal(t, e.drained, drained, "Unexpected result at poll #%d", i)
+	}
+}
+
+func TestWatchDrained(t *testing.T) {
+	const ceSource = "/some/source"
+
+	ceClient := adaptertest.NewTestClient()
+
+	c := &sequenceCounter{
+		counts: []int64{5, 0},
+		errs:   []error{nil, nil},
+	}
+
+	a := &adapter{
+		logger:   logtesting.TestLogger(t),
+		ceClient: ceClient,
+		ceSource: ceSource,
+		drainWatcher: &drainWatcher{
+			countMessages: c.count,
+			interval:      time.Millisecond,
+			entityPath:    "myqueue",
+		},
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.watchDrained(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return len(ceClient.Sent()) == 1 },
+		5*time.Second, 10*time.Millisecond, "Expected a drained event to be sent")
+
+	cancel()
+	<-done
+
+	events := ceClient.Sent()
+	require.Len(t, events, 1, "Expected a single drained event")
+
+	ev := events[0]
+	assert.Equal(t, "com.microsoft.azure.servicebus.drained", ev.Type())
+	assert.Equal(t, ceSource, ev.Source())
+	assert.Equal(t, "myqueue", ev.Subject())
+	assert.JSONEq(t, `{"entity":"myqueue"}`, string(ev.Data()))
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+// Encodings of CloudEvents sent to the sink.
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md#3-message-mapping
+const (
+	ceEncodingBinary     = "binary"
+	ceEncodingStructured = "structured"
+)
+
+// structuredClient is a cloudevents.Client which sends events in structured
+// content mode, i.e. with all attributes and data of each event encoded
+// together in the body of the request, instead of the binary content mode
+// used by default.
+type structuredClient struct {
+	cloudevents.Client
+}
+
+var _ cloudevents.Client = (*structuredClient)(nil)
+
+// Send implements cloudevents.Client.
+func (c *structuredClient) Send(ctx context.Context, event cloudevents.Event) protocol.Result {
+	return c.Client.Send(cloudevents.WithEncodingStructured(ctx), event)
+}
+
+// Request implements cloudevents.Client.
+func (c *structuredClient) Request(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, protocol.Result) {
+	return c.Client.Request(cloudevents.WithEncodingStructured(ctx), event)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestStructuredClient(t *testing.T) {
+	testCases := []struct {
+		name              string
+		structured        bool
+		expectContentType string
+		expectCEHeaders   bool
+	}{
+		{
+			name:              "Binary content mode",
+			structured:        false,
+			expectContentType: cloudevents.ApplicationJSON,
+			expectCEHeaders:   true,
+		},
+		{
+			name:              "Structured content mode",
+			structured:        true,
+			expectContentType: cloudevents.ApplicationCloudEventsJSON,
+			expectCEHeaders:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var contentType, ceID string
+
+			sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				ceID = r.Header.Get("Ce-Id")
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer sink.Close()
+
+			var ceClient cloudevents.Client
+			ceClient, err := cloudevents.NewClientHTTP(cloudevents.WithTarget(sink.URL))
+			require.NoError(t, err)
+
+			if tc.structured {
+				ceClient = &structuredClient{Client: ceClient}
+			}
+
+			event := newTestEvent("0")
+			require.NoError(t, event.SetData(cloudevents.ApplicationJSON, map[string]any{"test": nil}))
+
+			res := ceClient.Send(context.Background(), event)
+			require.True(t, cloudevents.IsACK(res), "Unexpected delivery failure: %v", res)
+
+			assert.Contains(t, contentType, tc.expectContentType)
+			if tc.expectCEHeaders {
+				assert.Equal(t, "0", ceID)
+			} else {
+				assert.Empty(t, ceID)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/Azure/azure-amqp-common-go/v3/uuid"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// conversionFailure is the data of the CloudEvents sent to the error sink,
+// which describe a message that couldn't be converted to CloudEvents. It is
+// serialized to JSON as follows:
+//
+//	{
+//	  "error": {
+//	    "reason": "MessageProcessingFailed",
+//	    "message": "processing Service Bus message with ID 1234: ..."
+//	  },
+//	  "body": "eyJvcmRlciI6...",
+//	  "systemProperties": {
+//	    "messageId": "1234",
+//	    "contentType": "application/json",
+//	    "deliveryCount": 1,
+//	    "enqueuedTime": "2023-01-01T00:00:00Z",
+//	    ...
+//	  },
+//	  "userProperties": {
+//	    "<name>": <value>,
+//	    ...
+//	  }
+//	}
+//
+// The body is the raw body of the message, encoded to base64 so that it is
+// preserved regardless of its format. System properties which aren't set
+// are omitted. Timestamps are formatted as RFC 3339 strings, and durations
+// as Go duration strings (e.g. "1h0m0s").
+type conversionFailure struct {
+	Error            conversionError        `json:"error"`
+	Body             []byte                 `json:"body"`
+	SystemProperties systemProperties       `json:"systemProperties"`
+	UserProperties   map[string]interface{} `json:"userProperties"`
+}
+
+// conversionError describes the failure to convert a message.
+type conversionError struct {
+	// Reason of the failure, as set by the adapter on messages it
+	// dead-letters (e.g. "MessageProcessingFailed").
+	Reason string `json:"reason"`
+	// Description of the failure.
+	Message string `json:"message"`
+}
+
+// systemProperties are the system properties of a message, as reported to the
+// error sink.
+type systemProperties struct {
+	MessageID                  string  `json:"messageId,omitempty"`
+	CorrelationID              *string `json:"correlationId,omitempty"`
+	SessionID                  *string `json:"sessionId,omitempty"`
+	To                         *string `json:"to,omitempty"`
+	ReplyTo                    *string `json:"replyTo,omitempty"`
+	ReplyToSessionID           *string `json:"replyToSessionId,omitempty"`
+	Subject                    *string `json:"subject,omitempty"`
+	ContentType                *string `json:"contentType,omitempty"`
+	PartitionKey               *string `json:"partitionKey,omitempty"`
+	ViaPartitionKey            *string `json:"viaPartitionKey,omitempty"`
+	DeliveryCount              uint32  `json:"deliveryCount"`
+	SequenceNumber             *int64  `json:"sequenceNumber,omitempty"`
+	EnqueuedTime               *string `json:"enqueuedTime,omitempty"`
+	ScheduledEnqueueTime       *string `json:"scheduledEnqueueTime,omitempty"`
+	ExpiresAt                  *string `json:"expiresAt,omitempty"`
+	TimeToLive                 *string `json:"timeToLive,omitempty"`
+	DeadLetterReason           *string `json:"deadLetterReason,omitempty"`
+	DeadLetterErrorDescription *string `json:"deadLetterErrorDescription,omitempty"`
+	DeadLetterSource           *string `json:"deadLetterSource,omitempty"`
+}
+
+// settleConversionFailure completes a message which couldn't be converted to
+// CloudEvents once it was forwarded to the error sink, so that it doesn't get
+// redelivered. Since its handling failed for good, the message is also
+// forwarded to the dead-letter sink, if one is configured. It returns whether
+// the message was settled, which isn't the case when the message wasn't
+// forwarded to the error sink, and the error which occurred while settling
+// it, if any.
+func (a *adapter) settleConversionFailure(ctx context.Context, fm *fullMessage, handleErr error) (bool, error) {
+	var procErr *processingError
+	if a.errorSink == "" || !errors.As(handleErr, &procErr) {
+		return false, nil
+	}
+
+	if err := a.forwardFailedMessage(ctx, a.errorSink, failurePayloadConversion, fm.serializable, handleErr); err != nil {
+		a.logger.Errorw("Failed to forward message which could not be converted to the error sink, "+
+			"settling it as usual", zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(err))
+		return false, nil
+	}
+
+	a.logger.Warnw("Completing message which could not be converted and was forwarded to the error sink",
+		zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+	a.forwardToDeadLetterSink(ctx, fm.serializable, handleErr)
+
+	if err := a.disposition().Complete(ctx, fm.rcvr, fm.received); err != nil {
+		return true, fmt.Errorf("error completing message: %w", err)
+	}
+	return true, nil
+}
+
+// makeConversionFailureEvent returns a CloudEvent which describes a message
+// that couldn't be converted to CloudEvents because of the given error.
+func makeConversionFailureEvent(msg *Message, srcAttr string, handleErr error) (*cloudevents.Event, error) {
+	event := cloudevents.NewEvent()
+	event.SetID(msg.ReceivedMessage.MessageID)
+	event.SetSource(srcAttr)
+	event.SetType(v1alpha1.AzureEventType(sources.AzureServiceServiceBus, v1alpha1.AzureServiceBusConversionErrorEventType))
+	event.SetTime(time.Now())
+
+	if msg.ReceivedMessage.MessageID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, fmt.Errorf("generating CloudEvent ID: %w", err)
+		}
+		event.SetID(id.String())
+	}
+
+	data := &conversionFailure{
+		Error: conversionError{
+			Reason:  failureReason(handleErr),
+			Message: handleErr.Error(),
+		},
+		Body:             msg.Body,
+		SystemProperties: makeSystemProperties(msg),
+		UserProperties:   make(map[string]interface{}, len(msg.ApplicationProperties)),
+	}
+
+	for k, v := range msg.ApplicationProperties {
+		data.UserProperties[k] = normalizeCompositeValue(reflect.ValueOf(v))
+	}
+
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return nil, fmt.Errorf("setting CloudEvent data: %w", err)
+	}
+
+	return &event, nil
+}
+
+// makeSystemProperties returns the system properties of the given message.
+func makeSystemProperties(msg *Message) systemProperties {
+	props := systemProperties{
+		MessageID:                  msg.ReceivedMessage.MessageID,
+		CorrelationID:              msg.CorrelationID,
+		SessionID:                  msg.SessionID,
+		To:                         msg.To,
+		ReplyTo:                    msg.ReplyTo,
+		ReplyToSessionID:           msg.ReplyToSessionID,
+		Subject:                    msg.Subject,
+		ContentType:                msg.ContentType,
+		PartitionKey:               msg.PartitionKey,
+		ViaPartitionKey:            msg.ViaPartitionKey,
+		DeliveryCount:              msg.DeliveryCount,
+		SequenceNumber:             msg.SequenceNumber,
+		DeadLetterReason:           msg.DeadLetterReason,
+		DeadLetterErrorDescription: msg.DeadLetterErrorDescription,
+		DeadLetterSource:           msg.DeadLetterSource,
+	}
+
+	formatTime := func(t *time.Time) *string {
+		if t == nil {
+			return nil
+		}
+		s := stringifyPropertyValue(*t)
+		return &s
+	}
+
+	props.EnqueuedTime = formatTime(msg.EnqueuedTime)
+	props.ScheduledEnqueueTime = formatTime(msg.ScheduledEnqueueTime)
+	props.ExpiresAt = formatTime(msg.ExpiresAt)
+
+	if msg.TimeToLive != nil {
+		ttl := msg.TimeToLive.String()
+		props.TimeToLive = &ttl
+	}
+
+	return props
+}
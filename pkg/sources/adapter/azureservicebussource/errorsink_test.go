@@ -0,0 +1,209 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestMakeConversionFailureEvent(t *testing.T) {
+	enqueuedTime := time.Unix(0, 0)
+
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			MessageID:     "someMessageID",
+			Body:          []byte("not JSON"),
+			ContentType:   to.Ptr(cloudevents.ApplicationJSON),
+			CorrelationID: to.Ptr("some-correlation-id"),
+			ReplyTo:       to.Ptr("some-queue"),
+			DeliveryCount: 2,
+			EnqueuedTime:  &enqueuedTime,
+			TimeToLive:    to.Ptr(time.Hour),
+			ApplicationProperties: map[string]interface{}{
+				"someString": "some value",
+				"someInt":    int64(42),
+				"someTime":   enqueuedTime,
+				"someList":   []interface{}{"a", int32(1)},
+			},
+		},
+		ViaPartitionKey: to.Ptr("some-via-partition-key"),
+	}
+
+	procErr := &processingError{err: errors.New("invalid message")}
+
+	event, err := makeConversionFailureEvent(msg, "/some/source", procErr)
+	require.NoError(t, err)
+	require.NoError(t, event.Validate())
+
+	assert.Equal(t, "com.microsoft.azure.servicebus.conversionerror", event.Type())
+	assert.Equal(t, "/some/source", event.Source())
+	assert.Equal(t, "someMessageID", event.ID())
+	assert.Equal(t, cloudevents.ApplicationJSON, event.DataContentType())
+
+	const expectData = `{
+		"error": {
+			"reason": "MessageProcessingFailed",
+			"message": "invalid message"
+		},
+		"body": "bm90IEpTT04=",
+		"systemProperties": {
+			"messageId": "someMessageID",
+			"correlationId": "some-correlation-id",
+			"replyTo": "some-queue",
+			"contentType": "application/json",
+			"viaPartitionKey": "some-via-partition-key",
+			"deliveryCount": 2,
+			"enqueuedTime": "1970-01-01T00:00:00Z",
+			"timeToLive": "1h0m0s"
+		},
+		"userProperties": {
+			"someString": "some value",
+			"someInt": 42,
+			"someTime": "1970-01-01T00:00:00Z",
+			"someList": ["a", 1]
+		}
+	}`
+	assert.JSONEq(t, expectData, string(event.Data()))
+
+	var data conversionFailure
+	require.NoError(t, json.Unmarshal(event.Data(), &data))
+	assert.Equal(t, msg.Body, data.Body, "The raw body should be preserved")
+}
+
+func TestSettleMessageErrorSink(t *testing.T) {
+	const errorSink = "http://errors.example.com"
+	const deadLetterSink = "http://deadletter.example.com"
+
+	procErr := &processingError{err: errors.New("invalid message")}
+	delivErr := &deliveryError{numEvents: 1, errs: errList{errs: []error{errors.New("sink unavailable")}}}
+
+	testCases := []struct {
+		name            string
+		errorSink       string
+		errorSinkResult error
+		handleErr       error
+		expectTargets   []string
+		expectCompleted []string
+		expectAbandoned []string
+	}{
+		{
+			name:            "Conversion failure forwarded to the error sink",
+			errorSink:       errorSink,
+			handleErr:       procErr,
+			expectTargets:   []string{errorSink, deadLetterSink},
+			expectCompleted: []string{"someMessageID"},
+		},
+		{
+			name:            "Conversion failure not forwarded to the error sink",
+			errorSink:       errorSink,
+			errorSinkResult: errors.New("error sink unavailable"),
+			handleErr:       procErr,
+			expectTargets:   []string{errorSink},
+			expectAbandoned: []string{"someMessageID"},
+		},
+		{
+			name:            "Delivery failure",
+			errorSink:       errorSink,
+			handleErr:       delivErr,
+			expectAbandoned: []string{"someMessageID"},
+		},
+		{
+			name:            "Error sink not set",
+			handleErr:       procErr,
+			expectAbandoned: []string{"someMessageID"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &targetFailingClient{
+				targetRecordingClient: &targetRecordingClient{TestCloudEventsClient: adaptertest.NewTestClient()},
+				target:                errorSink,
+				result:                tc.errorSinkResult,
+			}
+
+			a := &adapter{
+				logger:           logtesting.TestLogger(t),
+				ceSource:         "/some/source",
+				deadLetterSink:   deadLetterSink,
+				deadLetterClient: client,
+				errorSink:        tc.errorSink,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			rcvr := &fakeReceiver{}
+
+			rcvMsg := &azservicebus.ReceivedMessage{
+				MessageID: "someMessageID",
+				Body:      []byte("not JSON"),
+			}
+			msg, err := toMessage(rcvMsg)
+			require.NoError(t, err)
+
+			fm := &fullMessage{
+				rcvr:         rcvr,
+				received:     rcvMsg,
+				serializable: msg,
+			}
+
+			err = a.settleMessage(context.Background(), fm, tc.handleErr)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectTargets, client.targets)
+			assert.Equal(t, tc.expectCompleted, rcvr.completed)
+			assert.Equal(t, tc.expectAbandoned, rcvr.abandoned)
+		})
+	}
+}
+
+// targetFailingClient is a cloudevents.Client which fails to send events to a
+// given target.
+type targetFailingClient struct {
+	*targetRecordingClient
+	target string
+	result error
+}
+
+// Send implements cloudevents.Client.
+func (c *targetFailingClient) Send(ctx context.Context, e cloudevents.Event) protocol.Result {
+	if target := cecontext.TargetFrom(ctx); target != nil && target.String() == c.target && c.result != nil {
+		c.targets = append(c.targets, target.String())
+		return c.result
+	}
+	return c.targetRecordingClient.Send(ctx, e)
+}
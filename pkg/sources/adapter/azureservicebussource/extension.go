@@ -0,0 +1,102 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"strings"
+)
+
+// maxExtensionNameLength is the maximum length of CloudEvent attribute names
+// recommended by the CloudEvents specification.
+const maxExtensionNameLength = 20
+
+// extensionNameHashLength is the length of the hexadecimal hash which
+// suffixes extension attribute names that were truncated or disambiguated.
+const extensionNameHashLength = 8
+
+// extensionName normalizes the given string to a valid CloudEvent attribute
+// name, by lowercasing it and stripping all characters that are not ASCII
+// letters or digits. Names which exceed maxExtensionNameLength characters
+// once normalized are truncated, and suffixed with a hash of the given
+// string, so that long strings which share a prefix don't collide, e.g.
+// "Contoso-Shipping-Priority" becomes "contososhippb7b015ec".
+//
+// An empty string is returned if the given string contains no ASCII letter
+// or digit.
+func extensionName(s string) string {
+	name := normalizeExtensionName(s)
+	if len(name) <= maxExtensionNameLength {
+		return name
+	}
+	return hashedExtensionName(name, s)
+}
+
+// disambiguatedExtensionName returns an alternative to extensionName(s), for
+// cases where that name is already taken by another attribute. The
+// alternative is the normalized name, truncated as necessary, suffixed with
+// a hash of the given string, e.g. "My-Key" becomes "mykey3eb72651" if
+// "mykey" is taken. Because the hash only depends on the given string, the
+// alternative is stable regardless of the order in which names are claimed.
+//
+// An empty string is returned if the given string contains no ASCII letter
+// or digit.
+func disambiguatedExtensionName(s string) string {
+	name := normalizeExtensionName(s)
+	if name == "" {
+		return ""
+	}
+	return hashedExtensionName(name, s)
+}
+
+// isValidExtensionName returns whether the given name is a valid CloudEvent
+// attribute name. Names which exceed maxExtensionNameLength characters are
+// valid, since that length is only recommended by the CloudEvents
+// specification; only the names generated by extensionName are truncated.
+func isValidExtensionName(name string) bool {
+	return name != "" && normalizeExtensionName(name) == name
+}
+
+// normalizeExtensionName lowercases the given string and strips all
+// characters that are not ASCII letters or digits.
+func normalizeExtensionName(s string) string {
+	var name strings.Builder
+	name.Grow(len(s))
+
+	for _, c := range strings.ToLower(s) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			name.WriteRune(c)
+		}
+	}
+
+	return name.String()
+}
+
+// hashedExtensionName truncates the given normalized name so that it can be
+// suffixed with a hash of the original string without exceeding
+// maxExtensionNameLength characters.
+func hashedExtensionName(name, original string) string {
+	if maxLen := maxExtensionNameLength - extensionNameHashLength; len(name) > maxLen {
+		name = name[:maxLen]
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(original))
+
+	return name + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestExtensionName(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{
+			name:   "Already valid",
+			input:  "myprop",
+			expect: "myprop",
+		},
+		{
+			name:   "Camel case",
+			input:  "myProp",
+			expect: "myprop",
+		},
+		{
+			name:   "Dashes and underscores",
+			input:  "My-Routing_Key",
+			expect: "myroutingkey",
+		},
+		{
+			name:   "Non-ASCII characters",
+			input:  "prénom.utilisateur",
+			expect: "prnomutilisateur",
+		},
+		{
+			name:   "Exactly the maximum length",
+			input:  "abcdefghijklmnopqrst",
+			expect: "abcdefghijklmnopqrst",
+		},
+		{
+			name:   "Maximum length after normalization",
+			input:  "Abcdefghij-Klmnopqrst",
+			expect: "abcdefghijklmnopqrst",
+		},
+		{
+			name:   "Exceeds the maximum length",
+			input:  "Contoso-Shipping-Priority",
+			expect: "contososhippb7b015ec",
+		},
+		{
+			name:   "No valid character",
+			input:  "-_-",
+			expect: "",
+		},
+		{
+			name:   "Empty",
+			input:  "",
+			expect: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := extensionName(tc.input)
+			assert.Equal(t, tc.expect, name)
+			assert.LessOrEqual(t, len(name), maxExtensionNameLength)
+
+			if name != "" {
+				ev := cloudevents.NewEvent()
+				ev.SetID("0")
+				ev.SetSource("/")
+				ev.SetType("t")
+				ev.SetExtension(name, "v")
+				assert.NoError(t, ev.Validate())
+			}
+		})
+	}
+}
+
+func TestExtensionNameTruncation(t *testing.T) {
+	const prefix = "Contoso-Shipping-"
+
+	a := extensionName(prefix + "Priority")
+	b := extensionName(prefix + "Carrier")
+
+	assert.NotEqual(t, a, b, "Long names which share a prefix should not collide")
+	assert.Equal(t, a, extensionName(prefix+"Priority"), "Normalization should be deterministic")
+	assert.NotEqual(t, extensionName("contososhippingpriority"), a,
+		"Names which normalize identically but differ originally should get different hashes")
+}
+
+func TestDisambiguatedExtensionName(t *testing.T) {
+	assert.Equal(t, "mykey3eb72651", disambiguatedExtensionName("My-Key"))
+	assert.Equal(t, disambiguatedExtensionName("My-Key"), disambiguatedExtensionName("My-Key"),
+		"Disambiguation should be deterministic")
+	assert.NotEqual(t, disambiguatedExtensionName("My-Key"), disambiguatedExtensionName("my_key"),
+		"Strings which normalize identically should be disambiguated differently")
+	assert.NotEqual(t, extensionName("My-Key"), disambiguatedExtensionName("My-Key"))
+
+	long := disambiguatedExtensionName("Contoso-Shipping-Priority")
+	assert.Len(t, long, maxExtensionNameLength)
+	assert.True(t, isValidExtensionName(long))
+
+	assert.Empty(t, disambiguatedExtensionName("-_-"))
+}
+
+func TestIsValidExtensionName(t *testing.T) {
+	assert.True(t, isValidExtensionName("myprop"))
+	assert.True(t, isValidExtensionName("abcdefghijklmnopqrst"))
+	assert.True(t, isValidExtensionName("abcdefghijklmnopqrstu"), "Explicit names are not truncated")
+
+	assert.False(t, isValidExtensionName(""))
+	assert.False(t, isValidExtensionName("myProp"))
+	assert.False(t, isValidExtensionName("my-prop"))
+}
+
+func TestSetPropertiesExtensionsCollisions(t *testing.T) {
+	props := map[string]interface{}{
+		"my-key":                    "first",
+		"My_Key":                    "second",
+		"MyKey":                     "third",
+		"Source":                    "context attribute",
+		"existing":                  "already set",
+		"Contoso-Shipping-Priority": "high",
+		"Contoso-Shipping-Carrier":  "acme",
+	}
+
+	newEvent := func() *cloudevents.Event {
+		ev := cloudevents.NewEvent()
+		ev.SetID("0")
+		ev.SetSource("/")
+		ev.SetType("t")
+		ev.SetExtension("existing", "set by the adapter")
+		return &ev
+	}
+
+	ev := newEvent()
+	setPropertiesExtensions(ev, props, nil)
+
+	expectExts := map[string]interface{}{
+		"existing": "set by the adapter",
+
+		"mykey":                                "third", // "MyKey" sorts first
+		disambiguatedExtensionName("My_Key"):   "second",
+		disambiguatedExtensionName("my-key"):   "first",
+		disambiguatedExtensionName("Source"):   "context attribute",
+		disambiguatedExtensionName("existing"): "already set",
+
+		extensionName("Contoso-Shipping-Priority"): "high",
+		extensionName("Contoso-Shipping-Carrier"):  "acme",
+	}
+	assert.Equal(t, expectExts, ev.Extensions())
+	assert.NoError(t, ev.Validate())
+
+	for i := 0; i < 10; i++ {
+		ev := newEvent()
+		setPropertiesExtensions(ev, props, nil)
+		assert.Equal(t, expectExts, ev.Extensions(), "Collisions should be resolved deterministically")
+	}
+
+	t.Run("mapped property wins", func(t *testing.T) {
+		ev := newEvent()
+		setPropertiesExtensions(ev, props, map[string]string{"my-key": "mykey"})
+
+		exts := ev.Extensions()
+		assert.Equal(t, "first", exts["mykey"])
+		assert.Equal(t, "third", exts[disambiguatedExtensionName("MyKey")])
+		assert.Equal(t, "second", exts[disambiguatedExtensionName("My_Key")])
+	})
+
+	t.Run("mapped property collides with an existing attribute", func(t *testing.T) {
+		ev := newEvent()
+		setPropertiesExtensions(ev, map[string]interface{}{"prop": "value"}, map[string]string{"prop": "existing"})
+
+		assert.Equal(t, map[string]interface{}{"existing": "set by the adapter"}, ev.Extensions())
+	})
+}
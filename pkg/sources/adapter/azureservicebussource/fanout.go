@@ -0,0 +1,101 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+)
+
+// extraSink is a sink which receives a copy of each event, in addition to
+// the sink of the adapter.
+type extraSink struct {
+	url string
+	// whether failures to deliver events to this sink are ignored
+	bestEffort bool
+}
+
+// fanOutClient is a cloudevents.Client which delivers each event passed to
+// Send to the sink of the wrapped cloudevents.Client and to a number of extra
+// sinks, concurrently.
+//
+// Send only succeeds when the event was delivered to the sink of the wrapped
+// client and to all required extra sinks. Failures to deliver to best-effort
+// sinks are logged but don't affect the result. Because a failed Send is
+// retried as a whole, sinks which accepted the event may receive it again.
+//
+// Events sent to an explicit target, such as the dead-letter sink, are only
+// delivered to that target.
+type fanOutClient struct {
+	cloudevents.Client
+
+	logger *zap.SugaredLogger
+
+	sinks []extraSink
+}
+
+var _ cloudevents.Client = (*fanOutClient)(nil)
+
+// Send implements cloudevents.Client.
+func (c *fanOutClient) Send(ctx context.Context, event cloudevents.Event) protocol.Result {
+	if cecontext.TargetFrom(ctx) != nil {
+		return c.Client.Send(ctx, event)
+	}
+
+	results := make([]protocol.Result, len(c.sinks))
+
+	// Each send gets its own copy of the event, since clients may modify
+	// the attributes of the events they send.
+	var wg sync.WaitGroup
+	for i, s := range c.sinks {
+		wg.Add(1)
+		go func(i int, s extraSink, event cloudevents.Event) {
+			defer wg.Done()
+			results[i] = c.Client.Send(cloudevents.ContextWithTarget(ctx, s.url), event)
+		}(i, s, event.Clone())
+	}
+
+	result := c.Client.Send(ctx, event)
+	wg.Wait()
+
+	if !cloudevents.IsACK(result) {
+		return result
+	}
+
+	for i, s := range c.sinks {
+		if cloudevents.IsACK(results[i]) {
+			continue
+		}
+		if s.bestEffort {
+			c.logger.Warnw("Failed to send event to best-effort sink "+s.url,
+				zap.String("eventID", event.ID()), zap.Error(results[i]))
+			continue
+		}
+		if cloudevents.IsACK(result) {
+			result = fmt.Errorf("sending event to sink %s: %w", s.url, results[i])
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestFanOutClient(t *testing.T) {
+	const (
+		pipelineSink = ""
+		requiredSink = "http://required.example.com"
+		archiveSink  = "http://archive.example.com"
+	)
+
+	errUnavailable := errors.New("sink unavailable")
+
+	testCases := []struct {
+		name      string
+		failing   map[string]protocol.Result
+		expectACK bool
+	}{
+		{
+			name:      "All sinks accept the event",
+			expectACK: true,
+		},
+		{
+			name:    "Sink of the source fails",
+			failing: map[string]protocol.Result{pipelineSink: cehttp.NewResult(http.StatusServiceUnavailable, "unavailable")},
+		},
+		{
+			name:    "Required sink fails",
+			failing: map[string]protocol.Result{requiredSink: errUnavailable},
+		},
+		{
+			name:      "Best-effort sink fails",
+			failing:   map[string]protocol.Result{archiveSink: errUnavailable},
+			expectACK: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cli := &sinkResultClient{results: tc.failing}
+
+			c := &fanOutClient{
+				Client: cli,
+				logger: logtesting.TestLogger(t),
+				sinks: []extraSink{
+					{url: requiredSink},
+					{url: archiveSink, bestEffort: true},
+				},
+			}
+
+			res := c.Send(context.Background(), newTestEvent("1"))
+			assert.Equal(t, tc.expectACK, cloudevents.IsACK(res), "Unexpected result: %v", res)
+
+			assert.Equal(t, []string{pipelineSink, archiveSink, requiredSink}, cli.sentTo(),
+				"Expected the event to be sent to all sinks")
+		})
+	}
+}
+
+func TestFanOutClientExplicitTarget(t *testing.T) {
+	const deadLetterSink = "http://dead-letter.example.com"
+
+	cli := &sinkResultClient{}
+
+	c := &fanOutClient{
+		Client: cli,
+		logger: logtesting.TestLogger(t),
+		sinks:  []extraSink{{url: "http://archive.example.com"}},
+	}
+
+	res := c.Send(cloudevents.ContextWithTarget(context.Background(), deadLetterSink), newTestEvent("1"))
+	assert.True(t, cloudevents.IsACK(res), "Unexpected result: %v", res)
+
+	assert.Equal(t, []string{deadLetterSink}, cli.sentTo(), "Expected the event to be sent to its target only")
+}
+
+// sinkResultClient is a cloudevents.Client which returns the result
+// associated with the target of each sent event, and records these targets.
+// Events without a target are associated with an empty target.
+type sinkResultClient struct {
+	cloudevents.Client
+
+	results map[string]protocol.Result
+
+	mu      sync.Mutex
+	targets []string
+}
+
+// Send implements cloudevents.Client.
+func (c *sinkResultClient) Send(ctx context.Context, _ cloudevents.Event) protocol.Result {
+	var target string
+	if u := cecontext.TargetFrom(ctx); u != nil {
+		target = u.String()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = append(c.targets, target)
+
+	if res, ok := c.results[target]; ok {
+		return res
+	}
+	return protocol.ResultACK
+}
+
+// sentTo returns the sorted targets of the events sent so far.
+func (c *sinkResultClient) sentTo() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	targets := append([]string(nil), c.targets...)
+	sort.Strings(targets)
+	return targets
+}
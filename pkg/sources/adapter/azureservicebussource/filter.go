@@ -0,0 +1,97 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/itchyny/gojq"
+)
+
+// messageFilter selects Service Bus messages based on a jq expression
+// evaluated against their JSON body.
+type messageFilter struct {
+	code *gojq.Code
+}
+
+// newMessageFilter returns a messageFilter for the given jq expression.
+func newMessageFilter(expr string) (*messageFilter, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing filter expression: %w", err)
+	}
+
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("compiling filter expression: %w", err)
+	}
+
+	return &messageFilter{code: code}, nil
+}
+
+// matches returns whether the first value produced by the filter expression
+// for the given message body is neither false nor null.
+//
+// Bodies which aren't JSON always match, since the expression can not be
+// evaluated against them.
+func (f *messageFilter) matches(body []byte) bool {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return true
+	}
+
+	v, ok := f.code.Run(data).Next()
+	if !ok {
+		return false
+	}
+
+	switch v := v.(type) {
+	case error:
+		return false
+	case bool:
+		return v
+	default:
+		return v != nil
+	}
+}
+
+// correlationFilter selects Service Bus messages based on a regular
+// expression matched against their correlation ID.
+type correlationFilter struct {
+	re *regexp.Regexp
+}
+
+// newCorrelationFilter returns a correlationFilter for the given regular
+// expression.
+func newCorrelationFilter(expr string) (*correlationFilter, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("compiling correlation filter: %w", err)
+	}
+	return &correlationFilter{re: re}, nil
+}
+
+// matches returns whether the correlation ID of the given message matches the
+// regular expression. Messages without a correlation ID never match.
+func (f *correlationFilter) matches(msg *Message) bool {
+	if msg.CorrelationID == nil {
+		return false
+	}
+	return f.re.MatchString(*msg.CorrelationID)
+}
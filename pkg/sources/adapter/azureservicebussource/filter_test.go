@@ -0,0 +1,214 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestMessageFilter(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expr        string
+		body        []byte
+		expectMatch bool
+	}{
+		{
+			name:        "Body matches",
+			expr:        `.kind == "order"`,
+			body:        []byte(`{"kind": "order"}`),
+			expectMatch: true,
+		},
+		{
+			name: "Body does not match",
+			expr: `.kind == "order"`,
+			body: []byte(`{"kind": "invoice"}`),
+		},
+		{
+			name: "Expression returns null",
+			expr: `.missing`,
+			body: []byte(`{"kind": "order"}`),
+		},
+		{
+			name: "Expression fails",
+			expr: `.kind.nested`,
+			body: []byte(`{"kind": "order"}`),
+		},
+		{
+			name:        "Body is not JSON",
+			expr:        `.kind == "order"`,
+			body:        []byte("not JSON"),
+			expectMatch: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := newMessageFilter(tc.expr)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectMatch, f.matches(tc.body))
+		})
+	}
+}
+
+func TestNewMessageFilterInvalid(t *testing.T) {
+	_, err := newMessageFilter(`.kind ==`)
+	assert.Error(t, err)
+}
+
+func TestHandleMessageFilter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       []byte
+		expectSent int
+	}{
+		{
+			name:       "Message matches the filter",
+			body:       []byte(`{"kind": "order"}`),
+			expectSent: 1,
+		},
+		{
+			name:       "Message does not match the filter",
+			body:       []byte(`{"kind": "invoice"}`),
+			expectSent: 0,
+		},
+		{
+			name:       "Message body is not JSON",
+			body:       []byte("not JSON"),
+			expectSent: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := newMessageFilter(`.kind == "order"`)
+			require.NoError(t, err)
+
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				logger:   logtesting.TestLogger(t),
+				ceClient: ceClient,
+				msgPrcsr: &defaultMessageProcessor{},
+				filter:   filter,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID: "1",
+					Body:      tc.body,
+				},
+			}
+
+			err = a.handleMessage(context.Background(), msg, nil)
+			assert.NoError(t, err, "Filtered out messages should be completed")
+
+			assert.Len(t, ceClient.Sent(), tc.expectSent)
+		})
+	}
+}
+
+func TestCorrelationFilter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		correlationID *string
+		expectMatch   bool
+	}{
+		{
+			name:          "Correlation ID matches",
+			correlationID: to.Ptr("tenant-a/order-1"),
+			expectMatch:   true,
+		},
+		{
+			name:          "Correlation ID does not match",
+			correlationID: to.Ptr("tenant-b/order-1"),
+		},
+		{
+			name: "No correlation ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := newCorrelationFilter(`^tenant-a/`)
+			require.NoError(t, err)
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					CorrelationID: tc.correlationID,
+				},
+			}
+
+			assert.Equal(t, tc.expectMatch, f.matches(msg))
+		})
+	}
+}
+
+func TestNewCorrelationFilterInvalid(t *testing.T) {
+	_, err := newCorrelationFilter(`tenant-(a`)
+	assert.Error(t, err)
+}
+
+func TestHandleMessageCorrelationFilter(t *testing.T) {
+	f, err := newCorrelationFilter(`^tenant-a/`)
+	require.NoError(t, err)
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:     logtesting.TestLogger(t),
+		ceClient:   ceClient,
+		msgPrcsr:   &defaultMessageProcessor{},
+		corrFilter: f,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	for _, corrID := range []string{"tenant-a/1", "tenant-b/2", "tenant-a/3"} {
+		msg := &Message{
+			ReceivedMessage: &azservicebus.ReceivedMessage{
+				MessageID:     corrID,
+				CorrelationID: to.Ptr(corrID),
+				Body:          []byte(`{"test": null}`),
+			},
+		}
+
+		err := a.handleMessage(context.Background(), msg, nil)
+		assert.NoError(t, err, "Filtered out messages should be completed")
+	}
+
+	sent := ceClient.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "tenant-a/1", sent[0].ID())
+	assert.Equal(t, "tenant-a/3", sent[1].ID())
+}
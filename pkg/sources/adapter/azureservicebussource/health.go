@@ -0,0 +1,145 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/triggermesh/triggermesh/pkg/sources/adapter/common"
+)
+
+const (
+	// URL path of the readiness endpoint.
+	healthEndpointPath = "/health"
+
+	// Maximum duration of the shutdown of the health server.
+	healthServerShutdownTimeout = 5 * time.Second
+
+	// Maximum duration for reading the headers of requests to the health
+	// server.
+	healthServerReadHeaderTimeout = 5 * time.Second
+)
+
+// startHealthServer starts serving a readiness endpoint on the given port,
+// and returns a function which stops the server. The endpoint responds with
+// 200 OK when isReady returns true, and with 503 Service Unavailable
+// otherwise.
+//
+// When status is not nil, the debug status endpoint is served as well. When
+// pause is not nil, so are the endpoints which pause and resume the
+// consumption of messages.
+func startHealthServer(logger *zap.SugaredLogger, port uint16, isReady func() bool,
+	status *statusTracker, pause *pauseControl) (stop func(), err error) {
+
+	ln, err := net.Listen("tcp", fmt.Sprint(":", port))
+	if err != nil {
+		return nil, fmt.Errorf("listening on health port: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(healthEndpointPath, healthHandler(isReady))
+	if status != nil {
+		mux.Handle(debugStatusEndpointPath, status)
+	}
+	if pause != nil {
+		mux.Handle(pauseEndpointPath, pause.handler(pause.pause))
+		mux.Handle(resumeEndpointPath, pause.handler(pause.resume))
+	}
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: healthServerReadHeaderTimeout,
+	}
+
+	go func() {
+		if err := srv.Serve(ln); err != http.ErrServerClosed {
+			logger.Errorw("Health server stopped unexpectedly", zap.Error(err))
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), healthServerShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warnw("Failed to shut down health server", zap.Error(err))
+		}
+	}, nil
+}
+
+// healthHandler returns a http.Handler which reports the readiness returned
+// by isReady.
+func healthHandler(isReady func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if isReady() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+}
+
+// probeReadiness marks the adapter as ready once the Service Bus entity was
+// successfully reached. Failed attempts are retried with a backoff until ctx
+// is canceled.
+//
+// It doesn't apply to session-enabled entities, the readiness of which is
+// determined by the acceptance of sessions.
+func (a *adapter) probeReadiness(ctx context.Context) {
+	var backoff *common.Backoff
+
+	for {
+		err := a.validate(ctx)
+		if err == nil {
+			a.setReady(true)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if backoff == nil {
+			backoff = common.NewBackoff(a.receiveRetryBaseBackoff, a.receiveRetryMaxBackoff)
+		}
+		wait := backoff.Duration()
+
+		a.logger.Warnw("Unable to reach the Service Bus entity, retrying in "+wait.String(), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// isReady returns whether the adapter is ready to receive messages. The
+// adapter is ready once the Service Bus entity was successfully reached,
+// until an error occurs while receiving messages.
+func (a *adapter) isReady() bool {
+	return a.ready.Load()
+}
+
+// setReady sets the readiness of the adapter.
+func (a *adapter) setReady(ready bool) {
+	a.ready.Store(ready)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestHealthServer(t *testing.T) {
+	testCases := []struct {
+		name         string
+		peekFailures int32
+		expectStatus int
+	}{
+		{
+			name:         "Entity is reachable",
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "Entity is transiently unreachable",
+			peekFailures: 3,
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "Entity is unreachable",
+			peekFailures: -1,
+			expectStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &flakyPeeker{}
+			rcvr.failures.Store(tc.peekFailures)
+
+			a := &adapter{
+				logger:  logtesting.TestLogger(t),
+				msgRcvr: rcvr,
+
+				receiveRetryBaseBackoff: time.Millisecond,
+				receiveRetryMaxBackoff:  time.Millisecond,
+			}
+
+			port := freePort(t)
+
+			stop, err := startHealthServer(a.logger, port, a.isReady, nil, nil)
+			require.NoError(t, err)
+			defer stop()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				a.probeReadiness(ctx)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			url := fmt.Sprintf("http://localhost:%d%s", port, healthEndpointPath)
+
+			getStatus := func() int {
+				resp, err := http.Get(url)
+				if err != nil {
+					return 0
+				}
+				defer resp.Body.Close()
+				return resp.StatusCode
+			}
+
+			assert.Eventually(t, func() bool { return getStatus() == tc.expectStatus },
+				time.Second, 10*time.Millisecond)
+
+			a.setReady(false)
+			assert.Equal(t, http.StatusServiceUnavailable, getStatus())
+		})
+	}
+}
+
+func TestMultiAdapterReadiness(t *testing.T) {
+	a1 := &adapter{}
+	a2 := &adapter{}
+
+	m := &multiAdapter{adapters: []*adapter{a1, a2}}
+	assert.False(t, m.isReady())
+
+	a1.setReady(true)
+	assert.False(t, m.isReady(), "Not all entities are ready")
+
+	a2.setReady(true)
+	assert.True(t, m.isReady())
+}
+
+// flakyPeeker is a messageReceiver which fails to peek at messages the given
+// number of times before succeeding, or forever when that number is negative.
+type flakyPeeker struct {
+	fakeReceiver
+	failures atomic.Int32
+}
+
+var _ messagePeeker = (*flakyPeeker)(nil)
+
+// PeekMessages implements messagePeeker.
+func (r *flakyPeeker) PeekMessages(context.Context, int, *azservicebus.PeekMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	if f := r.failures.Load(); f < 0 || f > 0 && r.failures.CompareAndSwap(f, f-1) {
+		return nil, errors.New("unauthorized access")
+	}
+	return nil, nil
+}
+
+// freePort returns a TCP port which is available on the local host.
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
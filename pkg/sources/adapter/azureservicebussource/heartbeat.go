@@ -0,0 +1,120 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// heartbeat tracks the activity of a Service Bus entity, in order to signal
+// periods during which no message was received from that entity.
+type heartbeat struct {
+	interval   time.Duration
+	entityPath string
+
+	// receives a value every time a message is received
+	activity chan struct{}
+}
+
+// newHeartbeat returns a heartbeat which signals each period of the given
+// duration during which no message was received from the given entity.
+func newHeartbeat(interval time.Duration, entityPath string) *heartbeat {
+	return &heartbeat{
+		interval:   interval,
+		entityPath: entityPath,
+		activity:   make(chan struct{}, 1),
+	}
+}
+
+// touch records that a message was received. It never blocks.
+func (h *heartbeat) touch() {
+	select {
+	case h.activity <- struct{}{}:
+	default:
+	}
+}
+
+// emitHeartbeats sends a CloudEvent to the sink every time no message was
+// received from the Service Bus entity for the duration of the heartbeat
+// interval, until ctx is canceled. Receiving a message restarts the interval.
+func (a *adapter) emitHeartbeats(ctx context.Context) {
+	t := time.NewTimer(a.heartbeat.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-a.heartbeat.activity:
+			if !t.Stop() {
+				<-t.C
+			}
+			t.Reset(a.heartbeat.interval)
+			continue
+
+		case <-t.C:
+		}
+
+		a.sendHeartbeat(ctx)
+		t.Reset(a.heartbeat.interval)
+	}
+}
+
+// sendHeartbeat sends a heartbeat CloudEvent to the sink.
+func (a *adapter) sendHeartbeat(ctx context.Context) {
+	ev, err := newHeartbeatEvent(a.ceSource, a.heartbeat.entityPath, a.heartbeat.interval)
+	if err != nil {
+		a.logger.Errorw("Unable to create heartbeat event", zap.Error(err))
+		return
+	}
+	if a.srcIdentity != "" {
+		ev.SetExtension(extSourceIdentity, a.srcIdentity)
+	}
+
+	if err := a.sendCloudEventWithRetry(ctx, ev); err != nil {
+		if ctx.Err() == nil {
+			a.logger.Errorw("Unable to send heartbeat event", zap.Error(err))
+		}
+		return
+	}
+	a.logger.Debug("Sent heartbeat event")
+}
+
+// heartbeatEventData is the data of the CloudEvent which signals that no
+// message was received from a Service Bus entity for some time.
+type heartbeatEventData struct {
+	Entity       string `json:"entity"`
+	IdleInterval string `json:"idleInterval"`
+}
+
+// newHeartbeatEvent returns a CloudEvent which signals that no message was
+// received from the given Service Bus entity for some time.
+func newHeartbeatEvent(ceSource, entityPath string, interval time.Duration) (*cloudevents.Event, error) {
+	data := &heartbeatEventData{
+		Entity:       entityPath,
+		IdleInterval: interval.String(),
+	}
+	return newControlEvent(ceSource, entityPath, v1alpha1.AzureServiceBusHeartbeatEventType, data)
+}
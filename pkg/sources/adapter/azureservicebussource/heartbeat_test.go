@@ -0,0 +1,74 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestEmitHeartbeats(t *testing.T) {
+	const ceSource = "/some/source"
+	const interval = 200 * time.Millisecond
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:    logtesting.TestLogger(t),
+		ceClient:  ceClient,
+		ceSource:  ceSource,
+		heartbeat: newHeartbeat(interval, "myqueue"),
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.emitHeartbeats(ctx)
+		close(done)
+	}()
+
+	// Steady traffic keeps restarting the interval.
+	for end := time.Now().Add(2 * interval); time.Now().Before(end); {
+		a.heartbeat.touch()
+		time.Sleep(interval / 10)
+	}
+	assert.Empty(t, ceClient.Sent(), "Expected no heartbeat while messages are received")
+
+	require.Eventually(t, func() bool { return len(ceClient.Sent()) == 2 },
+		5*time.Second, 10*time.Millisecond, "Expected a heartbeat after each idle interval")
+
+	cancel()
+	<-done
+
+	ev := ceClient.Sent()[0]
+	assert.Equal(t, "com.microsoft.azure.servicebus.heartbeat", ev.Type())
+	assert.Equal(t, ceSource, ev.Source())
+	assert.Equal(t, "myqueue", ev.Subject())
+	assert.JSONEq(t, `{"entity":"myqueue","idleInterval":"200ms"}`, string(ev.Data()))
+}
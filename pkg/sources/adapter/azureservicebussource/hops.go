@@ -0,0 +1,101 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Service Bus doesn't record the entities a message was auto-forwarded
+// through. Topologies which need to be protected against forwarding loops
+// record them in the "Via" application property of messages, either as an
+// AMQP list of entity names or as a comma-separated string.
+const propertyVia = "Via"
+
+// Actions taken on messages which exceed the hop limit.
+const (
+	hopLimitActionFlag = "flag"
+	hopLimitActionDrop = "drop"
+)
+
+// hopLimit detects messages which traversed a given Service Bus entity more
+// times than allowed.
+type hopLimit struct {
+	// name of the queue or topic the adapter consumes from
+	entity string
+	// maximum number of times a message may traverse the entity
+	max int
+	// action taken on messages which exceed the limit
+	action string
+}
+
+// newHopLimit returns a hopLimit for the given entity.
+func newHopLimit(entity string, max int, action string) (*hopLimit, error) {
+	if max < 1 {
+		return nil, fmt.Errorf("the hop limit must be greater than 0, got %d", max)
+	}
+	if action != hopLimitActionFlag && action != hopLimitActionDrop {
+		return nil, fmt.Errorf("unsupported hop limit action %q", action)
+	}
+
+	return &hopLimit{
+		entity: entity,
+		max:    max,
+		action: action,
+	}, nil
+}
+
+// exceeded returns whether the given forwarding trail traversed the entity
+// more times than allowed. Entity names are case-insensitive.
+func (h *hopLimit) exceeded(via []string) bool {
+	var n int
+	for _, e := range via {
+		if strings.EqualFold(e, h.entity) {
+			n++
+		}
+	}
+	return n > h.max
+}
+
+// messageVia returns the names of the entities recorded in the "Via"
+// application property of the given message, in the order they were
+// traversed.
+func messageVia(msg *Message) []string {
+	var entries []string
+
+	switch v := msg.ApplicationProperties[propertyVia].(type) {
+	case string:
+		entries = strings.Split(v, ",")
+	case []string:
+		entries = v
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				entries = append(entries, s)
+			}
+		}
+	}
+
+	var via []string
+	for _, e := range entries {
+		if e = strings.Trim(strings.TrimSpace(e), "/"); e != "" {
+			via = append(via, e)
+		}
+	}
+	return via
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestMessageVia(t *testing.T) {
+	testCases := []struct {
+		name   string
+		props  map[string]any
+		expect []string
+	}{
+		{
+			name:   "No application properties",
+			expect: nil,
+		},
+		{
+			name:   "Comma-separated string",
+			props:  map[string]any{propertyVia: " q1, topic1/ ,, q1"},
+			expect: []string{"q1", "topic1", "q1"},
+		},
+		{
+			name:   "AMQP list",
+			props:  map[string]any{propertyVia: []any{"q1", int64(42), "q2"}},
+			expect: []string{"q1", "q2"},
+		},
+		{
+			name:   "Unsupported type",
+			props:  map[string]any{propertyVia: int64(3)},
+			expect: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					ApplicationProperties: tc.props,
+				},
+			}
+
+			assert.Equal(t, tc.expect, messageVia(msg))
+		})
+	}
+}
+
+func TestNewHopLimit(t *testing.T) {
+	_, err := newHopLimit("q1", 0, hopLimitActionFlag)
+	assert.Error(t, err, "Expected a limit lower than 1 to be rejected")
+
+	_, err = newHopLimit("q1", 1, "reject")
+	assert.Error(t, err, "Expected an unsupported action to be rejected")
+
+	h, err := newHopLimit("q1", 2, hopLimitActionDrop)
+	assert.NoError(t, err)
+
+	assert.False(t, h.exceeded([]string{"q1", "q2", "q1"}))
+	assert.True(t, h.exceeded([]string{"q1", "Q1", "q1"}), "Entity names should be case-insensitive")
+}
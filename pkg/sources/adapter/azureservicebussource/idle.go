@@ -0,0 +1,111 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Maximum duration of the probe of a receiver which didn't receive any message
+// within the idle timeout, and of the closing of a stalled receiver.
+const keepaliveTimeout = 30 * time.Second
+
+// errReceiverStalled is returned when no message was received within the idle
+// timeout, and the connection of the receiver doesn't respond.
+var errReceiverStalled = errors.New("no message was received within the idle timeout and the keepalive probe failed")
+
+// receiveMessages receives up to count messages using the given receiver.
+//
+// When an idle timeout is set and no message is received within this timeout,
+// the connection of the receiver is probed by peeking a message. An AMQP
+// connection which half-died without erroring doesn't respond to the probe, in
+// which case errReceiverStalled is returned. Otherwise, the entity is merely
+// empty, and an empty list of messages is returned.
+func (a *adapter) receiveMessages(ctx context.Context, rcvr messageReceiver,
+	count int) ([]*azservicebus.ReceivedMessage, error) {
+
+	if a.idleTimeout == 0 {
+		return rcvr.ReceiveMessages(ctx, count, nil)
+	}
+
+	idleCtx, cancel := context.WithTimeout(ctx, a.idleTimeout)
+	messages, err := rcvr.ReceiveMessages(idleCtx, count, nil)
+	cancel()
+
+	if ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+		return messages, err
+	}
+
+	peeker, ok := rcvr.(messagePeeker)
+	if !ok {
+		return nil, nil
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, keepaliveTimeout)
+	defer cancel()
+
+	if _, err := peeker.PeekMessages(probeCtx, 1, nil); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", errReceiverStalled, err)
+	}
+
+	return nil, nil
+}
+
+// clientCloser is a Service Bus client which can be closed.
+// It is implemented by azservicebus.Client.
+type clientCloser interface {
+	Close(context.Context) error
+}
+
+var _ clientCloser = (*azservicebus.Client)(nil)
+
+// replaceReceiver returns a new receiver, which uses a new client and thereby a
+// new connection to Service Bus, in place of the given stalled receiver, along
+// with that client. The stalled receiver is closed in the background, followed
+// by its client if it was itself a replacement (stalledClient is non-nil).
+func (a *adapter) replaceReceiver(ctx context.Context, stalled messageReceiver,
+	stalledClient clientCloser) (messageReceiver, clientCloser, error) {
+
+	rcvr, client, err := a.newReceiver()
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating receiver: %w", err)
+	}
+
+	c, ok := stalled.(clientCloser)
+	if ok || stalledClient != nil {
+		go func() {
+			closeCtx, cancel := context.WithTimeout(detach(ctx), keepaliveTimeout)
+			defer cancel()
+			if ok {
+				_ = c.Close(closeCtx)
+			}
+			if stalledClient != nil {
+				_ = stalledClient.Close(closeCtx)
+			}
+		}()
+	}
+
+	return rcvr, client, nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestReceiveMessagesIdleTimeout(t *testing.T) {
+	errProbe := errors.New("connection reset")
+
+	testCases := []struct {
+		name        string
+		idleTimeout time.Duration
+		batch       []*azservicebus.ReceivedMessage
+		peekErr     error
+		expectMsgs  int
+		expectErr   error
+	}{
+		{
+			name:        "Messages are received",
+			idleTimeout: 10 * time.Millisecond,
+			batch:       []*azservicebus.ReceivedMessage{{MessageID: "m1"}},
+			expectMsgs:  1,
+		},
+		{
+			name:        "Idle receiver with a healthy connection",
+			idleTimeout: 10 * time.Millisecond,
+		},
+		{
+			name:        "Idle receiver with a stalled connection",
+			idleTimeout: 10 * time.Millisecond,
+			peekErr:     errProbe,
+			expectErr:   errReceiverStalled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &probedReceiver{
+				fakeReceiver: fakeReceiver{batch: tc.batch},
+				peekErr:      tc.peekErr,
+			}
+
+			a := &adapter{
+				prefetchCount: 1,
+				idleTimeout:   tc.idleTimeout,
+			}
+
+			msgs, err := a.receiveMessages(context.Background(), rcvr, a.prefetchCount)
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr)
+				assert.ErrorContains(t, err, errProbe.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, msgs, tc.expectMsgs)
+		})
+	}
+}
+
+func TestProduceReplacesStalledReceiver(t *testing.T) {
+	stalled := &probedReceiver{peekErr: errors.New("connection reset")}
+
+	// The first replacement stalls as well, and is replaced in turn along
+	// with its client.
+	stalledReplacement := &probedReceiver{peekErr: errors.New("connection reset")}
+	stalledReplacementClient := &fakeClient{}
+	replacement := &fakeReceiver{
+		batch: []*azservicebus.ReceivedMessage{{MessageID: "m1"}},
+	}
+
+	replacements := []messageReceiver{stalledReplacement, replacement}
+	clients := []*fakeClient{stalledReplacementClient, {}}
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		prefetchCount: 1,
+		idleTimeout:   10 * time.Millisecond,
+		newReceiver: func() (messageReceiver, clientCloser, error) {
+			r, c := replacements[0], clients[0]
+			replacements, clients = replacements[1:], clients[1:]
+			return r, c, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgChan := make(chan *fullMessage)
+	errChan := make(chan error, 1)
+	go a.produce(ctx, stalled, msgChan, errChan)
+
+	select {
+	case fm := <-msgChan:
+		assert.Equal(t, "m1", fm.received.MessageID)
+		assert.Same(t, replacement, fm.rcvr, "Messages should be settled using the new receiver")
+	case err := <-errChan:
+		require.FailNow(t, "Unexpected error", err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Timed out waiting for a message from the new receiver")
+	}
+
+	assert.Eventually(t, func() bool { return stalled.closed.Load() },
+		time.Second, 10*time.Millisecond, "The stalled receiver should be closed")
+	assert.Eventually(t, func() bool { return stalledReplacement.closed.Load() && stalledReplacementClient.closed.Load() },
+		time.Second, 10*time.Millisecond, "The stalled replacement receiver should be closed along with its client")
+}
+
+// probedReceiver is a fakeReceiver which can be probed by peeking messages,
+// and closed.
+type probedReceiver struct {
+	fakeReceiver
+	peekErr error
+	closed  atomic.Bool
+}
+
+var _ messagePeeker = (*probedReceiver)(nil)
+
+// PeekMessages implements messagePeeker.
+func (r *probedReceiver) PeekMessages(context.Context, int, *azservicebus.PeekMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	return nil, r.peekErr
+}
+
+// Close closes the receiver.
+func (r *probedReceiver) Close(context.Context) error {
+	r.closed.Store(true)
+	return nil
+}
+
+// fakeClient is a clientCloser which records whether it was closed.
+type fakeClient struct {
+	closed atomic.Bool
+}
+
+var _ clientCloser = (*fakeClient)(nil)
+
+// Close implements clientCloser.
+func (c *fakeClient) Close(context.Context) error {
+	c.closed.Store(true)
+	return nil
+}
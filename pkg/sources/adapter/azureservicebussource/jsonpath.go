@@ -0,0 +1,127 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a JSONPath expression composed exclusively of member and
+// array index accessors, e.g. "$.order.id", "$.items[0].sku" or
+// "$['order']['id']". It selects at most one value.
+type jsonPath []jsonPathSegment
+
+// jsonPathSegment is a single accessor of a jsonPath.
+type jsonPathSegment struct {
+	// name of the selected member, for member accessors
+	member string
+	// index of the selected element, for array index accessors
+	index int
+
+	isIndex bool
+}
+
+// parseJSONPath parses the given JSONPath expression.
+func parseJSONPath(expr string) (jsonPath, error) {
+	rest := strings.TrimPrefix(expr, "$")
+	if rest == expr {
+		return nil, errors.New(`a JSONPath expression must start with "$"`)
+	}
+
+	var path jsonPath
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty member name in JSONPath expression %q", expr)
+			}
+			path = append(path, jsonPathSegment{member: rest[:end]})
+			rest = rest[end:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated bracket in JSONPath expression %q", expr)
+			}
+			sel := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0] {
+				path = append(path, jsonPathSegment{member: sel[1 : len(sel)-1]})
+				continue
+			}
+
+			idx, err := strconv.Atoi(sel)
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid array index %q in JSONPath expression %q", sel, expr)
+			}
+			path = append(path, jsonPathSegment{index: idx, isIndex: true})
+
+		default:
+			return nil, fmt.Errorf("unexpected character %q in JSONPath expression %q", rest[0], expr)
+		}
+	}
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("the JSONPath expression %q doesn't select any member", expr)
+	}
+
+	return path, nil
+}
+
+// lookup returns the value selected by the path in the given JSON document,
+// and whether that value exists and isn't null. Numbers are returned as
+// json.Number, so that their original representation is preserved.
+func (p jsonPath) lookup(data []byte) (interface{}, bool) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, false
+	}
+
+	for _, seg := range p {
+		switch tv := v.(type) {
+		case map[string]interface{}:
+			if seg.isIndex {
+				return nil, false
+			}
+			v = tv[seg.member]
+		case []interface{}:
+			if !seg.isIndex || seg.index >= len(tv) {
+				return nil, false
+			}
+			v = tv[seg.index]
+		default:
+			return nil, false
+		}
+	}
+
+	return v, v != nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	testCases := []struct {
+		expr      string
+		expect    jsonPath
+		expectErr bool
+	}{
+		{
+			expr:   "$.order.id",
+			expect: jsonPath{{member: "order"}, {member: "id"}},
+		},
+		{
+			expr:   "$.items[1].sku",
+			expect: jsonPath{{member: "items"}, {index: 1, isIndex: true}, {member: "sku"}},
+		},
+		{
+			expr:   `$['order']["customer.id"]`,
+			expect: jsonPath{{member: "order"}, {member: "customer.id"}},
+		},
+		{expr: "order.id", expectErr: true},
+		{expr: "$", expectErr: true},
+		{expr: "$..id", expectErr: true},
+		{expr: "$.items[-1]", expectErr: true},
+		{expr: "$.items[*]", expectErr: true},
+		{expr: "$.items[0", expectErr: true},
+		{expr: "$order", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			path, err := parseJSONPath(tc.expr)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, path)
+		})
+	}
+}
+
+func TestJSONPathLookup(t *testing.T) {
+	const body = `{"order": {"id": "o-42", "total": 12345678901, "lines": [{"sku": "a"}, {"sku": "b"}], "note": null}}`
+
+	testCases := []struct {
+		expr        string
+		expect      interface{}
+		expectFound bool
+	}{
+		{expr: "$.order.id", expect: "o-42", expectFound: true},
+		{expr: "$.order.total", expect: json.Number("12345678901"), expectFound: true},
+		{expr: "$.order.lines[1].sku", expect: "b", expectFound: true},
+		{expr: "$.order.lines[2].sku"},
+		{expr: "$.order.customer"},
+		{expr: "$.order.note"},
+		{expr: "$.order.id.value"},
+		{expr: "$.order[0]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			path, err := parseJSONPath(tc.expr)
+			require.NoError(t, err)
+
+			v, found := path.lookup([]byte(body))
+			assert.Equal(t, tc.expectFound, found)
+			assert.Equal(t, tc.expect, v)
+		})
+	}
+
+	_, found := jsonPath{{member: "order"}}.lookup([]byte("not JSON"))
+	assert.False(t, found, "Expected no value in a body which isn't JSON")
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Minimum interval between two renewals of a message lock.
+const minLockRenewalInterval = time.Second
+
+// messageLockRenewer renews the lock on Service Bus messages.
+// It is implemented by azservicebus.Receiver. Messages received from sessions
+// are locked by their session instead.
+type messageLockRenewer interface {
+	RenewMessageLock(context.Context, *azservicebus.ReceivedMessage, *azservicebus.RenewMessageLockOptions) error
+}
+
+var _ messageLockRenewer = (*azservicebus.Receiver)(nil)
+
+// startLockRenewal periodically renews the lock on the given message until the
+// returned function is called, provided that the automatic renewal of locks is
+// enabled and supported by the message's receiver.
+//
+// The lock is renewed when half of its duration has elapsed. Failures to
+// renew the lock are a leading indicator of a sink which is too slow, and are
+// therefore reported in metrics along with successful renewals.
+func (a *adapter) startLockRenewal(ctx context.Context, fm *fullMessage) (stop func()) {
+	renewer, ok := fm.rcvr.(messageLockRenewer)
+	if !a.autoRenewLock || !ok || fm.received.LockedUntil == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(lockRenewalInterval(a.clock, *fm.received.LockedUntil)):
+			}
+
+			if err := renewer.RenewMessageLock(ctx, fm.received, nil); err != nil {
+				if ctx.Err() == nil {
+					a.logger.Warnw("Failed to renew message lock", zap.String(logfieldMsgID, fm.received.MessageID),
+						zap.Error(err))
+					a.sr.ReportLockRenewal(false)
+				}
+				return
+			}
+			a.sr.ReportLockRenewal(true)
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// lockRenewalInterval returns the duration to wait for before renewing a lock
+// which expires at the given time, according to the given clock.
+func lockRenewalInterval(c *messageClock, lockedUntil time.Time) time.Duration {
+	if d := c.until(lockedUntil) / 2; d > minLockRenewalInterval {
+		return d
+	}
+	return minLockRenewalInterval
+}
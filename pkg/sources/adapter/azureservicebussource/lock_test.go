@@ -0,0 +1,137 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/metrics/metricstest"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+	metricstesting "github.com/triggermesh/triggermesh/pkg/metrics/testing"
+)
+
+func TestLockRenewalInterval(t *testing.T) {
+	assert.InDelta(t, 15*time.Second, lockRenewalInterval(nil, time.Now().Add(30*time.Second)), float64(time.Second))
+	assert.Equal(t, minLockRenewalInterval, lockRenewalInterval(nil, time.Now()))
+	assert.Equal(t, minLockRenewalInterval, lockRenewalInterval(nil, time.Now().Add(-time.Minute)))
+
+	now := time.Now()
+	clock := &messageClock{now: func() time.Time { return now }, skew: 10 * time.Second}
+	assert.Equal(t, 10*time.Second, lockRenewalInterval(clock, now.Add(30*time.Second)),
+		"Expected the lock to be renewed earlier by the clock skew")
+}
+
+func TestStartLockRenewal(t *testing.T) {
+	testCases := []struct {
+		name          string
+		autoRenewLock bool
+		renewErr      error
+		expectRenewal bool
+	}{
+		{
+			name:          "Auto-renewal enabled",
+			autoRenewLock: true,
+			expectRenewal: true,
+		},
+		{
+			name:          "Renewal fails",
+			autoRenewLock: true,
+			renewErr:      errors.New("lock lost"),
+			expectRenewal: true,
+		},
+		{
+			name: "Auto-renewal disabled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metricstesting.ResetMetrics(t)
+
+			rcvr := &lockRenewingReceiver{renewErr: tc.renewErr}
+
+			a := &adapter{
+				logger:        logtesting.TestLogger(t),
+				autoRenewLock: tc.autoRenewLock,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			fm := &fullMessage{
+				rcvr: rcvr,
+				received: &azservicebus.ReceivedMessage{
+					LockedUntil: to.Ptr(time.Now()),
+				},
+			}
+
+			stop := a.startLockRenewal(context.Background(), fm)
+			time.Sleep(minLockRenewalInterval + 500*time.Millisecond)
+			stop()
+
+			renewals := atomic.LoadInt32(&rcvr.renewals)
+			if tc.expectRenewal {
+				assert.Positive(t, renewals, "The message lock should have been renewed")
+			} else {
+				assert.Zero(t, renewals, "The message lock should not have been renewed")
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			assert.Equal(t, renewals, atomic.LoadInt32(&rcvr.renewals), "Renewals should stop")
+
+			switch {
+			case tc.renewErr != nil:
+				assert.EqualValues(t, 1, renewals, "Renewals should stop after a failure")
+				metricstest.CheckCountData(t, "lock_renewal_count", map[string]string{"result": "failure"}, 1)
+			case tc.expectRenewal:
+				metricstest.CheckCountData(t, "lock_renewal_count", map[string]string{"result": "success"}, int64(renewals))
+			default:
+				metricstest.AssertNoMetric(t, "lock_renewal_count")
+			}
+		})
+	}
+}
+
+// lockRenewingReceiver is a fakeReceiver which counts message lock renewals.
+type lockRenewingReceiver struct {
+	fakeReceiver
+	renewals int32
+	renewErr error
+}
+
+var _ messageLockRenewer = (*lockRenewingReceiver)(nil)
+
+// RenewMessageLock implements messageLockRenewer.
+func (r *lockRenewingReceiver) RenewMessageLock(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.RenewMessageLockOptions) error {
+	atomic.AddInt32(&r.renewals, 1)
+	if r.renewErr != nil {
+		return r.renewErr
+	}
+	msg.LockedUntil = to.Ptr(time.Now())
+	return nil
+}
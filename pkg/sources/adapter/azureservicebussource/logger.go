@@ -0,0 +1,72 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"knative.dev/pkg/logging"
+)
+
+// Formats of the logs of the adapter.
+const (
+	logFormatJSON    = "json"
+	logFormatConsole = "console"
+)
+
+// newLoggerWithOverrides returns a logger configured like the logger of the
+// adapter, as defined by the Knative logging configuration passed via the
+// environment, with the level and format overridden by the given values when
+// they are not empty.
+func newLoggerWithOverrides(env *envConfig, level, format string) (*zap.SugaredLogger, error) {
+	zapCfg := zap.NewProductionConfig()
+
+	if cfg, err := logging.JSONToConfig(env.LoggingConfigJson); err == nil && cfg.LoggingConfig != "" {
+		if err := json.Unmarshal([]byte(cfg.LoggingConfig), &zapCfg); err != nil {
+			return nil, fmt.Errorf("parsing logging configuration: %w", err)
+		}
+	}
+
+	if level != "" {
+		lvl, err := zap.ParseAtomicLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("parsing log level: %w", err)
+		}
+		zapCfg.Level = lvl
+	}
+
+	switch format {
+	case "":
+	case logFormatJSON, logFormatConsole:
+		zapCfg.Encoding = format
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", format)
+	}
+
+	logger, err := zapCfg.Build()
+	if err != nil {
+		return nil, fmt.Errorf("building logger: %w", err)
+	}
+
+	if env.Component != "" {
+		logger = logger.Named(env.Component)
+	}
+	return logger.Sugar(), nil
+}
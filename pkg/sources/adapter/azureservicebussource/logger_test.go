@@ -0,0 +1,83 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewLoggerWithOverrides(t *testing.T) {
+	testCases := []struct {
+		name        string
+		loggingCfg  string
+		level       string
+		format      string
+		expectLevel zapcore.Level
+		expectErr   bool
+	}{
+		{
+			name:        "Level is overridden",
+			loggingCfg:  "{}",
+			level:       "debug",
+			expectLevel: zapcore.DebugLevel,
+		},
+		{
+			name:        "Format is overridden",
+			loggingCfg:  "{}",
+			format:      logFormatConsole,
+			expectLevel: zapcore.InfoLevel,
+		},
+		{
+			name:        "Shared level applies when not overridden",
+			loggingCfg:  `{"zap-logger-config": "{\"level\": \"warn\", \"encoding\": \"json\", \"outputPaths\": [\"stdout\"]}"}`,
+			format:      logFormatJSON,
+			expectLevel: zapcore.WarnLevel,
+		},
+		{
+			name:       "Invalid level",
+			loggingCfg: "{}",
+			level:      "verbose",
+			expectErr:  true,
+		},
+		{
+			name:       "Invalid format",
+			loggingCfg: "{}",
+			format:     "xml",
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := &envConfig{}
+			env.LoggingConfigJson = tc.loggingCfg
+
+			logger, err := newLoggerWithOverrides(env, tc.level, tc.format)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectLevel, logger.Level())
+		})
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	"knative.dev/pkg/metrics/metricstest"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+	metricstesting "github.com/triggermesh/triggermesh/pkg/metrics/testing"
+)
+
+// metricsRecorder gives access to the measurements recorded by the adapter
+// during a test, as read by the metrics test exporter from all OpenCensus
+// meters. Unlike the assertions of the metricstest package, which expect a
+// single time series with an exact set of tags, measurements are aggregated
+// across all time series which carry the tags a test cares about, so that
+// tests aren't coupled to tags which are irrelevant to them.
+type metricsRecorder struct {
+	t *testing.T
+}
+
+// recordMetrics resets the global state of metrics, and returns a
+// metricsRecorder for the measurements recorded from that point on.
+func recordMetrics(t *testing.T) *metricsRecorder {
+	t.Helper()
+	metricstesting.ResetMetrics(t)
+	return &metricsRecorder{t: t}
+}
+
+// values returns the values of the metric with the given name, for all time
+// series whose tags include the given tags.
+func (r *metricsRecorder) values(name string, tags map[string]string) []metricstest.Value {
+	metricstest.EnsureRecorded()
+
+	var vals []metricstest.Value
+	for _, m := range metricstest.GetMetric(name) {
+		for _, v := range m.Values {
+			if hasTags(v.Tags, tags) {
+				vals = append(vals, v)
+			}
+		}
+	}
+	return vals
+}
+
+// total returns the sum of the values of the metric with the given name, for
+// all time series whose tags include the given tags. The values of
+// distributions are their number of measurements.
+func (r *metricsRecorder) total(name string, tags map[string]string) float64 {
+	var total float64
+	for _, v := range r.values(name, tags) {
+		switch {
+		case v.Int64 != nil:
+			total += float64(*v.Int64)
+		case v.Float64 != nil:
+			total += *v.Float64
+		case v.Distribution != nil:
+			total += float64(v.Distribution.Count)
+		}
+	}
+	return total
+}
+
+// assertTotal asserts that the sum of the values of the metric with the given
+// name, for all time series whose tags include the given tags, equals want.
+func (r *metricsRecorder) assertTotal(name string, tags map[string]string, want float64) {
+	r.t.Helper()
+	assert.Equal(r.t, want, r.total(name, tags), "Unexpected total for metric %q with tags %v", name, tags)
+}
+
+// assertNotRecorded asserts that no measurement was recorded for the metrics
+// with the given names.
+func (r *metricsRecorder) assertNotRecorded(names ...string) {
+	r.t.Helper()
+	for _, n := range names {
+		assert.Empty(r.t, r.values(n, nil), "Unexpected measurements for metric %q", n)
+	}
+}
+
+// hasTags returns whether the tags of a time series include the given tags.
+func hasTags(seriesTags, tags map[string]string) bool {
+	for k, v := range tags {
+		if seriesTags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	m := recordMetrics(t)
+
+	sr := metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{
+		Namespace: "ns",
+		Name:      "src",
+	})
+
+	m.assertNotRecorded("event_processing_success_count", "event_delivery_lag", "event_loss_count")
+
+	sr.ReportProcessingSuccess(metrics.TagEventType("type.a"), metrics.TagEventSource("source"))
+	sr.ReportProcessingSuccess(metrics.TagEventType("type.a"), metrics.TagEventSource("source"))
+	sr.ReportProcessingSuccess(metrics.TagEventType("type.b"), metrics.TagEventSource("source"))
+	sr.ReportDeliveryLag(time.Second)
+	sr.ReportDeliveryLag(2 * time.Second)
+	sr.ReportEventLoss(3)
+
+	m.assertTotal("event_processing_success_count", nil, 3)
+	m.assertTotal("event_processing_success_count", map[string]string{"event_type": "type.a"}, 2)
+	m.assertTotal("event_processing_success_count", map[string]string{"event_type": "type.b", "event_source": "source"}, 1)
+	m.assertTotal("event_processing_success_count", map[string]string{"event_type": "type.c"}, 0)
+	m.assertTotal("event_processing_success_count", map[string]string{"namespace_name": "ns"}, 3)
+
+	m.assertTotal("event_delivery_lag", nil, 2)
+	m.assertTotal("event_loss_count", nil, 3)
+
+	m.assertNotRecorded("nil_message_count")
+
+	t.Run("metrics are reset between tests", func(t *testing.T) {
+		m := recordMetrics(t)
+		m.assertNotRecorded("event_processing_success_count", "event_delivery_lag", "event_loss_count")
+	})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+)
+
+// multiAdapter receives messages from multiple Service Bus entities
+// concurrently, using one adapter per entity.
+type multiAdapter struct {
+	logger *zap.SugaredLogger
+
+	adapters []*adapter
+
+	// Shared by all adapters.
+	batcher    *batchingClient
+	healthPort uint16
+	status     *statusTracker
+	pause      *pauseControl
+}
+
+var _ pkgadapter.Adapter = (*multiAdapter)(nil)
+
+// Start implements adapter.Adapter.
+//
+// All adapters are stopped as soon as one of them returns with an error.
+func (m *multiAdapter) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Batches of events are delivered until all adapters have returned.
+	if m.batcher != nil {
+		batchCtx, stopBatching := context.WithCancel(detach(ctx))
+		batcherDone := make(chan struct{})
+		go func() {
+			m.batcher.run(batchCtx)
+			close(batcherDone)
+		}()
+		defer func() {
+			stopBatching()
+			<-batcherDone
+		}()
+	}
+
+	if m.healthPort != 0 {
+		stopHealthServer, err := startHealthServer(m.logger, m.healthPort, m.isReady, m.status, m.pause)
+		if err != nil {
+			return fmt.Errorf("starting health server: %w", err)
+		}
+		defer stopHealthServer()
+	}
+
+	errs := make([]error, len(m.adapters))
+
+	var wg sync.WaitGroup
+	for i, a := range m.adapters {
+		wg.Add(1)
+		go func(i int, a *adapter) {
+			defer wg.Done()
+			if errs[i] = a.Start(ctx); errs[i] != nil {
+				cancel()
+			}
+		}(i, a)
+	}
+	wg.Wait()
+
+	var errMsgs []string
+	for _, err := range errs {
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+		}
+	}
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, ". "))
+	}
+
+	return nil
+}
+
+// isReady returns whether all adapters are ready to receive messages.
+func (m *multiAdapter) isReady() bool {
+	for _, a := range m.adapters {
+		if !a.isReady() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestSplitEntityResourceIDs(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		expect []string
+	}{
+		{
+			name:   "Single ID",
+			input:  "/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q",
+			expect: []string{"/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q"},
+		},
+		{
+			name: "Multiple IDs with whitespace",
+			input: " /subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q1 ," +
+				"/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q2, ",
+			expect: []string{
+				"/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q1",
+				"/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q2",
+			},
+		},
+		{
+			name:  "Empty",
+			input: " , ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, splitEntityResourceIDs(tc.input))
+		})
+	}
+}
+
+func TestMultiAdapterStart(t *testing.T) {
+	ceClient := adaptertest.NewTestClient()
+
+	newEntityAdapter := func(source, msgID string) (*adapter, *fakeReceiver) {
+		rcvr := &fakeReceiver{
+			batch: []*azservicebus.ReceivedMessage{
+				{MessageID: msgID, Body: []byte(`{"test": null}`)},
+			},
+		}
+
+		return &adapter{
+			logger:        logtesting.TestLogger(t),
+			msgRcvr:       rcvr,
+			ceClient:      ceClient,
+			ceSource:      source,
+			msgPrcsr:      &defaultMessageProcessor{ceSource: source},
+			maxConcurrent: 1,
+			prefetchCount: 1,
+
+			sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+		}, rcvr
+	}
+
+	a1, rcvr1 := newEntityAdapter("queue1", "1")
+	a2, rcvr2 := newEntityAdapter("queue2", "2")
+
+	m := &multiAdapter{
+		logger:   logtesting.TestLogger(t),
+		adapters: []*adapter{a1, a2},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- m.Start(ctx)
+	}()
+
+	assert.Eventually(t, func() bool { return len(ceClient.Sent()) == 2 },
+		5*time.Second, 10*time.Millisecond, "Expected one event per entity")
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the adapter to stop")
+	}
+
+	sources := make(map[string]string, 2)
+	for _, ev := range ceClient.Sent() {
+		sources[ev.ID()] = ev.Source()
+	}
+	assert.Equal(t, map[string]string{"1": "queue1", "2": "queue2"}, sources)
+
+	assert.Equal(t, []string{"1"}, rcvr1.completed)
+	assert.Equal(t, []string{"2"}, rcvr2.completed)
+}
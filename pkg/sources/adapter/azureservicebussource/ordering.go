@@ -0,0 +1,101 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// Modes of verification of the order of messages.
+const (
+	orderingCheckWarn = "warn"
+	orderingCheckFail = "fail"
+)
+
+// isSupportedOrderingCheck returns whether the given mode of verification of
+// the order of messages is supported. An empty value disables the check.
+func isSupportedOrderingCheck(mode string) bool {
+	switch mode {
+	case "", orderingCheckWarn, orderingCheckFail:
+		return true
+	default:
+		return false
+	}
+}
+
+// outOfOrderError is returned when a message is observed with a sequence
+// number lower than the one of a message which was handled before it.
+type outOfOrderError struct {
+	seqNum     int64
+	lastSeqNum int64
+}
+
+var _ error = (*outOfOrderError)(nil)
+
+// Error implements the error interface.
+func (e *outOfOrderError) Error() string {
+	return fmt.Sprintf("received message with sequence number %d after message with sequence number %d",
+		e.seqNum, e.lastSeqNum)
+}
+
+// orderingChecker verifies that messages are handled in the order of their
+// sequence numbers. It tracks the highest sequence number observed so far,
+// and is therefore only meaningful when messages are handled by a single
+// consumer. It is not safe for concurrent use.
+type orderingChecker struct {
+	// whether an out-of-order message should stop the adapter, instead of
+	// merely being reported
+	failOnViolation bool
+
+	lastSeqNum *int64
+}
+
+// newOrderingChecker returns an orderingChecker for the given mode, or nil if
+// the check is disabled.
+func newOrderingChecker(mode string) *orderingChecker {
+	if mode == "" {
+		return nil
+	}
+	return &orderingChecker{
+		failOnViolation: mode == orderingCheckFail,
+	}
+}
+
+// check records the sequence number of the given message, and returns an
+// outOfOrderError if it is lower than the one of a message observed before.
+//
+// Redeliveries of the last observed message, which share its sequence number,
+// aren't considered out of order. Messages without a sequence number are
+// ignored.
+func (c *orderingChecker) check(msg *azservicebus.ReceivedMessage) error {
+	if msg.SequenceNumber == nil {
+		return nil
+	}
+	seqNum := *msg.SequenceNumber
+
+	if c.lastSeqNum != nil && seqNum < *c.lastSeqNum {
+		return &outOfOrderError{
+			seqNum:     seqNum,
+			lastSeqNum: *c.lastSeqNum,
+		}
+	}
+
+	c.lastSeqNum = &seqNum
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestOrderingChecker(t *testing.T) {
+	c := newOrderingChecker(orderingCheckWarn)
+
+	assert.NoError(t, c.check(newSequencedMessage("1", 1)))
+	assert.NoError(t, c.check(newSequencedMessage("3", 3)))
+	assert.NoError(t, c.check(newSequencedMessage("3", 3)), "Redelivery of the last message")
+	assert.NoError(t, c.check(&azservicebus.ReceivedMessage{}), "Message without a sequence number")
+
+	err := c.check(newSequencedMessage("2", 2))
+	var orderErr *outOfOrderError
+	require.True(t, errors.As(err, &orderErr))
+	assert.Equal(t, int64(2), orderErr.seqNum)
+	assert.Equal(t, int64(3), orderErr.lastSeqNum)
+
+	assert.NoError(t, c.check(newSequencedMessage("4", 4)))
+
+	assert.Nil(t, newOrderingChecker(""), "Check is disabled")
+}
+
+func TestConsumeOrdering(t *testing.T) {
+	testCases := []struct {
+		name            string
+		mode            string
+		expectErr       bool
+		expectCompleted []string
+		expectAbandoned []string
+	}{
+		{
+			name:            "Out-of-order message is reported",
+			mode:            orderingCheckWarn,
+			expectCompleted: []string{"1", "3", "2"},
+		},
+		{
+			name:            "Out-of-order message stops the consumer",
+			mode:            orderingCheckFail,
+			expectErr:       true,
+			expectCompleted: []string{"1", "3"},
+			expectAbandoned: []string{"2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &fakeReceiver{}
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				logger:   logtesting.TestLogger(t),
+				ceClient: ceClient,
+				msgPrcsr: &defaultMessageProcessor{},
+				ordering: newOrderingChecker(tc.mode),
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			msgChan := make(chan *fullMessage, 3)
+			for _, m := range []*azservicebus.ReceivedMessage{
+				newSequencedMessage("1", 1),
+				newSequencedMessage("3", 3),
+				newSequencedMessage("2", 2),
+			} {
+				msg, err := toMessage(m)
+				require.NoError(t, err)
+				msgChan <- &fullMessage{rcvr: rcvr, received: m, serializable: msg}
+			}
+			close(msgChan)
+
+			errChan := make(chan error, 1)
+			a.consume(context.Background(), msgChan, errChan)
+			close(errChan)
+
+			err := <-errChan
+			if tc.expectErr {
+				var orderErr *outOfOrderError
+				assert.ErrorAs(t, err, &orderErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectCompleted, rcvr.completed)
+			assert.Equal(t, tc.expectAbandoned, rcvr.abandoned)
+			assert.Len(t, ceClient.Sent(), len(tc.expectCompleted))
+		})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/extensions"
+)
+
+// Policies which determine how CloudEvents which exceed the maximum number
+// of extension attributes are handled.
+const (
+	extensionOverflowDrop       = "drop"
+	extensionOverflowStructured = "structured"
+	extensionOverflowFail       = "fail"
+)
+
+// isSupportedExtensionOverflowPolicy returns whether the given extension
+// overflow policy is supported.
+func isSupportedExtensionOverflowPolicy(p string) bool {
+	switch p {
+	case extensionOverflowDrop, extensionOverflowStructured, extensionOverflowFail:
+		return true
+	}
+	return false
+}
+
+// adapterExtensions are the names of the extension attributes which the
+// adapter sets on CloudEvents, as opposed to the ones which carry
+// application properties of messages.
+var adapterExtensions = []string{
+	extCorrelationID, extSessionID, extTo, extReplyTo, extReplyToSession, extDeliveryCount, extSequenceNumber,
+	extScheduledTime, extExpiryTime, extPartitionKey, extViaPartitionKey,
+	extDeadLetterReason, extDeadLetterDescription, extDeadLetterSource, extSubQueue,
+	extResourceID, extOriginalMessageID, extSourceIdentity, extAzureSubscription, extResourceGroup,
+	extHops, extHopLimitExceeded, extCEPartitionKey, extRawMessage, extRawProperties,
+	extensions.TraceParentExtension, extensions.TraceStateExtension,
+}
+
+// extensionLimit caps the number of extension attributes of CloudEvents.
+type extensionLimit struct {
+	max    int
+	policy string
+
+	// names of extension attributes which are never dropped
+	protected map[string]struct{}
+}
+
+// newExtensionLimit returns an extensionLimit which caps the number of
+// extension attributes of CloudEvents to max, and handles CloudEvents which
+// exceed it according to the given policy.
+//
+// The attributes set by the adapter and the given attributes, which are
+// typically explicitly configured, are protected from being dropped.
+func newExtensionLimit(max int, policy string, protected ...string) *extensionLimit {
+	l := &extensionLimit{
+		max:       max,
+		policy:    policy,
+		protected: make(map[string]struct{}, len(adapterExtensions)+len(protected)),
+	}
+
+	for _, names := range [][]string{adapterExtensions, protected} {
+		for _, n := range names {
+			l.protected[n] = struct{}{}
+		}
+	}
+
+	return l
+}
+
+// exceeded returns whether the given CloudEvent has more extension
+// attributes than allowed.
+func (l *extensionLimit) exceeded(event *cloudevents.Event) bool {
+	return len(event.Extensions()) > l.max
+}
+
+// isProtected returns whether the extension attribute with the given name
+// must not be dropped. The companion attribute which conveys the encoding of
+// a protected attribute is protected as well.
+func (l *extensionLimit) isProtected(name string) bool {
+	if _, ok := l.protected[name]; ok {
+		return true
+	}
+	_, ok := l.protected[strings.TrimSuffix(name, extEncodingSuffix)]
+	return ok && strings.HasSuffix(name, extEncodingSuffix)
+}
+
+// drop removes extension attributes which aren't protected from the given
+// CloudEvent, until it no longer exceeds the limit. Attributes are removed
+// in reverse alphabetical order, so that the same attributes are always
+// dropped from events which carry the same set of attributes. Companion
+// attributes are removed together with the attribute they describe.
+//
+// The names of removed attributes are returned. The CloudEvent may still
+// exceed the limit if it doesn't carry enough attributes which can be
+// dropped.
+func (l *extensionLimit) drop(event *cloudevents.Event) []string {
+	exts := event.Extensions()
+
+	candidates := make([]string, 0, len(exts))
+	for name := range exts {
+		if !l.isProtected(name) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(candidates)))
+
+	var dropped []string
+
+	for _, name := range candidates {
+		if !l.exceeded(event) {
+			break
+		}
+
+		// Companion attributes are removed with the attribute they
+		// describe, which sorts before them.
+		if base := strings.TrimSuffix(name, extEncodingSuffix); base != name {
+			if _, hasBase := event.Extensions()[base]; hasBase && !l.isProtected(base) {
+				continue
+			}
+		}
+
+		for _, n := range []string{name, name + extEncodingSuffix} {
+			if _, ok := event.Extensions()[n]; ok && !l.isProtected(n) {
+				event.SetExtension(n, nil)
+				dropped = append(dropped, n)
+			}
+		}
+	}
+
+	return dropped
+}
+
+// limitExtensions applies the extension overflow policy of the adapter to
+// the given CloudEvent, if it exceeds the maximum number of extension
+// attributes. It returns the context in which the CloudEvent must be sent,
+// which requests the structured content mode if required by the policy.
+//
+// An error is returned if the CloudEvent must not be sent, either per the
+// policy, or because not enough attributes could be dropped. The error is a
+// validation error, so that the message gets dead-lettered instead of being
+// redelivered.
+func (a *adapter) limitExtensions(ctx context.Context, ev *cloudevents.Event) (context.Context, error) {
+	if a.extLimit == nil || !a.extLimit.exceeded(ev) {
+		return ctx, nil
+	}
+
+	numExts := len(ev.Extensions())
+
+	switch a.extLimit.policy {
+	case extensionOverflowStructured:
+		return cloudevents.WithEncodingStructured(ctx), nil
+
+	case extensionOverflowDrop:
+		dropped := a.extLimit.drop(ev)
+		if len(dropped) != 0 {
+			a.logger.Debugw("Dropped extension attributes in excess", zap.String("eventID", ev.ID()),
+				zap.Strings("attributes", dropped))
+		}
+		if !a.extLimit.exceeded(ev) {
+			return ctx, nil
+		}
+		numExts = len(ev.Extensions())
+	}
+
+	return ctx, event.ValidationError{
+		"extensions": fmt.Errorf("the event has %d extension attributes, which exceeds the maximum of %d",
+			numExts, a.extLimit.max),
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestExtensionLimitDrop(t *testing.T) {
+	testCases := []struct {
+		name          string
+		max           int
+		protected     []string
+		exts          map[string]interface{}
+		expectDropped []string
+		expectExts    []string
+	}{
+		{
+			name:          "Within the limit",
+			max:           3,
+			exts:          map[string]interface{}{"a": "1", "b": "2", "c": "3"},
+			expectDropped: nil,
+			expectExts:    []string{"a", "b", "c"},
+		},
+		{
+			name:          "Reverse alphabetical order",
+			max:           2,
+			exts:          map[string]interface{}{"a": "1", "b": "2", "c": "3", "d": "4"},
+			expectDropped: []string{"d", "c"},
+			expectExts:    []string{"a", "b"},
+		},
+		{
+			name:          "Attributes set by the adapter are protected",
+			max:           2,
+			exts:          map[string]interface{}{"a": "1", "z": "2", extDeliveryCount: "0", extSourceIdentity: "ns/name"},
+			expectDropped: []string{"z", "a"},
+			expectExts:    []string{extDeliveryCount, extSourceIdentity},
+		},
+		{
+			name:          "Configured attributes are protected",
+			max:           2,
+			protected:     []string{"z"},
+			exts:          map[string]interface{}{"a": "1", "b": "2", "z": "3"},
+			expectDropped: []string{"b"},
+			expectExts:    []string{"a", "z"},
+		},
+		{
+			name: "Companion attributes are dropped with their attribute",
+			max:  2,
+			exts: map[string]interface{}{
+				"a": "1", "tags": `["a"]`, "tags" + extEncodingSuffix: propertyEncodingJSON,
+			},
+			expectDropped: []string{"tags", "tags" + extEncodingSuffix},
+			expectExts:    []string{"a"},
+		},
+		{
+			name:      "Companion attributes of protected attributes are protected",
+			max:       2,
+			protected: []string{"tags"},
+			exts: map[string]interface{}{
+				"a": "1", "tags": `["a"]`, "tags" + extEncodingSuffix: propertyEncodingJSON,
+			},
+			expectDropped: []string{"a"},
+			expectExts:    []string{"tags", "tags" + extEncodingSuffix},
+		},
+		{
+			name:          "Not enough attributes can be dropped",
+			max:           1,
+			exts:          map[string]interface{}{"a": "1", extDeliveryCount: "0", extSequenceNumber: "1"},
+			expectDropped: []string{"a"},
+			expectExts:    []string{extDeliveryCount, extSequenceNumber},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ev := newTestEvent("0")
+			for n, v := range tc.exts {
+				ev.SetExtension(n, v)
+			}
+
+			l := newExtensionLimit(tc.max, extensionOverflowDrop, tc.protected...)
+
+			assert.Equal(t, tc.expectDropped, l.drop(&ev))
+
+			exts := make([]string, 0, len(ev.Extensions()))
+			for n := range ev.Extensions() {
+				exts = append(exts, n)
+			}
+			assert.ElementsMatch(t, tc.expectExts, exts)
+		})
+	}
+}
+
+func TestHandleMessageExtensionOverflow(t *testing.T) {
+	testCases := []struct {
+		name              string
+		policy            string
+		max               int
+		expectErr         bool
+		expectContentType string
+		expectProps       []string
+	}{
+		{
+			name:              "Within the limit",
+			policy:            extensionOverflowFail,
+			max:               4,
+			expectContentType: cloudevents.ApplicationJSON,
+			expectProps:       []string{"alpha", "bravo", "charlie"},
+		},
+		{
+			name:              "Structured content mode",
+			policy:            extensionOverflowStructured,
+			max:               2,
+			expectContentType: cloudevents.ApplicationCloudEventsJSON,
+		},
+		{
+			name:              "Drop attributes",
+			policy:            extensionOverflowDrop,
+			max:               2,
+			expectContentType: cloudevents.ApplicationJSON,
+			expectProps:       []string{"alpha"},
+		},
+		{
+			name:      "Fail",
+			policy:    extensionOverflowFail,
+			max:       2,
+			expectErr: true,
+		},
+		{
+			name:      "Drop attributes, not enough attributes can be dropped",
+			policy:    extensionOverflowDrop,
+			max:       0,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var contentType string
+			var header http.Header
+
+			sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				header = r.Header.Clone()
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer sink.Close()
+
+			ceClient, err := cloudevents.NewClientHTTP(cloudevents.WithTarget(sink.URL))
+			require.NoError(t, err)
+
+			a := &adapter{
+				logger:   logtesting.TestLogger(t),
+				ceClient: ceClient,
+				msgPrcsr: &defaultMessageProcessor{
+					ceSource:          "/some/source",
+					propsAsExtensions: true,
+				},
+				extLimit: newExtensionLimit(tc.max, tc.policy),
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+
+			// sbdeliverycount + 3 properties
+			err = a.handleMessage(context.Background(), &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID: "1",
+					Body:      []byte(`{"test": null}`),
+					ApplicationProperties: map[string]interface{}{
+						"alpha":   "a",
+						"bravo":   "b",
+						"charlie": "c",
+					},
+				},
+			}, nil)
+
+			if tc.expectErr {
+				var delivErr *deliveryError
+				require.True(t, errors.As(err, &delivErr), "Unexpected error: %v", err)
+				assert.True(t, delivErr.isFatal(), "Events which exceed the limit should not be redelivered")
+				assert.Equal(t, deadLetterReasonRejected, failureReason(err))
+				assert.Nil(t, header, "The event should not have been sent")
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Contains(t, contentType, tc.expectContentType)
+
+			if tc.expectContentType == cloudevents.ApplicationJSON {
+				assert.Equal(t, "0", header.Get("Ce-Sbdeliverycount"))
+				for _, p := range []string{"alpha", "bravo", "charlie"} {
+					assert.Equal(t, contains(tc.expectProps, p), header.Get("Ce-"+p) != "",
+						"Unexpected presence of the attribute %q", p)
+				}
+			}
+		})
+	}
+}
+
+// contains returns whether the given list contains the given string.
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/itchyny/gojq"
+)
+
+// Sources of the "partitionkey" extension attribute of CloudEvents.
+const (
+	partitionKeyFromSessionID    = "session-id"
+	partitionKeyFromPartitionKey = "partition-key"
+	partitionKeyFromBody         = "body"
+)
+
+// partitionKeyExtractor determines the partition key of the CloudEvent
+// emitted for a Service Bus message, so that sinks which honor the
+// CloudEvents partitioning extension (e.g. Kafka) preserve the affinity of
+// related messages.
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/extensions/partitioning.md
+type partitionKeyExtractor struct {
+	from string
+	// only set when the partition key is extracted from the body
+	code *gojq.Code
+}
+
+// newPartitionKeyExtractor returns a partitionKeyExtractor which extracts
+// partition keys from the given source. The jq expression is required when
+// partition keys are extracted from the body of messages, and ignored
+// otherwise.
+func newPartitionKeyExtractor(from, expr string) (*partitionKeyExtractor, error) {
+	switch from {
+	case partitionKeyFromSessionID, partitionKeyFromPartitionKey:
+		return &partitionKeyExtractor{from: from}, nil
+
+	case partitionKeyFromBody:
+		if expr == "" {
+			return nil, errors.New("an expression is required to extract partition keys from the body of messages")
+		}
+
+		query, err := gojq.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing partition key expression: %w", err)
+		}
+		code, err := gojq.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("compiling partition key expression: %w", err)
+		}
+
+		return &partitionKeyExtractor{from: from, code: code}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported partition key source %q", from)
+	}
+}
+
+// extract returns the partition key of the given message, or an empty string
+// if the message has none.
+//
+// When extracted from the body of messages, the partition key is the first
+// value produced by the expression, formatted like the value of an
+// application property (see encodePropertyValue). Messages whose body isn't
+// JSON, or for which the expression fails or returns null, have no partition
+// key.
+func (e *partitionKeyExtractor) extract(msg *Message) string {
+	switch e.from {
+	case partitionKeyFromSessionID:
+		if msg.SessionID != nil {
+			return *msg.SessionID
+		}
+	case partitionKeyFromPartitionKey:
+		if msg.PartitionKey != nil {
+			return *msg.PartitionKey
+		}
+	case partitionKeyFromBody:
+		return e.extractFromBody(msg)
+	}
+	return ""
+}
+
+// extractFromBody evaluates the partition key expression against the JSON
+// body of the given message.
+func (e *partitionKeyExtractor) extractFromBody(msg *Message) string {
+	if ct := contentType(msg); ct != "" && !isJSONContentType(ct) {
+		return ""
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(msg.Body, &data); err != nil {
+		return ""
+	}
+
+	v, ok := e.code.Run(data).Next()
+	if !ok || v == nil {
+		return ""
+	}
+	if _, isErr := v.(error); isErr {
+		return ""
+	}
+
+	key, _ := encodePropertyValue(v)
+	return key
+}
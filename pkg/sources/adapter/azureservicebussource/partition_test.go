@@ -0,0 +1,136 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestPartitionKeyExtractor(t *testing.T) {
+	testCases := []struct {
+		name      string
+		from      string
+		expr      string
+		msg       *azservicebus.ReceivedMessage
+		expectKey string
+	}{
+		{
+			name:      "From session ID",
+			from:      partitionKeyFromSessionID,
+			msg:       &azservicebus.ReceivedMessage{SessionID: to.Ptr("session1")},
+			expectKey: "session1",
+		},
+		{
+			name: "Message has no session ID",
+			from: partitionKeyFromSessionID,
+			msg:  &azservicebus.ReceivedMessage{PartitionKey: to.Ptr("pk1")},
+		},
+		{
+			name:      "From partition key",
+			from:      partitionKeyFromPartitionKey,
+			msg:       &azservicebus.ReceivedMessage{PartitionKey: to.Ptr("pk1")},
+			expectKey: "pk1",
+		},
+		{
+			name:      "From body string field",
+			from:      partitionKeyFromBody,
+			expr:      `.customer.id`,
+			msg:       &azservicebus.ReceivedMessage{Body: []byte(`{"customer": {"id": "c1"}}`)},
+			expectKey: "c1",
+		},
+		{
+			name:      "From body numeric field",
+			from:      partitionKeyFromBody,
+			expr:      `.tenant`,
+			msg:       &azservicebus.ReceivedMessage{Body: []byte(`{"tenant": 42}`)},
+			expectKey: "42",
+		},
+		{
+			name: "Body field is missing",
+			from: partitionKeyFromBody,
+			expr: `.customer.id`,
+			msg:  &azservicebus.ReceivedMessage{Body: []byte(`{"order": 1}`)},
+		},
+		{
+			name: "Expression fails",
+			from: partitionKeyFromBody,
+			expr: `.customer.id`,
+			msg:  &azservicebus.ReceivedMessage{Body: []byte(`{"customer": "c1"}`)},
+		},
+		{
+			name: "Body is not JSON",
+			from: partitionKeyFromBody,
+			expr: `.customer.id`,
+			msg:  &azservicebus.ReceivedMessage{Body: []byte("not JSON")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := newPartitionKeyExtractor(tc.from, tc.expr)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectKey, e.extract(&Message{ReceivedMessage: tc.msg}))
+		})
+	}
+}
+
+func TestNewPartitionKeyExtractorInvalid(t *testing.T) {
+	_, err := newPartitionKeyExtractor("unknown", "")
+	assert.Error(t, err, "Expected unsupported sources to be rejected")
+
+	_, err = newPartitionKeyExtractor(partitionKeyFromBody, "")
+	assert.Error(t, err, "Expected an expression to be required")
+
+	_, err = newPartitionKeyExtractor(partitionKeyFromBody, ".customer.")
+	assert.Error(t, err, "Expected invalid expressions to be rejected")
+}
+
+func TestProcessMessagePartitionKey(t *testing.T) {
+	e, err := newPartitionKeyExtractor(partitionKeyFromSessionID, "")
+	require.NoError(t, err)
+
+	msgPrcsr := &defaultMessageProcessor{
+		ceSource:     "/some/source",
+		partitionKey: e,
+	}
+
+	events, err := msgPrcsr.Process(&Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body:      []byte(`{"test": null}`),
+			SessionID: to.Ptr("session1"),
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "session1", events[0].Extensions()[extCEPartitionKey])
+
+	events, err = msgPrcsr.Process(&Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body: []byte(`{"test": null}`),
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.NotContains(t, events[0].Extensions(), extCEPartitionKey)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+// URL paths of the endpoints which pause and resume the consumption of
+// messages.
+const (
+	pauseEndpointPath  = "/pause"
+	resumeEndpointPath = "/resume"
+)
+
+// pauseControl suspends the reception of messages while it is paused.
+// Messages which were already received continue to be handled, and
+// connections to Service Bus are kept open.
+type pauseControl struct {
+	logger *zap.SugaredLogger
+
+	mu sync.Mutex
+	// closed while the consumption of messages isn't paused
+	resumed chan struct{}
+	// closed while the consumption of messages is paused
+	paused chan struct{}
+}
+
+// newPauseControl returns a pauseControl which isn't paused.
+func newPauseControl(logger *zap.SugaredLogger) *pauseControl {
+	resumed := make(chan struct{})
+	close(resumed)
+
+	return &pauseControl{
+		logger:  logger,
+		resumed: resumed,
+		paused:  make(chan struct{}),
+	}
+}
+
+// pause suspends the reception of messages. It has no effect if the
+// reception is already suspended.
+func (p *pauseControl) pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.resumed:
+		p.resumed = make(chan struct{})
+		close(p.paused)
+		p.logger.Info("Pausing the consumption of messages")
+	default:
+	}
+}
+
+// resume resumes the reception of messages. It has no effect if the
+// reception isn't suspended.
+func (p *pauseControl) resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.resumed:
+	default:
+		p.paused = make(chan struct{})
+		close(p.resumed)
+		p.logger.Info("Resuming the consumption of messages")
+	}
+}
+
+// isPaused returns whether the reception of messages is suspended.
+func (p *pauseControl) isPaused() bool {
+	select {
+	case <-p.resumedChan():
+		return false
+	default:
+		return true
+	}
+}
+
+// wait blocks while the reception of messages is suspended, or until ctx is
+// canceled, in which case the error of ctx is returned.
+func (p *pauseControl) wait(ctx context.Context) error {
+	select {
+	case <-p.resumedChan():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// untilPaused returns a copy of ctx which is canceled as soon as the
+// reception of messages gets suspended, so that a pending receive operation
+// doesn't accept new messages after that point.
+func (p *pauseControl) untilPaused(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	paused := p.pausedChan()
+	go func() {
+		select {
+		case <-paused:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// resumedChan returns the channel which is closed when the reception of
+// messages isn't suspended.
+func (p *pauseControl) resumedChan() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed
+}
+
+// pausedChan returns the channel which is closed when the reception of
+// messages is suspended.
+func (p *pauseControl) pausedChan() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// handler returns a http.Handler which applies the given state change upon
+// POST requests, and responds with the resulting state.
+func (p *pauseControl) handler(change func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		change()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Paused bool `json:"paused"`
+		}{
+			Paused: p.isPaused(),
+		})
+	})
+}
+
+// receiveUnlessPaused receives messages from the given receiver like
+// receiveMessages, while the reception of messages isn't suspended. A receive
+// operation which is interrupted by a pause is resumed later on.
+func (a *adapter) receiveUnlessPaused(ctx context.Context, rcvr messageReceiver,
+	count int) ([]*azservicebus.ReceivedMessage, error) {
+
+	if a.pause == nil {
+		return a.receiveMessages(ctx, rcvr, count)
+	}
+
+	for {
+		if err := a.pause.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		rcvCtx, cancel := a.pause.untilPaused(ctx)
+		messages, err := a.receiveMessages(rcvCtx, rcvr, count)
+		interrupted := err != nil && ctx.Err() == nil && rcvCtx.Err() != nil
+		cancel()
+
+		if !interrupted {
+			return messages, err
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestPauseControl(t *testing.T) {
+	p := newPauseControl(logtesting.TestLogger(t))
+	assert.False(t, p.isPaused())
+	assert.NoError(t, p.wait(context.Background()))
+
+	p.pause()
+	p.pause()
+	assert.True(t, p.isPaused())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.wait(ctx), context.DeadlineExceeded, "Expected wait to block while paused")
+
+	rcvCtx, stop := p.untilPaused(context.Background())
+	defer stop()
+	assert.Eventually(t, func() bool { return rcvCtx.Err() != nil },
+		time.Second, 5*time.Millisecond, "Expected the context to be canceled while paused")
+
+	p.resume()
+	p.resume()
+	assert.False(t, p.isPaused())
+	assert.NoError(t, p.wait(context.Background()))
+
+	rcvCtx, stop = p.untilPaused(context.Background())
+	defer stop()
+	assert.NoError(t, rcvCtx.Err())
+
+	p.pause()
+	assert.Eventually(t, func() bool { return rcvCtx.Err() != nil },
+		time.Second, 5*time.Millisecond, "Expected the context to be canceled upon pause")
+}
+
+func TestReceiveUnlessPaused(t *testing.T) {
+	rcvr := &fakeReceiver{}
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		prefetchCount: 1,
+		pause:         newPauseControl(logtesting.TestLogger(t)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan []*azservicebus.ReceivedMessage)
+	go func() {
+		msgs, err := a.receiveUnlessPaused(ctx, rcvr, a.prefetchCount)
+		assert.NoError(t, err)
+		received <- msgs
+	}()
+
+	// Interrupts the pending receive operation.
+	a.pause.pause()
+
+	rcvr.mu.Lock()
+	rcvr.batch = []*azservicebus.ReceivedMessage{{MessageID: "1"}}
+	rcvr.mu.Unlock()
+
+	select {
+	case <-received:
+		t.Fatal("Expected no message to be received while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	a.pause.resume()
+
+	select {
+	case msgs := <-received:
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "1", msgs[0].MessageID)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the message to be received after resuming")
+	}
+}
+
+func TestPauseEndpoints(t *testing.T) {
+	p := newPauseControl(logtesting.TestLogger(t))
+	s := &statusTracker{pause: p}
+
+	port := freePort(t)
+
+	stop, err := startHealthServer(logtesting.TestLogger(t), port, func() bool { return true }, s, p)
+	require.NoError(t, err)
+	defer stop()
+
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(baseURL + healthEndpointPath)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	resp, err := http.Get(baseURL + pauseEndpointPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.False(t, p.isPaused())
+
+	post := func(path string) bool {
+		t.Helper()
+		resp, err := http.Post(baseURL+path, "", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var st struct{ Paused bool }
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+		return st.Paused
+	}
+
+	assert.True(t, post(pauseEndpointPath))
+	assert.True(t, p.isPaused())
+	assert.True(t, post(debugStatusEndpointPath), "Expected the status to report the paused state")
+
+	assert.False(t, post(resumeEndpointPath))
+	assert.False(t, p.isPaused())
+}
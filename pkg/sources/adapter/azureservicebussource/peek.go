@@ -0,0 +1,164 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// Peek writes to w the next count messages of the Service Bus entity which
+// is configured in the environment of the adapter, without consuming them.
+// It is a diagnostic tool for operators, and is independent from the regular
+// operation of the adapter.
+//
+// Messages are written as JSON objects, one per line, in the same shape as
+// the data of the CloudEvents emitted by the adapter. Peeking doesn't lock
+// messages, so they remain available to the receivers of the entity.
+//
+// Session-enabled entities are not supported.
+//
+// Required permissions:
+//
+//	Microsoft.ServiceBus/namespaces/messages/receive/action
+func Peek(ctx context.Context, count int, w io.Writer) error {
+	if count < 1 {
+		return fmt.Errorf("the number of messages to peek at must be at least 1, got %d", count)
+	}
+
+	env := &envConfig{}
+	if err := envconfig.Process("", env); err != nil {
+		return fmt.Errorf("reading configuration from the environment: %w", err)
+	}
+
+	if env.SessionEnabled {
+		return errors.New("peeking at messages of session-enabled entities is not supported")
+	}
+
+	entityID, err := peekEntityID(env)
+	if err != nil {
+		return err
+	}
+
+	var proxyURL *url.URL
+	if env.ProxyURL != "" {
+		if proxyURL, err = url.Parse(env.ProxyURL); err != nil {
+			return fmt.Errorf("parsing proxy URL: %w", err)
+		}
+	}
+
+	client, err := azureservicebus.ClientFromEnvironment(entityID, newAzureServiceBusClientOptions(
+		webSocketsClientOption(env.WebSocketsEnable || env.UseWebSockets, proxyURL, env.TCPKeepAlive),
+		connectTimeoutClientOption(env.ConnectTimeout)))
+	if err != nil {
+		return fmt.Errorf("obtaining interface for Service Bus Namespace: %w", err)
+	}
+	defer func() { _ = client.Close(ctx) }()
+
+	var rcvrOpts *azservicebus.ReceiverOptions
+	if subQueue := receiverSubQueue(env); subQueue != 0 {
+		rcvrOpts = &azservicebus.ReceiverOptions{
+			SubQueue: subQueue,
+		}
+	}
+
+	var rcvr *azservicebus.Receiver
+	switch entityID.ResourceType {
+	case azureservicebus.ResourceTypeQueues:
+		rcvr, err = client.NewReceiverForQueue(entityID.ResourceName, rcvrOpts)
+	case azureservicebus.ResourceTypeSubscriptions, azureservicebus.ResourceTypeTopics:
+		rcvr, err = client.NewReceiverForSubscription(entityID.ResourceName, entityID.SubResourceName, rcvrOpts)
+	default:
+		return fmt.Errorf("unsupported Service Bus entity type %q", entityID.ResourceType)
+	}
+	if err != nil {
+		return fmt.Errorf("obtaining message receiver for Service Bus entity: %w", err)
+	}
+	defer func() { _ = rcvr.Close(ctx) }()
+
+	return peekMessages(ctx, rcvr, count, w)
+}
+
+// peekEntityID returns the ID of the single Service Bus entity configured in
+// the given environment.
+func peekEntityID(env *envConfig) (*v1alpha1.AzureResourceID, error) {
+	entityIDStrs := splitEntityResourceIDs(env.EntityResourceID)
+
+	switch len(entityIDStrs) {
+	case 0:
+		entityID, _, err := entityFromConnectionString()
+		if err != nil {
+			return nil, fmt.Errorf("either %s or a connection string which contains an EntityPath must be set: %w",
+				envEntityResourceID, err)
+		}
+		return entityID, nil
+
+	case 1:
+		entityID, err := azureservicebus.ParseResourceID(entityIDStrs[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing entity ID %q: %w", entityIDStrs[0], err)
+		}
+		return entityID, nil
+
+	default:
+		return nil, fmt.Errorf("messages can only be peeked at from a single entity at a time, got %d entity IDs",
+			len(entityIDStrs))
+	}
+}
+
+// peekMessages writes to w up to count messages peeked at using p, as JSON
+// objects separated by newlines.
+func peekMessages(ctx context.Context, p messagePeeker, count int, w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	// The receiver keeps track of the last peeked message, so that
+	// successive peeks return successive messages.
+	for peeked := 0; peeked < count; {
+		msgs, err := p.PeekMessages(ctx, count-peeked, nil)
+		if err != nil {
+			return fmt.Errorf("peeking at messages from the Service Bus entity: %w", wrapPermissionError(err))
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		for _, m := range msgs {
+			msg, err := toMessage(m)
+			if err != nil {
+				return fmt.Errorf("reading message with ID %s: %w", m.MessageID, err)
+			}
+			if err := enc.Encode(toCloudEventData(msg)); err != nil {
+				return fmt.Errorf("writing message with ID %s: %w", m.MessageID, err)
+			}
+		}
+
+		peeked += len(msgs)
+	}
+
+	return nil
+}
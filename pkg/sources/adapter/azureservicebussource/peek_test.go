@@ -0,0 +1,153 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestPeekMessages(t *testing.T) {
+	testCases := []struct {
+		name        string
+		numMessages int
+		count       int
+		peekErr     error
+		expectIDs   []string
+		expectErr   bool
+	}{
+		{
+			name:        "More messages than requested",
+			numMessages: 5,
+			count:       3,
+			expectIDs:   []string{"0", "1", "2"},
+		},
+		{
+			name:        "Fewer messages than requested",
+			numMessages: 3,
+			count:       10,
+			expectIDs:   []string{"0", "1", "2"},
+		},
+		{
+			name:        "Empty entity",
+			numMessages: 0,
+			count:       10,
+			expectIDs:   nil,
+		},
+		{
+			name:      "Peek fails",
+			count:     10,
+			peekErr:   errors.New("connection lost"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &pagingPeeker{pageSize: 2, err: tc.peekErr}
+			for i := 0; i < tc.numMessages; i++ {
+				p.msgs = append(p.msgs, newSequencedMessage(strconv.Itoa(i), int64(i)))
+			}
+
+			var out bytes.Buffer
+			err := peekMessages(context.Background(), p, tc.count, &out)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var ids []string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var m struct {
+					MessageID string
+					Body      json.RawMessage
+				}
+				require.NoError(t, json.Unmarshal([]byte(line), &m))
+				assert.JSONEq(t, `{"test": null}`, string(m.Body))
+				ids = append(ids, m.MessageID)
+			}
+			assert.Equal(t, tc.expectIDs, ids)
+		})
+	}
+}
+
+func TestPeekEntityID(t *testing.T) {
+	const queueID = "/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q"
+
+	t.Run("Single entity", func(t *testing.T) {
+		entityID, err := peekEntityID(&envConfig{EntityResourceID: queueID})
+		require.NoError(t, err)
+		assert.Equal(t, queueID, entityID.String())
+	})
+
+	t.Run("Multiple entities", func(t *testing.T) {
+		_, err := peekEntityID(&envConfig{EntityResourceID: queueID + "," + queueID + "2"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid entity ID", func(t *testing.T) {
+		_, err := peekEntityID(&envConfig{EntityResourceID: "not-an-id"})
+		assert.Error(t, err)
+	})
+}
+
+// pagingPeeker is a messagePeeker which returns messages in pages of limited
+// size, and keeps track of the last peeked message like azservicebus.Receiver.
+type pagingPeeker struct {
+	msgs     []*azservicebus.ReceivedMessage
+	pageSize int
+	err      error
+
+	next int
+}
+
+var _ messagePeeker = (*pagingPeeker)(nil)
+
+// PeekMessages implements messagePeeker.
+func (p *pagingPeeker) PeekMessages(_ context.Context, maxMessages int,
+	_ *azservicebus.PeekMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	n := maxMessages
+	if n > p.pageSize {
+		n = p.pageSize
+	}
+	if rest := len(p.msgs) - p.next; n > rest {
+		n = rest
+	}
+
+	msgs := p.msgs[p.next : p.next+n]
+	p.next += n
+	return msgs, nil
+}
@@ -17,10 +17,20 @@ limitations under the License.
 package azureservicebussource
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding/spec"
+	"github.com/cloudevents/sdk-go/v2/extensions"
+	"go.uber.org/zap"
 
 	"github.com/Azure/azure-amqp-common-go/v3/uuid"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -30,6 +40,107 @@ import (
 	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
 )
 
+// Names of the CloudEvent extension attributes which carry system properties
+// of Service Bus messages.
+const (
+	extCorrelationID   = "sbcorrelationid"
+	extSessionID       = "sbsessionid"
+	extTo              = "sbto"
+	extReplyTo         = "sbreplyto"
+	extReplyToSession  = "sbreplytosessionid"
+	extDeliveryCount   = "sbdeliverycount"
+	extSequenceNumber  = "sbsequencenumber"
+	extScheduledTime   = "sbscheduledenqueuetime"
+	extExpiryTime      = "sbexpirytime"
+	extPartitionKey    = "sbpartitionkey"
+	extViaPartitionKey = "sbviapartitionkey"
+
+	// Properties of messages received from dead-letter queues.
+	extDeadLetterReason      = "sbdeadletterreason"
+	extDeadLetterDescription = "sbdeadletterdescription"
+	extDeadLetterSource      = "sbdeadlettersource"
+
+	// Sub-queue of the Service Bus entity messages are received from, which
+	// tells dead-lettered messages apart from messages which failed to be
+	// auto-forwarded.
+	extSubQueue = "sbsubqueue"
+
+	// Resource ID of the Service Bus entity, when it isn't already conveyed
+	// by the "source" attribute.
+	extResourceID = "sbresourceid"
+
+	// ID of the message which the elements of a JSON array body were
+	// exploded from, shared by all the resulting CloudEvents.
+	extOriginalMessageID = "sboriginalmessageid"
+
+	// Kubernetes identity of the source which produced the CloudEvent.
+	extSourceIdentity = "tmsource"
+
+	// Azure subscription and resource group of the Service Bus entity.
+	extAzureSubscription = "sbazuresubscription"
+	extResourceGroup     = "sbresourcegroup"
+
+	// Number of entities the message was auto-forwarded through, and
+	// whether it traversed the consumed entity more times than allowed
+	// (see hopLimit).
+	extHops             = "sbhops"
+	extHopLimitExceeded = "sbhoplimitexceeded"
+
+	// Partition key of the CloudEvent, as defined by the CloudEvents
+	// partitioning extension.
+	extCEPartitionKey = "partitionkey"
+
+	// Suffix of the name of the companion attribute which indicates how
+	// the value of an extension attribute was encoded, when it carries an
+	// application property which isn't a scalar (see encodePropertyValue).
+	extEncodingSuffix = "encoding"
+)
+
+// Encodings of application properties which don't have a scalar value.
+const (
+	propertyEncodingJSON = "json"
+)
+
+// Sources of the "id" attribute of CloudEvents.
+const (
+	ceIDSourceMessageID      = "message-id"
+	ceIDSourceUUID           = "uuid"
+	ceIDSourceSequenceNumber = "sequence-number"
+)
+
+// Sources of the "time" attribute of CloudEvents.
+const (
+	ceTimeSourceEnqueuedTime = "enqueued-time"
+	ceTimeSourceNow          = "now"
+)
+
+// Sources of the "subject" attribute of CloudEvents.
+const (
+	ceSubjectSourceNone           = "none"
+	ceSubjectSourceMessageSubject = "message-subject"
+	ceSubjectSourceEntityPath     = "entity-path"
+)
+
+// Encodings of the data of CloudEvents for binary message bodies.
+const (
+	binaryEncodingPassthrough = "passthrough"
+	binaryEncodingBase64      = "base64"
+)
+
+// isSupportedBinaryEncoding returns whether the given binary encoding is
+// supported. An empty value denotes the default behaviour.
+func isSupportedBinaryEncoding(enc string) bool {
+	switch enc {
+	case "", binaryEncodingPassthrough, binaryEncodingBase64:
+		return true
+	}
+	return false
+}
+
+// Annotation of AMQP messages which carries the ViaPartitionKey of Service Bus
+// messages.
+const annotationViaPartitionKey = "x-opt-via-partition-key"
+
 // MessageProcessor converts an Service Bus message to a CloudEvent.
 type MessageProcessor interface {
 	Process(*Message) ([]*cloudevents.Event, error)
@@ -38,40 +149,829 @@ type MessageProcessor interface {
 var _ MessageProcessor = (*defaultMessageProcessor)(nil)
 
 // defaultMessageProcessor is the default processor for Service Bus messages.
+//
+// The following system properties of messages are propagated as CloudEvent
+// attributes when they are set:
+//
+//	EnqueuedTime              -> time (falls back to ScheduledEnqueueTime)
+//	CorrelationID             -> sbcorrelationid
+//	SessionID                 -> sbsessionid
+//	To                        -> sbto
+//	ReplyTo                   -> sbreplyto
+//	ReplyToSessionID          -> sbreplytosessionid
+//	DeliveryCount             -> sbdeliverycount
+//	SequenceNumber            -> sbsequencenumber
+//	ScheduledEnqueueTime      -> sbscheduledenqueuetime (RFC 3339)
+//	EnqueuedTime + TimeToLive -> sbexpirytime (RFC 3339)
+//	PartitionKey              -> sbpartitionkey
+//	ViaPartitionKey           -> sbviapartitionkey
+//
+// Messages received from a dead-letter queue additionally carry the following
+// properties:
+//
+//	DeadLetterReason           -> sbdeadletterreason
+//	DeadLetterErrorDescription -> sbdeadletterdescription
+//	DeadLetterSource           -> sbdeadlettersource
+//
+// along with the name of that queue, as sbsubqueue: "deadletter" for the
+// dead-letter queue, or "transferdeadletter" for the transfer dead-letter
+// queue, in which case the properties above describe the failure to
+// auto-forward the message.
+//
+// Message annotations set by the broker are propagated when they are
+// explicitly allowed, as "sb<name>" where <name> is the normalized name of the
+// annotation without its "x-opt-" prefix (e.g. x-opt-enqueued-time ->
+// sbenqueuedtime).
+//
+// Messages whose ContentType is set to a non-JSON media type (e.g.
+// "application/xml") are sent as CloudEvents with this content type and the
+// message body as data. Other messages are sent as a JSON representation of
+// the Service Bus message.
+//
+// When a type prefix is configured, the Subject of messages determines the
+// CloudEvent type, as "<prefix>.<subject>".
+//
+// The W3C trace context found in the "traceparent" (or "Diagnostic-Id") and
+// "tracestate" application properties of messages is propagated using the
+// CloudEvents distributed tracing extension.
+//
+// When exploding of JSON arrays is enabled, messages whose body is a JSON
+// array yield one CloudEvent per element of the array, each of which is
+// processed as if it was the body of the message. The IDs of these
+// CloudEvents are suffixed with the index of the element, and the ID of the
+// original message is set as the "sboriginalmessageid" extension attribute.
+// Messages whose body is an empty JSON array yield no CloudEvent.
 type defaultMessageProcessor struct {
 	ceSource string
+
+	// Resource ID of the Service Bus entity, set as the "sbresourceid"
+	// extension attribute when not empty.
+	resourceIDExt string
+
+	// Name of the sub-queue of the Service Bus entity messages are
+	// received from, set as the "sbsubqueue" extension attribute when not
+	// empty.
+	subQueueExt string
+
+	// When not empty, the "type" attribute of CloudEvents is derived from
+	// the subject (label) of messages as "<ceTypePrefix>.<subject>".
+	ceTypePrefix string
+
+	// Whether the application properties of messages are propagated as
+	// CloudEvent extension attributes.
+	propsAsExtensions bool
+	// Names of extension attributes which specific application properties
+	// are propagated as, instead of their normalized name.
+	propMapping map[string]string
+
+	// Names of extension attributes which selected annotations of messages
+	// are propagated as, indexed by annotation name.
+	annotationExts map[string]string
+
+	// Source of the "id" attribute of CloudEvents. Either the ID of
+	// messages (default), a generated UUID, or the sequence number of
+	// messages qualified with entityPath. A UUID is also generated for
+	// messages which don't have an ID.
+	ceIDSource string
+
+	// Encoding of binary message bodies. When empty, binary bodies are
+	// embedded in the JSON representation of messages.
+	binaryEncoding string
+
+	// Source of the "time" attribute of CloudEvents. Either the enqueued
+	// time of messages (default), or the time at which they are
+	// processed. The processing time is also used for messages which
+	// don't have an enqueued time.
+	ceTimeSource string
+
+	// Clock used to determine the processing time of messages, and to
+	// tolerate enqueued times slightly in the future because of clock
+	// skew.
+	clock *messageClock
+
+	// Source of the "subject" attribute of CloudEvents. Either the
+	// subject (label) of messages, falling back to entityPath when it is
+	// not set, or entityPath. The attribute is not set when empty.
+	ceSubjectSource string
+	// When set, selects the "subject" attribute of CloudEvents in the
+	// JSON body of messages. Takes precedence over ceSubjectSource for
+	// messages whose body contains the selected value.
+	ceSubjectPath jsonPath
+	// Path of the Service Bus entity messages are received from.
+	entityPath string
+
+	// When not empty, the "dataschema" attribute of CloudEvents.
+	ceDataSchema string
+	// When not empty, overrides the "datacontenttype" attribute of
+	// CloudEvents.
+	ceDataContentType string
+
+	// When not empty, the version of the CloudEvents specification which
+	// CloudEvents are converted to, e.g. "0.3".
+	ceSpecVersion string
+
+	// Optional transformation of JSON message bodies, applied before they
+	// become the data of CloudEvents.
+	bodyTransform *bodyTransform
+
+	// When set, determines the "partitionkey" extension attribute of
+	// CloudEvents.
+	partitionKey *partitionKeyExtractor
+
+	// Whether messages whose body is a JSON array yield one CloudEvent per
+	// element of the array.
+	explodeJSONArray bool
+
+	// Optional logger.
+	logger *zap.SugaredLogger
 }
 
 // Process implements MessageProcessor.
 func (p *defaultMessageProcessor) Process(msg *Message) ([]*cloudevents.Event, error) {
-	event, err := makeServiceBusEvent(msg, p.ceSource)
+	if p.explodeJSONArray {
+		if elems, ok := jsonArrayElements(msg); ok {
+			return p.processArrayElements(msg, elems)
+		}
+	}
+
+	event, err := p.processMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return []*cloudevents.Event{event}, nil
+}
+
+// processArrayElements returns one CloudEvent per element of the JSON array
+// body of the given message.
+func (p *defaultMessageProcessor) processArrayElements(msg *Message, elems []json.RawMessage) ([]*cloudevents.Event, error) {
+	events := make([]*cloudevents.Event, 0, len(elems))
+
+	for i, elem := range elems {
+		rcvMsg := *msg.ReceivedMessage
+		rcvMsg.Body = elem
+		elemMsg := *msg
+		elemMsg.ReceivedMessage = &rcvMsg
+
+		event, err := p.processMessage(&elemMsg)
+		if err != nil {
+			return nil, fmt.Errorf("processing element %d of JSON array: %w", i, err)
+		}
+
+		if id := msg.ReceivedMessage.MessageID; id != "" {
+			if event.ID() == id {
+				event.SetID(id + "-" + strconv.Itoa(i))
+			}
+			event.SetExtension(extOriginalMessageID, id)
+		}
+		if p.ceIDSource == ceIDSourceSequenceNumber && msg.SequenceNumber != nil {
+			event.SetID(event.ID() + "-" + strconv.Itoa(i))
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// sequenceNumberID returns a CloudEvent ID which uniquely and durably
+// identifies the message with the given sequence number in the Service Bus
+// entity at the given path. Sequence numbers are assigned by Service Bus and
+// never change, so this ID is stable across redeliveries of a message.
+func sequenceNumberID(entityPath string, seqNum int64) string {
+	return entityPath + "/" + strconv.FormatInt(seqNum, 10)
+}
+
+// jsonArrayElements returns the elements of the body of the given message if
+// this body is a JSON array.
+func jsonArrayElements(msg *Message) ([]json.RawMessage, bool) {
+	if ct := contentType(msg); ct != "" && !isJSONContentType(ct) {
+		return nil, false
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(msg.Body, &elems); err != nil || elems == nil {
+		return nil, false
+	}
+	return elems, true
+}
+
+// processMessage returns a CloudEvent for the given message.
+func (p *defaultMessageProcessor) processMessage(msg *Message) (*cloudevents.Event, error) {
+	if p.bodyTransform != nil {
+		body, err := p.bodyTransform.apply(msg)
+		if err != nil {
+			return nil, fmt.Errorf("transforming message body: %w", err)
+		}
+
+		rcvMsg := *msg.ReceivedMessage
+		rcvMsg.Body = body
+		transformed := *msg
+		transformed.ReceivedMessage = &rcvMsg
+		msg = &transformed
+	}
+
+	event, err := makeServiceBusEvent(msg, p.ceSource, p.eventType(msg))
 	if err != nil {
 		return nil, fmt.Errorf("creating CloudEvent from Service Bus message: %w", err)
 	}
 
-	return []*cloudevents.Event{event}, nil
+	if p.binaryEncoding != "" && isBinaryBody(msg) {
+		if err := event.SetData("application/octet-stream", msg.Body); err != nil {
+			return nil, fmt.Errorf("setting CloudEvent data: %w", err)
+		}
+		event.DataBase64 = p.binaryEncoding == binaryEncodingBase64
+	}
+
+	switch {
+	case p.ceIDSource == ceIDSourceSequenceNumber && msg.SequenceNumber != nil:
+		event.SetID(sequenceNumberID(p.entityPath, *msg.SequenceNumber))
+	case p.ceIDSource == ceIDSourceUUID || msg.ReceivedMessage.MessageID == "":
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, fmt.Errorf("generating CloudEvent ID: %w", err)
+		}
+		event.SetID(id.String())
+	}
+
+	switch {
+	case p.ceTimeSource == ceTimeSourceNow:
+		event.SetTime(p.clock.Now())
+	case event.Time().IsZero():
+		if p.logger != nil {
+			p.logger.Debugw("Message has no enqueued time, using the current time as the event time",
+				zap.String(logfieldMsgID, msg.ReceivedMessage.MessageID))
+		}
+		event.SetTime(p.clock.Now())
+	default:
+		event.SetTime(p.clock.notAfterNow(event.Time()))
+	}
+
+	if subject := p.eventSubject(msg); subject != "" {
+		event.SetSubject(subject)
+	}
+
+	if p.ceDataSchema != "" {
+		event.SetDataSchema(p.ceDataSchema)
+	}
+
+	if p.ceDataContentType != "" {
+		event.SetDataContentType(p.ceDataContentType)
+	}
+
+	if p.partitionKey != nil {
+		if key := p.partitionKey.extract(msg); key != "" {
+			event.SetExtension(extCEPartitionKey, key)
+		}
+	}
+
+	if p.resourceIDExt != "" {
+		event.SetExtension(extResourceID, p.resourceIDExt)
+	}
+
+	if p.subQueueExt != "" {
+		event.SetExtension(extSubQueue, p.subQueueExt)
+	}
+
+	if p.propsAsExtensions {
+		setPropertiesExtensions(event, msg.ApplicationProperties, p.propMapping)
+	}
+
+	if len(p.annotationExts) != 0 {
+		setAnnotationsExtensions(event, msg, p.annotationExts)
+	}
+
+	setTraceContextExtensions(event, msg)
+
+	if p.ceSpecVersion != "" && p.ceSpecVersion != event.SpecVersion() {
+		event.SetSpecVersion(p.ceSpecVersion)
+	}
+
+	return event, nil
 }
 
-// makeServiceBusEvent returns a CloudEvent for a generic Service Bus message.
-func makeServiceBusEvent(msg *Message, srcAttr string) (*cloudevents.Event, error) {
-	ceData := toCloudEventData(msg)
+// eventType returns the CloudEvent type for the given message.
+func (p *defaultMessageProcessor) eventType(msg *Message) string {
+	if p.ceTypePrefix != "" && msg.Subject != nil && *msg.Subject != "" {
+		return p.ceTypePrefix + "." + *msg.Subject
+	}
+	return v1alpha1.AzureEventType(sources.AzureServiceServiceBus, v1alpha1.AzureServiceBusGenericEventType)
+}
+
+// eventSubject returns the CloudEvent subject for the given message, or an
+// empty string if the subject shouldn't be set.
+func (p *defaultMessageProcessor) eventSubject(msg *Message) string {
+	if p.ceSubjectPath != nil {
+		if subject := p.bodySubject(msg); subject != "" {
+			return subject
+		}
+	}
+
+	switch p.ceSubjectSource {
+	case ceSubjectSourceMessageSubject:
+		if msg.Subject != nil && *msg.Subject != "" {
+			return *msg.Subject
+		}
+		return p.entityPath
+	case ceSubjectSourceEntityPath:
+		return p.entityPath
+	default:
+		return ""
+	}
+}
+
+// bodySubject returns the value selected by ceSubjectPath in the JSON body of
+// the given message, formatted like the value of an application property
+// (see encodePropertyValue), or an empty string if the body isn't JSON or
+// has no such value.
+func (p *defaultMessageProcessor) bodySubject(msg *Message) string {
+	if ct := contentType(msg); ct != "" && !isJSONContentType(ct) {
+		return ""
+	}
+
+	v, ok := p.ceSubjectPath.lookup(msg.Body)
+	if !ok {
+		return ""
+	}
+
+	subject, _ := encodePropertyValue(v)
+	return subject
+}
+
+var _ MessageProcessor = (*rawMessageProcessor)(nil)
+
+// rawMessageProcessor is a processor which sends the body of Service Bus
+// messages as is, instead of a JSON representation of the whole message.
+//
+// The data content type of CloudEvents is the ContentType of messages when it
+// is set. Otherwise, it is "application/json" for bodies which contain JSON
+// data, and "application/octet-stream" for all other bodies.
+//
+// System properties of messages are propagated as CloudEvent attributes the
+// same way as with the default processor.
+type rawMessageProcessor struct {
+	ceSource string
+}
 
+// Process implements MessageProcessor.
+func (p *rawMessageProcessor) Process(msg *Message) ([]*cloudevents.Event, error) {
 	event := cloudevents.NewEvent()
 	event.SetID(msg.ReceivedMessage.MessageID)
-	event.SetSource(srcAttr)
+	event.SetSource(p.ceSource)
 	event.SetType(v1alpha1.AzureEventType(sources.AzureServiceServiceBus, v1alpha1.AzureServiceBusGenericEventType))
 
-	if msg.ScheduledEnqueueTime != nil {
+	if msg.ReceivedMessage.MessageID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, fmt.Errorf("generating CloudEvent ID: %w", err)
+		}
+		event.SetID(id.String())
+	}
+
+	switch {
+	case msg.EnqueuedTime != nil:
+		event.SetTime(*msg.EnqueuedTime)
+	case msg.ScheduledEnqueueTime != nil:
 		event.SetTime(*msg.ScheduledEnqueueTime)
 	}
 
-	if err := event.SetData(cloudevents.ApplicationJSON, ceData); err != nil {
+	setSystemPropertiesExtensions(&event, msg)
+	setTraceContextExtensions(&event, msg)
+
+	ct := contentType(msg)
+	if ct == "" {
+		ct = "application/octet-stream"
+		if json.Valid(msg.Body) {
+			ct = cloudevents.ApplicationJSON
+		}
+	}
+
+	if err := event.SetData(ct, msg.Body); err != nil {
+		return nil, fmt.Errorf("setting CloudEvent data: %w", err)
+	}
+
+	return []*cloudevents.Event{&event}, nil
+}
+
+// makeServiceBusEvent returns a CloudEvent for a generic Service Bus message.
+//
+// Messages which declare a content type other than JSON are sent as is, with
+// that content type. All other messages are wrapped in a JSON representation
+// of the Service Bus message, in which the body is structured if it contains
+// JSON data.
+func makeServiceBusEvent(msg *Message, srcAttr, typeAttr string) (*cloudevents.Event, error) {
+	event := cloudevents.NewEvent()
+	event.SetID(msg.ReceivedMessage.MessageID)
+	event.SetSource(srcAttr)
+	event.SetType(typeAttr)
+
+	switch {
+	case msg.EnqueuedTime != nil:
+		event.SetTime(*msg.EnqueuedTime)
+	case msg.ScheduledEnqueueTime != nil:
+		event.SetTime(*msg.ScheduledEnqueueTime)
+	}
+
+	setSystemPropertiesExtensions(&event, msg)
+
+	var err error
+	if ct := contentType(msg); ct != "" && !isJSONContentType(ct) {
+		err = event.SetData(ct, msg.Body)
+	} else {
+		err = event.SetData(cloudevents.ApplicationJSON, toCloudEventData(msg))
+	}
+	if err != nil {
 		return nil, fmt.Errorf("setting CloudEvent data: %w", err)
 	}
 
 	return &event, nil
 }
 
+// isBinaryBody returns whether the given message has a binary body, which is
+// neither JSON nor described by a content type.
+func isBinaryBody(msg *Message) bool {
+	return contentType(msg) == "" && !json.Valid(msg.Body)
+}
+
+// contentType returns the content type declared by the given message, if any.
+func contentType(msg *Message) string {
+	if msg.ContentType == nil {
+		return ""
+	}
+	return strings.TrimSpace(*msg.ContentType)
+}
+
+// isSupportedSpecVersion returns whether the given version of the CloudEvents
+// specification is supported by the CloudEvents SDK.
+func isSupportedSpecVersion(v string) bool {
+	return spec.VS.Version(v) != nil
+}
+
+// supportedSpecVersions returns the versions of the CloudEvents specification
+// supported by the CloudEvents SDK, most recent first.
+func supportedSpecVersions() []string {
+	versions := spec.VS.Versions()
+
+	names := make([]string, 0, len(versions))
+	for _, v := range versions {
+		names = append(names, v.String())
+	}
+	return names
+}
+
+// isJSONContentType returns whether the given content type denotes JSON data,
+// such as "application/json" or "application/cloudevents+json".
+func isJSONContentType(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || mediaType == "text/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// setSystemPropertiesExtensions sets the system properties of the given
+// Service Bus message as extension attributes of the given CloudEvent.
+func setSystemPropertiesExtensions(event *cloudevents.Event, msg *Message) {
+	if v := msg.CorrelationID; v != nil && *v != "" {
+		event.SetExtension(extCorrelationID, *v)
+	}
+	if v := msg.SessionID; v != nil && *v != "" {
+		event.SetExtension(extSessionID, *v)
+	}
+	if v := msg.To; v != nil && *v != "" {
+		event.SetExtension(extTo, *v)
+	}
+	if v := msg.ReplyTo; v != nil && *v != "" {
+		event.SetExtension(extReplyTo, *v)
+	}
+	if v := msg.ReplyToSessionID; v != nil && *v != "" {
+		event.SetExtension(extReplyToSession, *v)
+	}
+	if v := msg.PartitionKey; v != nil && *v != "" {
+		event.SetExtension(extPartitionKey, *v)
+	}
+	if v := msg.ViaPartitionKey; v != nil && *v != "" {
+		event.SetExtension(extViaPartitionKey, *v)
+	}
+
+	if v := msg.DeadLetterReason; v != nil && *v != "" {
+		event.SetExtension(extDeadLetterReason, *v)
+	}
+	if v := msg.DeadLetterErrorDescription; v != nil && *v != "" {
+		event.SetExtension(extDeadLetterDescription, *v)
+	}
+	if v := msg.DeadLetterSource; v != nil && *v != "" {
+		event.SetExtension(extDeadLetterSource, *v)
+	}
+
+	if v := msg.ScheduledEnqueueTime; v != nil && !v.IsZero() {
+		event.SetExtension(extScheduledTime, stringifyPropertyValue(*v))
+	}
+	if v := messageExpiry(msg.ReceivedMessage); v != nil {
+		event.SetExtension(extExpiryTime, stringifyPropertyValue(*v))
+	}
+
+	if v := msg.SequenceNumber; v != nil {
+		event.SetExtension(extSequenceNumber, strconv.FormatInt(*v, 10))
+	}
+
+	event.SetExtension(extDeliveryCount, strconv.FormatUint(uint64(msg.DeliveryCount), 10))
+}
+
+// setTraceContextExtensions sets the distributed tracing extension attributes
+// of the given CloudEvent from the trace context found in the application
+// properties of the given Service Bus message, if any.
+func setTraceContextExtensions(event *cloudevents.Event, msg *Message) {
+	kvs := newMessageCarrier(msg).GetKeyValues()
+
+	tp, ok := kvs[propTraceParent]
+	if !ok || tp == nil {
+		return
+	}
+
+	dt := extensions.DistributedTracingExtension{
+		TraceParent: stringifyPropertyValue(tp),
+	}
+	if ts, ok := kvs[propTraceState]; ok && ts != nil {
+		dt.TraceState = stringifyPropertyValue(ts)
+	}
+
+	dt.AddTracingAttributes(event)
+}
+
+// setPropertiesExtensions sets the given Service Bus application properties
+// as extension attributes of the given CloudEvent.
+//
+// Properties listed in the given mapping are set under the attribute name
+// they map to. The names of other properties are normalized to valid
+// CloudEvent attribute names (see extensionName). Properties which name can
+// not be normalized are ignored.
+//
+// When the names of multiple properties collide, mapped properties win over
+// unmapped ones, then the property which original name sorts first wins.
+// Unmapped properties which lose, or which normalized name collides with a
+// CloudEvent context attribute or an attribute that is already set, are set
+// under a disambiguated name instead (see disambiguatedExtensionName), e.g.
+// a property "Type" is set as "type" followed by a hash of "Type". Mapped
+// properties which name collides with an attribute that is already set are
+// ignored.
+//
+// Properties which value is a list or a map are encoded to JSON, and the
+// companion attribute "<name>encoding" is set to "json" so that consumers can
+// reconstruct the original value, e.g. a property "tags" with the value
+// ["a", "b"] results in the attributes
+//
+//	tags:         ["a","b"]
+//	tagsencoding: json
+//
+// Companion attributes are treated like regular attributes when names collide.
+func setPropertiesExtensions(event *cloudevents.Event, props map[string]interface{}, mapping map[string]string) {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		_, iMapped := mapping[keys[i]]
+		_, jMapped := mapping[keys[j]]
+		if iMapped != jMapped {
+			return iMapped
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		v := props[k]
+		if v == nil {
+			continue
+		}
+
+		name, mapped := mapping[k]
+		if !mapped {
+			name = extensionName(k)
+			if name != "" && isExtensionNameTaken(event, name) {
+				name = disambiguatedExtensionName(k)
+			}
+		}
+		if name == "" || isExtensionNameTaken(event, name) {
+			continue
+		}
+
+		val, encoding := encodePropertyValue(v)
+		event.SetExtension(name, val)
+
+		if encoding == "" {
+			continue
+		}
+		encName := name + extEncodingSuffix
+		if isExtensionNameTaken(event, encName) {
+			continue
+		}
+		event.SetExtension(encName, encoding)
+	}
+}
+
+// parseCEOverrides parses the given JSON object of CloudEvent extension
+// attribute names to string values.
+func parseCEOverrides(overrides string) (map[string]string, error) {
+	var exts map[string]string
+	if err := json.Unmarshal([]byte(overrides), &exts); err != nil {
+		return nil, fmt.Errorf("parsing CloudEvent overrides as a JSON object of strings: %w", err)
+	}
+
+	for name := range exts {
+		if !isValidExtensionName(name) {
+			return nil, fmt.Errorf("invalid CloudEvent extension attribute name %q: "+
+				"names must consist of lowercase ASCII letters and digits", name)
+		}
+		if isContextAttribute(name) {
+			return nil, fmt.Errorf("CloudEvent attribute %q is not an extension attribute", name)
+		}
+	}
+
+	return exts, nil
+}
+
+// sourceIdentity returns the Kubernetes identity of a source in the format
+// "namespace/name", or an empty string if either the namespace or the name of
+// the source is unknown.
+func sourceIdentity(namespace, name string) string {
+	if namespace == "" || name == "" {
+		return ""
+	}
+	return namespace + "/" + name
+}
+
+// azureScopeExtensions returns the extension attributes which convey the
+// Azure subscription and resource group of the given Service Bus entity.
+// Attributes which value is unknown, e.g. because the entity was identified
+// by a connection string, are omitted.
+func azureScopeExtensions(entityID *v1alpha1.AzureResourceID) map[string]string {
+	exts := make(map[string]string, 2)
+	if entityID.SubscriptionID != "" {
+		exts[extAzureSubscription] = entityID.SubscriptionID
+	}
+	if entityID.ResourceGroup != "" {
+		exts[extResourceGroup] = entityID.ResourceGroup
+	}
+	return exts
+}
+
+// parsePropertyMapping parses the given comma-separated list of
+// "property=attribute" pairs, which map the names of Service Bus application
+// properties to the names of the CloudEvent extension attributes they are
+// propagated as.
+func parsePropertyMapping(mapping string) (map[string]string, error) {
+	props := make(map[string]string)
+	attrs := make(map[string]string)
+
+	for _, pair := range strings.Split(mapping, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		prop, attr, ok := strings.Cut(pair, "=")
+		prop, attr = strings.TrimSpace(prop), strings.TrimSpace(attr)
+		if !ok || prop == "" || attr == "" {
+			return nil, fmt.Errorf("invalid property mapping %q: expected the format property=attribute", pair)
+		}
+
+		if !isValidExtensionName(attr) {
+			return nil, fmt.Errorf("invalid CloudEvent extension attribute name %q: "+
+				"names must consist of lowercase ASCII letters and digits", attr)
+		}
+		if isContextAttribute(attr) {
+			return nil, fmt.Errorf("CloudEvent attribute %q is not an extension attribute", attr)
+		}
+
+		if _, dup := props[prop]; dup {
+			return nil, fmt.Errorf("property %q is mapped more than once", prop)
+		}
+		if otherProp, dup := attrs[attr]; dup {
+			return nil, fmt.Errorf("properties %q and %q are both mapped to attribute %q", otherProp, prop, attr)
+		}
+
+		props[prop] = attr
+		attrs[attr] = prop
+	}
+
+	return props, nil
+}
+
+// isExtensionNameTaken returns whether the given attribute name is either
+// reserved for a context attribute or already set on the given CloudEvent.
+func isExtensionNameTaken(event *cloudevents.Event, name string) bool {
+	if isContextAttribute(name) {
+		return true
+	}
+	_, exists := event.Extensions()[name]
+	return exists
+}
+
+// isContextAttribute returns whether the given name is reserved by the
+// CloudEvents specification for a context attribute.
+func isContextAttribute(name string) bool {
+	switch name {
+	case "specversion", "id", "source", "type", "subject", "time",
+		"datacontenttype", "dataschema", "data", "data_base64":
+		return true
+	}
+	return false
+}
+
+// stringifyPropertyValue returns the string representation of the value of
+// a Service Bus application property.
+//
+// Byte slices are encoded to base64, timestamps are formatted according to
+// RFC 3339 in UTC, and all other values are formatted in their default
+// format (e.g. "true", "42", "4.2").
+func stringifyPropertyValue(v interface{}) string {
+	switch tv := v.(type) {
+	case string:
+		return tv
+	case []byte:
+		return base64.StdEncoding.EncodeToString(tv)
+	case time.Time:
+		return tv.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(tv)
+	}
+}
+
+// encodePropertyValue returns the string representation of the value of a
+// Service Bus application property, along with the encoding of that
+// representation.
+//
+// Lists and maps are encoded to JSON, in which case the returned encoding is
+// "json". Keys of maps which aren't strings are formatted in their default
+// format. The values of all other properties are stringified (see
+// stringifyPropertyValue), in which case the returned encoding is empty.
+func encodePropertyValue(v interface{}) (string, string) {
+	if _, isBytes := v.([]byte); isBytes || !isCompositeValue(reflect.ValueOf(v)) {
+		return stringifyPropertyValue(v), ""
+	}
+
+	b, err := json.Marshal(normalizeCompositeValue(reflect.ValueOf(v)))
+	if err != nil {
+		// Values decoded from AMQP messages are always serializable
+		// once normalized, fall back to the default format otherwise.
+		return stringifyPropertyValue(v), ""
+	}
+
+	return string(b), propertyEncodingJSON
+}
+
+// isCompositeValue returns whether the given value is a list or a map.
+func isCompositeValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// normalizeCompositeValue returns a copy of the given value in which maps are
+// converted to maps with string keys, so that it can be serialized to JSON.
+// Timestamps are formatted like in stringifyPropertyValue.
+func normalizeCompositeValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = normalizeCompositeValue(iter.Value())
+		}
+		return m
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface() // []byte, encoded to base64
+		}
+		l := make([]interface{}, v.Len())
+		for i := range l {
+			l[i] = normalizeCompositeValue(v.Index(i))
+		}
+		return l
+
+	default:
+		if !v.IsValid() {
+			return nil
+		}
+		if t, ok := v.Interface().(time.Time); ok {
+			return stringifyPropertyValue(t)
+		}
+		return v.Interface()
+	}
+}
+
 // toCloudEventData returns a servicebus.ReceivedMessage in a shape that is suitable for
 // JSON serialization inside some CloudEvent data.
 func toCloudEventData(msg *Message) interface{} {
@@ -98,6 +998,14 @@ func toCloudEventData(msg *Message) interface{} {
 type Message struct {
 	*azservicebus.ReceivedMessage
 	LockToken *string
+
+	// ViaPartitionKey isn't exposed by azservicebus.ReceivedMessage, it is
+	// read from the annotations of the raw AMQP message.
+	ViaPartitionKey *string `json:"-"`
+
+	// Annotations of the raw AMQP message, which aren't exposed by
+	// azservicebus.ReceivedMessage either.
+	Annotations map[string]interface{} `json:"-"`
 }
 
 // MessageWithRawJSONData is an ReceivedMessage with RawMessage-typed JSON data.
@@ -137,10 +1045,25 @@ func toMessage(rcvMsg *azservicebus.ReceivedMessage) (*Message, error) {
 			TimeToLive:                 rcvMsg.TimeToLive,
 			To:                         rcvMsg.To,
 		},
-		LockToken: stringifyLockToken((*uuid.UUID)(&rcvMsg.LockToken)),
+		LockToken:       stringifyLockToken((*uuid.UUID)(&rcvMsg.LockToken)),
+		ViaPartitionKey: viaPartitionKey(rcvMsg.RawAMQPMessage),
+		Annotations:     messageAnnotations(rcvMsg.RawAMQPMessage),
 	}, nil
 }
 
+// viaPartitionKey returns the value of the "x-opt-via-partition-key"
+// annotation of the given AMQP message, if any.
+func viaPartitionKey(amqpMsg *azservicebus.AMQPAnnotatedMessage) *string {
+	if amqpMsg == nil {
+		return nil
+	}
+
+	if v, ok := amqpMsg.MessageAnnotations[annotationViaPartitionKey].(string); ok {
+		return &v
+	}
+	return nil
+}
+
 // stringifyLockToken converts a UUID byte-array into its string representation.
 func stringifyLockToken(id *uuid.UUID) *string {
 	if id == nil {
@@ -17,14 +17,24 @@ limitations under the License.
 package azureservicebussource
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
 	"github.com/Azure/azure-amqp-common-go/v3/uuid"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	logtesting "knative.dev/pkg/logging/testing"
 )
 
 func TestProcessMessage(t *testing.T) {
@@ -65,6 +75,1332 @@ func TestProcessMessage(t *testing.T) {
 	assert.Equal(t, "00000000-0000-0000-0000-000000000000", lockToken, "LockToken should be stringified")
 }
 
+func TestProcessMessageApplicationProperties(t *testing.T) {
+	ts := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testData := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body:      sampleEvent,
+			MessageID: "someMessageID",
+			ApplicationProperties: map[string]interface{}{
+				"My-Routing_Key": "some/route",
+				"count":          int64(42),
+				"enabled":        true,
+				"ratio":          0.5,
+				"raw":            []byte("test"),
+				"ts":             ts,
+				"nothing":        nil,
+				"type":           "collides with a context attribute",
+				"-_-":            "can not be normalized",
+			},
+		},
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource:          "/some/source",
+			propsAsExtensions: true,
+		}
+		events, err := msgPrcsr.Process(testData)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		expectExts := map[string]interface{}{
+			"myroutingkey": "some/route",
+			"count":        "42",
+			"enabled":      "true",
+			"ratio":        "0.5",
+			"raw":          "dGVzdA==",
+			"ts":           "2022-01-02T03:04:05Z",
+			"type5127f14d": "collides with a context attribute",
+
+			"sbdeliverycount": "0",
+		}
+		assert.Equal(t, expectExts, events[0].Extensions())
+		assert.NoError(t, events[0].Validate())
+	})
+
+	t.Run("with mapping", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource:          "/some/source",
+			propsAsExtensions: true,
+			propMapping: map[string]string{
+				"My-Routing_Key": "route",
+				"type":           "kind",
+				"ratio":          "count",
+			},
+		}
+		events, err := msgPrcsr.Process(testData)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		expectExts := map[string]interface{}{
+			"route":   "some/route",
+			"kind":    "collides with a context attribute",
+			"count":   "0.5", // mapped property wins over the normalized name
+			"enabled": "true",
+			"raw":     "dGVzdA==",
+			"ts":      "2022-01-02T03:04:05Z",
+
+			"count39b1ddf4": "42",
+
+			"sbdeliverycount": "0",
+		}
+		assert.Equal(t, expectExts, events[0].Extensions())
+		assert.NoError(t, events[0].Validate())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource: "/some/source",
+		}
+		events, err := msgPrcsr.Process(testData)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		assert.Equal(t, map[string]interface{}{"sbdeliverycount": "0"}, events[0].Extensions())
+	})
+}
+
+func TestProcessMessageCompositeApplicationProperties(t *testing.T) {
+	ts := time.Date(2022, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+
+	testCases := []struct {
+		name        string
+		value       interface{}
+		expectValue string
+		expectRound interface{}
+	}{
+		{
+			name:        "List of strings",
+			value:       []string{"a", "b"},
+			expectValue: `["a","b"]`,
+			expectRound: []interface{}{"a", "b"},
+		},
+		{
+			name:        "Heterogeneous list",
+			value:       []interface{}{int32(1), "b", true, nil, ts},
+			expectValue: `[1,"b",true,null,"2022-01-02T02:04:05Z"]`,
+			expectRound: []interface{}{float64(1), "b", true, nil, "2022-01-02T02:04:05Z"},
+		},
+		{
+			name:        "Empty list",
+			value:       []int64{},
+			expectValue: `[]`,
+			expectRound: []interface{}{},
+		},
+		{
+			name:        "Map with non-string keys",
+			value:       map[interface{}]interface{}{int64(1): "one", "two": []byte("2")},
+			expectValue: `{"1":"one","two":"Mg=="}`,
+			expectRound: map[string]interface{}{"1": "one", "two": "Mg=="},
+		},
+		{
+			name:        "Nested values",
+			value:       map[string]interface{}{"tags": []string{"a"}, "meta": map[string]int{"n": 1}},
+			expectValue: `{"meta":{"n":1},"tags":["a"]}`,
+			expectRound: map[string]interface{}{"tags": []interface{}{"a"}, "meta": map[string]interface{}{"n": float64(1)}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:          "/some/source",
+				propsAsExtensions: true,
+			}
+
+			events, err := msgPrcsr.Process(&Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body: sampleEvent,
+					ApplicationProperties: map[string]interface{}{
+						"prop": tc.value,
+					},
+				},
+			})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			require.NoError(t, events[0].Validate())
+
+			exts := events[0].Extensions()
+			assert.Equal(t, tc.expectValue, exts["prop"])
+			assert.Equal(t, propertyEncodingJSON, exts["prop"+extEncodingSuffix])
+
+			var roundTrip interface{}
+			require.NoError(t, json.Unmarshal([]byte(exts["prop"].(string)), &roundTrip))
+			assert.Equal(t, tc.expectRound, roundTrip)
+		})
+	}
+
+	t.Run("Scalar values have no encoding", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource:          "/some/source",
+			propsAsExtensions: true,
+		}
+
+		events, err := msgPrcsr.Process(&Message{
+			ReceivedMessage: &azservicebus.ReceivedMessage{
+				Body: sampleEvent,
+				ApplicationProperties: map[string]interface{}{
+					"raw":  []byte("test"),
+					"text": "[1,2]",
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		exts := events[0].Extensions()
+		assert.Equal(t, "dGVzdA==", exts["raw"])
+		assert.Equal(t, "[1,2]", exts["text"])
+		assert.NotContains(t, exts, "raw"+extEncodingSuffix)
+		assert.NotContains(t, exts, "text"+extEncodingSuffix)
+	})
+
+	t.Run("Companion attribute collides with a property", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource:          "/some/source",
+			propsAsExtensions: true,
+		}
+
+		events, err := msgPrcsr.Process(&Message{
+			ReceivedMessage: &azservicebus.ReceivedMessage{
+				Body: sampleEvent,
+				ApplicationProperties: map[string]interface{}{
+					"tags":         []string{"a"},
+					"tagsencoding": "some value",
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		exts := events[0].Extensions()
+		assert.Equal(t, `["a"]`, exts["tags"])
+		assert.Equal(t, propertyEncodingJSON, exts["tagsencoding"],
+			"The companion attribute should win over the property which name sorts last")
+	})
+}
+
+func TestProcessMessageSystemProperties(t *testing.T) {
+	enqueuedTime := time.Unix(1, 0)
+	scheduledTime := time.Unix(0, 0)
+
+	testCases := []struct {
+		name            string
+		msg             *azservicebus.ReceivedMessage
+		viaPartitionKey *string
+		expectTime      time.Time
+		expectExts      map[string]interface{}
+	}{
+		{
+			name: "All properties set",
+			msg: &azservicebus.ReceivedMessage{
+				CorrelationID:        to.Ptr("some-correlation-id"),
+				SessionID:            to.Ptr("some-session-id"),
+				To:                   to.Ptr("some-entity"),
+				ReplyTo:              to.Ptr("some-queue"),
+				ReplyToSessionID:     to.Ptr("some-reply-session-id"),
+				PartitionKey:         to.Ptr("some-partition-key"),
+				DeliveryCount:        3,
+				SequenceNumber:       to.Ptr(int64(42)),
+				EnqueuedTime:         &enqueuedTime,
+				ScheduledEnqueueTime: &scheduledTime,
+				TimeToLive:           to.Ptr(time.Hour),
+			},
+			viaPartitionKey: to.Ptr("some-via-partition-key"),
+			expectTime:      enqueuedTime,
+			expectExts: map[string]interface{}{
+				"sbcorrelationid":        "some-correlation-id",
+				"sbsessionid":            "some-session-id",
+				"sbto":                   "some-entity",
+				"sbreplyto":              "some-queue",
+				"sbreplytosessionid":     "some-reply-session-id",
+				"sbpartitionkey":         "some-partition-key",
+				"sbviapartitionkey":      "some-via-partition-key",
+				"sbdeliverycount":        "3",
+				"sbsequencenumber":       "42",
+				"sbscheduledenqueuetime": "1970-01-01T00:00:00Z",
+				"sbexpirytime":           "1970-01-01T01:00:01Z",
+			},
+		},
+		{
+			name: "Time to live set",
+			msg: &azservicebus.ReceivedMessage{
+				DeliveryCount: 1,
+				EnqueuedTime:  &enqueuedTime,
+				TimeToLive:    to.Ptr(30 * time.Second),
+			},
+			expectTime: enqueuedTime,
+			expectExts: map[string]interface{}{
+				"sbdeliverycount": "1",
+				"sbexpirytime":    "1970-01-01T00:00:31Z",
+			},
+		},
+		{
+			name: "Time to live set without enqueued time",
+			msg: &azservicebus.ReceivedMessage{
+				DeliveryCount:        1,
+				ScheduledEnqueueTime: &scheduledTime,
+				TimeToLive:           to.Ptr(30 * time.Second),
+			},
+			expectTime: scheduledTime,
+			expectExts: map[string]interface{}{
+				"sbdeliverycount":        "1",
+				"sbscheduledenqueuetime": "1970-01-01T00:00:00Z",
+			},
+		},
+		{
+			name: "Only scheduled enqueue time set",
+			msg: &azservicebus.ReceivedMessage{
+				DeliveryCount:        1,
+				ScheduledEnqueueTime: &scheduledTime,
+			},
+			expectTime: scheduledTime,
+			expectExts: map[string]interface{}{
+				"sbdeliverycount":        "1",
+				"sbscheduledenqueuetime": "1970-01-01T00:00:00Z",
+			},
+		},
+		{
+			name: "Dead-lettered message",
+			msg: &azservicebus.ReceivedMessage{
+				DeliveryCount:              1,
+				EnqueuedTime:               &enqueuedTime,
+				DeadLetterReason:           to.Ptr("MaxDeliveryCountExceeded"),
+				DeadLetterErrorDescription: to.Ptr("Message could not be consumed after 10 delivery attempts."),
+				DeadLetterSource:           to.Ptr("some-queue"),
+			},
+			expectTime: enqueuedTime,
+			expectExts: map[string]interface{}{
+				"sbdeliverycount":         "1",
+				"sbdeadletterreason":      "MaxDeliveryCountExceeded",
+				"sbdeadletterdescription": "Message could not be consumed after 10 delivery attempts.",
+				"sbdeadlettersource":      "some-queue",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.msg.Body = sampleEvent
+			tc.msg.MessageID = "someMessageID"
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource: "/some/source",
+			}
+			events, err := msgPrcsr.Process(&Message{ReceivedMessage: tc.msg, ViaPartitionKey: tc.viaPartitionKey})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expectTime, events[0].Time())
+			assert.Equal(t, tc.expectExts, events[0].Extensions())
+		})
+	}
+}
+
+func TestProcessMessageSubQueue(t *testing.T) {
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			MessageID:                  "someMessageID",
+			Body:                       sampleEvent,
+			DeliveryCount:              1,
+			DeadLetterReason:           to.Ptr("MaxTransferHopCountExceeded"),
+			DeadLetterErrorDescription: to.Ptr("The message exceeded the maximum number of forwarding hops."),
+		},
+	}
+
+	t.Run("Transfer dead-letter queue", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource:    "/some/source",
+			subQueueExt: subQueueNameTransferDeadLetter,
+		}
+		events, err := msgPrcsr.Process(msg)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		assert.Equal(t, map[string]interface{}{
+			"sbdeliverycount":         "1",
+			"sbdeadletterreason":      "MaxTransferHopCountExceeded",
+			"sbdeadletterdescription": "The message exceeded the maximum number of forwarding hops.",
+			"sbsubqueue":              "transferdeadletter",
+		}, events[0].Extensions())
+	})
+
+	t.Run("Entity", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource: "/some/source",
+		}
+		events, err := msgPrcsr.Process(msg)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		assert.NotContains(t, events[0].Extensions(), "sbsubqueue")
+	})
+}
+
+func TestProcessMessageContentType(t *testing.T) {
+	testCases := []struct {
+		name              string
+		contentType       *string
+		body              []byte
+		expectContentType string
+		expectRawData     []byte
+	}{
+		{
+			name:              "JSON content type",
+			contentType:       to.Ptr("application/json; charset=utf-8"),
+			body:              []byte(`{"msg":"hello"}`),
+			expectContentType: "application/json",
+		},
+		{
+			name:              "No content type and JSON body",
+			body:              []byte(`{"msg":"hello"}`),
+			expectContentType: "application/json",
+		},
+		{
+			name:              "No content type and non-JSON body",
+			body:              []byte("hello"),
+			expectContentType: "application/json",
+		},
+		{
+			name:              "XML content type",
+			contentType:       to.Ptr("application/xml"),
+			body:              []byte("<msg>hello</msg>"),
+			expectContentType: "application/xml",
+			expectRawData:     []byte("<msg>hello</msg>"),
+		},
+		{
+			name:              "Plain text content type with JSON-like body",
+			contentType:       to.Ptr("text/plain"),
+			body:              []byte(`"hello"`),
+			expectContentType: "text/plain",
+			expectRawData:     []byte(`"hello"`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID:   "someMessageID",
+					ContentType: tc.contentType,
+					Body:        tc.body,
+				},
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource: "/some/source",
+			}
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expectContentType, events[0].DataContentType())
+
+			if tc.expectRawData != nil {
+				assert.Equal(t, tc.expectRawData, events[0].Data())
+				return
+			}
+
+			eventData := make(map[string]interface{})
+			require.NoError(t, events[0].DataAs(&eventData))
+			assert.Contains(t, eventData, "Body", "Data should be a representation of the message")
+		})
+	}
+}
+
+func TestProcessMessageBinaryEncoding(t *testing.T) {
+	binaryBody := []byte{0x00, 0xff, 0xfe, 0x10, 0x80}
+
+	testCases := []struct {
+		name           string
+		encoding       string
+		expectBase64   bool
+		expectWrapping bool
+	}{
+		{
+			name:           "Default encoding",
+			expectWrapping: true,
+		},
+		{
+			name:     "Passthrough encoding",
+			encoding: binaryEncodingPassthrough,
+		},
+		{
+			name:         "Base64 encoding",
+			encoding:     binaryEncodingBase64,
+			expectBase64: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID: "someMessageID",
+					Body:      binaryBody,
+				},
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:       "/some/source",
+				binaryEncoding: tc.encoding,
+			}
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			ev := events[0]
+
+			if tc.expectWrapping {
+				assert.Equal(t, cloudevents.ApplicationJSON, ev.DataContentType())
+				eventData := make(map[string]interface{})
+				require.NoError(t, ev.DataAs(&eventData))
+				assert.Contains(t, eventData, "Body", "Data should be a representation of the message")
+				return
+			}
+
+			assert.Equal(t, "application/octet-stream", ev.DataContentType())
+			assert.Equal(t, tc.expectBase64, ev.DataBase64)
+
+			// binary content mode
+			req, err := http.NewRequest(http.MethodPost, "http://localhost", nil)
+			require.NoError(t, err)
+			require.NoError(t, cehttp.WriteRequest(context.Background(), binding.ToMessage(ev), req))
+
+			rcvEv, err := binding.ToEvent(context.Background(), cehttp.NewMessageFromHttpRequest(req))
+			require.NoError(t, err)
+			assert.Equal(t, binaryBody, rcvEv.Data(), "Data should round-trip in binary mode")
+
+			if !tc.expectBase64 {
+				return
+			}
+
+			// structured content mode
+			structured, err := json.Marshal(ev)
+			require.NoError(t, err)
+			assert.Contains(t, string(structured), `"data_base64"`)
+
+			rcvEv = &cloudevents.Event{}
+			require.NoError(t, json.Unmarshal(structured, rcvEv))
+			assert.Equal(t, binaryBody, rcvEv.Data(), "Data should round-trip in structured mode")
+		})
+	}
+}
+
+func TestRawMessageProcessor(t *testing.T) {
+	testCases := []struct {
+		name              string
+		contentType       *string
+		body              []byte
+		expectContentType string
+	}{
+		{
+			name:              "JSON body",
+			body:              []byte(`{"msg":"hello"}`),
+			expectContentType: "application/json",
+		},
+		{
+			name:              "Binary body",
+			body:              []byte{0xde, 0xad, 0xbe, 0xef},
+			expectContentType: "application/octet-stream",
+		},
+		{
+			name:              "Declared content type",
+			contentType:       to.Ptr("application/xml"),
+			body:              []byte("<msg>hello</msg>"),
+			expectContentType: "application/xml",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID:   "someMessageID",
+					ContentType: tc.contentType,
+					Body:        tc.body,
+				},
+			}
+
+			msgPrcsr := &rawMessageProcessor{
+				ceSource: "/some/source",
+			}
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, "someMessageID", events[0].ID())
+			assert.Equal(t, "/some/source", events[0].Source())
+			assert.Equal(t, tc.expectContentType, events[0].DataContentType())
+			assert.Equal(t, tc.body, events[0].Data(), "Data should be the message body")
+		})
+	}
+}
+
+func TestProcessMessageID(t *testing.T) {
+	testCases := []struct {
+		name        string
+		idSource    string
+		msgID       string
+		expectMsgID bool
+	}{
+		{
+			name:        "Message ID",
+			idSource:    ceIDSourceMessageID,
+			msgID:       "someMessageID",
+			expectMsgID: true,
+		},
+		{
+			name:     "Message ID is empty",
+			idSource: ceIDSourceMessageID,
+		},
+		{
+			name:     "Generated UUID",
+			idSource: ceIDSourceUUID,
+			msgID:    "someMessageID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID: tc.msgID,
+					Body:      sampleEvent,
+				},
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:   "/some/source",
+				ceIDSource: tc.idSource,
+			}
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			if tc.expectMsgID {
+				assert.Equal(t, tc.msgID, events[0].ID())
+				return
+			}
+
+			assert.Len(t, events[0].ID(), len(uuid.Nil.String()), "ID should be a UUID")
+			assert.NotEqual(t, tc.msgID, events[0].ID())
+			assert.NoError(t, events[0].Validate())
+		})
+	}
+}
+
+func TestProcessMessageSequenceNumberID(t *testing.T) {
+	msgPrcsr := &defaultMessageProcessor{
+		ceSource:   "/some/source",
+		ceIDSource: ceIDSourceSequenceNumber,
+		entityPath: "myqueue",
+	}
+
+	newMessage := func(body []byte, seqNum *int64) *Message {
+		return &Message{
+			ReceivedMessage: &azservicebus.ReceivedMessage{
+				MessageID:      "someMessageID",
+				SequenceNumber: seqNum,
+				Body:           body,
+			},
+		}
+	}
+
+	t.Run("ID derived from the sequence number", func(t *testing.T) {
+		events, err := msgPrcsr.Process(newMessage(sampleEvent, to.Ptr(int64(42))))
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "myqueue/42", events[0].ID())
+
+		events, err = msgPrcsr.Process(newMessage(sampleEvent, to.Ptr(int64(42))))
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "myqueue/42", events[0].ID(), "The ID should be the same upon redelivery")
+	})
+
+	t.Run("no sequence number", func(t *testing.T) {
+		events, err := msgPrcsr.Process(newMessage(sampleEvent, nil))
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "someMessageID", events[0].ID(), "Expected a fallback to the message ID")
+	})
+
+	t.Run("exploded JSON array", func(t *testing.T) {
+		p := *msgPrcsr
+		p.explodeJSONArray = true
+
+		events, err := p.Process(newMessage([]byte(`[{"a":1},{"b":2}]`), to.Ptr(int64(42))))
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "myqueue/42-0", events[0].ID())
+		assert.Equal(t, "myqueue/42-1", events[1].ID())
+	})
+}
+
+func TestProcessMessageTime(t *testing.T) {
+	enqueuedTime := time.Unix(0, 0).UTC()
+
+	testCases := []struct {
+		name           string
+		timeSource     string
+		enqueuedTime   *time.Time
+		expectEnqueued bool
+	}{
+		{
+			name:           "Enqueued time",
+			timeSource:     ceTimeSourceEnqueuedTime,
+			enqueuedTime:   &enqueuedTime,
+			expectEnqueued: true,
+		},
+		{
+			name:       "Enqueued time is unavailable",
+			timeSource: ceTimeSourceEnqueuedTime,
+		},
+		{
+			name:         "Processing time",
+			timeSource:   ceTimeSourceNow,
+			enqueuedTime: &enqueuedTime,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID:    "someMessageID",
+					Body:         sampleEvent,
+					EnqueuedTime: tc.enqueuedTime,
+				},
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:     "/some/source",
+				ceTimeSource: tc.timeSource,
+				logger:       logtesting.TestLogger(t),
+			}
+
+			start := time.Now()
+
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			if tc.expectEnqueued {
+				assert.Equal(t, enqueuedTime, events[0].Time())
+				return
+			}
+
+			assert.WithinDuration(t, start, events[0].Time(), time.Second, "Expected the current time")
+		})
+	}
+}
+
+func TestProcessMessageTimeClockSkew(t *testing.T) {
+	now := time.Unix(1000, 0).UTC()
+
+	testCases := []struct {
+		name         string
+		enqueuedTime time.Time
+		expectTime   time.Time
+	}{
+		{
+			name:         "Enqueued time in the past",
+			enqueuedTime: now.Add(-time.Hour),
+			expectTime:   now.Add(-time.Hour),
+		},
+		{
+			name:         "Enqueued time in the future within the clock skew",
+			enqueuedTime: now.Add(3 * time.Second),
+			expectTime:   now,
+		},
+		{
+			name:         "Enqueued time in the future beyond the clock skew",
+			enqueuedTime: now.Add(time.Hour),
+			expectTime:   now.Add(time.Hour),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					MessageID:    "someMessageID",
+					Body:         sampleEvent,
+					EnqueuedTime: &tc.enqueuedTime,
+				},
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:     "/some/source",
+				ceTimeSource: ceTimeSourceEnqueuedTime,
+				clock: &messageClock{
+					now:  func() time.Time { return now },
+					skew: 5 * time.Second,
+				},
+			}
+
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expectTime, events[0].Time())
+		})
+	}
+}
+
+func TestToMessageViaPartitionKey(t *testing.T) {
+	rcvMsg := &azservicebus.ReceivedMessage{
+		RawAMQPMessage: &azservicebus.AMQPAnnotatedMessage{
+			MessageAnnotations: map[any]any{
+				"x-opt-via-partition-key": "some-via-partition-key",
+			},
+		},
+	}
+
+	msg, err := toMessage(rcvMsg)
+	require.NoError(t, err)
+	require.NotNil(t, msg.ViaPartitionKey)
+	assert.Equal(t, "some-via-partition-key", *msg.ViaPartitionKey)
+
+	msg, err = toMessage(&azservicebus.ReceivedMessage{})
+	require.NoError(t, err)
+	assert.Nil(t, msg.ViaPartitionKey)
+}
+
+func TestProcessMessageDataSchema(t *testing.T) {
+	const schema = "https://registry.example.com/schemas/order/v1"
+
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body:      sampleEvent,
+			MessageID: "someMessageID",
+		},
+	}
+
+	t.Run("schema is set", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource:     "/some/source",
+			ceDataSchema: schema,
+		}
+		events, err := msgPrcsr.Process(msg)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		assert.Equal(t, schema, events[0].DataSchema())
+		assert.NoError(t, events[0].Validate())
+	})
+
+	t.Run("schema is unset", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource: "/some/source",
+		}
+		events, err := msgPrcsr.Process(msg)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		assert.Empty(t, events[0].DataSchema())
+	})
+}
+
+func TestProcessMessageSpecVersion(t *testing.T) {
+	const schema = "https://registry.example.com/schemas/order/v1"
+
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body:          sampleEvent,
+			MessageID:     "someMessageID",
+			CorrelationID: to.Ptr("some-correlation-id"),
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		specVersion   string
+		expectVersion string
+	}{
+		{
+			name:          "Default version",
+			expectVersion: cloudevents.VersionV1,
+		},
+		{
+			name:          "Version 1.0",
+			specVersion:   cloudevents.VersionV1,
+			expectVersion: cloudevents.VersionV1,
+		},
+		{
+			name:          "Version 0.3",
+			specVersion:   cloudevents.VersionV03,
+			expectVersion: cloudevents.VersionV03,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:      "/some/source",
+				ceDataSchema:  schema,
+				ceSpecVersion: tc.specVersion,
+			}
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			event := events[0]
+			assert.Equal(t, tc.expectVersion, event.SpecVersion())
+			assert.NoError(t, event.Validate())
+
+			assert.Equal(t, "someMessageID", event.ID())
+			assert.Equal(t, schema, event.DataSchema(), "The data schema should survive the conversion")
+			assert.Equal(t, "some-correlation-id", event.Extensions()[extCorrelationID])
+
+			var data struct{ Body json.RawMessage }
+			require.NoError(t, event.DataAs(&data))
+			assert.JSONEq(t, string(sampleEvent), string(data.Body), "The data should survive the conversion")
+		})
+	}
+}
+
+func TestSupportedSpecVersions(t *testing.T) {
+	assert.ElementsMatch(t, []string{cloudevents.VersionV1, cloudevents.VersionV03}, supportedSpecVersions())
+
+	assert.True(t, isSupportedSpecVersion("1.0"))
+	assert.True(t, isSupportedSpecVersion("0.3"))
+	assert.False(t, isSupportedSpecVersion("0.2"))
+	assert.False(t, isSupportedSpecVersion(""))
+}
+
+func TestProcessMessageDataContentType(t *testing.T) {
+	const vendorType = "application/vnd.acme+json"
+
+	testCases := []struct {
+		name        string
+		override    string
+		contentType *string
+		expect      string
+	}{
+		{
+			name:   "JSON default",
+			expect: cloudevents.ApplicationJSON,
+		},
+		{
+			name:        "Message content type",
+			contentType: to.Ptr("application/xml"),
+			expect:      "application/xml",
+		},
+		{
+			name:     "Override of JSON default",
+			override: vendorType,
+			expect:   vendorType,
+		},
+		{
+			name:        "Override of message content type",
+			override:    vendorType,
+			contentType: to.Ptr("application/xml"),
+			expect:      vendorType,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body:        sampleEvent,
+					MessageID:   "someMessageID",
+					ContentType: tc.contentType,
+				},
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:          "/some/source",
+				ceDataContentType: tc.override,
+			}
+			events, err := msgPrcsr.Process(msg)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expect, events[0].DataContentType())
+			assert.NoError(t, events[0].Validate())
+		})
+	}
+}
+
+func TestProcessMessageResourceID(t *testing.T) {
+	const resourceID = "/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/ns/queues/q"
+
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			Body:      sampleEvent,
+			MessageID: "someMessageID",
+			ApplicationProperties: map[string]interface{}{
+				"sbresourceid": "collides with a system property",
+			},
+		},
+	}
+
+	t.Run("source is the resource ID", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource: resourceID,
+		}
+		events, err := msgPrcsr.Process(msg)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		assert.Equal(t, resourceID, events[0].Source())
+		assert.NotContains(t, events[0].Extensions(), "sbresourceid")
+	})
+
+	t.Run("source is overridden", func(t *testing.T) {
+		msgPrcsr := &defaultMessageProcessor{
+			ceSource:          "my-queue",
+			resourceIDExt:     resourceID,
+			propsAsExtensions: true,
+		}
+		events, err := msgPrcsr.Process(msg)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		assert.Equal(t, "my-queue", events[0].Source())
+		assert.Equal(t, resourceID, events[0].Extensions()["sbresourceid"])
+	})
+}
+
+func TestProcessMessageType(t *testing.T) {
+	const defaultType = "com.microsoft.azure.servicebus.message"
+
+	testCases := []struct {
+		name       string
+		typePrefix string
+		subject    *string
+		expectType string
+	}{
+		{
+			name:       "No prefix",
+			subject:    to.Ptr("order.created"),
+			expectType: defaultType,
+		},
+		{
+			name:       "Prefix and subject",
+			typePrefix: "com.example",
+			subject:    to.Ptr("order.created"),
+			expectType: "com.example.order.created",
+		},
+		{
+			name:       "Prefix without subject",
+			typePrefix: "com.example",
+			expectType: defaultType,
+		},
+		{
+			name:       "Prefix with empty subject",
+			typePrefix: "com.example",
+			subject:    to.Ptr(""),
+			expectType: defaultType,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &azservicebus.ReceivedMessage{
+				MessageID: "someMessageID",
+				Body:      sampleEvent,
+				Subject:   tc.subject,
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:     "/some/source",
+				ceTypePrefix: tc.typePrefix,
+			}
+			events, err := msgPrcsr.Process(&Message{ReceivedMessage: msg})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expectType, events[0].Type())
+		})
+	}
+}
+
+func TestProcessMessageSubject(t *testing.T) {
+	const entityPath = "mytopic/Subscriptions/mysub"
+
+	testCases := []struct {
+		name          string
+		subjectSource string
+		subject       *string
+		expectSubject string
+	}{
+		{
+			name:          "No subject",
+			subjectSource: ceSubjectSourceNone,
+			subject:       to.Ptr("order.created"),
+		},
+		{
+			name:          "Message subject",
+			subjectSource: ceSubjectSourceMessageSubject,
+			subject:       to.Ptr("order.created"),
+			expectSubject: "order.created",
+		},
+		{
+			name:          "Message subject is empty",
+			subjectSource: ceSubjectSourceMessageSubject,
+			subject:       to.Ptr(""),
+			expectSubject: entityPath,
+		},
+		{
+			name:          "Entity path",
+			subjectSource: ceSubjectSourceEntityPath,
+			subject:       to.Ptr("order.created"),
+			expectSubject: entityPath,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &azservicebus.ReceivedMessage{
+				MessageID: "someMessageID",
+				Body:      sampleEvent,
+				Subject:   tc.subject,
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:        "/some/source",
+				ceSubjectSource: tc.subjectSource,
+				entityPath:      entityPath,
+			}
+			events, err := msgPrcsr.Process(&Message{ReceivedMessage: msg})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expectSubject, events[0].Subject())
+		})
+	}
+}
+
+func TestProcessMessageSubjectFromBody(t *testing.T) {
+	const entityPath = "myqueue"
+
+	testCases := []struct {
+		name          string
+		body          string
+		contentType   *string
+		subjectSource string
+		expectSubject string
+	}{
+		{
+			name:          "Nested field",
+			body:          `{"order": {"id": "o-42"}}`,
+			expectSubject: "o-42",
+		},
+		{
+			name:          "Numeric field",
+			body:          `{"order": {"id": 42}}`,
+			expectSubject: "42",
+		},
+		{
+			name: "Absent field",
+			body: `{"order": {}}`,
+		},
+		{
+			name:          "Absent field falls back to subject source",
+			body:          `{"order": {}}`,
+			subjectSource: ceSubjectSourceEntityPath,
+			expectSubject: entityPath,
+		},
+		{
+			name: "Body isn't JSON",
+			body: `order 42`,
+		},
+		{
+			name:        "Content type isn't JSON",
+			body:        `{"order": {"id": "o-42"}}`,
+			contentType: to.Ptr("text/plain"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := parseJSONPath("$.order.id")
+			require.NoError(t, err)
+
+			msg := &azservicebus.ReceivedMessage{
+				MessageID:   "someMessageID",
+				Body:        []byte(tc.body),
+				ContentType: tc.contentType,
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:        "/some/source",
+				ceSubjectSource: tc.subjectSource,
+				ceSubjectPath:   path,
+				entityPath:      entityPath,
+			}
+			events, err := msgPrcsr.Process(&Message{ReceivedMessage: msg})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expectSubject, events[0].Subject())
+		})
+	}
+}
+
+func TestProcessMessageExplodeJSONArray(t *testing.T) {
+	testCases := []struct {
+		name             string
+		body             string
+		contentType      *string
+		ceIDSource       string
+		expectIDs        []string
+		expectBodies     []string
+		expectOriginalID bool
+	}{
+		{
+			name:             "Array body",
+			body:             `[{"a": 1}, {"b": 2}]`,
+			expectIDs:        []string{"someMessageID-0", "someMessageID-1"},
+			expectBodies:     []string{`{"a":1}`, `{"b":2}`},
+			expectOriginalID: true,
+		},
+		{
+			name:             "Array body with UUIDs",
+			body:             `[{"a": 1}, {"b": 2}]`,
+			ceIDSource:       ceIDSourceUUID,
+			expectBodies:     []string{`{"a":1}`, `{"b":2}`},
+			expectOriginalID: true,
+		},
+		{
+			name:             "Empty array body",
+			body:             `[]`,
+			expectOriginalID: true,
+		},
+		{
+			name:         "Object body",
+			body:         `{"a": 1}`,
+			expectIDs:    []string{"someMessageID"},
+			expectBodies: []string{`{"a":1}`},
+		},
+		{
+			name:         "Array body with non-JSON content type",
+			body:         `[1, 2]`,
+			contentType:  to.Ptr("text/plain"),
+			expectIDs:    []string{"someMessageID"},
+			expectBodies: []string{`[1, 2]`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &azservicebus.ReceivedMessage{
+				MessageID:   "someMessageID",
+				Body:        []byte(tc.body),
+				ContentType: tc.contentType,
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource:         "/some/source",
+				ceIDSource:       tc.ceIDSource,
+				explodeJSONArray: true,
+			}
+			events, err := msgPrcsr.Process(&Message{ReceivedMessage: msg})
+			require.NoError(t, err)
+			require.Len(t, events, len(tc.expectBodies))
+
+			ids := make(map[string]struct{}, len(events))
+
+			for i, event := range events {
+				if tc.expectIDs != nil {
+					assert.Equal(t, tc.expectIDs[i], event.ID())
+				}
+				ids[event.ID()] = struct{}{}
+
+				if tc.expectOriginalID {
+					assert.Equal(t, "someMessageID", event.Extensions()[extOriginalMessageID])
+				} else {
+					assert.NotContains(t, event.Extensions(), extOriginalMessageID)
+				}
+
+				if tc.contentType != nil {
+					assert.Equal(t, tc.expectBodies[i], string(event.Data()))
+					continue
+				}
+
+				var data struct {
+					Body json.RawMessage
+				}
+				require.NoError(t, event.DataAs(&data))
+				assert.JSONEq(t, tc.expectBodies[i], string(data.Body))
+			}
+
+			assert.Len(t, ids, len(events), "Event IDs should be unique")
+		})
+	}
+}
+
+func TestProcessMessageTraceContext(t *testing.T) {
+	const (
+		traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+		traceState  = "congo=t61rcWkgMzE"
+	)
+
+	testCases := []struct {
+		name       string
+		props      map[string]interface{}
+		expectExts map[string]interface{}
+	}{
+		{
+			name: "traceparent and tracestate",
+			props: map[string]interface{}{
+				"traceparent": traceParent,
+				"tracestate":  traceState,
+			},
+			expectExts: map[string]interface{}{
+				"traceparent":     traceParent,
+				"tracestate":      traceState,
+				"sbdeliverycount": "0",
+			},
+		},
+		{
+			name: "Diagnostic-Id",
+			props: map[string]interface{}{
+				"Diagnostic-Id": traceParent,
+			},
+			expectExts: map[string]interface{}{
+				"traceparent":     traceParent,
+				"sbdeliverycount": "0",
+			},
+		},
+		{
+			name: "No trace context",
+			props: map[string]interface{}{
+				"tracestate": traceState,
+			},
+			expectExts: map[string]interface{}{
+				"sbdeliverycount": "0",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &azservicebus.ReceivedMessage{
+				MessageID:             "someMessageID",
+				Body:                  sampleEvent,
+				ApplicationProperties: tc.props,
+			}
+
+			msgPrcsr := &defaultMessageProcessor{
+				ceSource: "/some/source",
+			}
+			events, err := msgPrcsr.Process(&Message{ReceivedMessage: msg})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+
+			assert.Equal(t, tc.expectExts, events[0].Extensions())
+		})
+	}
+}
+
 // Generated using https://www.json-generator.com
 var sampleEvent = []byte(`{
   "_id": "5fad5882028c6aafa3447b6e",
@@ -108,3 +1444,131 @@ var sampleEvent = []byte(`{
   "greeting": "Hello, Jo! You have 8 unread messages.",
   "favoriteFruit": "banana"
 }`)
+
+func TestParseCEOverrides(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expect    map[string]string
+		expectErr bool
+	}{
+		{
+			name:   "Valid overrides",
+			input:  `{"region": "westeurope", "env": "prod"}`,
+			expect: map[string]string{"region": "westeurope", "env": "prod"},
+		},
+		{
+			name:      "Invalid JSON",
+			input:     `{"region": `,
+			expectErr: true,
+		},
+		{
+			name:      "Non-string value",
+			input:     `{"priority": 1}`,
+			expectErr: true,
+		},
+		{
+			name:      "Invalid extension name",
+			input:     `{"my-region": "westeurope"}`,
+			expectErr: true,
+		},
+		{
+			name:   "Long extension name",
+			input:  `{"contososhippingregion": "westeurope"}`,
+			expect: map[string]string{"contososhippingregion": "westeurope"},
+		},
+		{
+			name:      "Context attribute",
+			input:     `{"source": "/some/source"}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exts, err := parseCEOverrides(tc.input)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, exts)
+		})
+	}
+}
+
+func TestParsePropertyMapping(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expect    map[string]string
+		expectErr bool
+	}{
+		{
+			name:   "Empty mapping",
+			input:  "",
+			expect: map[string]string{},
+		},
+		{
+			name:  "Valid mapping",
+			input: "X-Tenant-Id=tenant, orderRef = orderid,",
+			expect: map[string]string{
+				"X-Tenant-Id": "tenant",
+				"orderRef":    "orderid",
+			},
+		},
+		{
+			name:      "Missing separator",
+			input:     "X-Tenant-Id",
+			expectErr: true,
+		},
+		{
+			name:      "Missing attribute",
+			input:     "X-Tenant-Id=",
+			expectErr: true,
+		},
+		{
+			name:      "Invalid attribute name",
+			input:     "X-Tenant-Id=tenant-id",
+			expectErr: true,
+		},
+		{
+			name:   "Long attribute name",
+			input:  "X-Tenant-Id=contosotenantidentifier",
+			expect: map[string]string{"X-Tenant-Id": "contosotenantidentifier"},
+		},
+		{
+			name:      "Context attribute",
+			input:     "X-Tenant-Id=subject",
+			expectErr: true,
+		},
+		{
+			name:      "Duplicate property",
+			input:     "a=one,a=two",
+			expectErr: true,
+		},
+		{
+			name:      "Duplicate attribute",
+			input:     "a=one,b=one",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mapping, err := parsePropertyMapping(tc.input)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, mapping)
+		})
+	}
+}
+
+func TestSourceIdentity(t *testing.T) {
+	assert.Equal(t, "ns/src", sourceIdentity("ns", "src"))
+	assert.Empty(t, sourceIdentity("", "src"))
+	assert.Empty(t, sourceIdentity("ns", ""))
+}
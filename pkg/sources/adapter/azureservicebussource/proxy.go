@@ -0,0 +1,45 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFunc returns a function which determines the HTTP(S) proxy to use for
+// a given request, in the format expected by http.Transport.
+//
+// The proxy is read from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables (or their lowercase versions). When proxyURL is not nil, it takes
+// precedence over HTTP_PROXY and HTTPS_PROXY, but hosts listed in NO_PROXY are
+// still reached directly.
+func proxyFunc(proxyURL *url.URL) func(*http.Request) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	if proxyURL != nil {
+		cfg.HTTPProxy = proxyURL.String()
+		cfg.HTTPSProxy = proxyURL.String()
+	}
+
+	proxy := cfg.ProxyFunc()
+
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestProxyFunc(t *testing.T) {
+	const reqURL = "https://ns.servicebus.windows.net/$servicebus/websocket"
+
+	testCases := []struct {
+		name        string
+		envProxy    string
+		envNoProxy  string
+		proxyURL    string
+		expectProxy string
+	}{
+		{
+			name: "No proxy",
+		},
+		{
+			name:        "Proxy from environment",
+			envProxy:    "http://env-proxy:3128",
+			expectProxy: "http://env-proxy:3128",
+		},
+		{
+			name:        "Explicit proxy takes precedence",
+			envProxy:    "http://env-proxy:3128",
+			proxyURL:    "http://explicit-proxy:8080",
+			expectProxy: "http://explicit-proxy:8080",
+		},
+		{
+			name:       "Host excluded from proxying",
+			envNoProxy: ".servicebus.windows.net",
+			proxyURL:   "http://explicit-proxy:8080",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "NO_PROXY", "no_proxy"} {
+				t.Setenv(k, "")
+			}
+			t.Setenv("HTTPS_PROXY", tc.envProxy)
+			t.Setenv("NO_PROXY", tc.envNoProxy)
+
+			var proxyURL *url.URL
+			if tc.proxyURL != "" {
+				var err error
+				proxyURL, err = url.Parse(tc.proxyURL)
+				require.NoError(t, err)
+			}
+
+			req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+			require.NoError(t, err)
+
+			proxy, err := proxyFunc(proxyURL)(req)
+			require.NoError(t, err)
+
+			if tc.expectProxy == "" {
+				assert.Nil(t, proxy)
+				return
+			}
+			require.NotNil(t, proxy)
+			assert.Equal(t, tc.expectProxy, proxy.String())
+		})
+	}
+}
+
+func TestWebSocketsClientOptionProxy(t *testing.T) {
+	var proxied atomic.Bool
+
+	// The proxy rejects all tunnels, we only care about whether the
+	// WebSocket connection was attempted through it.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			proxied.Store(true)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	opts := newAzureServiceBusClientOptions(webSocketsClientOption(true, proxyURL, 0))
+	require.NotNil(t, opts.NewWebSocketConn)
+
+	_, err = opts.NewWebSocketConn(context.Background(), azservicebus.NewWebSocketConnArgs{
+		Host: "wss://ns.servicebus.windows.net/$servicebus/websocket",
+	})
+	assert.Error(t, err)
+
+	assert.True(t, proxied.Load(), "The connection should go through the proxy")
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Names of the CloudEvent extension attributes which carry a verbatim copy of
+// the Service Bus message that CloudEvents were produced from.
+const (
+	extRawMessage    = "sbrawmessage"
+	extRawProperties = "sbrawproperties"
+)
+
+// messageProperties is a Message serialized without its body.
+type messageProperties struct {
+	// shadows the Body of the embedded ReceivedMessage, and is always
+	// omitted since it is never set
+	Body *struct{} `json:",omitempty"`
+	*Message
+}
+
+// rawMessageExtensions returns the extension attributes which carry the
+// base64-encoded body of the given message, as received from Service Bus.
+// When withProps is true, the JSON serialization of the system and
+// application properties of the message is included as well.
+func rawMessageExtensions(msg *Message, withProps bool) (map[string]string, error) {
+	exts := map[string]string{
+		extRawMessage: base64.StdEncoding.EncodeToString(msg.Body),
+	}
+
+	if withProps {
+		props, err := json.Marshal(&messageProperties{Message: msg})
+		if err != nil {
+			return nil, fmt.Errorf("serializing message properties: %w", err)
+		}
+		exts[extRawProperties] = base64.StdEncoding.EncodeToString(props)
+	}
+
+	return exts, nil
+}
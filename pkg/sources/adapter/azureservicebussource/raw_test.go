@@ -0,0 +1,66 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestRawMessageExtensions(t *testing.T) {
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			MessageID:             "msg-1",
+			Body:                  []byte("\x00binary\xff"),
+			CorrelationID:         to.Ptr("corr-1"),
+			ApplicationProperties: map[string]any{"tenant": "acme"},
+		},
+	}
+
+	t.Run("Body only", func(t *testing.T) {
+		exts, err := rawMessageExtensions(msg, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]string{
+			extRawMessage: base64.StdEncoding.EncodeToString(msg.Body),
+		}, exts)
+	})
+
+	t.Run("Body and properties", func(t *testing.T) {
+		exts, err := rawMessageExtensions(msg, true)
+		require.NoError(t, err)
+
+		require.Contains(t, exts, extRawProperties)
+		rawProps, err := base64.StdEncoding.DecodeString(exts[extRawProperties])
+		require.NoError(t, err)
+
+		var props map[string]any
+		require.NoError(t, json.Unmarshal(rawProps, &props))
+
+		assert.NotContains(t, props, "Body", "The body should not be serialized with the properties")
+		assert.Equal(t, "msg-1", props["MessageID"])
+		assert.Equal(t, "corr-1", props["CorrelationID"])
+		assert.Equal(t, map[string]any{"tenant": "acme"}, props["ApplicationProperties"])
+	})
+}
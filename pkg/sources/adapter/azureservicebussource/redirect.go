@@ -0,0 +1,175 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	"knative.dev/eventing/pkg/metrics/source"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+// redirectingClient is a cloudevents.Client which follows redirects returned
+// by the sink instead of treating them as delivery failures.
+//
+// Redirects are followed by the HTTP client of the underlying CloudEvents
+// client, once per event, so that a sink which keeps redirecting can not
+// cause a loop. Once the redirect target accepts an event, it replaces the
+// sink for subsequent events. If that target later redirects, that redirect
+// is followed in turn.
+//
+// Events sent to an explicit target, such as the dead-letter sink, are sent
+// to that target.
+type redirectingClient struct {
+	cloudevents.Client
+
+	logger *zap.SugaredLogger
+
+	mu sync.RWMutex
+	// sink, or redirect target which replaced it
+	target *url.URL
+}
+
+var _ cloudevents.Client = (*redirectingClient)(nil)
+
+// newRedirectingClient returns a redirectingClient which delivers events to
+// the given sink, with the given CloudEvent overrides and timeout.
+func newRedirectingClient(logger *zap.SugaredLogger, sink *url.URL,
+	ceOverrides *duckv1.CloudEventOverrides, timeout time.Duration) (*redirectingClient, error) {
+
+	c := &redirectingClient{
+		logger: logger,
+		target: sink,
+	}
+
+	reporter, err := source.NewStatsReporter()
+	if err != nil {
+		return nil, fmt.Errorf("creating stats reporter: %w", err)
+	}
+
+	cli, err := pkgadapter.NewCloudEventsClientWithOptions(ceOverrides, reporter,
+		cehttp.WithTarget(sink.String()),
+		cehttp.WithClient(http.Client{
+			CheckRedirect: repostOnRedirect,
+			Timeout:       timeout,
+		}),
+		cehttp.WithRoundTripperDecorator(c.recordRedirects),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating CloudEvents client: %w", err)
+	}
+	c.Client = cli
+
+	return c, nil
+}
+
+// Send implements cloudevents.Client.
+func (c *redirectingClient) Send(ctx context.Context, event cloudevents.Event) protocol.Result {
+	if cecontext.TargetFrom(ctx) == nil {
+		c.mu.RLock()
+		ctx = cecontext.WithTarget(ctx, c.target.String())
+		c.mu.RUnlock()
+	}
+
+	return c.Client.Send(ctx, event)
+}
+
+// recordRedirects decorates the given http.RoundTripper so that a redirect
+// target which accepts an event replaces the sink for subsequent events.
+func (c *redirectingClient) recordRedirects(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := rt.RoundTrip(req)
+		if err != nil || req.Response == nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return resp, err
+		}
+
+		// req.Response is the redirect which caused this request to be
+		// sent, in response to the previous request.
+		redirected := req.Response.Request.URL.String()
+
+		c.mu.Lock()
+		if c.target.String() == redirected {
+			c.target = req.URL
+			c.logger.Infow("Sending subsequent events to the redirect target", zap.Stringer("target", req.URL))
+		}
+		c.mu.Unlock()
+
+		return resp, nil
+	})
+}
+
+// repostOnRedirect is a http.Client CheckRedirect function which follows a
+// single redirect per event. A second redirect is returned as a failure.
+//
+// The event is posted again to the redirect target regardless of the status
+// code, whereas the net/http client retains the method and body of requests
+// only upon 307 and 308 redirects, and turns other redirects into GET
+// requests without body.
+func repostOnRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > 1 {
+		return http.ErrUseLastResponse
+	}
+
+	orig := via[0]
+	if req.Method == orig.Method {
+		return nil
+	}
+	req.Method = orig.Method
+
+	// Events without data are sent without body.
+	if orig.GetBody == nil {
+		return nil
+	}
+
+	body, err := orig.GetBody()
+	if err != nil {
+		return fmt.Errorf("reading body of the redirected request: %w", err)
+	}
+	req.Body = body
+	req.GetBody = orig.GetBody
+	req.ContentLength = orig.ContentLength
+
+	// Headers which describe the body are dropped along with it.
+	for _, h := range []string{"Content-Encoding", "Content-Language", "Content-Location", "Content-Type"} {
+		if v, ok := orig.Header[h]; ok {
+			req.Header[h] = v
+		}
+	}
+
+	return nil
+}
+
+// roundTripperFunc is a function which implements http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
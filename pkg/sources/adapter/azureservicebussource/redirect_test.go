@@ -0,0 +1,179 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestRedirectingClient(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string][]string)
+
+	record := func(name string, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits[name] = append(hits[name], r.Method+" "+r.Header.Get("Ce-Id"))
+	}
+
+	regional := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("regional", r)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer regional.Close()
+
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("front", r)
+		http.Redirect(w, r, regional.URL, http.StatusTemporaryRedirect)
+	}))
+	defer front.Close()
+
+	moved := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("moved", r)
+		http.Redirect(w, r, front.URL, http.StatusMovedPermanently)
+	}))
+	defer moved.Close()
+
+	testCases := []struct {
+		name         string
+		sink         string
+		expectACK    bool
+		expectTarget string
+		expectHits   map[string][]string
+	}{
+		{
+			name:         "No redirect",
+			sink:         regional.URL,
+			expectACK:    true,
+			expectTarget: regional.URL,
+			expectHits: map[string][]string{
+				"regional": {"POST 1", "POST 2"},
+			},
+		},
+		{
+			name:         "Redirect followed once and cached",
+			sink:         front.URL,
+			expectACK:    true,
+			expectTarget: regional.URL,
+			expectHits: map[string][]string{
+				"front":    {"POST 1"},
+				"regional": {"POST 1", "POST 2"},
+			},
+		},
+		{
+			name:         "Redirect target redirects again",
+			sink:         moved.URL,
+			expectACK:    false,
+			expectTarget: moved.URL,
+			expectHits: map[string][]string{
+				"moved": {"POST 1", "POST 2"},
+				"front": {"POST 1", "POST 2"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			hits = make(map[string][]string)
+			mu.Unlock()
+
+			sinkURL, err := url.Parse(tc.sink)
+			require.NoError(t, err)
+
+			c, err := newRedirectingClient(logtesting.TestLogger(t), sinkURL, nil, 0)
+			require.NoError(t, err)
+
+			for _, id := range []string{"1", "2"} {
+				res := c.Send(context.Background(), newTestEvent(id))
+				assert.Equal(t, tc.expectACK, cloudevents.IsACK(res), "Unexpected result: %v", res)
+				if !tc.expectACK {
+					assert.Equal(t, sendFailureFatal, classifySendResult(res))
+				}
+			}
+
+			assert.Equal(t, tc.expectTarget, c.target.String())
+			assert.Equal(t, tc.expectHits, hits)
+		})
+	}
+}
+
+func TestRedirectingClientExplicitTarget(t *testing.T) {
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Unexpected request to the sink")
+	}))
+	defer sink.Close()
+
+	var deadLetterHits int
+	deadLetter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadLetterHits++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer deadLetter.Close()
+
+	sinkURL, err := url.Parse(sink.URL)
+	require.NoError(t, err)
+
+	c, err := newRedirectingClient(logtesting.TestLogger(t), sinkURL, nil, 0)
+	require.NoError(t, err)
+
+	ctx := cloudevents.ContextWithTarget(context.Background(), deadLetter.URL)
+	res := c.Send(ctx, newTestEvent("1"))
+	assert.True(t, cloudevents.IsACK(res), "Unexpected result: %v", res)
+	assert.Equal(t, 1, deadLetterHits, "Expected the event to be sent to the explicit target")
+	assert.Equal(t, sink.URL, c.target.String(), "The explicit target should not replace the sink")
+}
+
+func TestRepostOnRedirect(t *testing.T) {
+	var gotMethod, gotBody, gotContentType string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotMethod, gotBody, gotContentType = r.Method, string(b), r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer target.Close()
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusSeeOther)
+	}))
+	defer sink.Close()
+
+	client := &http.Client{CheckRedirect: repostOnRedirect}
+
+	resp, err := client.Post(sink.URL, "application/json", strings.NewReader(`{"test": null}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, http.MethodPost, gotMethod, "The method should be retained")
+	assert.Equal(t, `{"test": null}`, gotBody, "The body should be posted again")
+	assert.Equal(t, "application/json", gotContentType, "The content type should be retained")
+}
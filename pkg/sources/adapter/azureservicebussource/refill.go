@@ -0,0 +1,78 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"sync"
+)
+
+// refill paces the receipt of messages so that a buffer of received messages
+// which await a handler is refilled whenever it drops to a low watermark,
+// instead of only once it is empty.
+//
+// Receive operations then overlap with the handling of the messages which
+// remain in the buffer, which keeps handlers continuously fed instead of
+// letting them idle during each receive operation.
+type refill struct {
+	lowWatermark int
+
+	mu sync.Mutex
+	// closed and replaced every time a handler takes a message from the
+	// buffer
+	taken chan struct{}
+}
+
+// newRefill returns a refill which refills a buffer of prefetchCount messages
+// once the number of messages in that buffer drops to the given fraction of
+// its capacity.
+func newRefill(prefetchCount int, threshold float64) *refill {
+	return &refill{
+		lowWatermark: int(threshold * float64(prefetchCount)),
+		taken:        make(chan struct{}),
+	}
+}
+
+// notifyTaken signals that a handler took a message from the buffer.
+func (r *refill) notifyTaken() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	close(r.taken)
+	r.taken = make(chan struct{})
+}
+
+// wait blocks until the number of messages in the given buffer drops to the
+// low watermark, and returns the number of messages which fit in the buffer
+// at that point.
+func (r *refill) wait(ctx context.Context, buf chan *fullMessage) (int, error) {
+	for {
+		r.mu.Lock()
+		taken := r.taken
+		r.mu.Unlock()
+
+		if n := len(buf); n <= r.lowWatermark && n < cap(buf) {
+			return cap(buf) - n, nil
+		}
+
+		select {
+		case <-taken:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
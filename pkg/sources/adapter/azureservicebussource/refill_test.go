@@ -0,0 +1,320 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestRefillWait(t *testing.T) {
+	r := newRefill(4, 0.5)
+	require.Equal(t, 2, r.lowWatermark)
+
+	buf := make(chan *fullMessage, 4)
+	for i := 0; i < 3; i++ {
+		buf <- &fullMessage{}
+	}
+
+	type result struct {
+		count int
+		err   error
+	}
+
+	waitDone := make(chan result, 1)
+	go func() {
+		count, err := r.wait(context.Background(), buf)
+		waitDone <- result{count, err}
+	}()
+
+	select {
+	case <-waitDone:
+		t.Fatal("Expected wait to block while the buffer is above the low watermark")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-buf
+	r.notifyTaken()
+
+	select {
+	case res := <-waitDone:
+		assert.NoError(t, res.err)
+		assert.Equal(t, 2, res.count, "Expected the buffer to be refilled up to its capacity")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected wait to return once the buffer dropped to the low watermark")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	buf <- &fullMessage{}
+	go func() {
+		count, err := r.wait(ctx, buf)
+		waitDone <- result{count, err}
+	}()
+	cancel()
+
+	res := <-waitDone
+	assert.ErrorIs(t, res.err, context.Canceled)
+}
+
+// BenchmarkStartPrefetchRefill measures the throughput of the adapter with
+// and without a prefetch refill threshold, when each receive operation incurs
+// a fixed latency. The "max-gap-ms" metric is the longest period during which
+// no event was delivered, which reflects how smooth the throughput is.
+func BenchmarkStartPrefetchRefill(b *testing.B) {
+	const rcvLatency = 5 * time.Millisecond
+	const sendLatency = time.Millisecond
+
+	for _, threshold := range []float64{0, 0.5} {
+		b.Run("threshold "+strconv.FormatFloat(threshold, 'f', -1, 64), func(b *testing.B) {
+			remaining := int64(b.N)
+
+			ceClient := &pacedClient{delay: sendLatency}
+
+			a := &adapter{
+				logger:        zap.NewNop().Sugar(),
+				msgRcvr:       &latencyReceiver{latency: rcvLatency, remaining: &remaining},
+				ceClient:      ceClient,
+				msgPrcsr:      &defaultMessageProcessor{},
+				maxConcurrent: 10,
+				prefetchCount: 100,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+			if threshold > 0 {
+				a.refill = newRefill(a.prefetchCount, threshold)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			b.ResetTimer()
+
+			errCh := make(chan error)
+			go func() {
+				errCh <- a.Start(ctx)
+			}()
+
+			for atomic.LoadInt64(&ceClient.count) < int64(b.N) {
+				time.Sleep(time.Millisecond)
+			}
+
+			b.StopTimer()
+			cancel()
+			<-errCh
+
+			b.ReportMetric(float64(ceClient.maxGap.Microseconds())/1000, "max-gap-ms")
+		})
+	}
+}
+
+// BenchmarkStartLinkCredit measures the latency of the delivery of messages
+// which arrive at a low rate, for different combinations of prefetch count
+// (link credit) and prefetch refill threshold (credit replenishment). The
+// "latency-ms" metric is the average duration between the arrival of a
+// message and the delivery of its event.
+func BenchmarkStartLinkCredit(b *testing.B) {
+	const arrivalInterval = 2 * time.Millisecond
+
+	testCases := []struct {
+		name            string
+		prefetchCount   int
+		refillThreshold float64
+	}{
+		{name: "prefetch 1", prefetchCount: 1},
+		{name: "prefetch 5", prefetchCount: 5},
+		{name: "prefetch 100", prefetchCount: 100},
+		{name: "prefetch 100 threshold 0.5", prefetchCount: 100, refillThreshold: 0.5},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		b.Run(tc.name, func(b *testing.B) {
+			ceClient := &latencyRecordingClient{}
+
+			a := &adapter{
+				logger:        zap.NewNop().Sugar(),
+				msgRcvr:       &arrivalReceiver{interval: arrivalInterval, maxWait: sdkTimeAfterFirstMessage},
+				ceClient:      ceClient,
+				msgPrcsr:      &defaultMessageProcessor{},
+				maxConcurrent: 10,
+				prefetchCount: tc.prefetchCount,
+
+				sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+			}
+			if tc.refillThreshold > 0 {
+				a.refill = newRefill(a.prefetchCount, tc.refillThreshold)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			b.ResetTimer()
+
+			errCh := make(chan error)
+			go func() {
+				errCh <- a.Start(ctx)
+			}()
+
+			for atomic.LoadInt64(&ceClient.count) < int64(b.N) {
+				time.Sleep(time.Millisecond)
+			}
+
+			b.StopTimer()
+			cancel()
+			<-errCh
+
+			b.ReportMetric(float64(ceClient.avgLatency().Microseconds())/1000, "latency-ms")
+		})
+	}
+}
+
+// Duration after which the Service Bus SDK stops waiting for more messages
+// once a receive operation received its first message.
+const sdkTimeAfterFirstMessage = 20 * time.Millisecond
+
+// arrivalReceiver is a messageReceiver which emulates the behaviour of the
+// Service Bus SDK with an entity in which a message arrives at every interval.
+// Receive operations return once the requested number of messages arrived, or
+// maxWait after the first message arrived.
+type arrivalReceiver struct {
+	latencyReceiver
+
+	interval time.Duration
+	maxWait  time.Duration
+
+	mu sync.Mutex
+	// arrival time of the next message
+	next time.Time
+}
+
+var _ messageReceiver = (*arrivalReceiver)(nil)
+
+// ReceiveMessages implements messageReceiver.
+func (r *arrivalReceiver) ReceiveMessages(ctx context.Context, maxMessages int, _ *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next.IsZero() {
+		r.next = time.Now()
+	}
+	deadline := r.next.Add(r.maxWait)
+
+	var msgs []*azservicebus.ReceivedMessage
+	for len(msgs) < maxMessages && !r.next.After(deadline) {
+		if err := sleepUntil(ctx, r.next); err != nil {
+			return nil, err
+		}
+
+		arrival := r.next
+		msgs = append(msgs, &azservicebus.ReceivedMessage{
+			MessageID:    "msg",
+			Body:         []byte(`{"test": null}`),
+			EnqueuedTime: &arrival,
+		})
+		r.next = r.next.Add(r.interval)
+	}
+
+	if len(msgs) < maxMessages {
+		if err := sleepUntil(ctx, deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	return msgs, nil
+}
+
+// sleepUntil blocks until the given time, or until ctx is canceled.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(t)):
+		return nil
+	}
+}
+
+// latencyRecordingClient is a CloudEvents client which records the duration
+// between the time of events and their sending.
+type latencyRecordingClient struct {
+	cloudevents.Client
+
+	count        int64
+	totalLatency int64 // nanoseconds
+}
+
+// Send implements cloudevents.Client.
+func (c *latencyRecordingClient) Send(_ context.Context, e cloudevents.Event) protocol.Result {
+	atomic.AddInt64(&c.totalLatency, int64(time.Since(e.Time())))
+	atomic.AddInt64(&c.count, 1)
+	return nil
+}
+
+// avgLatency returns the average latency of sent events.
+func (c *latencyRecordingClient) avgLatency() time.Duration {
+	count := atomic.LoadInt64(&c.count)
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&c.totalLatency) / count)
+}
+
+// pacedClient is a CloudEvents client which takes the given delay to send
+// events, and records the longest period between two consecutive sends.
+type pacedClient struct {
+	cloudevents.Client
+
+	delay time.Duration
+	count int64
+
+	mu     sync.Mutex
+	last   time.Time
+	maxGap time.Duration
+}
+
+// Send implements cloudevents.Client.
+func (c *pacedClient) Send(context.Context, cloudevents.Event) protocol.Result {
+	time.Sleep(c.delay)
+	atomic.AddInt64(&c.count, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !c.last.IsZero() && now.Sub(c.last) > c.maxGap {
+		c.maxGap = now.Sub(c.last)
+	}
+	c.last = now
+
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"sort"
+	"sync"
+)
+
+// registry holds named implementations of an extension point of the adapter,
+// such as message processors, which other packages can add to.
+type registry[T any] struct {
+	// kind of the registered values, as reported in panics
+	kind string
+
+	mu      sync.RWMutex
+	entries map[string]T
+}
+
+// newRegistry returns a registry of the given kind which initially holds the
+// given built-in values.
+func newRegistry[T any](kind string, builtins map[string]T) *registry[T] {
+	return &registry[T]{
+		kind:    kind,
+		entries: builtins,
+	}
+}
+
+// register adds the given value to the registry under the given name. It
+// panics if a value is already registered under the same name.
+func (r *registry[T]) register(name string, v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, dup := r.entries[name]; dup {
+		panic("azureservicebussource: " + r.kind + " " + name + " is already registered")
+	}
+	r.entries[name] = v
+}
+
+// lookup returns the value registered under the given name, if any.
+func (r *registry[T]) lookup(name string) (T, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.entries[name]
+	return v, ok
+}
+
+// names returns the sorted names of all registered values.
+func (r *registry[T]) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.entries))
+	for n := range r.entries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Names of the built-in message processors.
+const (
+	msgPrcsrDefault = "default"
+	msgPrcsrRaw     = "raw"
+)
+
+// MessageProcessorFactory returns a MessageProcessor which sets the given
+// value as the "source" attribute of the CloudEvents it produces.
+type MessageProcessorFactory func(ceSource string) MessageProcessor
+
+// msgPrcsrs is the registry of message processors.
+var msgPrcsrs = newRegistry("message processor", map[string]MessageProcessorFactory{
+	msgPrcsrDefault: func(ceSource string) MessageProcessor {
+		return &defaultMessageProcessor{ceSource: ceSource}
+	},
+	msgPrcsrRaw: func(ceSource string) MessageProcessor {
+		return &rawMessageProcessor{ceSource: ceSource}
+	},
+})
+
+// RegisterMessageProcessor makes a MessageProcessor available under the given
+// name, which can then be selected using the SERVICEBUS_MESSAGE_PROCESSOR
+// environment variable. It is intended to be called from the init function of
+// packages which provide custom processors.
+//
+// RegisterMessageProcessor panics if factory is nil, or if a processor is
+// already registered under the same name.
+func RegisterMessageProcessor(name string, factory MessageProcessorFactory) {
+	if factory == nil {
+		panic("azureservicebussource: nil factory for message processor " + name)
+	}
+	msgPrcsrs.register(name, factory)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestRegisterMessageProcessor(t *testing.T) {
+	const name = "test-custom"
+
+	t.Cleanup(func() {
+		msgPrcsrs.mu.Lock()
+		defer msgPrcsrs.mu.Unlock()
+		delete(msgPrcsrs.entries, name)
+	})
+
+	RegisterMessageProcessor(name, func(ceSource string) MessageProcessor {
+		return &customMessageProcessor{ceSource: ceSource}
+	})
+
+	newMsgPrcsr, ok := msgPrcsrs.lookup(name)
+	require.True(t, ok, "Processor should be registered")
+
+	p := newMsgPrcsr("/some/source")
+	require.IsType(t, (*customMessageProcessor)(nil), p)
+	assert.Equal(t, "/some/source", p.(*customMessageProcessor).ceSource)
+
+	assert.Equal(t, []string{msgPrcsrDefault, msgPrcsrRaw, name}, msgPrcsrs.names())
+
+	assert.Panics(t, func() {
+		RegisterMessageProcessor(name, func(string) MessageProcessor { return nil })
+	}, "Registering a processor twice should panic")
+
+	assert.Panics(t, func() {
+		RegisterMessageProcessor("test-nil", nil)
+	}, "Registering a nil factory should panic")
+}
+
+func TestBuiltinMessageProcessors(t *testing.T) {
+	newMsgPrcsr, ok := msgPrcsrs.lookup(msgPrcsrDefault)
+	require.True(t, ok)
+	assert.IsType(t, (*defaultMessageProcessor)(nil), newMsgPrcsr("/some/source"))
+
+	newMsgPrcsr, ok = msgPrcsrs.lookup(msgPrcsrRaw)
+	require.True(t, ok)
+	assert.IsType(t, (*rawMessageProcessor)(nil), newMsgPrcsr("/some/source"))
+}
+
+// customMessageProcessor is a MessageProcessor which can be registered
+// externally.
+type customMessageProcessor struct {
+	ceSource string
+}
+
+var _ MessageProcessor = (*customMessageProcessor)(nil)
+
+// Process implements MessageProcessor.
+func (*customMessageProcessor) Process(*Message) ([]*cloudevents.Event, error) {
+	return nil, nil
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	"knative.dev/pkg/logging"
+)
+
+// replayReceiver receives specific Service Bus messages by sequence number.
+// It is implemented by azservicebus.Receiver.
+type replayReceiver interface {
+	messageReceiver
+	messagePeeker
+	ReceiveDeferredMessages(context.Context, []int64, *azservicebus.ReceiveDeferredMessagesOptions) ([]*azservicebus.ReceivedMessage, error)
+}
+
+var _ replayReceiver = (*azservicebus.Receiver)(nil)
+
+// ReplayAdapterConstructor returns an adapter constructor for the "replay"
+// command, which re-emits as CloudEvents the messages of the Service Bus
+// entity with the given sequence numbers, then exits without consuming the
+// entity. Sequence numbers are listed inline and/or in the file at the given
+// path, separated by commas or whitespaces (e.g. one per line).
+//
+// Both deferred and active (or dead-lettered) messages can be replayed.
+// Session-enabled entities are not supported, and messages can only be
+// replayed from a single entity at a time.
+func ReplayAdapterConstructor(list, path string) (pkgadapter.AdapterConstructor, error) {
+	seqNums, err := replaySequenceNumbers(list, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(seqNums) == 0 {
+		return nil, errors.New("at least one sequence number of a message to replay must be given")
+	}
+
+	return func(ctx context.Context, envAcc pkgadapter.EnvConfigAccessor, ceClient cloudevents.Client) pkgadapter.Adapter {
+		logger := logging.FromContext(ctx)
+
+		if envAcc.(*envConfig).SessionEnabled {
+			logger.Panic("Messages can not be replayed from session-enabled entities")
+		}
+
+		a, ok := NewAdapter(ctx, envAcc, ceClient).(*adapter)
+		if !ok {
+			logger.Panic("Messages can only be replayed from a single entity")
+		}
+		a.replaySeqNums = seqNums
+		// The health port belongs to the adapter which consumes the entity.
+		a.healthPort = 0
+
+		return a
+	}, nil
+}
+
+// replaySequenceNumbers returns the sequence numbers of the messages to
+// replay, listed either inline or in the file at the given path.
+func replaySequenceNumbers(list, path string) ([]int64, error) {
+	seqNums, err := parseSequenceNumbers(list)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		fileSeqNums, err := readSequenceNumbersFile(path)
+		if err != nil {
+			return nil, err
+		}
+		seqNums = append(seqNums, fileSeqNums...)
+	}
+
+	return seqNums, nil
+}
+
+// readSequenceNumbersFile reads the sequence numbers listed in the file at the
+// given path.
+func readSequenceNumbersFile(path string) ([]int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading sequence numbers file: %w", err)
+	}
+
+	seqNums, err := parseSequenceNumbers(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("parsing sequence numbers file %q: %w", path, err)
+	}
+	return seqNums, nil
+}
+
+// parseSequenceNumbers parses a list of sequence numbers separated by commas
+// and/or whitespaces (e.g. one per line).
+func parseSequenceNumbers(s string) ([]int64, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	seqNums := make([]int64, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence number %q", f)
+		}
+		seqNums = append(seqNums, n)
+	}
+
+	return seqNums, nil
+}
+
+// replay re-emits as CloudEvents the messages with the configured sequence
+// numbers.
+//
+// Deferred messages are received, and settled like any other message once
+// handled. Other messages, which are either active or already dead-lettered,
+// can only be peeked at and are therefore left untouched in the entity.
+func (a *adapter) replay(ctx context.Context) error {
+	r, ok := a.msgRcvr.(replayReceiver)
+	if !ok {
+		return errors.New("the message receiver does not support receiving messages by sequence number")
+	}
+
+	replayed, err := a.replayMessages(ctx, r, a.replaySeqNums)
+
+	a.logger.Infof("Replayed %d out of %d message(s)", replayed, len(a.replaySeqNums))
+
+	if err != nil {
+		return fmt.Errorf("replaying messages: %w", err)
+	}
+	return nil
+}
+
+// replayMessages re-emits as CloudEvents the messages with the given sequence
+// numbers, and returns the number of messages which were found. Each message
+// is replayed independently, so that failing to replay one of them doesn't
+// prevent the replay of the others.
+func (a *adapter) replayMessages(ctx context.Context, r replayReceiver, seqNums []int64) (int, error) {
+	var errs errList
+	var replayed int
+
+	for _, seqNum := range seqNums {
+		found, err := a.replayMessage(ctx, r, seqNum)
+		if found {
+			replayed++
+		}
+		if err != nil {
+			errs.errs = append(errs.errs, err)
+		}
+	}
+
+	if len(errs.errs) != 0 {
+		return replayed, &errs
+	}
+	return replayed, nil
+}
+
+// replayMessage re-emits as a CloudEvent the message with the given sequence
+// number, and returns whether that message was found.
+//
+// The message is peeked at first, because Service Bus fails the reception of
+// deferred messages by sequence number when the message isn't deferred.
+// Deferred messages are then received, and settled like any other message
+// once handled. Other messages are handled as peeked.
+func (a *adapter) replayMessage(ctx context.Context, r replayReceiver, seqNum int64) (bool, error) {
+	m, err := peekBySequenceNumber(ctx, r, seqNum)
+	if err != nil {
+		return false, fmt.Errorf("peeking at message with sequence number %d: %w", seqNum, wrapPermissionError(err))
+	}
+	if m == nil {
+		a.logger.Warnw("No message to replay with the given sequence number", zap.Int64("sequenceNumber", seqNum))
+		return false, nil
+	}
+
+	if m.State != azservicebus.MessageStateDeferred {
+		msg, err := toMessage(m)
+		if err != nil {
+			return true, fmt.Errorf("reading message with ID %s: %w", m.MessageID, err)
+		}
+		return true, a.handleMessage(ctx, msg, nil)
+	}
+
+	deferred, err := r.ReceiveDeferredMessages(ctx, []int64{seqNum}, nil)
+	if err != nil {
+		return true, fmt.Errorf("receiving deferred message with sequence number %d: %w",
+			seqNum, wrapPermissionError(err))
+	}
+	if len(deferred) == 0 {
+		a.logger.Warnw("Deferred message was settled before it could be replayed", zap.Int64("sequenceNumber", seqNum))
+		return false, nil
+	}
+	m = deferred[0]
+
+	msg, err := toMessage(m)
+	if err != nil {
+		return true, fmt.Errorf("reading message with ID %s: %w", m.MessageID, err)
+	}
+
+	fm := &fullMessage{
+		rcvr:         r,
+		received:     m,
+		serializable: msg,
+	}
+	handleErr := a.handleMessage(ctx, msg, a.earlyCompletion(ctx, fm))
+	if err := a.settleMessage(ctx, fm, handleErr); err != nil {
+		return true, err
+	}
+	return true, handleErr
+}
+
+// peekBySequenceNumber peeks at the message with the given sequence number.
+// It returns nil if no such message exists in the entity.
+func peekBySequenceNumber(ctx context.Context, p messagePeeker, seqNum int64) (*azservicebus.ReceivedMessage, error) {
+	msgs, err := p.PeekMessages(ctx, 1, &azservicebus.PeekMessagesOptions{
+		FromSequenceNumber: &seqNum,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Peeking returns the next message from the given sequence number,
+	// which is a different message when the requested one doesn't exist.
+	if len(msgs) == 0 || msgs[0].SequenceNumber == nil || *msgs[0].SequenceNumber != seqNum {
+		return nil, nil
+	}
+	return msgs[0], nil
+}
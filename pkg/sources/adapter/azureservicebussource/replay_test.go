@@ -0,0 +1,220 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestParseSequenceNumbers(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expect    []int64
+		expectErr bool
+	}{
+		{
+			name:   "Empty input",
+			input:  "",
+			expect: []int64{},
+		},
+		{
+			name:   "One per line",
+			input:  "12\n34\n\n56\n",
+			expect: []int64{12, 34, 56},
+		},
+		{
+			name:   "Comma separated",
+			input:  "12, 34,56",
+			expect: []int64{12, 34, 56},
+		},
+		{
+			name:      "Invalid sequence number",
+			input:     "12\nabc\n",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seqNums, err := parseSequenceNumbers(tc.input)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, seqNums)
+		})
+	}
+}
+
+func TestReplaySequenceNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seqnums")
+	require.NoError(t, os.WriteFile(path, []byte("3\n4\n"), 0o600))
+
+	seqNums, err := replaySequenceNumbers("1,2", path)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4}, seqNums)
+
+	seqNums, err = replaySequenceNumbers("1 2", "")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, seqNums)
+
+	_, err = replaySequenceNumbers("1", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	_, err = ReplayAdapterConstructor("", "")
+	assert.Error(t, err, "At least one sequence number is required")
+}
+
+func TestStartReplay(t *testing.T) {
+	rcvr := &replayingReceiver{
+		deferred: []*azservicebus.ReceivedMessage{
+			newDeferredMessage("deferred", 1),
+		},
+		active: []*azservicebus.ReceivedMessage{
+			newSequencedMessage("active", 2),
+			newSequencedMessage("next", 4),
+		},
+	}
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		msgRcvr:       rcvr,
+		ceClient:      ceClient,
+		msgPrcsr:      &defaultMessageProcessor{},
+		replaySeqNums: []int64{1, 2, 3},
+
+		mt: &pkgadapter.MetricTag{},
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	err := a.Start(context.Background())
+	require.NoError(t, err)
+
+	sent := ceClient.Sent()
+	require.Len(t, sent, 2, "Expected the deferred and the active message to be replayed")
+	assert.Equal(t, "deferred", sent[0].ID())
+	assert.Equal(t, "active", sent[1].ID())
+
+	assert.Equal(t, []string{"deferred"}, rcvr.completed,
+		"Only deferred messages can be settled")
+	assert.Equal(t, []int64{1, 2, 3}, rcvr.peekedFrom,
+		"Expected all messages to be peeked at")
+	assert.Equal(t, []int64{1}, rcvr.receivedDeferred,
+		"Expected only deferred messages to be received")
+}
+
+// replayingReceiver is a fakeReceiver which serves messages by sequence
+// number.
+type replayingReceiver struct {
+	fakeReceiver
+
+	// messages which were deferred
+	deferred []*azservicebus.ReceivedMessage
+	// active messages
+	active []*azservicebus.ReceivedMessage
+
+	peekedFrom       []int64
+	receivedDeferred []int64
+}
+
+var _ replayReceiver = (*replayingReceiver)(nil)
+
+// ReceiveDeferredMessages implements replayReceiver.
+func (r *replayingReceiver) ReceiveDeferredMessages(_ context.Context, seqNums []int64,
+	_ *azservicebus.ReceiveDeferredMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+
+	// Like Service Bus, fail the whole call when any of the requested
+	// messages isn't deferred.
+	var msgs []*azservicebus.ReceivedMessage
+	for _, n := range seqNums {
+		m := findBySequenceNumber(r.deferred, n)
+		if m == nil {
+			return nil, fmt.Errorf("message with sequence number %d is not deferred", n)
+		}
+		msgs = append(msgs, m)
+	}
+
+	r.receivedDeferred = append(r.receivedDeferred, seqNums...)
+	return msgs, nil
+}
+
+// PeekMessages implements replayReceiver.
+func (r *replayingReceiver) PeekMessages(_ context.Context, maxMessages int,
+	opts *azservicebus.PeekMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+
+	r.peekedFrom = append(r.peekedFrom, *opts.FromSequenceNumber)
+
+	all := append(append([]*azservicebus.ReceivedMessage(nil), r.active...), r.deferred...)
+	sort.Slice(all, func(i, j int) bool { return *all[i].SequenceNumber < *all[j].SequenceNumber })
+
+	var msgs []*azservicebus.ReceivedMessage
+	for _, m := range all {
+		if len(msgs) < maxMessages && *m.SequenceNumber >= *opts.FromSequenceNumber {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+// findBySequenceNumber returns the message with the given sequence number
+// among msgs, or nil if there is none.
+func findBySequenceNumber(msgs []*azservicebus.ReceivedMessage, seqNum int64) *azservicebus.ReceivedMessage {
+	for _, m := range msgs {
+		if *m.SequenceNumber == seqNum {
+			return m
+		}
+	}
+	return nil
+}
+
+// newSequencedMessage returns a Service Bus message with the given ID and
+// sequence number.
+func newSequencedMessage(id string, seqNum int64) *azservicebus.ReceivedMessage {
+	return &azservicebus.ReceivedMessage{
+		MessageID:      id,
+		SequenceNumber: &seqNum,
+		Body:           []byte(`{"test": null}`),
+	}
+}
+
+// newDeferredMessage returns a deferred Service Bus message with the given ID
+// and sequence number.
+func newDeferredMessage(id string, seqNum int64) *azservicebus.ReceivedMessage {
+	m := newSequencedMessage(id, seqNum)
+	m.State = azservicebus.MessageStateDeferred
+	return m
+}
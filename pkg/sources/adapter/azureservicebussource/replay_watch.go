@@ -0,0 +1,187 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// Duration without file system events after which the replay list is read,
+// so that a file which is being written isn't read partially.
+const replayListSettleDelay = 500 * time.Millisecond
+
+// replayListWatcher watches a file which lists the sequence numbers of
+// messages to replay, and keeps track of the sequence numbers which were
+// already replayed.
+type replayListWatcher struct {
+	path    string
+	watcher *fsnotify.Watcher
+
+	mu sync.Mutex
+	// sequence numbers which were either replayed, or already listed when
+	// the watcher was created
+	seen map[int64]struct{}
+}
+
+// newReplayListWatcher returns a replayListWatcher for the file at the given
+// path. Sequence numbers which are listed in the file at that point are not
+// replayed, so that restarts of the adapter don't replay them again. The file
+// doesn't need to exist yet, but its parent directory does.
+func newReplayListWatcher(path string) (*replayListWatcher, error) {
+	seqNums, err := readSequenceNumbersFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating file watcher: %w", err)
+	}
+
+	// Files mounted from ConfigMaps are updated by swapping a symbolic link
+	// in their parent directory, which is therefore watched instead of the
+	// file itself.
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("watching directory of file %q: %w", path, err)
+	}
+
+	seen := make(map[int64]struct{}, len(seqNums))
+	for _, n := range seqNums {
+		seen[n] = struct{}{}
+	}
+
+	return &replayListWatcher{
+		path:    path,
+		watcher: w,
+		seen:    seen,
+	}, nil
+}
+
+// newSequenceNumbers returns the sequence numbers listed in the watched file
+// which weren't seen before. Sequence numbers are only marked as seen once
+// replayed, by calling markReplayed.
+func (w *replayListWatcher) newSequenceNumbers() ([]int64, error) {
+	seqNums, err := readSequenceNumbersFile(w.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var newSeqNums []int64
+	listed := make(map[int64]struct{}, len(seqNums))
+	for _, n := range seqNums {
+		if _, ok := w.seen[n]; ok {
+			continue
+		}
+		if _, ok := listed[n]; ok {
+			continue
+		}
+		listed[n] = struct{}{}
+		newSeqNums = append(newSeqNums, n)
+	}
+
+	return newSeqNums, nil
+}
+
+// markReplayed marks the given sequence number as seen, so that it isn't
+// replayed again.
+func (w *replayListWatcher) markReplayed(seqNum int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seen[seqNum] = struct{}{}
+}
+
+// watchReplayList replays the messages whose sequence numbers get added to
+// the watched replay list, until ctx is canceled. Messages are replayed one
+// at a time, and each sequence number is replayed at most once. A sequence
+// number whose replay fails is retried the next time the list changes.
+func (a *adapter) watchReplayList(ctx context.Context) {
+	w := a.replayWatcher
+	defer w.watcher.Close()
+
+	r, ok := a.msgRcvr.(replayReceiver)
+	if !ok {
+		a.logger.Error("The message receiver does not support receiving messages by sequence number, " +
+			"the replay list is ignored")
+		return
+	}
+
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			a.logger.Warnw("Error watching the replay list", zap.Error(err))
+
+		case _, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			settled = time.After(replayListSettleDelay)
+
+		case <-settled:
+			settled = nil
+
+			seqNums, err := w.newSequenceNumbers()
+			if err != nil {
+				a.logger.Errorw("Unable to read the replay list", zap.Error(err))
+				continue
+			}
+			if len(seqNums) == 0 {
+				continue
+			}
+
+			a.logger.Infow("Replaying messages added to the replay list", zap.Int64s("sequenceNumbers", seqNums))
+
+			var replayed int
+			for _, n := range seqNums {
+				found, err := a.replayMessage(ctx, r, n)
+				if err != nil {
+					a.logger.Errorw("Failed to replay message", zap.Int64("sequenceNumber", n), zap.Error(err))
+					continue
+				}
+				w.markReplayed(n)
+				if found {
+					replayed++
+				}
+			}
+			a.logger.Infof("Replayed %d out of %d message(s)", replayed, len(seqNums))
+		}
+	}
+}
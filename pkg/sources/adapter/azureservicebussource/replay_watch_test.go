@@ -0,0 +1,134 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudevents/sdk-go/v2/protocol"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestReplayListWatcherNewSequenceNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay")
+
+	w, err := newReplayListWatcher(path)
+	require.NoError(t, err, "The file doesn't need to exist")
+	defer w.watcher.Close()
+
+	seqNums, err := w.newSequenceNumbers()
+	require.NoError(t, err)
+	assert.Empty(t, seqNums)
+
+	require.NoError(t, os.WriteFile(path, []byte("1\n2\n1\n"), 0o600))
+	seqNums, err = w.newSequenceNumbers()
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, seqNums)
+
+	w.markReplayed(1)
+
+	require.NoError(t, os.WriteFile(path, []byte("2\n3\n1\n"), 0o600))
+	seqNums, err = w.newSequenceNumbers()
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, seqNums, "Only replayed sequence numbers should be omitted")
+
+	require.NoError(t, os.WriteFile(path, []byte("4,x"), 0o600))
+	_, err = w.newSequenceNumbers()
+	assert.Error(t, err)
+
+	_, err = newReplayListWatcher(filepath.Join(t.TempDir(), "missing", "replay"))
+	assert.Error(t, err, "The parent directory must exist")
+}
+
+func TestWatchReplayList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay")
+	require.NoError(t, os.WriteFile(path, []byte("1\n"), 0o600))
+
+	w, err := newReplayListWatcher(path)
+	require.NoError(t, err)
+
+	rcvr := &replayingReceiver{
+		deferred: []*azservicebus.ReceivedMessage{
+			newDeferredMessage("deferred", 2),
+		},
+		active: []*azservicebus.ReceivedMessage{
+			newSequencedMessage("listed-on-start", 1),
+			newSequencedMessage("active", 3),
+		},
+	}
+
+	// The first replay of the deferred message fails.
+	ceClient := &sequenceResultClient{
+		TestCloudEventsClient: adaptertest.NewTestClient(),
+		results:               []protocol.Result{errors.New("sink unavailable"), nil, nil, nil},
+	}
+
+	a := &adapter{
+		logger:        logtesting.TestLogger(t),
+		msgRcvr:       rcvr,
+		ceClient:      ceClient,
+		msgPrcsr:      &defaultMessageProcessor{},
+		replayWatcher: w,
+
+		mt: &pkgadapter.MetricTag{},
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.watchReplayList(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.NoError(t, os.WriteFile(path, []byte("1\n2\n3\n"), 0o600))
+
+	require.Eventually(t, func() bool { return len(ceClient.Sent()) == 1 },
+		5*time.Second, 10*time.Millisecond, "Expected the added sequence numbers to be replayed")
+	assert.Equal(t, "active", ceClient.Sent()[0].ID())
+
+	// Rewriting the list retries the sequence number whose replay failed,
+	// but doesn't replay the other messages again.
+	require.NoError(t, os.WriteFile(path, []byte("3\n2\n1\n"), 0o600))
+
+	require.Eventually(t, func() bool { return len(ceClient.Sent()) == 2 },
+		5*time.Second, 10*time.Millisecond, "Expected the failed replay to be retried")
+	assert.Equal(t, "deferred", ceClient.Sent()[1].ID())
+
+	require.NoError(t, os.WriteFile(path, []byte("1\n2\n3\n"), 0o600))
+	time.Sleep(2 * replayListSettleDelay)
+	assert.Len(t, ceClient.Sent(), 2)
+}
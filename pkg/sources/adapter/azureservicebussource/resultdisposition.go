@@ -0,0 +1,209 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// Dispositions of messages which results of the delivery of events can be
+// mapped to.
+const (
+	dispositionComplete   = "complete"
+	dispositionAbandon    = "abandon"
+	dispositionDeadLetter = "deadletter"
+)
+
+// dispositionPrecedence orders dispositions by precedence when the events of
+// a message map to different dispositions. A message is only completed if
+// none of its events requires it to be redelivered or dead-lettered.
+var dispositionPrecedence = map[string]int{
+	dispositionComplete:   0,
+	dispositionDeadLetter: 1,
+	dispositionAbandon:    2,
+}
+
+// resultDispositions maps the HTTP status codes returned by the sink upon
+// failed deliveries to the disposition of the messages the undelivered events
+// were produced from.
+type resultDispositions struct {
+	// dispositions indexed by status code
+	byStatus map[int]string
+	// dispositions indexed by class of status code (e.g. 4 for 4xx)
+	byClass map[int]string
+}
+
+// parseResultDispositions parses a comma-separated list of rules in the
+// format <status>=<disposition>, where <status> is either an HTTP status code
+// (e.g. "422") or a class of status codes (e.g. "4xx"), and <disposition> is
+// one of "complete", "abandon" or "deadletter".
+//
+// It returns nil if the list is empty.
+func parseResultDispositions(rules string) (*resultDispositions, error) {
+	d := &resultDispositions{
+		byStatus: make(map[int]string),
+		byClass:  make(map[int]string),
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+
+		status, disp, ok := strings.Cut(rule, "=")
+		status, disp = strings.ToLower(strings.TrimSpace(status)), strings.TrimSpace(disp)
+		if !ok || status == "" || disp == "" {
+			return nil, fmt.Errorf("invalid result disposition rule %q: expected the format status=disposition", rule)
+		}
+
+		if _, supported := dispositionPrecedence[disp]; !supported {
+			return nil, fmt.Errorf("unsupported disposition %q in rule %q, expected one of %s, %s or %s",
+				disp, rule, dispositionComplete, dispositionAbandon, dispositionDeadLetter)
+		}
+
+		dispositions := d.byStatus
+		code, err := strconv.Atoi(status)
+		class, isClass := strings.CutSuffix(status, "xx")
+		if isClass {
+			dispositions = d.byClass
+			code, err = strconv.Atoi(class)
+			code *= 100
+		}
+		if err != nil || len(status) != 3 || code < 400 || code > 599 {
+			return nil, fmt.Errorf("invalid status %q in rule %q: expected either a 4xx or 5xx HTTP status code, "+
+				"or one of the classes 4xx and 5xx", status, rule)
+		}
+
+		key := code
+		if isClass {
+			key = code / 100
+		}
+
+		if _, dup := dispositions[key]; dup {
+			return nil, fmt.Errorf("status %q is mapped more than once", status)
+		}
+		dispositions[key] = disp
+	}
+
+	if len(d.byStatus) == 0 && len(d.byClass) == 0 {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// forResult returns the disposition which the given result of a failed
+// delivery maps to, if any. Statuses take precedence over classes of
+// statuses.
+func (d *resultDispositions) forResult(result protocol.Result) (string, bool) {
+	var httpResult *cehttp.Result
+	if !cloudevents.ResultAs(result, &httpResult) {
+		return "", false
+	}
+
+	if disp, ok := d.byStatus[httpResult.StatusCode]; ok {
+		return disp, true
+	}
+	disp, ok := d.byClass[httpResult.StatusCode/100]
+	return disp, ok
+}
+
+// forDeliveryError returns the disposition of a message, the events of which
+// failed to be delivered with the given error. It returns false unless the
+// failed delivery of every undelivered event maps to a disposition, in which
+// case the disposition with the highest precedence applies.
+//
+// A nil resultDispositions doesn't map any delivery failure.
+func (d *resultDispositions) forDeliveryError(delivErr *deliveryError) (string, bool) {
+	if d == nil || len(delivErr.errs.errs) == 0 {
+		return "", false
+	}
+
+	var disposition string
+	for _, err := range delivErr.errs.errs {
+		var sendErr *sendError
+		if !errors.As(err, &sendErr) {
+			return "", false
+		}
+
+		disp, ok := d.forResult(sendErr.err)
+		if !ok {
+			return "", false
+		}
+		if disposition == "" || dispositionPrecedence[disp] > dispositionPrecedence[disposition] {
+			disposition = disp
+		}
+	}
+
+	return disposition, true
+}
+
+// settleByResult settles a message, the events of which failed to be
+// delivered, according to the disposition the results of these deliveries
+// map to. It returns whether the message was settled, which isn't the case
+// when the failure isn't mapped to any disposition, and the error which
+// occurred while settling it, if any.
+func (a *adapter) settleByResult(ctx context.Context, fm *fullMessage, handleErr error) (bool, error) {
+	var delivErr *deliveryError
+	if !errors.As(handleErr, &delivErr) {
+		return false, nil
+	}
+
+	disp, ok := a.resultDispositions.forDeliveryError(delivErr)
+	if !ok {
+		return false, nil
+	}
+
+	switch disp {
+	case dispositionComplete:
+		a.logger.Warnw("Completing message the events of which could not be delivered, as mapped from the result",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+		a.forwardToDeadLetterSink(ctx, fm.serializable, handleErr)
+
+		if err := a.disposition().Complete(ctx, fm.rcvr, fm.received); err != nil {
+			return true, fmt.Errorf("error completing message: %w", err)
+		}
+
+	case dispositionDeadLetter:
+		a.logger.Errorw("Dead-lettering message the events of which could not be delivered, as mapped from the result",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+		if err := a.deadLetter(ctx, fm, handleErr, deadLetterReasonRejected, delivErr.Error()); err != nil {
+			return true, err
+		}
+
+	default:
+		a.logger.Errorw("Abandoning message the events of which could not be delivered, as mapped from the result",
+			zap.String(logfieldMsgID, fm.received.MessageID), zap.Error(handleErr))
+
+		if err := a.disposition().Abandon(ctx, fm.rcvr, fm.received); err != nil {
+			return true, fmt.Errorf("error abandoning message: %w", err)
+		}
+	}
+
+	return true, nil
+}
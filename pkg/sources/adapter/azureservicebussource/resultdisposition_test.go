@@ -0,0 +1,258 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestParseResultDispositions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		rules     string
+		expect    *resultDispositions
+		expectErr bool
+	}{
+		{
+			name: "No rule",
+		},
+		{
+			name:  "Statuses and classes",
+			rules: " 422=deadletter, 503 = abandon,4XX=complete,",
+			expect: &resultDispositions{
+				byStatus: map[int]string{422: dispositionDeadLetter, 503: dispositionAbandon},
+				byClass:  map[int]string{4: dispositionComplete},
+			},
+		},
+		{
+			name:      "Missing disposition",
+			rules:     "422",
+			expectErr: true,
+		},
+		{
+			name:      "Unsupported disposition",
+			rules:     "422=retry",
+			expectErr: true,
+		},
+		{
+			name:      "Successful status",
+			rules:     "200=complete",
+			expectErr: true,
+		},
+		{
+			name:      "Invalid status",
+			rules:     "4x2=complete",
+			expectErr: true,
+		},
+		{
+			name:      "Unsupported class",
+			rules:     "3xx=complete",
+			expectErr: true,
+		},
+		{
+			name:      "Duplicate status",
+			rules:     "422=deadletter,422=abandon",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := parseResultDispositions(tc.rules)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, d)
+		})
+	}
+}
+
+func TestResultDispositionsForDeliveryError(t *testing.T) {
+	d, err := parseResultDispositions("422=deadletter,503=abandon,4xx=complete")
+	require.NoError(t, err)
+
+	delivErr := func(results ...error) *deliveryError {
+		errs := make([]error, len(results))
+		for i, r := range results {
+			errs[i] = &sendError{eventID: "someEventID", err: r}
+		}
+		return &deliveryError{numEvents: len(results), errs: errList{errs: errs}}
+	}
+
+	unprocessable := cehttp.NewResult(http.StatusUnprocessableEntity, "unprocessable")
+	unavailable := cehttp.NewResult(http.StatusServiceUnavailable, "unavailable")
+	conflict := cehttp.NewResult(http.StatusConflict, "conflict")
+	badGateway := cehttp.NewResult(http.StatusBadGateway, "bad gateway")
+
+	testCases := []struct {
+		name          string
+		delivErr      *deliveryError
+		expectDisp    string
+		expectDispSet bool
+	}{
+		{
+			name:          "Status mapped",
+			delivErr:      delivErr(unprocessable),
+			expectDisp:    dispositionDeadLetter,
+			expectDispSet: true,
+		},
+		{
+			name:          "Class mapped",
+			delivErr:      delivErr(conflict),
+			expectDisp:    dispositionComplete,
+			expectDispSet: true,
+		},
+		{
+			name:     "Status not mapped",
+			delivErr: delivErr(badGateway),
+		},
+		{
+			name:     "Connection error",
+			delivErr: delivErr(errors.New("connection refused")),
+		},
+		{
+			name:          "Abandon takes precedence",
+			delivErr:      delivErr(conflict, unavailable, unprocessable),
+			expectDisp:    dispositionAbandon,
+			expectDispSet: true,
+		},
+		{
+			name:          "Dead-letter takes precedence over completion",
+			delivErr:      delivErr(conflict, unprocessable),
+			expectDisp:    dispositionDeadLetter,
+			expectDispSet: true,
+		},
+		{
+			name:     "Some failures not mapped",
+			delivErr: delivErr(unprocessable, badGateway),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disp, ok := d.forDeliveryError(tc.delivErr)
+			assert.Equal(t, tc.expectDispSet, ok)
+			assert.Equal(t, tc.expectDisp, disp)
+		})
+	}
+
+	var nilDispositions *resultDispositions
+	_, ok := nilDispositions.forDeliveryError(delivErr(unprocessable))
+	assert.False(t, ok, "A nil resultDispositions shouldn't map any failure")
+}
+
+func TestSettleMessageResultDispositions(t *testing.T) {
+	d, err := parseResultDispositions("422=deadletter,409=complete")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name             string
+		result           error
+		expectSettlement string
+		expectReasons    []string
+	}{
+		{
+			name:             "Mapped to dead-letter",
+			result:           cehttp.NewResult(http.StatusUnprocessableEntity, "unprocessable"),
+			expectSettlement: settledDeadLetter,
+			expectReasons:    []string{deadLetterReasonRejected},
+		},
+		{
+			name:             "Mapped to completion",
+			result:           cehttp.NewResult(http.StatusConflict, "conflict"),
+			expectSettlement: settledComplete,
+		},
+		{
+			name:             "Not mapped",
+			result:           cehttp.NewResult(http.StatusServiceUnavailable, "unavailable"),
+			expectSettlement: settledAbandon,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disp := &fakeDispositioner{}
+
+			a := &adapter{
+				logger:             logtesting.TestLogger(t),
+				dispositioner:      disp,
+				resultDispositions: d,
+			}
+
+			fm := &fullMessage{
+				rcvr:     &fakeReceiver{},
+				received: &azservicebus.ReceivedMessage{MessageID: "someMessageID"},
+			}
+
+			handleErr := &deliveryError{
+				numEvents: 1,
+				errs:      errList{errs: []error{&sendError{eventID: "someEventID", err: tc.result}}},
+			}
+
+			err := a.settleMessage(context.Background(), fm, handleErr)
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{tc.expectSettlement}, disp.settlements)
+			assert.Equal(t, tc.expectReasons, disp.deadLetterReasons)
+		})
+	}
+}
+
+func TestResultDispositionsBatchedDelivery(t *testing.T) {
+	d, err := parseResultDispositions("422=deadletter")
+	require.NoError(t, err)
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+	defer sink.Close()
+
+	c := newBatchingClient(adaptertest.NewTestClient(), logtesting.TestLogger(t), sink.URL, 1, time.Hour, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go c.run(ctx)
+
+	result := c.Send(ctx, newTestEvent("1"))
+
+	delivErr := &deliveryError{
+		numEvents: 1,
+		errs:      errList{errs: []error{&sendError{eventID: "1", err: result}}},
+	}
+
+	disp, ok := d.forDeliveryError(delivErr)
+	assert.True(t, ok, "The status returned for the batch should be mapped")
+	assert.Equal(t, dispositionDeadLetter, disp)
+}
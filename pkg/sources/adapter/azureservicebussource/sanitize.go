@@ -0,0 +1,97 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// Names of the built-in event sanitizers.
+const (
+	sanitizerInvalidDataSchema = "invalid-dataschema"
+	sanitizerInvalidTime       = "invalid-time"
+	sanitizerInvalidSubject    = "invalid-subject"
+	sanitizerMissingSource     = "missing-source"
+)
+
+// EventSanitizer fixes, in place, some of the validation issues listed in the
+// given cloudevents.ValidationError. Attributes which aren't listed in the
+// ValidationError must be left untouched.
+//
+// fallbackSource is the source of the adapter, which can be used in place of
+// a missing source.
+type EventSanitizer func(validErrs event.ValidationError, ev *cloudevents.Event, fallbackSource string)
+
+// sanitizers is the registry of event sanitizers.
+var sanitizers = newRegistry("event sanitizer", map[string]EventSanitizer{
+	// Clears an invalid dataschema, such as the
+	//
+	//   "dataschema": "#"
+	//
+	// often found in CloudEvents sent by Azure Event Grid.
+	sanitizerInvalidDataSchema: func(validErrs event.ValidationError, ev *cloudevents.Event, _ string) {
+		if _, ok := validErrs["dataschema"]; ok {
+			ev.SetDataSchema("")
+		}
+	},
+	sanitizerInvalidTime: func(validErrs event.ValidationError, ev *cloudevents.Event, _ string) {
+		if _, ok := validErrs["time"]; ok {
+			ev.SetTime(time.Time{})
+		}
+	},
+	sanitizerInvalidSubject: func(validErrs event.ValidationError, ev *cloudevents.Event, _ string) {
+		if _, ok := validErrs["subject"]; ok {
+			ev.SetSubject("")
+		}
+	},
+	sanitizerMissingSource: func(validErrs event.ValidationError, ev *cloudevents.Event, fallbackSource string) {
+		if _, ok := validErrs["source"]; ok && fallbackSource != "" {
+			ev.SetSource(fallbackSource)
+		}
+	},
+})
+
+// RegisterEventSanitizer makes an EventSanitizer available under the given
+// name, which can then be enabled using the SERVICEBUS_EVENT_SANITIZERS
+// environment variable. It is intended to be called from the init function of
+// packages which provide custom sanitizers.
+//
+// RegisterEventSanitizer panics if s is nil, or if a sanitizer is already
+// registered under the same name.
+func RegisterEventSanitizer(name string, s EventSanitizer) {
+	if s == nil {
+		panic("azureservicebussource: nil event sanitizer " + name)
+	}
+	sanitizers.register(name, s)
+}
+
+// sanitizeEvent applies the given sanitizers, in order, to an event which
+// failed validation, and returns the sanitized event.
+func sanitizeEvent(enabled []EventSanitizer, validErrs event.ValidationError,
+	origEvent *cloudevents.Event, fallbackSource string) *cloudevents.Event {
+
+	// we don't bother cloning, events are garbage collected after being
+	// sent to the sink
+	for _, s := range enabled {
+		s(validErrs, origEvent, fallbackSource)
+	}
+
+	return origEvent
+}
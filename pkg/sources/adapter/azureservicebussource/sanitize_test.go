@@ -0,0 +1,194 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+func TestSanitizeEvent(t *testing.T) {
+	const fallbackSource = "/fallback/source"
+
+	eventTime := time.Unix(0, 0)
+
+	newEvent := func() *cloudevents.Event {
+		e := cloudevents.NewEvent()
+		e.SetID("some-id")
+		e.SetType("some.type")
+		e.SetSource("some/source")
+		e.SetSubject("some-subject")
+		e.SetTime(eventTime)
+		e.SetDataSchema("http://example.com/schema")
+		return &e
+	}
+
+	testCases := []struct {
+		name      string
+		invalid   string
+		fallback  string
+		mutate    func(*cloudevents.Event)
+		assertion func(*testing.T, *cloudevents.Event)
+	}{
+		{
+			name:    "Invalid dataschema is cleared",
+			invalid: "dataschema",
+			assertion: func(t *testing.T, e *cloudevents.Event) {
+				assert.Empty(t, e.DataSchema())
+			},
+		},
+		{
+			name:    "Invalid time is cleared",
+			invalid: "time",
+			assertion: func(t *testing.T, e *cloudevents.Event) {
+				assert.True(t, e.Time().IsZero())
+			},
+		},
+		{
+			name:    "Invalid subject is cleared",
+			invalid: "subject",
+			assertion: func(t *testing.T, e *cloudevents.Event) {
+				assert.Empty(t, e.Subject())
+			},
+		},
+		{
+			name:     "Missing source is replaced",
+			invalid:  "source",
+			fallback: fallbackSource,
+			mutate: func(e *cloudevents.Event) {
+				e.Context.(*event.EventContextV1).Source = types.URIRef{}
+			},
+			assertion: func(t *testing.T, e *cloudevents.Event) {
+				assert.Equal(t, fallbackSource, e.Source())
+				assert.NoError(t, e.Validate())
+			},
+		},
+		{
+			name:    "Missing source without fallback",
+			invalid: "source",
+			mutate: func(e *cloudevents.Event) {
+				e.Context.(*event.EventContextV1).Source = types.URIRef{}
+			},
+			assertion: func(t *testing.T, e *cloudevents.Event) {
+				assert.Empty(t, e.Source())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newEvent()
+			if tc.mutate != nil {
+				tc.mutate(e)
+			}
+
+			expect := e.Clone()
+
+			validErrs := event.ValidationError{tc.invalid: errors.New("invalid")}
+			out := sanitizeEvent(defaultSanitizers(t), validErrs, e, tc.fallback)
+
+			tc.assertion(t, out)
+
+			// Attributes other than the invalid one are left untouched.
+			if tc.invalid != "dataschema" {
+				assert.Equal(t, expect.DataSchema(), out.DataSchema())
+			}
+			if tc.invalid != "time" {
+				assert.Equal(t, expect.Time(), out.Time())
+			}
+			if tc.invalid != "subject" {
+				assert.Equal(t, expect.Subject(), out.Subject())
+			}
+			if tc.invalid != "source" {
+				assert.Equal(t, expect.Source(), out.Source())
+			}
+			assert.Equal(t, expect.ID(), out.ID())
+			assert.Equal(t, expect.Type(), out.Type())
+		})
+	}
+}
+
+func TestSanitizeEventOrder(t *testing.T) {
+	var applied []string
+
+	recordSanitizer := func(name string) EventSanitizer {
+		return func(event.ValidationError, *cloudevents.Event, string) {
+			applied = append(applied, name)
+		}
+	}
+
+	e := cloudevents.NewEvent()
+	e.SetDataSchema("http://example.com/schema")
+
+	validErrs := event.ValidationError{"dataschema": errors.New("invalid")}
+
+	out := sanitizeEvent([]EventSanitizer{recordSanitizer("b"), recordSanitizer("a")}, validErrs, &e, "")
+	assert.Equal(t, []string{"b", "a"}, applied, "Sanitizers are applied in the given order")
+	assert.Equal(t, "http://example.com/schema", out.DataSchema(), "Disabled sanitizers are not applied")
+}
+
+func TestRegisterEventSanitizer(t *testing.T) {
+	const name = "test-sanitizer"
+
+	RegisterEventSanitizer(name, func(_ event.ValidationError, ev *cloudevents.Event, _ string) {
+		ev.SetExtension("sanitized", true)
+	})
+	t.Cleanup(func() {
+		sanitizers.mu.Lock()
+		delete(sanitizers.entries, name)
+		sanitizers.mu.Unlock()
+	})
+
+	s, ok := sanitizers.lookup(name)
+	require.True(t, ok)
+	assert.Contains(t, sanitizers.names(), name)
+
+	e := cloudevents.NewEvent()
+	s(nil, &e, "")
+	assert.Equal(t, true, e.Extensions()["sanitized"])
+
+	assert.Panics(t, func() { RegisterEventSanitizer(name, s) }, "Duplicate name")
+	assert.Panics(t, func() { RegisterEventSanitizer("nil-sanitizer", nil) }, "Nil sanitizer")
+}
+
+// defaultSanitizers returns the event sanitizers which are enabled by default.
+func defaultSanitizers(t *testing.T) []EventSanitizer {
+	t.Helper()
+
+	names := []string{
+		sanitizerInvalidDataSchema,
+		sanitizerInvalidTime,
+		sanitizerInvalidSubject,
+		sanitizerMissingSource,
+	}
+
+	out := make([]EventSanitizer, len(names))
+	for i, n := range names {
+		s, ok := sanitizers.lookup(n)
+		require.True(t, ok, "Sanitizer %q is not registered", n)
+		out[i] = s
+	}
+	return out
+}
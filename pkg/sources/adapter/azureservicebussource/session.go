@@ -0,0 +1,230 @@
+/*
+Copyright 2022 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+const (
+	// Duration after which the adapter releases a session which has no
+	// message available, to move on to the next available session.
+	sessionIdleTimeout = 30 * time.Second
+
+	// Maximum duration of the attempt to accept a session, during the
+	// initialization of the adapter.
+	sessionProbeTimeout = 10 * time.Second
+)
+
+// sessionReceiver is a messageReceiver bound to a Service Bus session.
+type sessionReceiver interface {
+	messageReceiver
+	SessionID() string
+	Close(context.Context) error
+}
+
+var _ sessionReceiver = (*azservicebus.SessionReceiver)(nil)
+
+// sessionAcceptor accepts a session on a session-enabled Service Bus entity.
+type sessionAcceptor func(context.Context) (sessionReceiver, error)
+
+// newSessionAcceptor returns a sessionAcceptor for the given Service Bus
+// entity. If sessionID is empty, the returned sessionAcceptor accepts the next
+// available session.
+func newSessionAcceptor(client *azservicebus.Client, entityID *v1alpha1.AzureResourceID, sessionID string) sessionAcceptor {
+	switch entityID.ResourceType {
+	case azureservicebus.ResourceTypeQueues:
+		queue := entityID.ResourceName
+
+		if sessionID != "" {
+			return func(ctx context.Context) (sessionReceiver, error) {
+				return client.AcceptSessionForQueue(ctx, queue, sessionID, nil)
+			}
+		}
+		return func(ctx context.Context) (sessionReceiver, error) {
+			return client.AcceptNextSessionForQueue(ctx, queue, nil)
+		}
+
+	default:
+		topic, subs := entityID.ResourceName, entityID.SubResourceName
+
+		if sessionID != "" {
+			return func(ctx context.Context) (sessionReceiver, error) {
+				return client.AcceptSessionForSubscription(ctx, topic, subs, sessionID, nil)
+			}
+		}
+		return func(ctx context.Context) (sessionReceiver, error) {
+			return client.AcceptNextSessionForSubscription(ctx, topic, subs, nil)
+		}
+	}
+}
+
+// probeSessionEntity ensures that sessions can be accepted on the Service Bus
+// entity. Accepting a session on an entity which isn't session-enabled fails
+// right away, whereas the absence of available session on a session-enabled
+// entity results in a timeout.
+func probeSessionEntity(ctx context.Context, accept sessionAcceptor) error {
+	ctx, cancel := context.WithTimeout(ctx, sessionProbeTimeout)
+	defer cancel()
+
+	sr, err := accept(ctx)
+	if err != nil {
+		if isSessionUnavailable(err) {
+			return nil
+		}
+		return err
+	}
+
+	return sr.Close(ctx)
+}
+
+// isSessionUnavailable returns whether the given error indicates that no
+// session is currently available on the Service Bus entity.
+func isSessionUnavailable(err error) bool {
+	var sbErr *azservicebus.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &sbErr) && sbErr.Code == azservicebus.CodeTimeout
+}
+
+// isSessionLost returns whether the given error indicates that the lock on
+// the current session was lost.
+func isSessionLost(err error) bool {
+	var sbErr *azservicebus.Error
+	return errors.As(err, &sbErr) && sbErr.Code == azservicebus.CodeLockLost
+}
+
+// runSessions consumes messages from sessions of the Service Bus entity, one
+// session at a time. Multiple sessions are consumed in parallel by running
+// runSessions in multiple routines.
+//
+// Sessions are accepted and messages received until ctx is canceled, whereas
+// received messages are handled within handleCtx.
+func (a *adapter) runSessions(ctx, handleCtx context.Context, errChan chan error) {
+	for {
+		if a.pause != nil {
+			if err := a.pause.wait(ctx); err != nil {
+				return
+			}
+		}
+
+		sr, err := a.acceptSession(ctx)
+		switch {
+		case err == nil:
+			a.setReady(true)
+		case ctx.Err() != nil:
+			return
+		case isSessionUnavailable(err):
+			a.setReady(true)
+			continue
+		default:
+			a.setReady(false)
+			errChan <- fmt.Errorf("error accepting session: %w", wrapPermissionError(err))
+			return
+		}
+
+		err = a.consumeSession(ctx, handleCtx, sr)
+
+		if closeErr := sr.Close(context.Background()); closeErr != nil {
+			a.logger.Warnw("Failed to close session receiver", zap.String(logfieldSessionID, sr.SessionID()),
+				zap.Error(closeErr))
+		}
+
+		if err != nil {
+			a.setReady(false)
+			errChan <- err
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// consumeSession handles messages from the given session sequentially, in
+// the order they are received, which preserves the ordering guarantees of
+// Service Bus sessions.
+//
+// Unless the adapter is bound to a specific session, consumeSession returns
+// once the session has been idle for sessionIdleTimeout, so that other
+// sessions can be accepted.
+func (a *adapter) consumeSession(ctx, handleCtx context.Context, sr sessionReceiver) error {
+	a.logger.Debugw("Consuming messages from session", zap.String(logfieldSessionID, sr.SessionID()))
+
+	for {
+		// The session is released while the consumption of messages is
+		// paused, and accepted again once it is resumed.
+		if a.pause != nil && a.pause.isPaused() {
+			return nil
+		}
+
+		// The receive operation is interrupted as soon as the consumption
+		// of messages gets paused.
+		rcvCtx, cancel := context.WithTimeout(ctx, sessionIdleTimeout)
+		stopOnPause := context.CancelFunc(func() {})
+		if a.pause != nil {
+			rcvCtx, stopOnPause = a.pause.untilPaused(rcvCtx)
+		}
+		messages, err := sr.ReceiveMessages(rcvCtx, a.sessionPrefetch, nil)
+		stopOnPause()
+		cancel()
+
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return nil
+		case a.pause != nil && a.pause.isPaused():
+			return nil
+		case errors.Is(err, context.DeadlineExceeded):
+			if a.sessionID != "" {
+				continue
+			}
+			return nil
+		case isSessionLost(err):
+			a.logger.Warnw("Lost the lock on the session", zap.String(logfieldSessionID, sr.SessionID()))
+			return nil
+		default:
+			return fmt.Errorf("error receiving messages from session %q: %w", sr.SessionID(), err)
+		}
+
+		for _, m := range messages {
+			msg, err := toMessage(m)
+			if err != nil {
+				return fmt.Errorf("error transforming message: %w", err)
+			}
+
+			fm := &fullMessage{
+				rcvr:         sr,
+				received:     m,
+				serializable: msg,
+			}
+
+			if err := a.settleMessage(detach(handleCtx), fm, a.handleMessage(handleCtx, msg, a.earlyCompletion(handleCtx, fm))); err != nil {
+				return err
+			}
+		}
+	}
+}
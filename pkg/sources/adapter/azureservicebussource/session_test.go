@@ -0,0 +1,284 @@
+/*
+Copyright 2022 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/metrics"
+)
+
+func TestRunSessions(t *testing.T) {
+	const sessionID = "some-session"
+
+	sr := &fakeSessionReceiver{
+		id: sessionID,
+		batches: [][]*azservicebus.ReceivedMessage{
+			{newSessionMessage("1", sessionID), newSessionMessage("2", sessionID)},
+			{newSessionMessage("3", sessionID)},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var accepted int
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:   logtesting.TestLogger(t),
+		ceClient: ceClient,
+		msgPrcsr: &defaultMessageProcessor{},
+		acceptSession: func(ctx context.Context) (sessionReceiver, error) {
+			accepted++
+			if accepted > 1 {
+				// no more session to consume from
+				cancel()
+				return nil, ctx.Err()
+			}
+			return sr, nil
+		},
+		sessionPrefetch: 10,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	errChan := make(chan error, 1)
+	a.runSessions(ctx, ctx, errChan)
+	close(errChan)
+
+	assert.NoError(t, <-errChan)
+
+	assert.Equal(t, []string{"1", "2", "3"}, sr.completed, "Messages should be completed in order")
+	assert.True(t, sr.closed, "The session receiver should be closed")
+
+	sent := ceClient.Sent()
+	require.Len(t, sent, 3)
+	for i, id := range []string{"1", "2", "3"} {
+		assert.Equal(t, id, sent[i].ID(), "Events should be sent in order")
+		assert.Equal(t, sessionID, sent[i].Extensions()[extSessionID])
+	}
+}
+
+func TestStartConcurrentSessions(t *testing.T) {
+	unblock := make(chan struct{})
+
+	// The first session can only be consumed once the second one was
+	// accepted, which requires sessions to be consumed in parallel.
+	sessions := []*fakeSessionReceiver{{
+		id: "session1",
+		batches: [][]*azservicebus.ReceivedMessage{
+			{newSessionMessage("1-1", "session1"), newSessionMessage("1-2", "session1")},
+		},
+		unblock: unblock,
+	}, {
+		id: "session2",
+		batches: [][]*azservicebus.ReceivedMessage{
+			{newSessionMessage("2-1", "session2"), newSessionMessage("2-2", "session2")},
+		},
+	}}
+
+	var mu sync.Mutex
+	var accepted int
+
+	ceClient := adaptertest.NewTestClient()
+
+	a := &adapter{
+		logger:   logtesting.TestLogger(t),
+		ceClient: ceClient,
+		msgPrcsr: &defaultMessageProcessor{},
+		acceptSession: func(ctx context.Context) (sessionReceiver, error) {
+			mu.Lock()
+			i := accepted
+			accepted++
+			mu.Unlock()
+
+			switch i {
+			case 0:
+				return sessions[0], nil
+			case 1:
+				close(unblock)
+				return sessions[1], nil
+			}
+
+			// no more session to consume from
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		maxSessions:     2,
+		sessionPrefetch: 10,
+
+		sr: metrics.MustNewEventProcessingStatsReporter(&pkgadapter.MetricTag{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- a.Start(ctx)
+	}()
+
+	assert.Eventually(t, func() bool { return len(ceClient.Sent()) == 4 },
+		5*time.Second, 10*time.Millisecond, "Messages from both sessions should be handled")
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the adapter to stop")
+	}
+
+	assert.Equal(t, []string{"1-1", "1-2"}, sessions[0].completed, "Messages should be completed in order")
+	assert.Equal(t, []string{"2-1", "2-2"}, sessions[1].completed, "Messages should be completed in order")
+}
+
+func TestProbeSessionEntity(t *testing.T) {
+	testCases := []struct {
+		name      string
+		acceptErr error
+		expectErr bool
+	}{
+		{
+			name: "Session accepted",
+		},
+		{
+			name:      "No available session",
+			acceptErr: &azservicebus.Error{Code: azservicebus.CodeTimeout},
+		},
+		{
+			name:      "Entity is not session-enabled",
+			acceptErr: errors.New("the entity does not support sessions"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sr := &fakeSessionReceiver{}
+
+			err := probeSessionEntity(context.Background(), func(context.Context) (sessionReceiver, error) {
+				if tc.acceptErr != nil {
+					return nil, tc.acceptErr
+				}
+				return sr, nil
+			})
+
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.acceptErr == nil, sr.closed, "An accepted session should be released")
+		})
+	}
+}
+
+func newSessionMessage(id, sessionID string) *azservicebus.ReceivedMessage {
+	return &azservicebus.ReceivedMessage{
+		MessageID: id,
+		SessionID: to.Ptr(sessionID),
+		Body:      []byte(`{"test": null}`),
+	}
+}
+
+// fakeSessionReceiver is a sessionReceiver which returns predefined batches
+// of messages, and records the settlement of messages.
+type fakeSessionReceiver struct {
+	id      string
+	batches [][]*azservicebus.ReceivedMessage
+
+	// when not nil, the reception of messages is blocked until this
+	// channel is closed
+	unblock <-chan struct{}
+
+	completed []string
+	abandoned []string
+	closed    bool
+}
+
+var _ sessionReceiver = (*fakeSessionReceiver)(nil)
+
+// ReceiveMessages implements messageReceiver.
+func (r *fakeSessionReceiver) ReceiveMessages(ctx context.Context, _ int, _ *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	if r.unblock != nil {
+		select {
+		case <-r.unblock:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if len(r.batches) == 0 {
+		return nil, context.DeadlineExceeded
+	}
+
+	b := r.batches[0]
+	r.batches = r.batches[1:]
+	return b, nil
+}
+
+// CompleteMessage implements messageReceiver.
+func (r *fakeSessionReceiver) CompleteMessage(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.CompleteMessageOptions) error {
+	r.completed = append(r.completed, msg.MessageID)
+	return nil
+}
+
+// AbandonMessage implements messageReceiver.
+func (r *fakeSessionReceiver) AbandonMessage(_ context.Context, msg *azservicebus.ReceivedMessage, _ *azservicebus.AbandonMessageOptions) error {
+	r.abandoned = append(r.abandoned, msg.MessageID)
+	return nil
+}
+
+// DeadLetterMessage implements messageReceiver.
+func (r *fakeSessionReceiver) DeadLetterMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.DeadLetterOptions) error {
+	return nil
+}
+
+// DeferMessage implements messageReceiver.
+func (r *fakeSessionReceiver) DeferMessage(context.Context, *azservicebus.ReceivedMessage, *azservicebus.DeferMessageOptions) error {
+	return nil
+}
+
+// SessionID implements sessionReceiver.
+func (r *fakeSessionReceiver) SessionID() string {
+	return r.id
+}
+
+// Close implements sessionReceiver.
+func (r *fakeSessionReceiver) Close(context.Context) error {
+	r.closed = true
+	return nil
+}
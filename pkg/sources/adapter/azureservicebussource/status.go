@@ -0,0 +1,121 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// URL path of the debug status endpoint.
+const debugStatusEndpointPath = "/debug/status"
+
+// statusTracker keeps track of the handling of messages, for reporting the
+// current status of the adapter on the debug status endpoint. It is intended
+// for ad-hoc inspection, and complements the metrics of the adapter.
+type statusTracker struct {
+	inFlight  atomic.Int64
+	processed atomic.Uint64
+
+	// reports whether the consumption of messages is paused, when set
+	pause *pauseControl
+
+	mu            sync.Mutex
+	lastProcessed time.Time
+	lastLag       time.Duration
+	lastErr       error
+	lastErrTime   time.Time
+}
+
+// adapterStatus is the JSON representation of the status of the adapter.
+type adapterStatus struct {
+	Paused            bool       `json:"paused"`
+	InFlight          int64      `json:"inFlight"`
+	Processed         uint64     `json:"processed"`
+	LastProcessedTime *time.Time `json:"lastProcessedTime,omitempty"`
+	LastDeliveryLag   string     `json:"lastDeliveryLag,omitempty"`
+	LastError         string     `json:"lastError,omitempty"`
+	LastErrorTime     *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+var _ http.Handler = (*statusTracker)(nil)
+
+// begin records that the handling of the given message started, and returns
+// a function which records the end of this handling along with its result.
+func (s *statusTracker) begin(msg *Message) (done func(error)) {
+	s.inFlight.Add(1)
+
+	return func(err error) {
+		s.inFlight.Add(-1)
+		s.processed.Add(1)
+
+		now := time.Now()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.lastProcessed = now
+		if msg.EnqueuedTime != nil {
+			// clock skew between Service Bus and the local host
+			// can cause negative values, which are reported as is
+			s.lastLag = now.Sub(*msg.EnqueuedTime)
+		}
+
+		// Messages which were skipped aren't failures.
+		if err != nil && !errors.Is(err, errMessageNotDue) && !errors.Is(err, errMessageExpired) {
+			s.lastErr = err
+			s.lastErrTime = now
+		}
+	}
+}
+
+// snapshot returns the current status of the adapter.
+func (s *statusTracker) snapshot() *adapterStatus {
+	st := &adapterStatus{
+		InFlight:  s.inFlight.Load(),
+		Processed: s.processed.Load(),
+	}
+	if s.pause != nil {
+		st.Paused = s.pause.isPaused()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastProcessed.IsZero() {
+		t := s.lastProcessed
+		st.LastProcessedTime = &t
+		st.LastDeliveryLag = s.lastLag.String()
+	}
+	if s.lastErr != nil {
+		t := s.lastErrTime
+		st.LastError = s.lastErr.Error()
+		st.LastErrorTime = &t
+	}
+
+	return st
+}
+
+// ServeHTTP implements http.Handler.
+func (s *statusTracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.snapshot())
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestStatusTracker(t *testing.T) {
+	s := &statusTracker{}
+
+	st := s.snapshot()
+	assert.Equal(t, &adapterStatus{}, st, "Expected an empty status before any message is handled")
+
+	enqueuedTime := time.Now().Add(-time.Minute)
+	msg := &Message{ReceivedMessage: &azservicebus.ReceivedMessage{EnqueuedTime: &enqueuedTime}}
+
+	done1 := s.begin(msg)
+	done2 := s.begin(msg)
+	assert.EqualValues(t, 2, s.snapshot().InFlight)
+
+	done1(errors.New("sink unavailable"))
+	done2(errMessageNotDue)
+
+	st = s.snapshot()
+	assert.EqualValues(t, 0, st.InFlight)
+	assert.EqualValues(t, 2, st.Processed)
+	assert.NotNil(t, st.LastProcessedTime)
+	assert.NotEmpty(t, st.LastDeliveryLag)
+	assert.Equal(t, "sink unavailable", st.LastError, "Skipped messages should not be reported as errors")
+	assert.NotNil(t, st.LastErrorTime)
+}
+
+func TestDebugStatusEndpoint(t *testing.T) {
+	s := &statusTracker{}
+	s.begin(&Message{ReceivedMessage: &azservicebus.ReceivedMessage{}})(nil)
+
+	port := freePort(t)
+
+	stop, err := startHealthServer(logtesting.TestLogger(t), port, func() bool { return true }, s, nil)
+	require.NoError(t, err)
+	defer stop()
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%d%s", port, debugStatusEndpointPath))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var st adapterStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+	assert.EqualValues(t, 1, st.Processed)
+	assert.Empty(t, st.LastError)
+}
+
+func TestDebugStatusEndpointDisabled(t *testing.T) {
+	port := freePort(t)
+
+	stop, err := startHealthServer(logtesting.TestLogger(t), port, func() bool { return true }, nil, nil)
+	require.NoError(t, err)
+	defer stop()
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%d%s", port, debugStatusEndpointPath))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+// Maximum duration of the deletion of a topic subscription upon shutdown.
+const subscriptionDeleteTimeout = 10 * time.Second
+
+// Duration after which Service Bus deletes an idle ephemeral subscription,
+// in case the adapter which created it didn't delete it upon shutdown.
+const ephemeralSubscriptionIdleTimeout = time.Hour
+
+// subscriptionManager manages Service Bus topic subscriptions.
+// It is implemented by admin.Client.
+type subscriptionManager interface {
+	GetSubscription(ctx context.Context, topicName, subscriptionName string,
+		options *admin.GetSubscriptionOptions) (*admin.GetSubscriptionResponse, error)
+	CreateSubscription(ctx context.Context, topicName, subscriptionName string,
+		options *admin.CreateSubscriptionOptions) (admin.CreateSubscriptionResponse, error)
+	DeleteSubscription(ctx context.Context, topicName, subscriptionName string,
+		options *admin.DeleteSubscriptionOptions) (admin.DeleteSubscriptionResponse, error)
+}
+
+var _ subscriptionManager = (*admin.Client)(nil)
+
+// ensureSubscription ensures that the given topic subscription exists, and
+// creates it with the given properties otherwise. It returns whether the
+// subscription was created.
+//
+// The properties of a subscription which already exists are left untouched.
+func ensureSubscription(ctx context.Context, logger *zap.SugaredLogger, sm subscriptionManager,
+	entityID *v1alpha1.AzureResourceID, props *admin.SubscriptionProperties) (created bool, err error) {
+
+	topic, subs := entityID.ResourceName, entityID.SubResourceName
+
+	existing, err := sm.GetSubscription(ctx, topic, subs, nil)
+	if err != nil {
+		return false, fmt.Errorf("getting subscription: %w", err)
+	}
+	if existing != nil {
+		return false, nil
+	}
+
+	if _, err := sm.CreateSubscription(ctx, topic, subs, &admin.CreateSubscriptionOptions{Properties: props}); err != nil {
+		return false, fmt.Errorf("creating subscription: %w", err)
+	}
+	logger.Infow("Created subscription "+strconv.Quote(subs)+" on topic "+strconv.Quote(topic),
+		zap.Stringp("defaultMessageTimeToLive", props.DefaultMessageTimeToLive),
+		zap.Stringp("lockDuration", props.LockDuration))
+
+	return true, nil
+}
+
+// subscriptionDeleter returns a function which deletes the given topic
+// subscription.
+func subscriptionDeleter(sm subscriptionManager, entityID *v1alpha1.AzureResourceID) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if _, err := sm.DeleteSubscription(ctx, entityID.ResourceName, entityID.SubResourceName, nil); err != nil {
+			return fmt.Errorf("deleting subscription: %w", err)
+		}
+		return nil
+	}
+}
+
+// iso8601Duration returns the given duration in the ISO 8601 format expected
+// by the Service Bus management API (e.g. "PT30S"), or nil if the duration is
+// zero, in which case Service Bus applies its own default.
+func iso8601Duration(d time.Duration) *string {
+	if d == 0 {
+		return nil
+	}
+
+	s := "PT" + strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S"
+	return &s
+}
+
+// deleteSubscription deletes the ephemeral topic subscription of the adapter.
+// Failures are only logged, since the adapter is shutting down anyway.
+func (a *adapter) deleteSubscription(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(detach(ctx), subscriptionDeleteTimeout)
+	defer cancel()
+
+	if err := a.deleteSubs(ctx); err != nil {
+		a.logger.Errorw("Unable to delete the Service Bus subscription", zap.Error(err))
+		return
+	}
+	a.logger.Info("Deleted the Service Bus subscription")
+}
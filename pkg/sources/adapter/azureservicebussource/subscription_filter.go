@@ -0,0 +1,105 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+const (
+	// Name of the subscription rule which holds the SQL filter of the
+	// adapter.
+	subscriptionFilterRuleName = "triggermesh-filter"
+
+	// Name of the rule created by Service Bus along with every
+	// subscription, which matches all messages.
+	defaultRuleName = "$Default"
+)
+
+// ruleManager manages the rules of Service Bus topic subscriptions.
+// It is implemented by admin.Client.
+type ruleManager interface {
+	GetRule(ctx context.Context, topicName, subscriptionName, ruleName string,
+		options *admin.GetRuleOptions) (*admin.GetRuleResponse, error)
+	CreateRule(ctx context.Context, topicName, subscriptionName string,
+		options *admin.CreateRuleOptions) (admin.CreateRuleResponse, error)
+}
+
+var _ ruleManager = (*admin.Client)(nil)
+
+// ensureSubscriptionFilter ensures that the given topic subscription has a
+// rule with the given SQL filter expression.
+//
+// This is a no-op if the rule already exists with the same expression. If the
+// rule exists with a different filter, the conflict is logged and the rule is
+// left untouched, so that filters managed outside of the adapter are never
+// overwritten.
+func ensureSubscriptionFilter(ctx context.Context, logger *zap.SugaredLogger, rm ruleManager,
+	entityID *v1alpha1.AzureResourceID, sqlExpr string) error {
+
+	topic, subs := entityID.ResourceName, entityID.SubResourceName
+
+	rule, err := rm.GetRule(ctx, topic, subs, subscriptionFilterRuleName, nil)
+	if err != nil {
+		return fmt.Errorf("getting subscription rule %q: %w", subscriptionFilterRuleName, err)
+	}
+
+	switch {
+	case rule == nil:
+		_, err := rm.CreateRule(ctx, topic, subs, &admin.CreateRuleOptions{
+			Name:   to.Ptr(subscriptionFilterRuleName),
+			Filter: &admin.SQLFilter{Expression: sqlExpr},
+		})
+		if err != nil {
+			return fmt.Errorf("creating subscription rule %q: %w", subscriptionFilterRuleName, err)
+		}
+		logger.Infow("Created subscription rule "+strconv.Quote(subscriptionFilterRuleName), zap.String("filter", sqlExpr))
+
+	case !isSQLFilter(rule.Filter, sqlExpr):
+		logger.Warnw("Subscription rule "+strconv.Quote(subscriptionFilterRuleName)+" exists with a different filter, "+
+			"leaving it unchanged", zap.String("filter", sqlExpr))
+	}
+
+	defaultRule, err := rm.GetRule(ctx, topic, subs, defaultRuleName, nil)
+	if err != nil {
+		return fmt.Errorf("getting subscription rule %q: %w", defaultRuleName, err)
+	}
+	if defaultRule != nil {
+		if _, matchesAll := defaultRule.Filter.(*admin.TrueFilter); matchesAll {
+			logger.Warn("The subscription has a " + strconv.Quote(defaultRuleName) + " rule which matches all messages, " +
+				"messages which don't match the filter are still delivered unless this rule is deleted")
+		}
+	}
+
+	return nil
+}
+
+// isSQLFilter returns whether the given rule filter is a SQL filter with the
+// given expression.
+func isSQLFilter(f admin.RuleFilter, sqlExpr string) bool {
+	sqlFilter, ok := f.(*admin.SQLFilter)
+	return ok && sqlFilter.Expression == sqlExpr
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
+
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+func TestEnsureSubscriptionFilter(t *testing.T) {
+	const sqlExpr = "priority = 'high'"
+
+	testCases := []struct {
+		name          string
+		existingRules map[string]admin.RuleFilter
+		getErr        error
+		expectCreated bool
+		expectErr     bool
+	}{
+		{
+			name:          "Rule does not exist",
+			expectCreated: true,
+		},
+		{
+			name: "Rule exists with the same filter",
+			existingRules: map[string]admin.RuleFilter{
+				subscriptionFilterRuleName: &admin.SQLFilter{Expression: sqlExpr},
+			},
+		},
+		{
+			name: "Rule exists with a conflicting filter",
+			existingRules: map[string]admin.RuleFilter{
+				subscriptionFilterRuleName: &admin.SQLFilter{Expression: "priority = 'low'"},
+			},
+		},
+		{
+			name: "Default rule matches all messages",
+			existingRules: map[string]admin.RuleFilter{
+				defaultRuleName: &admin.TrueFilter{},
+			},
+			expectCreated: true,
+		},
+		{
+			name:      "Rule can not be read",
+			getErr:    errors.New("unauthorized access"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rm := &fakeRuleManager{
+				rules:  tc.existingRules,
+				getErr: tc.getErr,
+			}
+
+			entityID := &v1alpha1.AzureResourceID{
+				ResourceName:    "my-topic",
+				SubResourceName: "my-subscription",
+			}
+
+			err := ensureSubscriptionFilter(context.Background(), logtesting.TestLogger(t), rm, entityID, sqlExpr)
+
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			if !tc.expectCreated {
+				assert.Nil(t, rm.created, "No rule should be created")
+				return
+			}
+
+			if assert.NotNil(t, rm.created, "A rule should be created") {
+				assert.Equal(t, subscriptionFilterRuleName, *rm.created.Name)
+				assert.Equal(t, &admin.SQLFilter{Expression: sqlExpr}, rm.created.Filter)
+			}
+		})
+	}
+}
+
+// fakeRuleManager is a ruleManager which serves predefined rules and records
+// the creation of rules.
+type fakeRuleManager struct {
+	rules  map[string]admin.RuleFilter
+	getErr error
+
+	created *admin.CreateRuleOptions
+}
+
+var _ ruleManager = (*fakeRuleManager)(nil)
+
+// GetRule implements ruleManager.
+func (m *fakeRuleManager) GetRule(_ context.Context, _, _, ruleName string,
+	_ *admin.GetRuleOptions) (*admin.GetRuleResponse, error) {
+
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+
+	f, ok := m.rules[ruleName]
+	if !ok {
+		return nil, nil
+	}
+	return &admin.GetRuleResponse{
+		RuleProperties: admin.RuleProperties{
+			Name:   ruleName,
+			Filter: f,
+		},
+	}, nil
+}
+
+// CreateRule implements ruleManager.
+func (m *fakeRuleManager) CreateRule(_ context.Context, _, _ string,
+	opts *admin.CreateRuleOptions) (admin.CreateRuleResponse, error) {
+
+	m.created = opts
+	return admin.CreateRuleResponse{}, nil
+}
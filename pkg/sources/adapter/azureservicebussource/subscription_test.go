@@ -0,0 +1,162 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/admin"
+
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/apis/sources/v1alpha1"
+)
+
+func TestEnsureSubscription(t *testing.T) {
+	props := &admin.SubscriptionProperties{
+		DefaultMessageTimeToLive: to.Ptr("PT1H"),
+		LockDuration:             to.Ptr("PT30S"),
+	}
+
+	testCases := []struct {
+		name          string
+		exists        bool
+		getErr        error
+		expectCreated bool
+		expectErr     bool
+	}{
+		{
+			name:          "Subscription does not exist",
+			expectCreated: true,
+		},
+		{
+			name:   "Subscription exists",
+			exists: true,
+		},
+		{
+			name:      "Subscription can not be read",
+			getErr:    errors.New("unauthorized access"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm := &fakeSubscriptionManager{
+				exists: tc.exists,
+				getErr: tc.getErr,
+			}
+
+			entityID := &v1alpha1.AzureResourceID{
+				ResourceName:    "my-topic",
+				SubResourceName: "my-subscription",
+			}
+
+			created, err := ensureSubscription(context.Background(), logtesting.TestLogger(t), sm, entityID, props)
+
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectCreated, created)
+			if !tc.expectCreated {
+				assert.Nil(t, sm.created, "No subscription should be created")
+				return
+			}
+
+			if assert.NotNil(t, sm.created, "A subscription should be created") {
+				assert.Equal(t, "my-topic/my-subscription", *sm.created)
+				assert.Equal(t, props, sm.createdProps)
+			}
+		})
+	}
+}
+
+func TestSubscriptionDeleter(t *testing.T) {
+	sm := &fakeSubscriptionManager{exists: true}
+
+	entityID := &v1alpha1.AzureResourceID{
+		ResourceName:    "my-topic",
+		SubResourceName: "my-subscription",
+	}
+
+	err := subscriptionDeleter(sm, entityID)(context.Background())
+	require.NoError(t, err)
+
+	if assert.NotNil(t, sm.deleted, "The subscription should be deleted") {
+		assert.Equal(t, "my-topic/my-subscription", *sm.deleted)
+	}
+}
+
+func TestISO8601Duration(t *testing.T) {
+	assert.Nil(t, iso8601Duration(0))
+	assert.Equal(t, to.Ptr("PT30S"), iso8601Duration(30*time.Second))
+	assert.Equal(t, to.Ptr("PT1.5S"), iso8601Duration(1500*time.Millisecond))
+	assert.Equal(t, to.Ptr("PT1209600S"), iso8601Duration(14*24*time.Hour))
+}
+
+// fakeSubscriptionManager is a subscriptionManager which records the creation
+// and deletion of subscriptions, in the format "<topic>/<subscription>".
+type fakeSubscriptionManager struct {
+	exists bool
+	getErr error
+
+	created      *string
+	createdProps *admin.SubscriptionProperties
+	deleted      *string
+}
+
+var _ subscriptionManager = (*fakeSubscriptionManager)(nil)
+
+// GetSubscription implements subscriptionManager.
+func (m *fakeSubscriptionManager) GetSubscription(_ context.Context, _, _ string,
+	_ *admin.GetSubscriptionOptions) (*admin.GetSubscriptionResponse, error) {
+
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	if !m.exists {
+		return nil, nil
+	}
+	return &admin.GetSubscriptionResponse{}, nil
+}
+
+// CreateSubscription implements subscriptionManager.
+func (m *fakeSubscriptionManager) CreateSubscription(_ context.Context, topic, subs string,
+	opts *admin.CreateSubscriptionOptions) (admin.CreateSubscriptionResponse, error) {
+
+	m.created = to.Ptr(topic + "/" + subs)
+	m.createdProps = opts.Properties
+	return admin.CreateSubscriptionResponse{}, nil
+}
+
+// DeleteSubscription implements subscriptionManager.
+func (m *fakeSubscriptionManager) DeleteSubscription(_ context.Context, topic, subs string,
+	_ *admin.DeleteSubscriptionOptions) (admin.DeleteSubscriptionResponse, error) {
+
+	m.deleted = to.Ptr(topic + "/" + subs)
+	return admin.DeleteSubscriptionResponse{}, nil
+}
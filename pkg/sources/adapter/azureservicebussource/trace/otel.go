@@ -0,0 +1,246 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/devigned/tab"
+	"go.uber.org/zap"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name under which spans are reported to
+// OpenTelemetry.
+const instrumentationName = "github.com/triggermesh/triggermesh/pkg/sources/adapter/azureservicebussource"
+
+// Names of log fields which correlate log entries with spans.
+const (
+	logfieldTraceID = "traceID"
+	logfieldSpanID  = "spanID"
+)
+
+// NewOpenTelemetryTracer returns an OpenTelemetryTracer which creates spans
+// using the global OpenTelemetry TracerProvider, and logs using the given
+// logger.
+func NewOpenTelemetryTracer(l *zap.SugaredLogger) *OpenTelemetryTracer {
+	return &OpenTelemetryTracer{
+		Logger: l.Desugar(),
+		tracer: otel.Tracer(instrumentationName),
+	}
+}
+
+// OpenTelemetryTracer is a tab.Tracer implementation backed by OpenTelemetry.
+// Trace context is propagated to and from carriers using the W3C Trace
+// Context format.
+type OpenTelemetryTracer struct {
+	Logger *zap.Logger
+
+	tracer oteltrace.Tracer
+}
+
+// otelSpanner is a tab.Spanner implementation which wraps an OpenTelemetry
+// span.
+type otelSpanner struct {
+	span   oteltrace.Span
+	logger *zap.Logger
+}
+
+// carrierAdapter adapts a tab.Carrier to OpenTelemetry's
+// propagation.TextMapCarrier interface.
+type carrierAdapter struct {
+	carrier tab.Carrier
+}
+
+// Verify implementation of interfaces.
+var _ tab.Tracer = (*OpenTelemetryTracer)(nil)
+var _ tab.Spanner = (*otelSpanner)(nil)
+var _ propagation.TextMapCarrier = (*carrierAdapter)(nil)
+
+// StartSpan implements tab.Tracer.
+//
+// Options of type oteltrace.SpanStartOption are passed to the underlying
+// tracer, other options are ignored.
+func (t *OpenTelemetryTracer) StartSpan(ctx context.Context, operationName string, opts ...interface{}) (context.Context, tab.Spanner) {
+	ctx, span := t.tracer.Start(ctx, operationName, spanStartOptions(opts)...)
+	return ctx, t.newSpanner(span)
+}
+
+// StartSpanWithRemoteParent implements tab.Tracer.
+//
+// Spans started with a remote parent are of kind "consumer", unless the kind
+// is overridden by one of the given options.
+func (t *OpenTelemetryTracer) StartSpanWithRemoteParent(ctx context.Context, operationName string, carrier tab.Carrier, opts ...interface{}) (context.Context, tab.Spanner) {
+	if carrier != nil {
+		ctx = propagation.TraceContext{}.Extract(ctx, &carrierAdapter{carrier: carrier})
+	}
+	opts = append([]interface{}{oteltrace.WithSpanKind(oteltrace.SpanKindConsumer)}, opts...)
+	return t.StartSpan(ctx, operationName, opts...)
+}
+
+// FromContext implements tab.Tracer.
+func (t *OpenTelemetryTracer) FromContext(ctx context.Context) tab.Spanner {
+	return t.newSpanner(oteltrace.SpanFromContext(ctx))
+}
+
+// NewContext implements tab.Tracer.
+func (t *OpenTelemetryTracer) NewContext(parent context.Context, s tab.Spanner) context.Context {
+	span, ok := s.InternalSpan().(oteltrace.Span)
+	if !ok {
+		return parent
+	}
+	return oteltrace.ContextWithSpan(parent, span)
+}
+
+// newSpanner returns a tab.Spanner for the given span, with a logger which
+// annotates log entries with the span's identifiers.
+func (t *OpenTelemetryTracer) newSpanner(span oteltrace.Span) *otelSpanner {
+	logger := t.Logger
+	if sc := span.SpanContext(); sc.IsValid() {
+		logger = logger.With(
+			zap.String(logfieldTraceID, sc.TraceID().String()),
+			zap.String(logfieldSpanID, sc.SpanID().String()),
+		)
+	}
+
+	return &otelSpanner{
+		span:   span,
+		logger: logger,
+	}
+}
+
+// AddAttributes implements tab.Spanner.
+func (s *otelSpanner) AddAttributes(attributes ...tab.Attribute) {
+	s.span.SetAttributes(attributesToKeyValues(attributes)...)
+}
+
+// End implements tab.Spanner.
+func (s *otelSpanner) End() {
+	s.span.End()
+}
+
+// Logger implements tab.Spanner.
+func (s *otelSpanner) Logger() tab.Logger {
+	return &otelLogger{
+		zapLogger: zapLogger{logger: s.logger},
+		span:      s.span,
+	}
+}
+
+// Inject implements tab.Spanner.
+func (s *otelSpanner) Inject(carrier tab.Carrier) error {
+	ctx := oteltrace.ContextWithSpan(context.Background(), s.span)
+	propagation.TraceContext{}.Inject(ctx, &carrierAdapter{carrier: carrier})
+	return nil
+}
+
+// InternalSpan implements tab.Spanner.
+func (s *otelSpanner) InternalSpan() interface{} {
+	return s.span
+}
+
+// otelLogger is a tab.Logger which, in addition to writing log entries,
+// records errors on the span it belongs to.
+type otelLogger struct {
+	zapLogger
+	span oteltrace.Span
+}
+
+// Error implements tab.Logger.
+func (l *otelLogger) Error(err error, attributes ...tab.Attribute) {
+	l.span.RecordError(err, oteltrace.WithAttributes(attributesToKeyValues(attributes)...))
+	l.span.SetStatus(codes.Error, err.Error())
+	l.zapLogger.Error(err, attributes...)
+}
+
+// SetSpanError marks the given span as failed with the given error. It is a
+// no-op for spans which aren't backed by OpenTelemetry.
+func SetSpanError(s tab.Spanner, err error) {
+	span, ok := s.InternalSpan().(oteltrace.Span)
+	if !ok {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Get implements propagation.TextMapCarrier.
+func (c *carrierAdapter) Get(key string) string {
+	v, ok := c.carrier.GetKeyValues()[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// Set implements propagation.TextMapCarrier.
+func (c *carrierAdapter) Set(key, value string) {
+	c.carrier.Set(key, value)
+}
+
+// Keys implements propagation.TextMapCarrier.
+func (c *carrierAdapter) Keys() []string {
+	kvs := c.carrier.GetKeyValues()
+
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// spanStartOptions filters the OpenTelemetry span start options out of the
+// given list of options.
+func spanStartOptions(opts []interface{}) []oteltrace.SpanStartOption {
+	var spanOpts []oteltrace.SpanStartOption
+	for _, o := range opts {
+		if so, ok := o.(oteltrace.SpanStartOption); ok {
+			spanOpts = append(spanOpts, so)
+		}
+	}
+	return spanOpts
+}
+
+// attributesToKeyValues converts tab.Attributes into OpenTelemetry span
+// attributes.
+func attributesToKeyValues(attributes []tab.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attributes))
+	for i, a := range attributes {
+		switch v := a.Value.(type) {
+		case string:
+			kvs[i] = attribute.String(a.Key, v)
+		case bool:
+			kvs[i] = attribute.Bool(a.Key, v)
+		case int64:
+			kvs[i] = attribute.Int64(a.Key, v)
+		case int:
+			kvs[i] = attribute.Int(a.Key, v)
+		default:
+			kvs[i] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	return kvs
+}
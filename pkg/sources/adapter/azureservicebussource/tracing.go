@@ -0,0 +1,113 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"github.com/devigned/tab"
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/triggermesh/triggermesh/pkg/sources/adapter/azureservicebussource/trace"
+)
+
+// Supported tracers.
+const (
+	tracerLog           = "log"
+	tracerOpenTelemetry = "opentelemetry"
+)
+
+// Names of spans created while handling Service Bus messages.
+const (
+	spanNameReceive = "servicebus.receive"
+	spanNameSend    = "servicebus.send"
+)
+
+// Names of trace context properties.
+const (
+	propTraceParent  = "traceparent"
+	propTraceState   = "tracestate"
+	propDiagnosticID = "Diagnostic-Id"
+)
+
+// newTracer returns the tab.Tracer with the given name.
+func newTracer(name string, logger *zap.SugaredLogger) (tab.Tracer, bool) {
+	switch name {
+	case tracerLog:
+		return trace.NewNoOpTracerWithLogger(logger), true
+	case tracerOpenTelemetry:
+		return trace.NewOpenTelemetryTracer(logger), true
+	default:
+		return nil, false
+	}
+}
+
+// messageCarrier is a read-only tab.Carrier which exposes the trace context
+// contained in the application properties of a Service Bus message.
+//
+// Azure SDKs propagate the trace context in the "Diagnostic-Id" application
+// property, which is used in place of "traceparent" when the latter is absent.
+type messageCarrier struct {
+	props map[string]interface{}
+}
+
+var _ tab.Carrier = (*messageCarrier)(nil)
+
+// newMessageCarrier returns a messageCarrier for the given message.
+func newMessageCarrier(msg *Message) *messageCarrier {
+	return &messageCarrier{
+		props: msg.ApplicationProperties,
+	}
+}
+
+// Set implements tab.Carrier.
+func (*messageCarrier) Set(string, interface{}) {}
+
+// GetKeyValues implements tab.Carrier.
+func (c *messageCarrier) GetKeyValues() map[string]interface{} {
+	kvs := make(map[string]interface{}, 2)
+
+	if tp, ok := c.props[propTraceParent]; ok {
+		kvs[propTraceParent] = tp
+	} else if diagID, ok := c.props[propDiagnosticID]; ok {
+		kvs[propTraceParent] = diagID
+	}
+
+	if ts, ok := c.props[propTraceState]; ok {
+		kvs[propTraceState] = ts
+	}
+
+	return kvs
+}
+
+// eventCarrier is a tab.Carrier which writes trace context to the extension
+// attributes of a CloudEvent.
+type eventCarrier struct {
+	event *cloudevents.Event
+}
+
+var _ tab.Carrier = (*eventCarrier)(nil)
+
+// Set implements tab.Carrier.
+func (c *eventCarrier) Set(key string, value interface{}) {
+	c.event.SetExtension(key, value)
+}
+
+// GetKeyValues implements tab.Carrier.
+func (c *eventCarrier) GetKeyValues() map[string]interface{} {
+	return c.event.Extensions()
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/devigned/tab"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	logtesting "knative.dev/pkg/logging/testing"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+	testCases := []struct {
+		name              string
+		tracer            string
+		props             map[string]interface{}
+		expectTraceParent interface{}
+	}{
+		{
+			name:              "OpenTelemetry with traceparent",
+			tracer:            tracerOpenTelemetry,
+			props:             map[string]interface{}{propTraceParent: traceParent},
+			expectTraceParent: traceParent,
+		},
+		{
+			name:              "OpenTelemetry with Diagnostic-Id",
+			tracer:            tracerOpenTelemetry,
+			props:             map[string]interface{}{propDiagnosticID: traceParent},
+			expectTraceParent: traceParent,
+		},
+		{
+			name:   "OpenTelemetry without trace context",
+			tracer: tracerOpenTelemetry,
+		},
+		{
+			name:   "Log only",
+			tracer: tracerLog,
+			props:  map[string]interface{}{propTraceParent: traceParent},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer, ok := newTracer(tc.tracer, logtesting.TestLogger(t))
+			if !ok {
+				t.Fatal("Unsupported tracer", tc.tracer)
+			}
+			tab.Register(tracer)
+			t.Cleanup(func() { tab.Register(&tab.NoOpTracer{}) })
+
+			msg := &Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					ApplicationProperties: tc.props,
+				},
+			}
+
+			ctx, span := tab.StartSpanWithRemoteParent(context.Background(), spanNameReceive, newMessageCarrier(msg))
+			defer span.End()
+
+			_, sendSpan := tab.StartSpan(ctx, spanNameSend)
+			defer sendSpan.End()
+
+			event := cloudevents.NewEvent()
+			assert.NoError(t, sendSpan.Inject(&eventCarrier{event: &event}))
+
+			assert.Equal(t, tc.expectTraceParent, event.Extensions()[propTraceParent])
+		})
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/itchyny/gojq"
+)
+
+// bodyTransform reshapes the JSON body of Service Bus messages using a jq
+// expression, e.g. to rename fields or drop sensitive data before the body
+// becomes the data of a CloudEvent.
+type bodyTransform struct {
+	code *gojq.Code
+}
+
+// newBodyTransform returns a bodyTransform for the given jq expression.
+func newBodyTransform(expr string) (*bodyTransform, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing body transformation: %w", err)
+	}
+
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("compiling body transformation: %w", err)
+	}
+
+	return &bodyTransform{code: code}, nil
+}
+
+// apply returns the first value produced by the transformation for the given
+// message, serialized to JSON. It returns the body of the message as is if
+// this body isn't JSON, since the expression can not be evaluated against it.
+func (t *bodyTransform) apply(msg *Message) ([]byte, error) {
+	if ct := contentType(msg); ct != "" && !isJSONContentType(ct) {
+		return msg.Body, nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(msg.Body, &data); err != nil {
+		return msg.Body, nil
+	}
+
+	v, ok := t.code.Run(data).Next()
+	if !ok {
+		return nil, errors.New("the body transformation produced no value")
+	}
+	if err, ok := v.(error); ok {
+		return nil, fmt.Errorf("evaluating body transformation: %w", err)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("serializing transformed body: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func TestBodyTransform(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expr        string
+		body        []byte
+		contentType *string
+		expectBody  string
+		expectErr   bool
+	}{
+		{
+			name:       "Fields are renamed",
+			expr:       `{id: .orderId, total}`,
+			body:       []byte(`{"orderId": "42", "total": 9.5, "note": "x"}`),
+			expectBody: `{"id": "42", "total": 9.5}`,
+		},
+		{
+			name:       "Fields are dropped",
+			expr:       `del(.customer.email)`,
+			body:       []byte(`{"customer": {"name": "Jane", "email": "jane@example.com"}}`),
+			expectBody: `{"customer": {"name": "Jane"}}`,
+		},
+		{
+			name:       "Only the first value is used",
+			expr:       `.items[]`,
+			body:       []byte(`{"items": [1, 2]}`),
+			expectBody: `1`,
+		},
+		{
+			name:       "Body is not JSON",
+			expr:       `.kind`,
+			body:       []byte("not JSON"),
+			expectBody: "not JSON",
+		},
+		{
+			name:        "Content type is not JSON",
+			expr:        `.kind`,
+			body:        []byte(`{"kind": "order"}`),
+			contentType: to.Ptr("text/plain"),
+			expectBody:  `{"kind": "order"}`,
+		},
+		{
+			name:      "Expression fails",
+			expr:      `.kind.nested`,
+			body:      []byte(`{"kind": "order"}`),
+			expectErr: true,
+		},
+		{
+			name:      "Expression produces no value",
+			expr:      `empty`,
+			body:      []byte(`{"kind": "order"}`),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, err := newBodyTransform(tc.expr)
+			require.NoError(t, err)
+
+			body, err := tr.apply(&Message{
+				ReceivedMessage: &azservicebus.ReceivedMessage{
+					Body:        tc.body,
+					ContentType: tc.contentType,
+				},
+			})
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if json.Valid([]byte(tc.expectBody)) {
+				assert.JSONEq(t, tc.expectBody, string(body))
+			} else {
+				assert.Equal(t, tc.expectBody, string(body))
+			}
+		})
+	}
+}
+
+func TestNewBodyTransformInvalid(t *testing.T) {
+	_, err := newBodyTransform(`{id: `)
+	assert.Error(t, err)
+}
+
+func TestProcessMessageBodyTransform(t *testing.T) {
+	tr, err := newBodyTransform(`{id: .orderId}`)
+	require.NoError(t, err)
+
+	msgPrcsr := &defaultMessageProcessor{
+		ceSource:         "/some/source",
+		bodyTransform:    tr,
+		explodeJSONArray: true,
+	}
+
+	msg := &Message{
+		ReceivedMessage: &azservicebus.ReceivedMessage{
+			MessageID: "someMessageID",
+			Body:      []byte(`[{"orderId": "1", "email": "a@example.com"}, {"orderId": "2"}]`),
+		},
+	}
+
+	events, err := msgPrcsr.Process(msg)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	for i, expectID := range []string{"1", "2"} {
+		var data struct {
+			Body map[string]interface{}
+		}
+		require.NoError(t, events[i].DataAs(&data))
+		assert.Equal(t, map[string]interface{}{"id": expectID}, data.Body,
+			"Expected the transformation to apply to each element")
+	}
+
+	assert.Equal(t, []byte(`[{"orderId": "1", "email": "a@example.com"}, {"orderId": "2"}]`), msg.Body,
+		"The original message should not be modified")
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+)
+
+// Maximum duration of the validation of the access to the Service Bus entity.
+const validateTimeout = 30 * time.Second
+
+// AMQP error condition returned by Service Bus when the credentials don't
+// grant the rights required by an operation, e.g. when a SAS policy lacks
+// the Listen right.
+const amqpConditionUnauthorizedAccess = "amqp:unauthorized-access"
+
+// AMQP error condition returned by Service Bus when the entity doesn't exist,
+// or can't be seen with the configured credentials.
+const amqpConditionNotFound = "amqp:not-found"
+
+// errListenRightRequired is returned when the credentials of the adapter
+// don't allow receiving messages from the Service Bus entity.
+var errListenRightRequired = errors.New("access denied: the credentials must grant the Listen right " +
+	"on the Service Bus entity (or its namespace)")
+
+// messagePeeker peeks at Service Bus messages without locking them.
+// It is implemented by both azservicebus.Receiver and
+// azservicebus.SessionReceiver.
+type messagePeeker interface {
+	PeekMessages(context.Context, int, *azservicebus.PeekMessagesOptions) ([]*azservicebus.ReceivedMessage, error)
+}
+
+var (
+	_ messagePeeker = (*azservicebus.Receiver)(nil)
+	_ messagePeeker = (*azservicebus.SessionReceiver)(nil)
+)
+
+// validate ensures that messages can be read from the Service Bus entity with
+// the configured credentials, without consuming any message.
+func (a *adapter) validate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+	defer cancel()
+
+	if a.acceptSession != nil {
+		if err := probeSessionEntity(ctx, a.acceptSession); err != nil {
+			return fmt.Errorf("accepting a session on the Service Bus entity: %w", wrapPermissionError(err))
+		}
+		return nil
+	}
+
+	p, ok := a.msgRcvr.(messagePeeker)
+	if !ok {
+		return errors.New("the message receiver does not support peeking at messages")
+	}
+
+	if _, err := p.PeekMessages(ctx, 1, nil); err != nil {
+		return fmt.Errorf("peeking at messages from the Service Bus entity: %w", wrapPermissionError(err))
+	}
+	return nil
+}
+
+// wrapPermissionError wraps the given error into errListenRightRequired if it
+// indicates that the credentials of the adapter lack the Listen right, so
+// that the cause of the failure is evident. Other errors are returned as is.
+//
+// The azservicebus package doesn't expose a code for this kind of error, so
+// the AMQP error condition is looked up in the error message.
+func wrapPermissionError(err error) error {
+	if err == nil || !strings.Contains(err.Error(), amqpConditionUnauthorizedAccess) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", errListenRightRequired, err)
+}
+
+// checkAccess performs a lightweight authorized operation against the Service
+// Bus entity, so that missing permissions are reported at startup as a
+// configuration error instead of surfacing later as an opaque AMQP error in
+// the receive loop.
+//
+// Errors which don't denote a missing permission, such as network errors, are
+// only logged, since they may be transient, unless a connect timeout is set.
+// In that case, the entity must be reached within the connect timeout, so that
+// an adapter which can't establish a connection fails fast and gets restarted.
+func (a *adapter) checkAccess(ctx context.Context, resourceType, authMethod string) {
+	if a.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.connectTimeout)
+		defer cancel()
+	}
+
+	err := a.validate(ctx)
+	if err == nil {
+		return
+	}
+
+	if hint := missingPermissionHint(err, resourceType, authMethod); hint != "" {
+		a.logger.Panicw("Insufficient permissions on the Service Bus entity. "+hint, zap.Error(err))
+	}
+	if a.connectTimeout > 0 {
+		a.logger.Panicw("Unable to reach the Service Bus entity within the connect timeout of "+
+			a.connectTimeout.String(), zap.Error(err))
+	}
+	a.logger.Warnw("Unable to validate access to the Service Bus entity at startup", zap.Error(err))
+}
+
+// missingPermissionHint returns an actionable description of the permission
+// which is likely missing, based on the given error returned by Service Bus.
+// It returns an empty string if the error doesn't denote a missing permission.
+func missingPermissionHint(err error, resourceType, authMethod string) string {
+	switch {
+	case errors.Is(err, errListenRightRequired):
+		if authMethod == azureservicebus.AuthMethodAzureAD {
+			return "The identity of the adapter must be granted the " +
+				"Microsoft.ServiceBus/namespaces/messages/receive/action data action, " +
+				"e.g. via the \"Azure Service Bus Data Receiver\" role."
+		}
+		return "The shared access policy must grant the Listen right on the entity or its namespace."
+
+	case strings.Contains(err.Error(), amqpConditionNotFound):
+		readPerm := "Microsoft.ServiceBus/namespaces/queues/read"
+		if resourceType != azureservicebus.ResourceTypeQueues {
+			readPerm = "Microsoft.ServiceBus/namespaces/topics/subscriptions/read"
+		}
+		return "The entity either doesn't exist, or can't be read by the adapter. " +
+			"Ensure that it exists and that the identity of the adapter is granted " + readPerm + "."
+	}
+
+	return ""
+}
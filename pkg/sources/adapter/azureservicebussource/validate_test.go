@@ -0,0 +1,249 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebussource
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+
+	adaptertest "knative.dev/eventing/pkg/adapter/v2/test"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
+)
+
+func TestStartValidateOnly(t *testing.T) {
+	testCases := []struct {
+		name                string
+		peekErr             error
+		expectErr           bool
+		expectPermissionErr bool
+	}{
+		{
+			name: "Entity is reachable",
+		},
+		{
+			name:      "Entity is unreachable",
+			peekErr:   errors.New("connection refused"),
+			expectErr: true,
+		},
+		{
+			name: "Listen right is missing",
+			peekErr: errors.New("*Error{Condition: amqp:unauthorized-access, Description: " +
+				"Unauthorized access. 'Listen' claim(s) are required to perform this operation.}"),
+			expectErr:           true,
+			expectPermissionErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rcvr := &peekingReceiver{
+				fakeReceiver: fakeReceiver{
+					batch: []*azservicebus.ReceivedMessage{
+						{MessageID: "1", Body: []byte(`{"test": null}`)},
+					},
+				},
+				err: tc.peekErr,
+			}
+
+			ceClient := adaptertest.NewTestClient()
+
+			a := &adapter{
+				logger:       logtesting.TestLogger(t),
+				msgRcvr:      rcvr,
+				ceClient:     ceClient,
+				validateOnly: true,
+			}
+
+			err := a.Start(context.Background())
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectPermissionErr, errors.Is(err, errListenRightRequired))
+
+			assert.Equal(t, 1, rcvr.peeked, "Messages should be peeked at once")
+			assert.Len(t, rcvr.batch, 1, "No message should be received")
+			assert.Empty(t, ceClient.Sent(), "No event should be sent")
+		})
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	testCases := []struct {
+		name           string
+		peekErr        error
+		hang           bool
+		connectTimeout time.Duration
+		expectPanic    bool
+	}{
+		{
+			name: "Entity is reachable",
+		},
+		{
+			name:    "Transient error",
+			peekErr: errors.New("connection refused"),
+		},
+		{
+			name:        "Listen right is missing",
+			peekErr:     errors.New("*Error{Condition: amqp:unauthorized-access, Description: Unauthorized access.}"),
+			expectPanic: true,
+		},
+		{
+			name:        "Entity not found",
+			peekErr:     errors.New("*Error{Condition: amqp:not-found, Description: The messaging entity could not be found.}"),
+			expectPanic: true,
+		},
+		{
+			name:           "Entity is reachable within the connect timeout",
+			connectTimeout: time.Second,
+		},
+		{
+			name:           "Transient error with a connect timeout",
+			peekErr:        errors.New("connection refused"),
+			connectTimeout: time.Second,
+			expectPanic:    true,
+		},
+		{
+			name:           "Entity is not reached within the connect timeout",
+			hang:           true,
+			connectTimeout: 50 * time.Millisecond,
+			expectPanic:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var rcvr messageReceiver = &peekingReceiver{err: tc.peekErr}
+			if tc.hang {
+				rcvr = &hangingPeeker{}
+			}
+
+			a := &adapter{
+				logger:         logtesting.TestLogger(t),
+				msgRcvr:        rcvr,
+				connectTimeout: tc.connectTimeout,
+			}
+
+			checkAccess := func() {
+				a.checkAccess(context.Background(), azureservicebus.ResourceTypeQueues, azureservicebus.AuthMethodSASKey)
+			}
+
+			if tc.expectPanic {
+				assert.Panics(t, checkAccess)
+			} else {
+				assert.NotPanics(t, checkAccess)
+			}
+		})
+	}
+}
+
+func TestMissingPermissionHint(t *testing.T) {
+	errUnauthorized := wrapPermissionError(errors.New("*Error{Condition: amqp:unauthorized-access}"))
+	errNotFound := errors.New("*Error{Condition: amqp:not-found}")
+
+	testCases := []struct {
+		name         string
+		err          error
+		resourceType string
+		authMethod   string
+		expectHint   string
+	}{
+		{
+			name:         "Listen right missing with SAS key",
+			err:          errUnauthorized,
+			resourceType: azureservicebus.ResourceTypeQueues,
+			authMethod:   azureservicebus.AuthMethodSASKey,
+			expectHint:   "Listen right",
+		},
+		{
+			name:         "Receive data action missing with Azure AD",
+			err:          errUnauthorized,
+			resourceType: azureservicebus.ResourceTypeQueues,
+			authMethod:   azureservicebus.AuthMethodAzureAD,
+			expectHint:   "Microsoft.ServiceBus/namespaces/messages/receive/action",
+		},
+		{
+			name:         "Queue not found",
+			err:          errNotFound,
+			resourceType: azureservicebus.ResourceTypeQueues,
+			authMethod:   azureservicebus.AuthMethodAzureAD,
+			expectHint:   "Microsoft.ServiceBus/namespaces/queues/read",
+		},
+		{
+			name:         "Subscription not found",
+			err:          errNotFound,
+			resourceType: azureservicebus.ResourceTypeSubscriptions,
+			authMethod:   azureservicebus.AuthMethodAzureAD,
+			expectHint:   "Microsoft.ServiceBus/namespaces/topics/subscriptions/read",
+		},
+		{
+			name:         "Unrelated error",
+			err:          errors.New("connection refused"),
+			resourceType: azureservicebus.ResourceTypeQueues,
+			authMethod:   azureservicebus.AuthMethodSASKey,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hint := missingPermissionHint(tc.err, tc.resourceType, tc.authMethod)
+			if tc.expectHint == "" {
+				assert.Empty(t, hint)
+				return
+			}
+			assert.Contains(t, hint, tc.expectHint)
+		})
+	}
+}
+
+// peekingReceiver is a fakeReceiver which supports peeking at messages.
+type peekingReceiver struct {
+	fakeReceiver
+	err    error
+	peeked int
+}
+
+var _ messagePeeker = (*peekingReceiver)(nil)
+
+// PeekMessages implements messagePeeker.
+func (r *peekingReceiver) PeekMessages(context.Context, int, *azservicebus.PeekMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	r.peeked++
+	return nil, r.err
+}
+
+// hangingPeeker is a messageReceiver which peeks at messages until the given
+// context is done, as if Service Bus couldn't be reached.
+type hangingPeeker struct {
+	fakeReceiver
+}
+
+var _ messagePeeker = (*hangingPeeker)(nil)
+
+// PeekMessages implements messagePeeker.
+func (*hangingPeeker) PeekMessages(ctx context.Context, _ int, _ *azservicebus.PeekMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
@@ -19,10 +19,8 @@ package azureservicebustarget
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net"
-	"os"
 	"strconv"
 	"time"
 
@@ -30,34 +28,21 @@ import (
 	"nhooyr.io/websocket"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
 
 	pkgadapter "knative.dev/eventing/pkg/adapter/v2"
 	"knative.dev/pkg/logging"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
-	"github.com/Azure/go-autorest/autorest/azure"
 
+	"github.com/triggermesh/triggermesh/pkg/adapter/azureservicebus"
 	"github.com/triggermesh/triggermesh/pkg/apis/targets"
 	"github.com/triggermesh/triggermesh/pkg/apis/targets/v1alpha1"
 	"github.com/triggermesh/triggermesh/pkg/metrics"
 	targetce "github.com/triggermesh/triggermesh/pkg/targets/adapter/cloudevents"
 )
 
-const (
-	resourceProviderServiceBus = "Microsoft.ServiceBus"
-
-	resourceTypeQueues        = "queues"
-	resourceTypeTopics        = "topics"
-	resourceTypeSubscriptions = "subscriptions"
-)
-
-const (
-	envKeyName  = "SERVICEBUS_KEY_NAME"
-	envKeyValue = "SERVICEBUS_KEY_VALUE"
-	envConnStr  = "SERVICEBUS_CONNECTION_STRING"
-)
-
 // NewTarget adapter implementation
 func NewTarget(ctx context.Context, envAcc pkgadapter.EnvConfigAccessor, ceClient cloudevents.Client) pkgadapter.Adapter {
 	logger := logging.FromContext(ctx)
@@ -80,12 +65,12 @@ func NewTarget(ctx context.Context, envAcc pkgadapter.EnvConfigAccessor, ceClien
 		logger.Panicf("Error creating CloudEvents replier: %v", err)
 	}
 
-	entityID, err := parseServiceBusResourceID(env.EntityResourceID)
+	entityID, err := azureservicebus.ParseTargetResourceID(env.EntityResourceID)
 	if err != nil {
 		logger.Panicw("Unable to parse entity ID "+strconv.Quote(env.EntityResourceID), zap.Error(err))
 	}
 
-	client, err := clientFromEnvironment(entityID, newAzureServiceBusClientOptions(
+	client, err := azureservicebus.ClientFromEnvironment(entityID, newAzureServiceBusClientOptions(
 		webSocketsClientOption(env.WebSocketsEnable)))
 	if err != nil {
 		logger.Panicw("Unable to obtain interface for Service Bus Namespace", zap.Error(err))
@@ -136,19 +121,14 @@ func (a *adapter) dispatch(ctx context.Context, event cloudevents.Event) (*cloud
 		a.sr.ReportProcessingLatency(time.Since(start), ceTypeTag, ceSrcTag)
 	}()
 
-	var msg []byte
-	if a.discardCEContext {
-		msg = event.Data()
-	} else {
-		jsonEvent, err := json.Marshal(event)
-		if err != nil {
-			a.logger.Errorw("Error marshalling CloudEvent", zap.Error(err))
-			a.sr.ReportProcessingError(true, ceTypeTag, ceSrcTag)
-			return a.replier.Error(&event, targetce.ErrorCodeAdapterProcess, err, nil)
-		}
-		msg = jsonEvent
+	msg, err := a.newServiceBusMessage(&event)
+	if err != nil {
+		a.logger.Errorw("Error converting CloudEvent to Service Bus message", zap.Error(err))
+		a.sr.ReportProcessingError(true, ceTypeTag, ceSrcTag)
+		return a.replier.Error(&event, targetce.ErrorCodeAdapterProcess, err, nil)
 	}
-	if err := a.sender.SendMessage(ctx, &azservicebus.Message{Body: msg}, nil); err != nil {
+
+	if err := a.sender.SendMessage(ctx, msg, nil); err != nil {
 		a.logger.Errorw("Error sending message to Service Bus", zap.Error(err))
 		a.sr.ReportProcessingError(true, ceTypeTag, ceSrcTag)
 		return a.replier.Error(&event, targetce.ErrorCodeAdapterProcess, err, nil)
@@ -157,86 +137,43 @@ func (a *adapter) dispatch(ctx context.Context, event cloudevents.Event) (*cloud
 	return a.replier.Ok(&event, "ok")
 }
 
-// parseServiceBusResourceID parses the given resource ID string to a
-// structured resource ID, and validates that this resource ID refers to a
-// Service Bus entity.
-func parseServiceBusResourceID(resIDStr string) (*v1alpha1.AzureResourceID, error) {
-	resID := &v1alpha1.AzureResourceID{}
-
-	err := json.Unmarshal([]byte(strconv.Quote(resIDStr)), resID)
-	if err != nil {
-		return nil, fmt.Errorf("deserializing resource ID string: %w", err)
-	}
-
-	// Must match one of the following patterns:
-	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/queues/{queueName}
-	//  - /.../providers/Microsoft.ServiceBus/namespaces/{namespaceName}/topics/{topicName}/subscriptions/{subsName}
-	if resID.ResourceProvider != resourceProviderServiceBus ||
-		resID.Namespace == "" ||
-		resID.ResourceType != resourceTypeQueues && resID.ResourceType != resourceTypeTopics {
-		return nil, errors.New("resource ID does not refer to a Service Bus entity")
-	}
-
-	return resID, nil
-}
-
-// entityPath returns the entity path of the given Service Bus entity.
-func entityPath(entityID *v1alpha1.AzureResourceID) string {
-	switch entityID.ResourceType {
-	case resourceTypeQueues:
-		queueName := entityID.ResourceName
-		return queueName
-	case resourceTypeTopics:
-		topicName := entityID.ResourceName
-		subsName := entityID.SubResourceName
-		return topicName + "/Subscriptions/" + subsName
-	default:
-		return ""
-	}
-}
+// newServiceBusMessage returns a Service Bus message which body is either the
+// given CloudEvent in its JSON representation, or only the data of the
+// CloudEvent if the adapter discards the CloudEvent context.
+//
+// In both cases, the extension attributes of the CloudEvent are set as
+// application properties of the message, in their canonical string
+// representation.
+func (a *adapter) newServiceBusMessage(event *cloudevents.Event) (*azservicebus.Message, error) {
+	msg := &azservicebus.Message{}
 
-// clientFromEnvironment mimics the behaviour of servicebus.NewHubFromEnvironment.
-// It returns a azservicebus.Client that is suitable for the
-// authentication method selected via environment variables.
-func clientFromEnvironment(entityID *v1alpha1.AzureResourceID, clientOptions *azservicebus.ClientOptions) (*azservicebus.Client, error) {
-	// SAS authentication (token, connection string)
-	connStr := connectionStringFromEnvironment(entityID.Namespace, entityPath(entityID))
-	if connStr != "" {
-		client, err := azservicebus.NewClientFromConnectionString(connStr, clientOptions)
+	if a.discardCEContext {
+		msg.Body = event.Data()
+		if ct := event.DataContentType(); ct != "" {
+			msg.ContentType = &ct
+		}
+	} else {
+		jsonEvent, err := json.Marshal(event)
 		if err != nil {
-			return nil, fmt.Errorf("creating client from connection string: %w", err)
+			return nil, fmt.Errorf("marshaling CloudEvent: %w", err)
 		}
-		return client, nil
+		msg.Body = jsonEvent
+		msg.ContentType = to.Ptr(cloudevents.ApplicationCloudEventsJSON)
 	}
 
-	// AAD authentication (service principal)
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create Azure credentials: %w", err)
-	}
+	if exts := event.Extensions(); len(exts) > 0 {
+		msg.ApplicationProperties = make(map[string]interface{}, len(exts))
 
-	fqNamespace := entityID.Namespace + ".servicebus.windows.net"
-	client, err := azservicebus.NewClient(fqNamespace, cred, clientOptions)
-	if err != nil {
-		return nil, fmt.Errorf("creating client from service principal: %w", err)
-	}
-	return client, nil
-}
-
-// connectionStringFromEnvironment returns a Service Bus connection string
-// based on values read from the environment.
-func connectionStringFromEnvironment(namespace, entityPath string) string {
-	connStr := os.Getenv(envConnStr)
-
-	// if a key is set explicitly, it takes precedence and is used to
-	// compose a new connection string
-	if keyName, keyValue := os.Getenv(envKeyName), os.Getenv(envKeyValue); keyName != "" || keyValue != "" {
-		azureEnv := &azure.PublicCloud
-		connStr = fmt.Sprintf("Endpoint=sb://%s.%s;SharedAccessKeyName=%s;SharedAccessKey=%s;EntityPath=%s",
-			namespace, azureEnv.ServiceBusEndpointSuffix, keyName, keyValue, entityPath)
+		for name, val := range exts {
+			strVal, err := types.Format(val)
+			if err != nil {
+				return nil, fmt.Errorf("formatting value of extension %q: %w", name, err)
+			}
+			msg.ApplicationProperties[name] = strVal
+		}
 	}
 
-	return connStr
+	return msg, nil
 }
 
 type clientOption func(*azservicebus.ClientOptions)
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureservicebustarget
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestNewServiceBusMessage(t *testing.T) {
+	newEvent := func() *cloudevents.Event {
+		e := cloudevents.NewEvent()
+		e.SetID("some-id")
+		e.SetType("some.type")
+		e.SetSource("some/source")
+		e.SetExtension("someext", "some value")
+		e.SetExtension("someint", 42)
+		if err := e.SetData(cloudevents.TextPlain, "hello"); err != nil {
+			t.Fatal(err)
+		}
+		return &e
+	}
+
+	expectProps := map[string]interface{}{
+		"someext": "some value",
+		"someint": "42",
+	}
+
+	t.Run("whole event", func(t *testing.T) {
+		a := &adapter{}
+
+		event := newEvent()
+
+		msg, err := a.newServiceBusMessage(event)
+		require.NoError(t, err)
+
+		expectBody, err := json.Marshal(event)
+		require.NoError(t, err)
+
+		assert.Equal(t, expectBody, msg.Body)
+		require.NotNil(t, msg.ContentType)
+		assert.Equal(t, cloudevents.ApplicationCloudEventsJSON, *msg.ContentType)
+		assert.Equal(t, expectProps, msg.ApplicationProperties)
+	})
+
+	t.Run("data only", func(t *testing.T) {
+		a := &adapter{discardCEContext: true}
+
+		msg, err := a.newServiceBusMessage(newEvent())
+		require.NoError(t, err)
+
+		assert.Equal(t, []byte("hello"), msg.Body)
+		require.NotNil(t, msg.ContentType)
+		assert.Equal(t, cloudevents.TextPlain, *msg.ContentType)
+		assert.Equal(t, expectProps, msg.ApplicationProperties)
+	})
+}
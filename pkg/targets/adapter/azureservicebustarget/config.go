@@ -28,7 +28,7 @@ func EnvAccessorCtor() pkgadapter.EnvConfigAccessor {
 type envAccessor struct {
 	pkgadapter.EnvConfig
 
-	// Resource ID of the Service Bus entity (Queue or Topic subscription).
+	// Resource ID of the Service Bus entity (Queue or Topic).
 	EntityResourceID string `envconfig:"SERVICEBUS_ENTITY_RESOURCE_ID" required:"true"`
 
 	// WebSocketsEnable.
@@ -52,4 +52,8 @@ type envAccessor struct {
 	_ string `envconfig:"SERVICEBUS_KEY_NAME"`
 	_ string `envconfig:"SERVICEBUS_KEY_VALUE"`
 	_ string `envconfig:"SERVICEBUS_CONNECTION_STRING"`
+	_ string `envconfig:"SERVICEBUS_KEY_NAME_FILE"`
+	_ string `envconfig:"SERVICEBUS_KEY_VALUE_FILE"`
+	_ string `envconfig:"SERVICEBUS_CONNECTION_STRING_FILE"`
+	_ string `envconfig:"AZURE_ENVIRONMENT"`
 }
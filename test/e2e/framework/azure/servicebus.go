@@ -64,9 +64,10 @@ func CreateServiceBusNamespace(ctx context.Context, cli servicebus.NamespacesCli
 	return nil
 }
 
-// CreateClient will create a servicebus client.
-func CreateClient(ctx context.Context, region string, name string, nsCli *servicebus.NamespacesClient) *sv.Client {
-	keys, err := nsCli.ListKeys(ctx, name, name, "RootManageSharedAccessKey")
+// CreateClient will create a servicebus client for the namespace with the given
+// name in the given resource group.
+func CreateClient(ctx context.Context, region, rgName, name string, nsCli *servicebus.NamespacesClient) *sv.Client {
+	keys, err := nsCli.ListKeys(ctx, rgName, name, "RootManageSharedAccessKey")
 	if err != nil {
 		framework.FailfWithOffset(3, "unable to obtain the connection string: %s", err)
 		return nil
@@ -83,9 +84,10 @@ func CreateClient(ctx context.Context, region string, name string, nsCli *servic
 	return client
 }
 
-// CreateAdminClient will create a servicebus admin client.
-func CreateAdminClient(ctx context.Context, region string, name string, nsCli *servicebus.NamespacesClient) *svadmin.Client {
-	keys, err := nsCli.ListKeys(ctx, name, name, "RootManageSharedAccessKey")
+// CreateAdminClient will create a servicebus admin client for the namespace with
+// the given name in the given resource group.
+func CreateAdminClient(ctx context.Context, region, rgName, name string, nsCli *servicebus.NamespacesClient) *svadmin.Client {
+	keys, err := nsCli.ListKeys(ctx, rgName, name, "RootManageSharedAccessKey")
 	if err != nil {
 		framework.FailfWithOffset(3, "unable to obtain the connection string: %s", err)
 		return nil
@@ -101,3 +103,68 @@ func CreateAdminClient(ctx context.Context, region string, name string, nsCli *s
 
 	return client
 }
+
+// CreateQueue creates a Service Bus queue with the given name.
+func CreateQueue(ctx context.Context, adminCli *svadmin.Client, name string) {
+	if _, err := adminCli.CreateQueue(ctx, name, nil); err != nil {
+		framework.FailfWithOffset(1, "Unable to create servicebus queue %q: %s", name, err)
+	}
+}
+
+// DeleteQueue deletes the Service Bus queue with the given name.
+func DeleteQueue(ctx context.Context, adminCli *svadmin.Client, name string) {
+	if _, err := adminCli.DeleteQueue(ctx, name, nil); err != nil {
+		framework.FailfWithOffset(1, "Unable to delete servicebus queue %q: %s", name, err)
+	}
+}
+
+// CreateTopic creates a Service Bus topic with the given name.
+func CreateTopic(ctx context.Context, adminCli *svadmin.Client, name string) {
+	if _, err := adminCli.CreateTopic(ctx, name, nil); err != nil {
+		framework.FailfWithOffset(1, "Unable to create servicebus topic %q: %s", name, err)
+	}
+}
+
+// DeleteTopic deletes the Service Bus topic with the given name, along with
+// all its subscriptions.
+func DeleteTopic(ctx context.Context, adminCli *svadmin.Client, name string) {
+	if _, err := adminCli.DeleteTopic(ctx, name, nil); err != nil {
+		framework.FailfWithOffset(1, "Unable to delete servicebus topic %q: %s", name, err)
+	}
+}
+
+// CreateSubscription creates a subscription with the given name to a Service
+// Bus topic.
+func CreateSubscription(ctx context.Context, adminCli *svadmin.Client, topicName, name string) {
+	if _, err := adminCli.CreateSubscription(ctx, topicName, name, nil); err != nil {
+		framework.FailfWithOffset(1, "Unable to create subscription %q to servicebus topic %q: %s", name, topicName, err)
+	}
+}
+
+// DeleteSubscription deletes the subscription with the given name from a
+// Service Bus topic.
+func DeleteSubscription(ctx context.Context, adminCli *svadmin.Client, topicName, name string) {
+	if _, err := adminCli.DeleteSubscription(ctx, topicName, name, nil); err != nil {
+		framework.FailfWithOffset(1, "Unable to delete subscription %q from servicebus topic %q: %s", name, topicName, err)
+	}
+}
+
+// SendServiceBusMessage sends a message with the given body and application
+// properties to a Service Bus queue or topic.
+func SendServiceBusMessage(ctx context.Context, cli *sv.Client, entityPath string, body []byte, props map[string]interface{}) {
+	sender, err := cli.NewSender(entityPath, nil)
+	if err != nil {
+		framework.FailfWithOffset(1, "Unable to create servicebus sender for %q: %s", entityPath, err)
+		return
+	}
+	defer func() { _ = sender.Close(ctx) }()
+
+	msg := &sv.Message{
+		Body:                  body,
+		ApplicationProperties: props,
+	}
+
+	if err := sender.SendMessage(ctx, msg, nil); err != nil {
+		framework.FailfWithOffset(1, "Unable to send message to servicebus entity %q: %s", entityPath, err)
+	}
+}
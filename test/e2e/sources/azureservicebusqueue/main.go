@@ -144,14 +144,14 @@ var _ = Describe("Azure ServiceBusQueue", func() {
 			nsClient := e2eazure.CreateServiceBusNamespaceClient(ctx, subscriptionID, ns)
 			err := e2eazure.CreateServiceBusNamespace(ctx, *nsClient, *rg.Name, ns, region)
 			Expect(err).ToNot(HaveOccurred())
-			adminClient := e2eazure.CreateAdminClient(ctx, region, ns, nsClient)
+			adminClient := e2eazure.CreateAdminClient(ctx, region, *rg.Name, ns, nsClient)
 
 			By("creating an event sink", func() {
 				sink = bridges.CreateEventDisplaySink(f.KubeClient, ns)
 			})
 
 			By("creating a queue", func() {
-				queueSender = createQueue(ctx, region, ns, e2eazure.CreateClient(ctx, region, ns, nsClient), adminClient)
+				queueSender = createQueue(ctx, region, ns, e2eazure.CreateClient(ctx, region, *rg.Name, ns, nsClient), adminClient)
 			})
 		})
 
@@ -276,10 +276,7 @@ func readReceivedEvents(c clientset.Interface, namespace, eventDisplayName strin
 
 // createQueue will create a servicebus queue and a sender using the given name
 func createQueue(ctx context.Context, region string, name string, client *sv.Client, adminClient *svadmin.Client) *sv.Sender {
-	if _, err := adminClient.CreateQueue(ctx, name, nil); err != nil {
-		framework.FailfWithOffset(2, "Error creating queue: %s", err)
-		return nil
-	}
+	e2eazure.CreateQueue(ctx, adminClient, name)
 
 	sender, err := client.NewSender(name, nil)
 	if err != nil {
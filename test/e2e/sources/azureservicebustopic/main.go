@@ -144,14 +144,14 @@ var _ = Describe("Azure ServiceBusTopic", func() {
 			nsClient := e2eazure.CreateServiceBusNamespaceClient(ctx, subscriptionID, ns)
 			err := e2eazure.CreateServiceBusNamespace(ctx, *nsClient, *rg.Name, ns, region)
 			Expect(err).ToNot(HaveOccurred())
-			adminClient := e2eazure.CreateAdminClient(ctx, region, ns, nsClient)
+			adminClient := e2eazure.CreateAdminClient(ctx, region, *rg.Name, ns, nsClient)
 
 			By("creating an event sink", func() {
 				sink = bridges.CreateEventDisplaySink(f.KubeClient, ns)
 			})
 
 			By("creating a topic", func() {
-				topicSender = createTopic(ctx, ns, e2eazure.CreateClient(ctx, region, ns, nsClient), adminClient)
+				topicSender = createTopic(ctx, ns, e2eazure.CreateClient(ctx, region, *rg.Name, ns, nsClient), adminClient)
 			})
 		})
 
@@ -276,10 +276,7 @@ func readReceivedEvents(c clientset.Interface, namespace, eventDisplayName strin
 
 // createTopic will create a servicebus topic and a sender using the given name
 func createTopic(ctx context.Context, name string, client *sv.Client, adminClient *svadmin.Client) *sv.Sender {
-	if _, err := adminClient.CreateTopic(ctx, name, nil); err != nil {
-		framework.FailfWithOffset(2, "Error creating topic: %s", err)
-		return nil
-	}
+	e2eazure.CreateTopic(ctx, adminClient, name)
 
 	sender, err := client.NewSender(name, nil)
 	if err != nil {